@@ -14,6 +14,7 @@ require (
 	github.com/btcsuite/btcutil v0.0.0-20190316010144-3ac1210f4b38
 	github.com/codeskyblue/go-sh v0.0.0-20190328095946-f4ce45e7999e
 	github.com/ethereum/go-ethereum v1.8.25
+	github.com/gorilla/websocket v1.4.0
 	github.com/graarh/golang-socketio v0.0.0-20170510162725-2c44953b9b5f
 	github.com/imroc/req v0.2.3
 	github.com/pborman/uuid v1.2.0
@@ -21,6 +22,7 @@ require (
 	github.com/prometheus/common v0.6.0
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24
 	github.com/tidwall/gjson v1.2.1
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 )
 
 //replace github.com/blocktree/openwallet => ../../openwallet
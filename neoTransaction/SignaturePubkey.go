@@ -1,6 +1,7 @@
 package neoTransaction
 
 import (
+	"encoding/hex"
 	"errors"
 	"math/big"
 
@@ -36,8 +37,18 @@ func calcSignaturePubkey(txHash, prikey []byte) (*SignaturePubkey, error) {
 		return nil, errors.New("Transaction hash or private key data error!")
 	}
 
-	txHash = owcrypt.Hash(txHash, 0, owcrypt.HASH_ALG_SHA256)
-	sig, err := owcrypt.Signature(prikey, nil, 0, txHash, 32, owcrypt.ECC_CURVE_SECP256R1)
+	return SignDigest(owcrypt.Hash(txHash, 0, owcrypt.HASH_ALG_SHA256), prikey)
+}
+
+// 对摘要签名，交易的摘要为 SHA256(未签名交易)
+// digest : 32字节摘要
+// prikey : 私钥
+func SignDigest(digest, prikey []byte) (*SignaturePubkey, error) {
+	if len(digest) != 32 || len(prikey) != 32 {
+		return nil, errors.New("Digest or private key data error!")
+	}
+
+	sig, err := owcrypt.Signature(prikey, nil, 0, digest, 32, owcrypt.ECC_CURVE_SECP256R1)
 	if err != owcrypt.SUCCESS {
 		return nil, errors.New("Signature failed!")
 	}
@@ -52,6 +63,28 @@ func calcSignaturePubkey(txHash, prikey []byte) (*SignaturePubkey, error) {
 	return &SignaturePubkey{sig, pub}, nil
 }
 
+// 校验摘要签名
+// digest : 32字节摘要
+// pubkey : 压缩公钥
+// signature : 64字节签名
+func VerifyDigest(digest, pubkey, signature []byte) bool {
+	if len(digest) != 32 || len(pubkey) != PublicKeySize || len(signature) != 64 {
+		return false
+	}
+	point := owcrypt.PointDecompress(pubkey, owcrypt.ECC_CURVE_SECP256R1)[1:]
+	return owcrypt.Verify(point, nil, 0, digest, 32, signature, owcrypt.ECC_CURVE_SECP256R1) == owcrypt.SUCCESS
+}
+
+// 获取交易的签名摘要
+// rawTx : 未签名交易的十六进制
+func GetTransactionDigest(rawTx string) ([]byte, error) {
+	txBytes, err := hex.DecodeString(rawTx)
+	if err != nil || len(txBytes) == 0 {
+		return nil, errors.New("Invalid transaction hex data!")
+	}
+	return owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256), nil
+}
+
 func (sp SignaturePubkey) encodeSignatureToScript(sigType byte) []byte {
 	r := sp.Signature[:32]
 	s := sp.Signature[32:]
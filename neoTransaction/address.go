@@ -0,0 +1,86 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
+// 地址解码后的长度：版本号(1) + 脚本哈希(20) + 校验和(4)
+const addressDataLength = 1 + ScriptHashSize + 4
+
+// 脚本哈希长度
+const ScriptHashSize = 20
+
+// 验证脚本类型
+const (
+	VerificationStandard = "standard" // 单签标准脚本 PushBytes33 + 公钥 + CheckSig
+	VerificationMultiSig = "multisig" // 多签脚本
+	VerificationContract = "contract" // 其它验证合约
+)
+
+// 解析地址，校验 base58check 校验和与版本号，返回小端序脚本哈希
+// address : 地址
+// version : 地址版本号，NEO 为 0x17
+func AddressToScriptHash(address string, version byte) ([]byte, error) {
+	data, err := Decode(address, NeocoinAlphabet)
+	if err != nil || len(data) != addressDataLength {
+		return nil, errors.New("Invalid address!")
+	}
+	if !byteArrayCompare(owcrypt.Hash(data[:addressDataLength-4], 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4], data[addressDataLength-4:]) {
+		return nil, errors.New("Invalid address checksum!")
+	}
+	if data[0] != version {
+		return nil, errors.New("Invalid address version!")
+	}
+	return data[1 : 1+ScriptHashSize], nil
+}
+
+// 小端序脚本哈希转地址
+// scriptHash : 小端序脚本哈希
+// version : 地址版本号
+func ScriptHashToAddress(scriptHash []byte, version byte) (string, error) {
+	if len(scriptHash) != ScriptHashSize {
+		return "", errors.New("Invalid script hash length!")
+	}
+	return EncodeCheck([]byte{version}, scriptHash), nil
+}
+
+// 脚本哈希转十六进制
+// bigEndian 为 true 时输出带 0x 前缀的大端序，与 neo-cli 和 NEP-5 合约哈希的显示一致；否则输出小端序，与交易中的字节一致
+func ScriptHashToHex(scriptHash []byte, bigEndian bool) string {
+	if bigEndian {
+		return "0x" + hex.EncodeToString(reverseByteArray(append([]byte{}, scriptHash...)))
+	}
+	return hex.EncodeToString(scriptHash)
+}
+
+// 十六进制转小端序脚本哈希，大端序允许带 0x 前缀
+// hash : 十六进制脚本哈希
+// bigEndian : 输入是否为大端序
+func ScriptHashFromHex(hash string, bigEndian bool) ([]byte, error) {
+	if bigEndian {
+		hash = strings.TrimPrefix(strings.TrimPrefix(hash, "0x"), "0X")
+	}
+	data, err := hex.DecodeString(hash)
+	if err != nil || len(data) != ScriptHashSize {
+		return nil, errors.New("Invalid script hash!")
+	}
+	if bigEndian {
+		data = reverseByteArray(data)
+	}
+	return data, nil
+}
+
+// 获取验证脚本的类型
+func GetVerificationType(script []byte) string {
+	if IsStandardVerification(script) {
+		return VerificationStandard
+	}
+	if IsMultiSigVerification(script) {
+		return VerificationMultiSig
+	}
+	return VerificationContract
+}
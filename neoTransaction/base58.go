@@ -152,7 +152,7 @@ func Decode(input string, alphabet *Alphabet) ([]byte, error) {
 //return prefix + hash + error
 func DecodeCheck(address string) ([]byte, []byte, error) {
 	ret, err := Decode(address, NeocoinAlphabet)
-	if err != nil {
+	if err != nil || len(ret) < 4+0x14 {
 		return nil, nil, errors.New("Invalid address!")
 	}
 	checksum := owcrypt.Hash(ret[:len(ret)-4], 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
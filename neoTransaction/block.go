@@ -0,0 +1,267 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
+// 区块头的哈希长度
+const BlockHashSize = 32
+
+// 区块头
+type BlockHeader struct {
+	Version       uint32
+	PrevHash      string // 上一区块哈希，大端序十六进制，不带0x
+	MerkleRoot    string // 交易默克尔根，大端序十六进制，不带0x
+	Timestamp     uint32
+	Index         uint32
+	ConsensusData uint64 // 共识数据，即区块的 nonce
+	NextConsensus []byte // 下一轮共识节点多签脚本哈希，小端序
+	Script        TxScript
+}
+
+// 区块 = 区块头 + 交易
+type Block struct {
+	BlockHeader
+	Transactions []*Transaction
+}
+
+// 创建区块头的见证人
+// invocation : 调用脚本，共识节点的签名
+// verification : 验证脚本，共识节点的多签脚本
+func NewBlockWitness(invocation, verification []byte) TxScript {
+	return TxScript{invocationScript: invocation, verificationScript: verification}
+}
+
+// 序列化不含见证人的区块头，即区块哈希和签名的数据
+func (h BlockHeader) unsignedBytes() ([]byte, error) {
+	prevHash, err := decodeHash256(h.PrevHash)
+	if err != nil {
+		return nil, errors.New("Invalid block previous hash!")
+	}
+	merkleRoot, err := decodeHash256(h.MerkleRoot)
+	if err != nil {
+		return nil, errors.New("Invalid block merkle root!")
+	}
+	if len(h.NextConsensus) != ScriptHashSize {
+		return nil, errors.New("Invalid block next consensus!")
+	}
+
+	ret := make([]byte, 0)
+	ret = append(ret, uint32ToLittleEndianBytes(h.Version)...)
+	ret = append(ret, prevHash...)
+	ret = append(ret, merkleRoot...)
+	ret = append(ret, uint32ToLittleEndianBytes(h.Timestamp)...)
+	ret = append(ret, uint32ToLittleEndianBytes(h.Index)...)
+	ret = append(ret, uint64ToLittleEndianBytes(h.ConsensusData)...)
+	ret = append(ret, h.NextConsensus...)
+	return ret, nil
+}
+
+// 序列化区块头 = 不含见证人的区块头 + 0x01 + 见证人
+func (h BlockHeader) Encode() ([]byte, error) {
+	ret, err := h.unsignedBytes()
+	if err != nil {
+		return nil, err
+	}
+	script, _ := h.Script.toBytes()
+	ret = append(ret, 0x01)
+	ret = append(ret, script...)
+	return ret, nil
+}
+
+// 计算区块哈希 = 反序(SHA256(SHA256(不含见证人的区块头)))
+func (h BlockHeader) GetHash() (string, error) {
+	data, err := h.unsignedBytes()
+	if err != nil {
+		return "", err
+	}
+	return reverseBytesToHex(owcrypt.Hash(data, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)), nil
+}
+
+// 获取区块头的签名摘要 = SHA256(不含见证人的区块头)
+func (h BlockHeader) GetSignDigest() ([]byte, error) {
+	data, err := h.unsignedBytes()
+	if err != nil {
+		return nil, err
+	}
+	return owcrypt.Hash(data, 0, owcrypt.HASH_ALG_SHA256), nil
+}
+
+// 验证区块见证人
+// 验证脚本的脚本哈希需要等于上一区块的 NextConsensus，调用脚本中的签名按顺序对应多签脚本中的公钥
+// nextConsensus : 上一区块的 NextConsensus，小端序脚本哈希
+func (h BlockHeader) VerifyWitness(nextConsensus []byte) error {
+	if !byteArrayCompare(GetScriptHash(h.Script.verificationScript), nextConsensus) {
+		return errors.New("Block witness does not match the previous block's next consensus!")
+	}
+
+	required, pubkeys, err := ParseMultiSigVerification(h.Script.verificationScript)
+	if err != nil {
+		return errors.New("Block witness is not a multisig verification script!")
+	}
+
+	signatures, err := readScriptPushes(h.Script.invocationScript, true)
+	if err != nil {
+		return err
+	}
+	if len(signatures) != required {
+		return errors.New("Block witness signature count does not match the multisig script!")
+	}
+
+	digest, err := h.GetSignDigest()
+	if err != nil {
+		return err
+	}
+
+	//与 CheckMultiSig 一致，签名和公钥按顺序匹配
+	i, j := 0, 0
+	for i < len(signatures) && j < len(pubkeys) {
+		if VerifyDigest(digest, pubkeys[j], signatures[i]) {
+			i++
+		}
+		j++
+		if len(signatures)-i > len(pubkeys)-j {
+			break
+		}
+	}
+	if i != len(signatures) {
+		return errors.New("Block witness signature verify failed!")
+	}
+	return nil
+}
+
+// 反序列化区块头，返回区块头之后数据的索引
+// data : 区块或区块头的序列化数据
+// index : 区块头在数据中的索引
+func DecodeBlockHeader(data []byte, index int) (*BlockHeader, int, error) {
+	if index+4+BlockHashSize*2+4+4+8+ScriptHashSize+1 > len(data) {
+		return nil, index, errors.New("Invalid block header data length!")
+	}
+
+	var h BlockHeader
+	h.Version = littleEndianBytesToUint32(data[index : index+4])
+	index += 4
+	h.PrevHash = reverseBytesToHex(append([]byte{}, data[index:index+BlockHashSize]...))
+	index += BlockHashSize
+	h.MerkleRoot = reverseBytesToHex(append([]byte{}, data[index:index+BlockHashSize]...))
+	index += BlockHashSize
+	h.Timestamp = littleEndianBytesToUint32(data[index : index+4])
+	index += 4
+	h.Index = littleEndianBytesToUint32(data[index : index+4])
+	index += 4
+	h.ConsensusData = littleEndianBytesToUint64(data[index : index+8])
+	index += 8
+	h.NextConsensus = append([]byte{}, data[index:index+ScriptHashSize]...)
+	index += ScriptHashSize
+
+	if data[index] != 0x01 {
+		return nil, index, errors.New("Invalid block header witness count!")
+	}
+	index++
+
+	invocation, index, err := readVarBytes(data, index)
+	if err != nil {
+		return nil, index, errors.New("Invalid block header invocation script!")
+	}
+	verification, index, err := readVarBytes(data, index)
+	if err != nil {
+		return nil, index, errors.New("Invalid block header verification script!")
+	}
+	h.Script = NewBlockWitness(invocation, verification)
+	return &h, index, nil
+}
+
+// 序列化区块 = 区块头 + 交易数量 + 交易
+func (b Block) Encode() ([]byte, error) {
+	ret, err := b.BlockHeader.Encode()
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, writeVarBytesLength(len(b.Transactions))...)
+	for _, tx := range b.Transactions {
+		txBytes, err := tx.encodeToBytes()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, txBytes...)
+		//区块中的交易总是带见证人数量
+		if tx.Scripts == nil {
+			ret = append(ret, 0x00)
+		}
+	}
+	return ret, nil
+}
+
+// 反序列化区块
+// data : 区块序列化数据
+func DecodeBlock(data []byte) (*Block, error) {
+	header, index, err := DecodeBlockHeader(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	count, index, err := readLength(data, index)
+	if err != nil {
+		return nil, errors.New("Invalid block transaction count!")
+	}
+
+	block := &Block{BlockHeader: *header}
+	for i := uint64(0); i < count; i++ {
+		tx, newIndex, err := DecodeBlockTransaction(data, index)
+		if err != nil {
+			return nil, err
+		}
+		index = newIndex
+		block.Transactions = append(block.Transactions, tx)
+	}
+	if index != len(data) {
+		return nil, errors.New("Invalid block data length!")
+	}
+	return block, nil
+}
+
+// 计算交易默克尔根，与 neo-cli 的 MerkleTree 一致
+// 相邻两个哈希拼接后计算 SHA256(SHA256())，奇数个时最后一个与自身拼接
+// txids : 交易ID，大端序十六进制，允许带0x前缀
+func ComputeMerkleRoot(txids []string) (string, error) {
+	if len(txids) == 0 {
+		return "", errors.New("Merkle root needs at least one transaction!")
+	}
+
+	hashes := make([][]byte, 0, len(txids))
+	for _, txid := range txids {
+		hash, err := decodeHash256(txid)
+		if err != nil {
+			return "", errors.New("Invalid transaction id for merkle root!")
+		}
+		hashes = append(hashes, hash)
+	}
+
+	for len(hashes) > 1 {
+		parents := make([][]byte, 0, (len(hashes)+1)/2)
+		for i := 0; i < len(hashes); i += 2 {
+			right := hashes[i]
+			if i+1 < len(hashes) {
+				right = hashes[i+1]
+			}
+			data := append(append([]byte{}, hashes[i]...), right...)
+			parents = append(parents, owcrypt.Hash(data, 0, owcrypt.HASh_ALG_DOUBLE_SHA256))
+		}
+		hashes = parents
+	}
+
+	return reverseBytesToHex(hashes[0]), nil
+}
+
+// 大端序哈希转为序列化使用的小端序字节
+func decodeHash256(hash string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(hash), "0x"))
+	if err != nil || len(data) != BlockHashSize {
+		return nil, errors.New("Invalid hash256!")
+	}
+	return reverseByteArray(data), nil
+}
@@ -0,0 +1,225 @@
+package neoTransaction
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
+// 构造由 3/4 共识节点签名的测试区块头
+func newTestSignedHeader(t *testing.T) (*BlockHeader, []byte) {
+	prikeys := make(map[string][]byte)
+	pubkeys := make([][]byte, 0)
+	for i := 1; i <= 4; i++ {
+		prikey := bytes.Repeat([]byte{byte(i)}, 32)
+		sp, err := SignDigest(make([]byte, 32), prikey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prikeys[hex.EncodeToString(sp.Pubkey)] = prikey
+		pubkeys = append(pubkeys, sp.Pubkey)
+	}
+	verification, err := BuildMultiSigVerification(3, pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := &BlockHeader{
+		Version:       0,
+		PrevHash:      "0x" + hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32)),
+		MerkleRoot:    hex.EncodeToString(bytes.Repeat([]byte{0xcd}, 32)),
+		Timestamp:     1546300800,
+		Index:         100,
+		ConsensusData: 0x1122334455667788,
+		NextConsensus: GetScriptHash(verification),
+	}
+	digest, err := header.GetSignDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//按多签脚本中的公钥顺序签名，跳过第二个节点
+	_, ordered, _ := ParseMultiSigVerification(verification)
+	sb := NewScriptBuilder()
+	for i, pub := range ordered {
+		if i == 1 {
+			continue
+		}
+		sp, err := SignDigest(digest, prikeys[hex.EncodeToString(pub)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb.EmitPushBytes(sp.Signature)
+	}
+	header.Script = NewBlockWitness(sb.ToBytes(), verification)
+
+	return header, GetScriptHash(verification)
+}
+
+func TestBlockHeader_VerifyWitness(t *testing.T) {
+	header, nextConsensus := newTestSignedHeader(t)
+
+	if err := header.VerifyWitness(nextConsensus); err != nil {
+		t.Fatalf("VerifyWitness failed: %v", err)
+	}
+
+	//共识节点不匹配
+	if err := header.VerifyWitness(make([]byte, ScriptHashSize)); err == nil {
+		t.Fatal("witness with wrong next consensus should fail")
+	}
+
+	//区块头被篡改
+	forged := *header
+	forged.Timestamp++
+	if err := forged.VerifyWitness(nextConsensus); err == nil {
+		t.Fatal("forged header should fail")
+	}
+
+	//签名数量不足
+	pushes, _ := readScriptPushes(header.Script.invocationScript, true)
+	sb := NewScriptBuilder()
+	sb.EmitPushBytes(pushes[0]).EmitPushBytes(pushes[1])
+	forged = *header
+	forged.Script = NewBlockWitness(sb.ToBytes(), header.Script.verificationScript)
+	if err := forged.VerifyWitness(nextConsensus); err == nil {
+		t.Fatal("witness with too few signatures should fail")
+	}
+
+	//签名顺序与公钥顺序不一致
+	sb = NewScriptBuilder()
+	sb.EmitPushBytes(pushes[1]).EmitPushBytes(pushes[0]).EmitPushBytes(pushes[2])
+	forged.Script = NewBlockWitness(sb.ToBytes(), header.Script.verificationScript)
+	if err := forged.VerifyWitness(nextConsensus); err == nil {
+		t.Fatal("witness with unordered signatures should fail")
+	}
+}
+
+func TestDecodeBlockHeader(t *testing.T) {
+	header, _ := newTestSignedHeader(t)
+
+	data, err := header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//区块头消息在见证人之后带一个交易数量 0
+	data = append(data, 0x00)
+
+	decoded, index, err := DecodeBlockHeader(data, 0)
+	if err != nil {
+		t.Fatalf("DecodeBlockHeader failed: %v", err)
+	}
+	if index != len(data)-1 {
+		t.Fatalf("decoded index wrong: %d", index)
+	}
+
+	hash, _ := header.GetHash()
+	decodedHash, _ := decoded.GetHash()
+	if hash != decodedHash || decoded.Index != 100 || decoded.ConsensusData != 0x1122334455667788 ||
+		decoded.PrevHash != hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32)) {
+		t.Fatalf("decoded header wrong: %+v", decoded)
+	}
+	if !bytes.Equal(decoded.Script.invocationScript, header.Script.invocationScript) ||
+		!bytes.Equal(decoded.Script.verificationScript, header.Script.verificationScript) {
+		t.Fatalf("decoded witness wrong: %v", decoded.Script.String())
+	}
+
+	if _, _, err := DecodeBlockHeader(data[:50], 0); err == nil {
+		t.Fatal("short header data should fail")
+	}
+}
+
+func TestComputeMerkleRoot(t *testing.T) {
+	a := hex.EncodeToString(bytes.Repeat([]byte{0x01}, 32))
+	b := hex.EncodeToString(bytes.Repeat([]byte{0x02}, 32))
+	c := hex.EncodeToString(bytes.Repeat([]byte{0x03}, 32))
+
+	hash := func(l, r string) string {
+		left, _ := decodeHash256(l)
+		right, _ := decodeHash256(r)
+		return reverseBytesToHex(owcrypt.Hash(append(left, right...), 0, owcrypt.HASh_ALG_DOUBLE_SHA256))
+	}
+
+	root, err := ComputeMerkleRoot([]string{"0x" + a})
+	if err != nil || root != a {
+		t.Fatalf("single merkle root wrong: %s, %v", root, err)
+	}
+
+	root, _ = ComputeMerkleRoot([]string{a, b})
+	if root != hash(a, b) {
+		t.Fatalf("merkle root of two wrong: %s", root)
+	}
+
+	//奇数个时最后一个与自身拼接
+	root, _ = ComputeMerkleRoot([]string{a, b, c})
+	if root != hash(hash(a, b), hash(c, c)) {
+		t.Fatalf("merkle root of three wrong: %s", root)
+	}
+
+	if _, err := ComputeMerkleRoot(nil); err == nil {
+		t.Fatal("empty merkle root should fail")
+	}
+}
+
+func TestDecodeBlock(t *testing.T) {
+	header, _ := newTestSignedHeader(t)
+
+	//MinerTransaction 只有 nonce
+	miner := []byte{MinerTransaction.hexValue, 0x00, 0x78, 0x56, 0x34, 0x12, 0x00, 0x00, 0x00, 0x00}
+
+	contractHex, err := CreateEmptyRawTransaction(ContractTransaction,
+		[]Vin{{TxID: hex.EncodeToString(bytes.Repeat([]byte{0x11}, 32)), Vout: 1}},
+		[]Vout{{Asset: NeoGasAssetId, Address: "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", Value: 150000000}},
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractBytes, _ := hex.DecodeString(contractHex)
+	contract, err := DecodeRawTransaction(contractBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minerTx, _, err := DecodeBlockTransaction(miner, 0)
+	if err != nil {
+		t.Fatalf("decode miner transaction failed: %v", err)
+	}
+
+	block := Block{BlockHeader: *header, Transactions: []*Transaction{minerTx, contract}}
+	data, err := block.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeBlock(data)
+	if err != nil {
+		t.Fatalf("DecodeBlock failed: %v", err)
+	}
+	if len(decoded.Transactions) != 2 || decoded.Index != header.Index {
+		t.Fatalf("decoded block wrong: %+v", decoded)
+	}
+
+	if decoded.Transactions[0].GetTypeName() != "MinerTransaction" || decoded.Transactions[1].GetTypeName() != "ContractTransaction" {
+		t.Fatalf("transaction type wrong: %s, %s", decoded.Transactions[0].GetTypeName(), decoded.Transactions[1].GetTypeName())
+	}
+
+	txid, _ := decoded.Transactions[1].GetHash()
+	expected, _ := GetTransactionHash(contractHex)
+	if txid != expected {
+		t.Fatalf("transaction hash wrong: %s, expected: %s", txid, expected)
+	}
+
+	tx := decoded.Transactions[1]
+	if tx.Vins[0].GetTxID() != hex.EncodeToString(bytes.Repeat([]byte{0x11}, 32)) || tx.Vins[0].GetVout() != 1 {
+		t.Fatalf("transaction input wrong: %v", tx.Vins[0].String())
+	}
+	scriptHash, _ := AddressToScriptHash("ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", 0x17)
+	if tx.Vouts[0].GetAssetID() != NeoGasAssetId || tx.Vouts[0].GetValue() != 150000000 || !bytes.Equal(tx.Vouts[0].GetScriptHash(), scriptHash) {
+		t.Fatalf("transaction output wrong: %v", tx.Vouts[0].String())
+	}
+
+	if _, err := DecodeBlock(append(data, 0x00)); err == nil {
+		t.Fatal("block with trailing data should fail")
+	}
+}
@@ -0,0 +1,65 @@
+package neoTransaction
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
+// 消息签名数据的前缀和后缀，与 NEO 钱包 dAPI 的 signMessage 一致
+// 签名数据伪装为一个没有输入输出的交易，避免签名被当作真实交易广播
+var (
+	messagePrefix = []byte{0x01, 0x00, 0x01, 0xf0}
+	messageSuffix = []byte{0x00, 0x00}
+)
+
+// 消息盐的随机字节数，十六进制后为32个字符
+const MessageSaltSize = 16
+
+// 生成随机的消息盐
+func GenerateMessageSalt() (string, error) {
+	salt := make([]byte, MessageSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// 构造消息签名数据：前缀 + 变长长度 + (盐 + 消息) + 后缀
+// message : 消息原文
+// salt : 十六进制的盐，为空时不加盐
+func BuildMessageData(message, salt string) []byte {
+	content := []byte(salt + message)
+	data := append([]byte{}, messagePrefix...)
+	data = append(data, writeVarBytesLength(len(content))...)
+	data = append(data, content...)
+	return append(data, messageSuffix...)
+}
+
+// 对消息签名，签名为 SHA256(消息签名数据) 的 secp256r1 签名
+// message : 消息原文
+// salt : 十六进制的盐，为空时不加盐
+// prikey : 私钥
+func SignMessage(message, salt string, prikey []byte) (*SignaturePubkey, error) {
+	if len(prikey) != 32 {
+		return nil, errors.New("Invalid private key!")
+	}
+	return SignDigest(GetMessageDigest(message, salt), prikey)
+}
+
+// 校验消息签名
+// message : 消息原文
+// salt : 签名时使用的盐
+// pubkey : 压缩公钥
+// signature : 64字节签名
+func VerifyMessage(message, salt string, pubkey, signature []byte) bool {
+	return VerifyDigest(GetMessageDigest(message, salt), pubkey, signature)
+}
+
+// 获取消息签名的摘要
+func GetMessageDigest(message, salt string) []byte {
+	return owcrypt.Hash(BuildMessageData(message, salt), 0, owcrypt.HASH_ALG_SHA256)
+}
@@ -0,0 +1,154 @@
+package neoTransaction
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/blocktree/go-owcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// NEP-2 加密私钥的前缀：0x01 0x42 + 标志位 0xe0（压缩公钥，非 EC 乘法）
+var nep2Prefix = []byte{0x01, 0x42, 0xe0}
+
+const nep2KeyLength = 39
+
+// scrypt 参数
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+// NEP-2 标准的 scrypt 参数
+var DefaultScryptParams = ScryptParams{N: 16384, R: 8, P: 8}
+
+// 使用 NEP-2 加密私钥
+// 地址哈希 = SHA256(SHA256(地址))[:4]，作为 scrypt 的盐
+// 私钥两半分别与 scrypt 结果的前32字节异或后，用后32字节作为密钥进行 AES-256-ECB 加密
+// privateKey : 私钥
+// passphrase : 密码，非 ASCII 字符需要调用方先做 NFC 规范化
+// params : scrypt 参数
+func NEP2Encrypt(privateKey []byte, passphrase string, params ScryptParams) (string, error) {
+	if len(privateKey) != 32 {
+		return "", errors.New("Invalid private key!")
+	}
+
+	address, err := privateKeyToAddress(privateKey)
+	if err != nil {
+		return "", err
+	}
+	addressHash := owcrypt.Hash([]byte(address), 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+
+	derived, err := scrypt.Key([]byte(passphrase), addressHash, params.N, params.R, params.P, 64)
+	if err != nil {
+		return "", err
+	}
+
+	xored := make([]byte, 32)
+	for i := range xored {
+		xored[i] = privateKey[i] ^ derived[i]
+	}
+
+	encrypted, err := aesECB(derived[32:], xored, true)
+	if err != nil {
+		return "", err
+	}
+
+	data := append([]byte{}, nep2Prefix...)
+	data = append(data, addressHash...)
+	data = append(data, encrypted...)
+	return encodeBase58Check(data), nil
+}
+
+// 解密 NEP-2 加密私钥，并用地址哈希校验密码是否正确
+// nep2 : 6P 开头的加密私钥
+// passphrase : 密码
+// params : scrypt 参数
+func NEP2Decrypt(nep2 string, passphrase string, params ScryptParams) ([]byte, error) {
+	data, err := decodeBase58Check(nep2)
+	if err != nil || len(data) != nep2KeyLength || !bytes.Equal(data[:3], nep2Prefix) {
+		return nil, errors.New("Invalid NEP-2 key!")
+	}
+
+	addressHash := data[3:7]
+	derived, err := scrypt.Key([]byte(passphrase), addressHash, params.N, params.R, params.P, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := aesECB(derived[32:], data[7:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey := make([]byte, 32)
+	for i := range privateKey {
+		privateKey[i] = decrypted[i] ^ derived[i]
+	}
+
+	address, err := privateKeyToAddress(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(owcrypt.Hash([]byte(address), 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4], addressHash) {
+		return nil, errors.New("Wrong passphrase!")
+	}
+
+	return privateKey, nil
+}
+
+// 私钥对应的单签地址
+func privateKeyToAddress(privateKey []byte) (string, error) {
+	pub, ret := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return "", errors.New("Invalid private key!")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1)
+	verification, err := BuildVerification(hex.EncodeToString(pub))
+	if err != nil {
+		return "", err
+	}
+	return EncodeCheck([]byte{AddressVersion}, GetScriptHash(verification)), nil
+}
+
+// AES-256-ECB 加解密，数据长度必须为16的整数倍
+func aesECB(key, data []byte, encrypt bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("Invalid AES data length!")
+	}
+	ret := make([]byte, len(data))
+	for i := 0; i < len(data); i += aes.BlockSize {
+		if encrypt {
+			block.Encrypt(ret[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		} else {
+			block.Decrypt(ret[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+	}
+	return ret, nil
+}
+
+// Base58Check 编码，不区分前缀
+func encodeBase58Check(data []byte) string {
+	checksum := owcrypt.Hash(data, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+	return Encode(append(append([]byte{}, data...), checksum...), NeocoinAlphabet)
+}
+
+// Base58Check 解码并校验
+func decodeBase58Check(data string) ([]byte, error) {
+	ret, err := Decode(data, NeocoinAlphabet)
+	if err != nil || len(ret) < 4 {
+		return nil, errors.New("Invalid base58 data!")
+	}
+	checksum := owcrypt.Hash(ret[:len(ret)-4], 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+	if !bytes.Equal(checksum, ret[len(ret)-4:]) {
+		return nil, errors.New("Invalid base58 checksum!")
+	}
+	return ret[:len(ret)-4], nil
+}
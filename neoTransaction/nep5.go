@@ -0,0 +1,80 @@
+package neoTransaction
+
+import (
+	"errors"
+	"math/big"
+)
+
+const (
+	NEP5MethodTransfer  = "transfer"
+	NEP5MethodBalanceOf = "balanceOf"
+	NEP5MethodDecimals  = "decimals"
+	NEP5MethodSymbol    = "symbol"
+)
+
+// 通过地址获取脚本哈希（小端序20字节）
+// address : NEO 地址
+func decodeAddressScriptHash(address string) ([]byte, error) {
+	_, hash, err := DecodeCheck(address)
+	if err != nil || len(hash) != 20 {
+		return nil, errors.New("Invalid address!")
+	}
+	return hash, nil
+}
+
+// 通过合约哈希获取 APPCALL 使用的小端序字节
+// contractHash : 合约脚本哈希，大端序十六进制，可带 0x 前缀
+func decodeContractHash(contractHash string) ([]byte, error) {
+	hash, err := reverseHexToBytes(cleanHexPrefix(contractHash))
+	if err != nil || len(hash) != 20 {
+		return nil, errors.New("Invalid contract script hash!")
+	}
+	return reverseByteArray(hash), nil
+}
+
+// 构建 NEP-5 转账调用脚本
+// 参数按 amount, to, from 的顺序压栈后打包，调用 transfer，结果为 false 时脚本异常退出
+// contractHash : 合约脚本哈希，大端序十六进制
+// from : 发送地址
+// to : 接收地址
+// amount : 转账数量，已按合约精度放大
+func BuildNEP5TransferScript(contractHash, from, to string, amount *big.Int) ([]byte, error) {
+	sb := NewScriptBuilder()
+	err := sb.EmitNEP5Transfer(contractHash, from, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	return sb.ToBytes(), nil
+}
+
+// 向脚本追加一笔 NEP-5 转账调用，多笔转账可以写入同一个脚本
+func (sb *ScriptBuilder) EmitNEP5Transfer(contractHash, from, to string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return errors.New("Invalid NEP-5 transfer amount!")
+	}
+	contract, err := decodeContractHash(contractHash)
+	if err != nil {
+		return err
+	}
+	fromHash, err := decodeAddressScriptHash(from)
+	if err != nil {
+		return err
+	}
+	toHash, err := decodeAddressScriptHash(to)
+	if err != nil {
+		return err
+	}
+
+	sb.EmitPushInteger(amount)
+	sb.EmitPushBytes(toHash)
+	sb.EmitPushBytes(fromHash)
+	sb.EmitPushInteger(big.NewInt(3))
+	sb.Emit(OpPack)
+	sb.EmitPushString(NEP5MethodTransfer)
+	_, err = sb.EmitAppCall(contract, false)
+	if err != nil {
+		return err
+	}
+	sb.Emit(OpThrowIfNot)
+	return nil
+}
@@ -1,6 +1,7 @@
 package neoTransaction
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -64,6 +65,183 @@ func CreateEmptyRawTransaction(txType TransactionType, vins []Vin, vouts []Vout,
 	return hex.EncodeToString(txBytes), nil
 }
 
+// 创建未签名的合约调用交易(InvocationTransaction)
+// script : 合约调用脚本
+// gas : 消耗的系统费用，单位为 10^-8 GAS
+// vins : 交易输入，免费交易可为空
+// vouts : 交易输出，免费交易可为空
+// attrs : 交易附加属性，无输入时需要用 AttrScript 声明签名者
+func CreateEmptyInvocationTransaction(script []byte, gas uint64, vins []Vin, vouts []Vout, attrs []Attribute) (string, error) {
+	if len(script) == 0 {
+		return "", errors.New("Invocation script is empty!")
+	}
+
+	emptyTrans, err := newEmptyTransaction(InvocationTransaction, vins, vouts, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	if len(emptyTrans.Vins) == 0 && len(emptyTrans.getAttributeScriptHashes()) == 0 {
+		return "", errors.New("No input or script attribute found, the transaction has no signer!")
+	}
+
+	emptyTrans.ExclusiveData = writeVarBytes(script)
+	if emptyTrans.Version >= 1 {
+		emptyTrans.ExclusiveData = append(emptyTrans.ExclusiveData, uint64ToLittleEndianBytes(gas)...)
+	}
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+// 创建未签名的状态交易(StateTransaction)，用于投票和候选人注册
+// descriptors : 状态描述
+// vins : 交易输入，投票无需输入，注册候选人需要支付系统费
+// vouts : 交易输出
+// attrs : 交易附加属性
+func CreateEmptyStateTransaction(descriptors []StateDescriptor, vins []Vin, vouts []Vout, attrs []Attribute) (string, error) {
+	txDescriptors, err := newTxStateDescriptorForEmptyTrans(descriptors)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans, err := newEmptyTransaction(StateTransaction, vins, vouts, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans.ExclusiveData = writeVarBytesLength(len(txDescriptors))
+	for _, d := range txDescriptors {
+		emptyTrans.ExclusiveData = append(emptyTrans.ExclusiveData, d.toBytes()...)
+	}
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+// 创建未签名的注册资产交易(RegisterTransaction)
+// asset : 注册资产元数据
+// vins : 交易输入，用于支付注册资产的系统费
+// vouts : 交易输出，找零
+// attrs : 交易附加属性
+func CreateEmptyRegisterTransaction(asset Asset, vins []Vin, vouts []Vout, attrs []Attribute) (string, error) {
+	assetBytes, err := asset.toBytes()
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans, err := newEmptyTransaction(RegisterTransaction, vins, vouts, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans.ExclusiveData = assetBytes
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+// 创建未签名的发行资产交易(IssueTransaction)
+// vins : 交易输入，用于支付发行的系统费，可为空
+// vouts : 发行的资产输出
+// attrs : 交易附加属性，无输入时需要用 AttrScript 声明资产管理员
+func CreateEmptyIssueTransaction(vins []Vin, vouts []Vout, attrs []Attribute) (string, error) {
+	if len(vouts) == 0 {
+		return "", errors.New("No address to issue when create an issue transaction!")
+	}
+
+	emptyTrans, err := newEmptyTransaction(IssueTransaction, vins, vouts, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	if len(emptyTrans.Vins) == 0 && len(emptyTrans.getAttributeScriptHashes()) == 0 {
+		return "", errors.New("No input or script attribute found, the transaction has no signer!")
+	}
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+// 创建未签名的提取 GAS 交易(ClaimTransaction)
+// claims : 要提取 GAS 的已花费 NEO 输出，即 getclaimable 返回的 txid 和 n
+// vouts : 提取的 GAS 输出，总额需等于可提取的 GAS
+// attrs : 交易附加属性
+func CreateEmptyClaimTransaction(claims []Vin, vouts []Vout, attrs []Attribute) (string, error) {
+	if len(claims) == 0 {
+		return "", errors.New("No claim found when create a claim transaction!")
+	}
+	if len(vouts) == 0 {
+		return "", errors.New("No address to claim when create a claim transaction!")
+	}
+
+	txClaims, err := newTxInForEmptyTrans(claims)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans, err := newEmptyTransaction(ClaimTransaction, nil, vouts, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans.ExclusiveData = writeVarBytesLength(len(txClaims))
+	for _, c := range txClaims {
+		claimBytes, err := c.toBytes()
+		if err != nil {
+			return "", err
+		}
+		emptyTrans.ExclusiveData = append(emptyTrans.ExclusiveData, claimBytes...)
+	}
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+// 获取交易ID = 反转(SHA256(SHA256(未签名交易)))
+// 注册资产交易的交易ID即为资产ID
+// rawTx : 签名或未签名的交易
+func GetTransactionHash(rawTx string) (string, error) {
+	txBytes, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return "", errors.New("Invalid transaction hex data!")
+	}
+
+	trans, err := DecodeRawTransaction(txBytes)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans := trans.cloneEmpty()
+	emptyTransBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	hash := owcrypt.Hash(emptyTransBytes, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)
+	return reverseBytesToHex(hash), nil
+}
+
 func CreateRawTransactionHashForSig(txHex string) ([]TxHash, error) {
 	txBytes, err := hex.DecodeString(txHex)
 	if err != nil {
@@ -108,12 +286,14 @@ func InsertSignatureIntoEmptyTransaction(rawTx string, txHashes []TxHash) ([]byt
 		return nil, errors.New("No signature data found!")
 	}
 
-	if emptyTrans.Vins == nil || len(emptyTrans.Vins) == 0 {
-		return nil, errors.New("Invalid empty transaction,no input found!")
-	}
+	if emptyTrans.Type == ContractTransaction.hexValue {
+		if emptyTrans.Vins == nil || len(emptyTrans.Vins) == 0 {
+			return nil, errors.New("Invalid empty transaction,no input found!")
+		}
 
-	if emptyTrans.Vouts == nil || len(emptyTrans.Vouts) == 0 {
-		return nil, errors.New("Invalid empty transaction,no output found!")
+		if emptyTrans.Vouts == nil || len(emptyTrans.Vouts) == 0 {
+			return nil, errors.New("Invalid empty transaction,no output found!")
+		}
 	}
 
 	if emptyTrans.Scripts == nil {
@@ -121,7 +301,15 @@ func InsertSignatureIntoEmptyTransaction(rawTx string, txHashes []TxHash) ([]byt
 	}
 
 	for _, txHash := range txHashes {
-		script, err := createTxScript(txHash.Normal.SigPub.Pubkey, txHash.Normal.SigPub.Signature)
+		var (
+			script *TxScript
+			err    error
+		)
+		if txHash.IsContract() {
+			script, err = NewContractTxScript(txHash.Contract.Verification, txHash.Contract.Parameters)
+		} else {
+			script, err = createTxScript(txHash.Normal.SigPub.Pubkey, txHash.Normal.SigPub.Signature)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -129,6 +317,14 @@ func InsertSignatureIntoEmptyTransaction(rawTx string, txHashes []TxHash) ([]byt
 		emptyTrans.Scripts = append(emptyTrans.Scripts, *script)
 	}
 
+	// 附加信息和状态描述中声明的签名者必须有见证人
+	err = emptyTrans.checkDeclaredWitnesses()
+	if err != nil {
+		return nil, err
+	}
+
+	sortTxScripts(emptyTrans.Scripts)
+
 	fmt.Println("============================>>", emptyTrans.String())
 
 	ret, err := emptyTrans.encodeToBytes()
@@ -142,6 +338,13 @@ func InsertSignatureIntoEmptyTransaction(rawTx string, txHashes []TxHash) ([]byt
 // 验证交易签名
 // signedRawTx : 添加签名信息的原始交易
 func VerifyRawTransaction(signedRawTx string) bool {
+	return VerifyRawTransactionWithContracts(signedRawTx, nil)
+}
+
+// 验证交易签名，合约见证人按对应合约的参数类型列表验证签名参数
+// signedRawTx : 添加签名信息的原始交易
+// contracts : 合约地址的见证数据，按验证脚本匹配见证人，未提供的合约按验证脚本中的签名操作码验证
+func VerifyRawTransactionWithContracts(signedRawTx string, contracts []ContractTx) bool {
 	txBytes, err := hex.DecodeString(signedRawTx)
 	if err != nil {
 		return false
@@ -152,14 +355,29 @@ func VerifyRawTransaction(signedRawTx string) bool {
 		return false
 	}
 
+	if signedTrans.checkDeclaredWitnesses() != nil {
+		return false
+	}
+
 	txHash, err := signedTrans.getHashesForSig()
 	if err != nil {
 		return false
 	}
 
-	for _, t := range txHash {
+	for i, t := range txHash {
 		th, _ := hex.DecodeString(t.Hash)
-		if t.NRequired == 0 {
+		if t.IsContract() {
+			var paramTypes []ContractParameterType
+			for _, c := range contracts {
+				if bytes.Equal(c.Verification, t.Contract.Verification) {
+					paramTypes = c.ParameterTypes()
+					break
+				}
+			}
+			if !signedTrans.Scripts[i].verifyContractSignatures(th, paramTypes) {
+				return false
+			}
+		} else if t.NRequired == 0 {
 			pubkey := owcrypt.PointDecompress(t.Normal.SigPub.Pubkey, owcrypt.ECC_CURVE_SECP256R1)[1:]
 			if owcrypt.Verify(pubkey, nil, 0, th, 32, t.Normal.SigPub.Signature, owcrypt.ECC_CURVE_SECP256R1) != owcrypt.SUCCESS {
 				return false
@@ -2,8 +2,11 @@ package neoTransaction
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -69,7 +72,7 @@ func Test_case1(t *testing.T) {
 		}
 
 		txHash := owcrypt.Hash(emptyTransBytes, 0, owcrypt.HASH_ALG_SHA256)
-		txHashs = append(txHashs, TxHash{hex.EncodeToString(txHash), 0, &NormalTx{"", 0, *sigPub}, nil})
+		txHashs = append(txHashs, TxHash{hex.EncodeToString(txHash), 0, &NormalTx{"", 0, *sigPub}, nil, nil})
 	}
 
 	// 签名结果返回给服务器
@@ -1670,3 +1673,644 @@ func TestVerifyRawTransaction(t *testing.T) {
 	}
 	t.Log("Verify raw transaction success!")
 }
+
+// 测试脚本哈希与交易输入ID：脚本哈希与交易找零输出的脚本哈希一致，重复读取交易输入ID不改变交易
+func TestGetScriptHashAndTxInID(t *testing.T) {
+	verification, _ := hex.DecodeString("21036943c02168ce22fb2e48a3f92dd72336d295e793a52633beba22ac46916dc201ac")
+	if hex.EncodeToString(GetScriptHash(verification)) != "accc9eba9934271301effd425f88d4d0e1d1ac6e" {
+		t.Error("script hash wrong!")
+	}
+
+	txBytes, _ := hex.DecodeString("80000001e68886c12efbb0b3afe14367eb23910e62b6d17e1582ede73fc53945bcafc8100100029b7cffdaa674beae0f930ebe6085af9093e5fe56b34a5c220ccdcf6efc336fc500e1f505000000004a43e85f3e0137a23998cdc6dbacfac0268bf0389b7cffdaa674beae0f930ebe6085af9093e5fe56b34a5c220ccdcf6efc336fc50073e581df862300accc9eba9934271301effd425f88d4d0e1d1ac6e0141409d4a90a60013929bd69b045371f6d7d5b68ba6fcbd9b70b1ba04e7d75cb43d6eb1645718033c032a6a659bf4873ed717227ae7277897fae98f66614064553bbf2321036943c02168ce22fb2e48a3f92dd72336d295e793a52633beba22ac46916dc201ac")
+	trx, err := DecodeRawTransaction(txBytes)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	txid := trx.Vins[0].GetTxID()
+	if txid != "10c8afbc4539c53fe7ed82157ed1b6620e9123eb6743e1afb3b0fb2ec18688e6" || trx.Vins[0].GetTxID() != txid {
+		t.Error("vin txid wrong!")
+	}
+}
+
+// 测试无输入的 NEP-5 免费转账：签名者由 Script 附加信息声明
+func TestFreeNEP5InvocationTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	from := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+	_, fromHash, _ := DecodeCheck(from)
+
+	script, err := BuildNEP5TransferScript("ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", from, "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC", big.NewInt(1))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	attrs := []Attribute{
+		{AttrScript, hex.EncodeToString(fromHash)},
+		{AttrRemark, "0102030405060708"},
+	}
+
+	emptyTrans, err := CreateEmptyInvocationTransaction(script, 0, nil, nil, attrs)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("空交易单：", emptyTrans)
+
+	sigPub, err := SignRawTransaction(emptyTrans, privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	signedTrans, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *sigPub}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("合并之后的交易单：", hex.EncodeToString(signedTrans))
+
+	if !VerifyRawTransaction(hex.EncodeToString(signedTrans)) {
+		t.Error("验证失败!")
+	}
+
+	// 签名者与 Script 附加信息不一致时不能合并
+	otherKey, _ := hex.DecodeString("7bd61eb925f715e9520987700c44bb9641ef8c1759984f7c21e5d584a8b81c30")
+	otherSig, _ := SignRawTransaction(emptyTrans, otherKey)
+	_, err = InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *otherSig}}})
+	if err == nil {
+		t.Error("attribute signer without witness should be rejected")
+	}
+
+	// 无输入也无 Script 附加信息时没有签名者
+	_, err = CreateEmptyInvocationTransaction(script, 0, nil, nil, []Attribute{{AttrRemark, "01"}})
+	if err == nil {
+		t.Error("invocation transaction without signer should be rejected")
+	}
+}
+
+// 测试投票状态交易
+func TestVoteStateTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+	candidates := []string{
+		"024c7b7fb6c310fccf1ba33b082519d82964ea93868d676662d4a59ad548df0e7d",
+		"02aaec38470f6aad0042c6e877cfd8087d2676b0f516fddd362801b9bd3936399e",
+	}
+
+	descriptor, err := NewVoteStateDescriptor(address, candidates)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println(descriptor.String())
+
+	emptyTrans, err := CreateEmptyStateTransaction([]StateDescriptor{*descriptor}, nil, nil, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("空交易单：", emptyTrans)
+
+	// type + version + descriptor count + Account
+	if emptyTrans[:8] != "90000140" {
+		t.Errorf("Invalid state transaction header : %s", emptyTrans[:8])
+	}
+
+	sigPub, err := SignRawTransaction(emptyTrans, privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	signedTrans, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *sigPub}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("合并之后的交易单：", hex.EncodeToString(signedTrans))
+
+	if !VerifyRawTransaction(hex.EncodeToString(signedTrans)) {
+		t.Error("验证失败!")
+	}
+
+	// 投票账户以外的签名不能合并
+	otherKey, _ := hex.DecodeString("7bd61eb925f715e9520987700c44bb9641ef8c1759984f7c21e5d584a8b81c30")
+	otherSig, _ := SignRawTransaction(emptyTrans, otherKey)
+	_, err = InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *otherSig}}})
+	if err == nil {
+		t.Error("vote without account witness should be rejected")
+	}
+}
+
+// 测试候选人注册状态描述
+func TestValidatorStateDescriptor(t *testing.T) {
+	_, err := NewValidatorStateDescriptor("024c7b7fb6c310fccf1ba33b082519d82964ea93868d676662d4a59ad548df0e7d", true)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	_, err = NewValidatorStateDescriptor("04c7b7fb6c310fccf1ba33b082519d82964ea93868d676662d4a59ad548df0e7d", true)
+	if err == nil {
+		t.Error("invalid validator public key should be rejected")
+	}
+}
+
+// 测试交易ID：创世区块中 NEO 和 GAS 的注册资产交易ID即为资产ID
+func TestGetTransactionHash_GenesisAssets(t *testing.T) {
+	build := func(assetType byte, name string, precision byte, admin byte) string {
+		tx := []byte{RegisterTransaction.hexValue, 0x00, assetType}
+		tx = append(tx, writeVarBytes([]byte(name))...)
+		tx = append(tx, uint64ToLittleEndianBytes(uint64(100000000*100000000))...)
+		tx = append(tx, precision, 0x00)
+		tx = append(tx, GetScriptHash([]byte{admin})...)
+		tx = append(tx, 0x00, 0x00, 0x00)
+		return hex.EncodeToString(tx)
+	}
+
+	neo, err := GetTransactionHash(build(AssetGoverningToken.value, `[{"lang":"zh-CN","name":"小蚁股"},{"lang":"en","name":"AntShare"}]`, 0, OpPushT))
+	if err != nil || neo != NeoAssetId {
+		t.Errorf("NEO asset id : want %s, got %s, err : %v", NeoAssetId, neo, err)
+	}
+
+	gas, err := GetTransactionHash(build(AssetUtilityToken.value, `[{"lang":"zh-CN","name":"小蚁币"},{"lang":"en","name":"AntCoin"}]`, 8, OpPushF))
+	if err != nil || gas != NeoGasAssetId {
+		t.Errorf("GAS asset id : want %s, got %s, err : %v", NeoGasAssetId, gas, err)
+	}
+}
+
+// 测试注册资产并发行
+func TestRegisterAndIssueTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	admin := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+	_, adminHash, _ := DecodeCheck(admin)
+
+	sigPub, err := SignRawTransaction("00", privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	asset := Asset{
+		Type:      AssetToken,
+		Name:      `[{"lang":"en","name":"TestCoin"}]`,
+		Amount:    1000000 * 100000000,
+		Precision: 2,
+		Owner:     hex.EncodeToString(sigPub.Pubkey),
+		Admin:     admin,
+	}
+
+	gasIn := Vin{"eee7e5f815a54b070980c75b3bd0aaf34d197af7566704156faddaaf55d9543b", 0}
+	registerTrans, err := CreateEmptyRegisterTransaction(asset, []Vin{gasIn}, []Vout{{NeoGasAssetId, admin, 100000000}}, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("注册资产空交易单：", registerTrans)
+
+	assetID, err := GetTransactionHash(registerTrans)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("资产ID：", assetID)
+
+	registerSig, _ := SignRawTransaction(registerTrans, privKey)
+	signedRegister, err := InsertSignatureIntoEmptyTransaction(registerTrans, []TxHash{{Normal: &NormalTx{SigPub: *registerSig}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signedRegister)) {
+		t.Error("注册资产交易验证失败!")
+	}
+
+	// 签名后交易ID不变
+	signedID, _ := GetTransactionHash(hex.EncodeToString(signedRegister))
+	if signedID != assetID {
+		t.Errorf("transaction hash changed after signing : %s, %s", assetID, signedID)
+	}
+
+	// 精度为 2 时总量必须是 10^6 的整数倍
+	invalid := asset
+	invalid.Amount = 123
+	_, err = CreateEmptyRegisterTransaction(invalid, []Vin{gasIn}, nil, nil)
+	if err == nil {
+		t.Error("asset amount not matching precision should be rejected")
+	}
+
+	issueTrans, err := CreateEmptyIssueTransaction(nil, []Vout{{assetID, "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC", 500 * 100000000}}, []Attribute{
+		{AttrScript, hex.EncodeToString(adminHash)},
+		{AttrRemark, "01"},
+	})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("发行资产空交易单：", issueTrans)
+	if issueTrans[:4] != "0100" {
+		t.Error("发行资产交易类型错误!")
+	}
+
+	issueSig, _ := SignRawTransaction(issueTrans, privKey)
+	signedIssue, err := InsertSignatureIntoEmptyTransaction(issueTrans, []TxHash{{Normal: &NormalTx{SigPub: *issueSig}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signedIssue)) {
+		t.Error("发行资产交易验证失败!")
+	}
+}
+
+func TestContractDeployInvocationTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	owner := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+	_, ownerHash, _ := DecodeCheck(owner)
+
+	sigPub, err := SignRawTransaction("00", privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 部署单签验证合约，合约哈希与地址的脚本哈希一致
+	avm := append([]byte{0x21}, sigPub.Pubkey...)
+	avm = append(avm, 0xac)
+
+	contract := ContractDeployment{
+		Script:        avm,
+		ParameterList: []ContractParameterType{ParamSignature},
+		ReturnType:    ParamBoolean,
+		NeedStorage:   true,
+		Name:          "custody",
+		Version:       "1.0",
+		Author:        "openwallet",
+		Email:         "dev@openwallet.cn",
+		Description:   "verification contract",
+	}
+
+	if contract.GetScriptHash() != "0x"+hex.EncodeToString(reverseBytes(append([]byte{}, ownerHash...))) {
+		t.Errorf("contract script hash wrong : %s", contract.GetScriptHash())
+	}
+
+	if contract.GetDeployFee() != 490*100000000 {
+		t.Errorf("deploy fee wrong : %d", contract.GetDeployFee())
+	}
+	contract.NeedStorage = false
+	contract.DynamicInvoke = true
+	if contract.GetDeployFee() != 590*100000000 {
+		t.Errorf("deploy fee wrong : %d", contract.GetDeployFee())
+	}
+
+	script, err := BuildContractCreateScript(contract)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("部署合约脚本：", hex.EncodeToString(script))
+
+	// 参数类型列表 0x00，返回值 Boolean(PUSH1)，属性 DynamicInvoke(PUSH2)，最后压入合约脚本并调用 Neo.Contract.Create
+	expectTail := "52" + "51" + "0100" + "23" + hex.EncodeToString(avm) + "68134e656f2e436f6e74726163742e437265617465"
+	scriptHex := hex.EncodeToString(script)
+	if len(scriptHex) < len(expectTail) || scriptHex[len(scriptHex)-len(expectTail):] != expectTail {
+		t.Errorf("contract create script wrong : %s", scriptHex)
+	}
+
+	gasIn := Vin{"eee7e5f815a54b070980c75b3bd0aaf34d197af7566704156faddaaf55d9543b", 0}
+	emptyTrans, err := CreateEmptyInvocationTransaction(script, contract.GetDeployFee(), []Vin{gasIn}, []Vout{{NeoGasAssetId, owner, 100000000}}, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	sig, _ := SignRawTransaction(emptyTrans, privKey)
+	signed, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *sig}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signed)) {
+		t.Error("部署合约交易验证失败!")
+	}
+
+	_, err = GetContractParameterType("ByteArray")
+	if err != nil {
+		t.Error(err.Error())
+	}
+	pt, err := GetContractParameterType("07")
+	if err != nil || *pt != ParamString {
+		t.Error("parameter type by hex wrong")
+	}
+}
+
+func TestContractWitnessTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+
+	sigPub, err := SignRawTransaction("00", privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 自定义验证合约：栈顶为整数 5 且签名有效
+	// PUSH5 NUMEQUALVERIFY(0x9d) PUSHBYTES33 <pubkey> CHECKSIG
+	verification := []byte{0x55, 0x9d, 0x21}
+	verification = append(verification, sigPub.Pubkey...)
+	verification = append(verification, OpCheckSig)
+	if IsStandardVerification(verification) {
+		t.Error("custom verification should not be standard")
+	}
+
+	contractAddress := EncodeCheck([]byte{0x17}, GetScriptHash(verification))
+	fmt.Println("合约地址：", contractAddress)
+
+	in := Vin{"eee7e5f815a54b070980c75b3bd0aaf34d197af7566704156faddaaf55d9543b", 0}
+	out := Vout{NeoAssetId, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", 1}
+
+	emptyTrans, err := CreateEmptyRawTransaction(ContractTransaction, []Vin{in}, []Vout{out}, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	sig, _ := SignRawTransaction(emptyTrans, privKey)
+
+	// 签名参数在前，整数参数在后，调用脚本倒序压栈
+	params := []ContractParameter{
+		NewIntegerParameter(big.NewInt(5)),
+		NewSignatureParameter(sig.Signature),
+	}
+	invocation, err := BuildInvocationByParameters(params)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(invocation) != "40"+hex.EncodeToString(sig.Signature)+"55" {
+		t.Errorf("invocation script wrong : %x", invocation)
+	}
+
+	signed, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Contract: &ContractTx{Verification: verification, Parameters: params}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signed)) {
+		t.Error("合约见证人交易验证失败!")
+	}
+
+	// 错误的签名不能通过验证
+	badSig := append([]byte{}, sig.Signature...)
+	badSig[10] ^= 0xff
+	bad, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Contract: &ContractTx{Verification: verification, Parameters: []ContractParameter{NewIntegerParameter(big.NewInt(5)), NewSignatureParameter(badSig)}}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if VerifyRawTransaction(hex.EncodeToString(bad)) {
+		t.Error("wrong signature should not pass")
+	}
+
+	// 参数 JSON 序列化
+	data, _ := json.Marshal([]ContractParameter{NewBooleanParameter(true), NewByteArrayParameter([]byte{0xab, 0xcd})})
+	if string(data) != `[{"type":"Boolean","value":"true"},{"type":"ByteArray","value":"abcd"}]` {
+		t.Errorf("contract parameter json wrong : %s", data)
+	}
+	var decoded []ContractParameter
+	err = json.Unmarshal(data, &decoded)
+	if err != nil || decoded[0].Type != ParamBoolean || decoded[1].Type != ParamByteArray {
+		t.Errorf("contract parameter json decode wrong : %v", decoded)
+	}
+	invocation, _ = BuildInvocationByParameters(decoded)
+	if hex.EncodeToString(invocation) != "02abcd51" {
+		t.Errorf("invocation script wrong : %x", invocation)
+	}
+}
+
+func TestContractWitnessSignatureSlots(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	sigPub, _ := SignRawTransaction("00", privKey)
+
+	in := Vin{"eee7e5f815a54b070980c75b3bd0aaf34d197af7566704156faddaaf55d9543b", 0}
+	out := Vout{NeoAssetId, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", 1}
+	emptyTrans, err := CreateEmptyRawTransaction(ContractTransaction, []Vin{in}, []Vout{out}, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	sig, _ := SignRawTransaction(emptyTrans, privKey)
+
+	// 哈希锁合约：SHA256(0xa8) PUSHBYTES32 <hash> EQUAL(0x87)，不需要签名
+	preimage := []byte("neo hash lock")
+	hashLock := append([]byte{0xa8, 0x20}, owcrypt.Hash(preimage, 0, owcrypt.HASH_ALG_SHA256)...)
+	hashLock = append(hashLock, 0x87)
+	lockTx := ContractTx{Verification: hashLock, Parameters: []ContractParameter{NewByteArrayParameter(preimage)}}
+	signed, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Contract: &lockTx}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signed)) || !VerifyRawTransactionWithContracts(hex.EncodeToString(signed), []ContractTx{lockTx}) {
+		t.Error("contract without signature parameters should pass")
+	}
+
+	// DROP(0x75) PUSHBYTES33 <pubkey> CHECKSIG：第一个参数为64字节数据，第二个参数为签名
+	verification := append([]byte{0x75, 0x21}, sigPub.Pubkey...)
+	verification = append(verification, OpCheckSig)
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	contractTx := ContractTx{Verification: verification, Parameters: []ContractParameter{NewByteArrayParameter(data), NewSignatureParameter(sig.Signature)}}
+	signed, err = InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Contract: &contractTx}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyRawTransactionWithContracts(hex.EncodeToString(signed), []ContractTx{contractTx}) {
+		t.Error("64 bytes byte array parameter should not be verified as signature")
+	}
+	if !VerifyRawTransaction(hex.EncodeToString(signed)) {
+		t.Error("witness with the signature required by CHECKSIG should pass")
+	}
+
+	// 参数类型列表中的签名位置必须是有效签名
+	swapped := ContractTx{Verification: verification, Parameters: []ContractParameter{NewSignatureParameter(data), NewByteArrayParameter(sig.Signature)}}
+	if VerifyRawTransactionWithContracts(hex.EncodeToString(signed), []ContractTx{swapped}) {
+		t.Error("signature slot holding invalid signature should fail")
+	}
+
+	// 缺少 CHECKSIG 需要的签名
+	missing := ContractTx{Verification: verification, Parameters: []ContractParameter{NewByteArrayParameter(data), NewByteArrayParameter(data)}}
+	signed, _ = InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Contract: &missing}})
+	if VerifyRawTransaction(hex.EncodeToString(signed)) {
+		t.Error("witness without required signature should fail")
+	}
+}
+
+func TestNEP2(t *testing.T) {
+	// NEP-2 标准测试向量
+	privKey, _ := hex.DecodeString("cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5")
+	passphrase := "TestingOneTwoThree"
+	expect := "6PYVPVe1fQznphjbUxXP9KZJqPMVnVwCx5s5pr5axRJ8uHkMtZg97eT5kL"
+
+	address, err := privateKeyToAddress(privKey)
+	if err != nil || address != "AStZHy8E6StCqYQbzMqi4poH7YNDHQKxvt" {
+		t.Errorf("address wrong : %s", address)
+	}
+
+	nep2, err := NEP2Encrypt(privKey, passphrase, DefaultScryptParams)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if nep2 != expect {
+		t.Errorf("nep2 encrypt wrong : %s", nep2)
+	}
+
+	decrypted, err := NEP2Decrypt(expect, passphrase, DefaultScryptParams)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(decrypted) != hex.EncodeToString(privKey) {
+		t.Errorf("nep2 decrypt wrong : %x", decrypted)
+	}
+
+	_, err = NEP2Decrypt(expect, "wrong", DefaultScryptParams)
+	if err == nil {
+		t.Error("wrong passphrase should fail")
+	}
+
+	// 自定义 scrypt 参数
+	light := ScryptParams{N: 256, R: 1, P: 1}
+	nep2, _ = NEP2Encrypt(privKey, passphrase, light)
+	decrypted, err = NEP2Decrypt(nep2, passphrase, light)
+	if err != nil || hex.EncodeToString(decrypted) != hex.EncodeToString(privKey) {
+		t.Errorf("nep2 with custom scrypt params failed : %v", err)
+	}
+}
+
+func TestMultiSigVerification(t *testing.T) {
+	// 主网创世区块的备用共识节点，NextConsensus 为 5/7 多签地址
+	validators := []string{
+		"03b209fd4f53a7170ea4444e0cb0a6bb6a53c2bd016926989cf85f9b0fba17a70c",
+		"02df48f60e8f3e01c48ff40b9b7f1310d7a8b2a193188befe1c2e3df740e895093",
+		"03b8d9d5771d8f513aa0869b9cc8d50986403b78c6da36890638c3d46a5adce04a",
+		"02ca0e27697b9c248f6f16e085fd0061e26f44da85b58ee835c110caa5ec3ba554",
+		"024c7b7fb6c310fccf1ba33b082519d82964ea93868d676662d4a59ad548df0e7d",
+		"02aaec38470f6aad0042c6e877cfd8087d2676b0f516fddd362801b9bd3936399e",
+		"02486fd15702c4490a26703112a5cc1d0923fd697a33406bd5a1c00e0013b09a70",
+	}
+	pubkeys := make([][]byte, 0)
+	for _, v := range validators {
+		pub, _ := hex.DecodeString(v)
+		pubkeys = append(pubkeys, pub)
+	}
+
+	verification, err := BuildMultiSigVerification(5, pubkeys)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	address := EncodeCheck([]byte{AddressVersion}, GetScriptHash(verification))
+	if address != "APyEx5f4Zm4oCHwFWiSTaph1fPBxZacYVR" {
+		t.Errorf("multisig address wrong : %s", address)
+	}
+
+	required, parsed, err := ParseMultiSigVerification(verification)
+	if err != nil || required != 5 || len(parsed) != len(validators) {
+		t.Errorf("parse multisig verification failed : %v", err)
+		return
+	}
+	for i := 1; i < len(parsed); i++ {
+		if comparePublicKey(parsed[i-1], parsed[i]) >= 0 {
+			t.Errorf("public keys not sorted : %x", parsed)
+		}
+	}
+
+	if IsMultiSigVerification(verification[:len(verification)-1]) {
+		t.Error("truncated script should not be multisig")
+	}
+	if _, err := BuildMultiSigVerification(8, pubkeys); err == nil {
+		t.Error("required greater than public keys should fail")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	data := BuildMessageData("Hello", "")
+	if hex.EncodeToString(data) != "010001f00548656c6c6f0000" {
+		t.Errorf("message data wrong : %x", data)
+	}
+
+	salt, err := GenerateMessageSalt()
+	if err != nil || len(salt) != MessageSaltSize*2 {
+		t.Errorf("generate salt failed : %v", err)
+		return
+	}
+	data = BuildMessageData("Hello", salt)
+	if hex.EncodeToString(data[4:5]) != "25" || string(data[5:5+len(salt)]) != salt {
+		t.Errorf("salted message data wrong : %x", data)
+	}
+
+	prikey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	sigPub, err := SignMessage("Hello", salt, prikey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !VerifyMessage("Hello", salt, sigPub.Pubkey, sigPub.Signature) {
+		t.Error("verify message failed")
+	}
+	if VerifyMessage("Hello!", salt, sigPub.Pubkey, sigPub.Signature) || VerifyMessage("Hello", "", sigPub.Pubkey, sigPub.Signature) {
+		t.Error("tampered message should not be verified")
+	}
+}
+
+// 测试提取 GAS 交易
+func TestClaimTransaction(t *testing.T) {
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	claims := []Vin{
+		{"bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", 1},
+	}
+	vouts := []Vout{
+		{NeoGasAssetId, address, 100000000},
+	}
+
+	emptyTrans, err := CreateEmptyClaimTransaction(claims, vouts, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("空交易单：", emptyTrans)
+
+	// 类型 0x02，版本 0，1个提取项，无附加属性，无输入
+	expectPrefix := "020001" + "e4b75b99c4c54a2f9197ea7cafe931b2608627a3ff4eaf1a22a48de5594045bd" + "0100" + "00" + "00"
+	if !strings.HasPrefix(emptyTrans, expectPrefix) {
+		t.Errorf("unexpected claim transaction: %s", emptyTrans)
+		return
+	}
+
+	sigPub, err := SignRawTransaction(emptyTrans, privKey)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	signedTrans, err := InsertSignatureIntoEmptyTransaction(emptyTrans, []TxHash{{Normal: &NormalTx{SigPub: *sigPub}}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fmt.Println("合并之后的交易单：", hex.EncodeToString(signedTrans))
+
+	if !VerifyRawTransaction(hex.EncodeToString(signedTrans)) {
+		t.Error("验证失败!")
+	}
+
+	_, err = CreateEmptyClaimTransaction(nil, vouts, nil)
+	if err == nil {
+		t.Error("claim transaction without claims should be rejected")
+	}
+}
@@ -41,8 +41,14 @@ func newTxAttributeForEmptyTrans(attrs []Attribute) ([]TxAttribute, error) {
 		}
 		txAttr := TxAttribute{usage: attr.Attr.value}
 		if attr.Attr.fixedDataLength != 0 {
-			data = fixedDataLen(data, int(attr.Attr.fixedDataLength))
-			txAttr.length = uint16ToLittleEndianBytes(uint16(len(data)))
+			if len(data) != int(attr.Attr.fixedDataLength) {
+				return nil, errors.New(fmt.Sprintf("Invalid %s attribute data length : %d", attr.Attr.jsonString, len(data)))
+			}
+		} else {
+			if attr.Attr.maxDataLength != 0 && len(data) > int(attr.Attr.maxDataLength) {
+				return nil, errors.New(fmt.Sprintf("%s attribute data is too long : %d", attr.Attr.jsonString, len(data)))
+			}
+			txAttr.length, _ = writeLength(int64(len(data)))
 		}
 		txAttr.data = data
 		ret = append(ret, txAttr)
@@ -55,32 +61,34 @@ func newTxAttributeForEmptyTrans(attrs []Attribute) ([]TxAttribute, error) {
 // index : 对应在序列化数组中的索引
 func decodeTxAttributeFromRawTrans(txByte []byte, index int) ([]TxAttribute, int, error) {
 	var txAttrs = make([]TxAttribute, 0)
-	var attrCount = txByte[index]
-	index++
+	attrCount, index, err := readLength(txByte, index)
+	if err != nil {
+		return nil, index, errors.New("Invalid transaction attribute count")
+	}
 	if attrCount == 0 {
 		return txAttrs, index, nil
 	}
 
-	for i := byte(0); i < attrCount; i++ {
+	for i := uint64(0); i < attrCount; i++ {
 		var txAttr = TxAttribute{}
-		if index > len(txByte) {
+		if index+1 > len(txByte) {
 			return nil, index, errors.New("Invalid transaction vout attribute length")
 		}
 		txAttr.usage = txByte[index]
 		index++
 		attrType := getAttributeTypeByUsage(txAttr.usage)
+		if attrType == nil {
+			return nil, index, errors.New(fmt.Sprintf("Unknown attribute usage : %x", txAttr.usage))
+		}
 		if attrType.fixedDataLength == 0 {
-			if index+2 > len(txByte) {
-				return nil, index, errors.New("Invalid transaction vout attribute length")
-			}
-			txAttr.length = txByte[index : index+2]
-			index += 2
-			dataLen := int(littleEndianBytesToUint16(txAttr.length))
-			if index+dataLen > len(txByte) {
+			start := index
+			data, newIndex, err := readVarBytes(txByte, index)
+			if err != nil {
 				return nil, index, errors.New("Invalid transaction vout attribute length")
 			}
-			txAttr.data = txByte[index : index+dataLen]
-			index += dataLen
+			txAttr.length = txByte[start : newIndex-len(data)]
+			txAttr.data = data
+			index = newIndex
 			txAttrs = append(txAttrs, txAttr)
 			continue
 		}
@@ -88,22 +96,25 @@ func decodeTxAttributeFromRawTrans(txByte []byte, index int) ([]TxAttribute, int
 			return nil, index, errors.New("Invalid transaction vout attribute length")
 		}
 		txAttr.data = txByte[index : index+int(attrType.fixedDataLength)]
+		index += int(attrType.fixedDataLength)
 		txAttrs = append(txAttrs, txAttr)
 	}
 	return txAttrs, index, nil
 }
 
+// 获取附加信息中声明的脚本哈希（Script 类型）
+func (ta TxAttribute) GetScriptHash() ([]byte, bool) {
+	if ta.usage != AttrScript.value {
+		return nil, false
+	}
+	return ta.data, true
+}
+
 // 转换为字节数组
 func (ta TxAttribute) toBytes() ([]byte, error) {
-	if ta.usage < 0 || ta.usage > 0xff {
-		return nil, errors.New(fmt.Sprintf("Invalid usage value : %d", ta.usage))
-	}
 	ret := []byte{}
 	ret = append(ret, ta.usage)
-	lengthData := littleEndianBytesToUint16(ta.length)
-	if lengthData > 0 {
-		ret = append(ret, ta.length...)
-	}
+	ret = append(ret, ta.length...)
 	ret = append(ret, ta.data...)
 	return ret, nil
 }
@@ -0,0 +1,231 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// 合约参数类型
+type ContractParameterType struct {
+	jsonString string
+	value      byte
+}
+
+var (
+	ParamSignature        = ContractParameterType{"Signature", 0x00}
+	ParamBoolean          = ContractParameterType{"Boolean", 0x01}
+	ParamInteger          = ContractParameterType{"Integer", 0x02}
+	ParamHash160          = ContractParameterType{"Hash160", 0x03}
+	ParamHash256          = ContractParameterType{"Hash256", 0x04}
+	ParamByteArray        = ContractParameterType{"ByteArray", 0x05}
+	ParamPublicKey        = ContractParameterType{"PublicKey", 0x06}
+	ParamString           = ContractParameterType{"String", 0x07}
+	ParamArray            = ContractParameterType{"Array", 0x10}
+	ParamInteropInterface = ContractParameterType{"InteropInterface", 0xf0}
+	ParamVoid             = ContractParameterType{"Void", 0xff}
+)
+
+var contractParameterTypes = []ContractParameterType{ParamSignature, ParamBoolean, ParamInteger, ParamHash160, ParamHash256, ParamByteArray, ParamPublicKey, ParamString, ParamArray, ParamInteropInterface, ParamVoid}
+
+func (pt ContractParameterType) String() string {
+	return pt.jsonString
+}
+
+// 根据名称或十六进制值获取合约参数类型，如 "Signature" 或 "00"
+func GetContractParameterType(name string) (*ContractParameterType, error) {
+	for _, t := range contractParameterTypes {
+		if strings.EqualFold(t.jsonString, name) || strings.EqualFold(hex.EncodeToString([]byte{t.value}), name) {
+			return &t, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown contract parameter type : %s", name))
+}
+
+// 合约属性
+const (
+	ContractNoProperty       = byte(0x00)
+	ContractHasStorage       = byte(0x01)
+	ContractHasDynamicInvoke = byte(0x02)
+	ContractPayable          = byte(0x04)
+)
+
+// 部署合约的系统费，单位为 GAS
+const (
+	ContractCreateFee        = int64(100) // 部署基础费用
+	ContractStorageFee       = int64(400) // 使用存储的附加费用
+	ContractDynamicInvokeFee = int64(500) // 动态调用的附加费用
+	FreeGasPerInvocation     = int64(10)  // 每笔调用交易的免费额度
+)
+
+// 部署合约的元数据
+// Script : 合约脚本，即 AVM 文件内容
+// ParameterList : 合约入口的参数类型列表
+// ReturnType : 合约入口的返回值类型
+// NeedStorage : 是否使用存储区
+// DynamicInvoke : 是否动态调用其它合约
+// Payable : 是否可接收全局资产
+// Name, Version, Author, Email, Description : 合约描述信息
+type ContractDeployment struct {
+	Script        []byte
+	ParameterList []ContractParameterType
+	ReturnType    ContractParameterType
+	NeedStorage   bool
+	DynamicInvoke bool
+	Payable       bool
+	Name          string
+	Version       string
+	Author        string
+	Email         string
+	Description   string
+}
+
+// 合约属性标志
+func (c ContractDeployment) properties() byte {
+	props := ContractNoProperty
+	if c.NeedStorage {
+		props |= ContractHasStorage
+	}
+	if c.DynamicInvoke {
+		props |= ContractHasDynamicInvoke
+	}
+	if c.Payable {
+		props |= ContractPayable
+	}
+	return props
+}
+
+// 参数类型列表的字节形式
+func (c ContractDeployment) parameterListBytes() []byte {
+	ret := make([]byte, 0, len(c.ParameterList))
+	for _, p := range c.ParameterList {
+		ret = append(ret, p.value)
+	}
+	return ret
+}
+
+// 获取合约脚本哈希，大端序十六进制，带 0x 前缀
+func (c ContractDeployment) GetScriptHash() string {
+	return "0x" + hex.EncodeToString(reverseByteArray(GetScriptHash(c.Script)))
+}
+
+// 获取部署合约需要支付的系统费，单位为 10^-8 GAS
+// 部署费用扣除每笔调用交易的免费额度后向上取整到整数 GAS
+func (c ContractDeployment) GetDeployFee() uint64 {
+	fee := ContractCreateFee
+	if c.NeedStorage {
+		fee += ContractStorageFee
+	}
+	if c.DynamicInvoke {
+		fee += ContractDynamicInvokeFee
+	}
+	fee -= FreeGasPerInvocation
+	if fee < 0 {
+		fee = 0
+	}
+	return uint64(fee) * 100000000
+}
+
+// 构建部署合约的调用脚本
+// 参数按 description, email, author, version, name, properties, return type, parameter list, script 的顺序压栈，再调用 Neo.Contract.Create
+func BuildContractCreateScript(c ContractDeployment) ([]byte, error) {
+	if len(c.Script) == 0 {
+		return nil, errors.New("Contract script is empty!")
+	}
+
+	sb := NewScriptBuilder()
+	sb.EmitPushString(c.Description).
+		EmitPushString(c.Email).
+		EmitPushString(c.Author).
+		EmitPushString(c.Version).
+		EmitPushString(c.Name).
+		EmitPushInteger(big.NewInt(int64(c.properties()))).
+		EmitPushInteger(big.NewInt(int64(c.ReturnType.value))).
+		EmitPushBytes(c.parameterListBytes()).
+		EmitPushBytes(c.Script)
+
+	_, err := sb.EmitSysCall("Neo.Contract.Create")
+	if err != nil {
+		return nil, err
+	}
+	return sb.ToBytes(), nil
+}
+
+func (pt ContractParameterType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.jsonString)
+}
+
+func (pt *ContractParameterType) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return err
+	}
+	t, err := GetContractParameterType(name)
+	if err != nil {
+		return err
+	}
+	*pt = *t
+	return nil
+}
+
+// 合约参数，用于构建见证人的调用脚本
+// Type : 参数类型，支持 Signature, Integer, ByteArray, Boolean
+// Value : 参数值，Signature 和 ByteArray 为十六进制，Integer 为十进制，Boolean 为 true 或 false
+type ContractParameter struct {
+	Type  ContractParameterType `json:"type"`
+	Value string                `json:"value"`
+}
+
+func NewSignatureParameter(signature []byte) ContractParameter {
+	return ContractParameter{Type: ParamSignature, Value: hex.EncodeToString(signature)}
+}
+
+func NewIntegerParameter(number *big.Int) ContractParameter {
+	return ContractParameter{Type: ParamInteger, Value: number.String()}
+}
+
+func NewByteArrayParameter(data []byte) ContractParameter {
+	return ContractParameter{Type: ParamByteArray, Value: hex.EncodeToString(data)}
+}
+
+func NewBooleanParameter(data bool) ContractParameter {
+	return ContractParameter{Type: ParamBoolean, Value: strconv.FormatBool(data)}
+}
+
+// 压入合约参数
+func (sb *ScriptBuilder) EmitPushParameter(param ContractParameter) error {
+	switch param.Type {
+	case ParamSignature:
+		signature, err := hex.DecodeString(param.Value)
+		if err != nil || len(signature) != 64 {
+			return errors.New("Invalid signature parameter!")
+		}
+		sb.EmitPushBytes(signature)
+	case ParamByteArray:
+		data, err := hex.DecodeString(param.Value)
+		if err != nil {
+			return errors.New("Invalid byte array parameter!")
+		}
+		sb.EmitPushBytes(data)
+	case ParamInteger:
+		number, ok := new(big.Int).SetString(param.Value, 10)
+		if !ok {
+			return errors.New("Invalid integer parameter!")
+		}
+		sb.EmitPushInteger(number)
+	case ParamBoolean:
+		data, err := strconv.ParseBool(param.Value)
+		if err != nil {
+			return errors.New("Invalid boolean parameter!")
+		}
+		sb.EmitPushBool(data)
+	default:
+		return errors.New(fmt.Sprintf("Unsupported contract parameter type : %s", param.Type.jsonString))
+	}
+	return nil
+}
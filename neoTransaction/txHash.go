@@ -18,11 +18,33 @@ type MultiTx struct {
 	SigPub  SignaturePubkey
 }
 
+// 合约地址的见证数据
+// Verification : 验证脚本
+// Parameters : 调用参数，签名参数需填入签名结果
+type ContractTx struct {
+	Verification []byte
+	Parameters   []ContractParameter
+}
+
 type TxHash struct {
 	Hash      string
 	NRequired byte
 	Normal    *NormalTx
 	Multi     []MultiTx
+	Contract  *ContractTx
+}
+
+// 合约调用参数的类型列表
+func (c ContractTx) ParameterTypes() []ContractParameterType {
+	ret := make([]ContractParameterType, 0, len(c.Parameters))
+	for _, p := range c.Parameters {
+		ret = append(ret, p.Type)
+	}
+	return ret
+}
+
+func (tx TxHash) IsContract() bool {
+	return tx.Contract != nil
 }
 
 func (tx TxHash) IsMultisig() bool {
@@ -195,7 +217,7 @@ func (t Transaction) getBytesForSig() ([]byte, error) {
 
 func (t Transaction) getHashesForSig() ([]TxHash, error) {
 	hashes := []TxHash{}
-	if t.Vouts == nil || len(t.Vouts) == 0 {
+	if t.Type == ContractTransaction.hexValue && (t.Vouts == nil || len(t.Vouts) == 0) {
 		return nil, errors.New("No output found!")
 	}
 
@@ -209,23 +231,29 @@ func (t Transaction) getHashesForSig() ([]TxHash, error) {
 	hash := owcrypt.Hash(emptyTransBytes, 0, owcrypt.HASH_ALG_SHA256)
 
 	for _, script := range t.Scripts {
+		// 非标准验证脚本按合约见证人处理
+		if !script.isStandardVerification() {
+			hashes = append(hashes, TxHash{
+				Hash: hex.EncodeToString(hash),
+				Contract: &ContractTx{
+					Verification: script.verificationScript,
+				},
+			})
+			continue
+		}
 		pubKey, err := script.GetPubKeyByVerificationScript()
 		if err != nil {
 			return nil, err
 		}
 		sign, err := script.GetSignatureByInvocationScript()
 		hashes = append(hashes, TxHash{
-			hex.EncodeToString(hash),
-			0,
-			&NormalTx{
-				"",
-				0,
-				SignaturePubkey{
-					sign,
-					pubKey,
+			Hash: hex.EncodeToString(hash),
+			Normal: &NormalTx{
+				SigPub: SignaturePubkey{
+					Signature: sign,
+					Pubkey:    pubKey,
 				},
 			},
-			nil,
 		})
 	}
 	return hashes, nil
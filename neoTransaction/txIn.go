@@ -12,7 +12,7 @@ type TxIn struct {
 
 // 获取交易ID
 func (in TxIn) GetTxID() string {
-	return reverseBytesToHex(in.txID)
+	return reverseBytesToHex(append([]byte{}, in.txID...))
 }
 
 // 获取对应索引
@@ -23,10 +23,7 @@ func (in TxIn) GetVout() uint16 {
 // 创建交易输入 并将字段值序列化
 // vins : 交易输入
 func newTxInForEmptyTrans(vins []Vin) ([]TxIn, error) {
-	if vins == nil || len(vins) == 0 {
-		return nil, errors.New("No input found when create an empty transaction!")
-	}
-	var ret []TxIn
+	var ret = make([]TxIn, 0)
 
 	for _, v := range vins {
 		txid, err := reverseHexToBytes(v.TxID)
@@ -45,13 +42,12 @@ func newTxInForEmptyTrans(vins []Vin) ([]TxIn, error) {
 // index : 字段值在序列化数组中的索引
 func decodeTxInFromRawTrans(txBytes []byte, index int) ([]TxIn, int, error) {
 	var txIns = make([]TxIn, 0)
-	vinCount := txBytes[index]
-	index++
-	if vinCount == 0 {
+	vinCount, index, err := readLength(txBytes, index)
+	if err != nil {
 		return nil, index, errors.New("Invalid transaction vin count")
 	}
 
-	for i := byte(0); i < vinCount; i++ {
+	for i := uint64(0); i < vinCount; i++ {
 		var txIn = TxIn{}
 
 		if index+32 > len(txBytes) {
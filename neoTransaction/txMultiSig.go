@@ -1,5 +1,14 @@
 package neoTransaction
 
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
 // type msSigPub struct {
 // 	sig []byte
 // 	pub []byte
@@ -224,3 +233,98 @@ func decodeMultiBytes(script []byte) ([]SignaturePubkey, []byte, error) {
 	//return sp, st, nil
 	return nil, nil, nil
 }
+
+// 多签验证脚本允许的最大公钥数量
+const MaxMultiSigPublicKeys = 1024
+
+// 构建多签验证脚本 PUSH(m) + 按公钥大小排序的 PushBytes33 + 公钥 + PUSH(n) + CheckMultiSig，与 neo-cli 的 CreateMultiSigRedeemScript 一致
+// required : 需要的签名数量
+// pubkeys : 压缩公钥
+func BuildMultiSigVerification(required int, pubkeys [][]byte) ([]byte, error) {
+	if required < 1 || required > len(pubkeys) || len(pubkeys) > MaxMultiSigPublicKeys {
+		return nil, errors.New("Invalid required number for multisig verification!")
+	}
+
+	sorted := make([][]byte, 0, len(pubkeys))
+	for _, pub := range pubkeys {
+		if len(pub) != PublicKeySize || (pub[0] != 0x02 && pub[0] != 0x03) {
+			return nil, errors.New("Invalid pubkey data for multisig verification!")
+		}
+		sorted = append(sorted, pub)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePublicKey(sorted[i], sorted[j]) < 0
+	})
+
+	sb := NewScriptBuilder()
+	sb.EmitPushInteger(big.NewInt(int64(required)))
+	for _, pub := range sorted {
+		sb.EmitPushBytes(pub)
+	}
+	sb.EmitPushInteger(big.NewInt(int64(len(sorted))))
+	sb.Emit(OpCheckMultiSig)
+	return sb.ToBytes(), nil
+}
+
+// 解析多签验证脚本，返回需要的签名数量和脚本中的公钥（按脚本中的顺序）
+// script : 验证脚本
+func ParseMultiSigVerification(script []byte) (int, [][]byte, error) {
+	if len(script) < 37 || script[len(script)-1] != OpCheckMultiSig {
+		return 0, nil, errors.New("Invalid multisig verification script!")
+	}
+
+	required, index, err := readScriptInteger(script, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pubkeys := make([][]byte, 0)
+	for index < len(script) && script[index] == OpPushBytes33 {
+		if index+1+PublicKeySize > len(script) {
+			return 0, nil, errors.New("Invalid multisig verification script!")
+		}
+		pubkeys = append(pubkeys, script[index+1:index+1+PublicKeySize])
+		index += 1 + PublicKeySize
+	}
+
+	total, index, err := readScriptInteger(script, index)
+	if err != nil {
+		return 0, nil, err
+	}
+	if index != len(script)-1 || total != len(pubkeys) || required < 1 || required > total {
+		return 0, nil, errors.New("Invalid multisig verification script!")
+	}
+	return required, pubkeys, nil
+}
+
+// 判断验证脚本是否为多签脚本
+func IsMultiSigVerification(script []byte) bool {
+	_, _, err := ParseMultiSigVerification(script)
+	return err == nil
+}
+
+// 读取多签脚本中的整数，支持 PUSH1 到 PUSH16 以及 1 到 2 字节的压栈数据
+func readScriptInteger(script []byte, index int) (int, int, error) {
+	if index >= len(script) {
+		return 0, 0, errors.New("Invalid multisig verification script!")
+	}
+	op := script[index]
+	switch {
+	case op >= OpPush1 && op <= OpPush16:
+		return int(op-OpPush1) + 1, index + 1, nil
+	case op == OpPushBytes1 && index+2 <= len(script):
+		return int(script[index+1]), index + 2, nil
+	case op == OpPushBytes1+1 && index+3 <= len(script):
+		return int(littleEndianBytesToUint16(script[index+1 : index+3])), index + 3, nil
+	}
+	return 0, 0, errors.New("Invalid multisig verification script!")
+}
+
+// 比较两个压缩公钥对应的椭圆曲线点，先比较 X 再比较 Y，与 neo-cli 的 ECPoint.CompareTo 一致
+func comparePublicKey(a, b []byte) int {
+	ret := bytes.Compare(a[1:], b[1:])
+	if ret != 0 {
+		return ret
+	}
+	return bytes.Compare(owcrypt.PointDecompress(a, owcrypt.ECC_CURVE_SECP256R1)[33:], owcrypt.PointDecompress(b, owcrypt.ECC_CURVE_SECP256R1)[33:])
+}
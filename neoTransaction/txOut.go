@@ -16,10 +16,7 @@ type TxOut struct {
 // 创建并序列化交易输出
 // vouts : 交易输出源数据
 func newTxOutForEmptyTrans(vouts []Vout) ([]TxOut, error) {
-	if vouts == nil || len(vouts) == 0 {
-		return nil, errors.New("No address to send when create an empty transaction!")
-	}
-	var ret []TxOut
+	var ret = make([]TxOut, 0)
 
 	for _, v := range vouts {
 		assetId, err := hex.DecodeString(v.Asset)
@@ -44,13 +41,12 @@ func newTxOutForEmptyTrans(vouts []Vout) ([]TxOut, error) {
 // index : 值在序列化数组中的索引
 func decodeTxOutFromRawTrans(txBytes []byte, index int) ([]TxOut, int, error) {
 	var txOuts = make([]TxOut, 0)
-	var voutCount = txBytes[index]
-	index++
-	if voutCount == 0 {
+	voutCount, index, err := readLength(txBytes, index)
+	if err != nil {
 		return nil, index, errors.New("Invalid transaction vout count")
 	}
 
-	for i := byte(0); i < voutCount; i++ {
+	for i := uint64(0); i < voutCount; i++ {
 		var txOut = TxOut{}
 		if index+32 > len(txBytes) {
 			return nil, index, errors.New("Invalid transaction vout assetid length ")
@@ -72,6 +68,21 @@ func decodeTxOutFromRawTrans(txBytes []byte, index int) ([]TxOut, int, error) {
 	return txOuts, index, nil
 }
 
+// 获取资产ID，大端序十六进制，不带0x
+func (out TxOut) GetAssetID() string {
+	return reverseBytesToHex(append([]byte{}, out.asset...))
+}
+
+// 获取输出金额，精度为8位
+func (out TxOut) GetValue() uint64 {
+	return littleEndianBytesToUint64(out.value)
+}
+
+// 获取接收地址的脚本哈希，小端序
+func (out TxOut) GetScriptHash() []byte {
+	return append([]byte{}, out.address...)
+}
+
 // 交易输出转换为字节数组
 func (out TxOut) toBytes() ([]byte, error) {
 	if out.value == nil || len(out.value) != 8 {
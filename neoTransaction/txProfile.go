@@ -16,8 +16,8 @@ type TransactionType struct {
 
 var (
 	MinerTransaction        = TransactionType{"MinerTransaction", 0x00, 0}
-	IssueTransaction        = TransactionType{"IssueTransaction", 0x02, 0}
-	ClaimTransaction        = TransactionType{"ClaimTransaction", 0x03, 0}
+	IssueTransaction        = TransactionType{"IssueTransaction", 0x01, 0}
+	ClaimTransaction        = TransactionType{"ClaimTransaction", 0x02, 0}
 	DataFile                = TransactionType{"DataFile", 0x12, 0}
 	EnrollmentTransaction   = TransactionType{"EnrollmentTransaction", 0x20, 0}
 	RegisterTransaction     = TransactionType{"RegisterTransaction", 0x40, 0}
@@ -31,6 +31,9 @@ var (
 	InvocationTransaction   = TransactionType{"InvocationTransaction", 0xd1, 1}
 )
 
+// 区块中可能出现的交易类型
+var transactionTypes = []TransactionType{MinerTransaction, IssueTransaction, ClaimTransaction, EnrollmentTransaction, RegisterTransaction, ContractTransaction, StateTransaction, PublishTransaction, InvocationTransaction}
+
 // 交易附加参数类型
 type AttributeType struct {
 	jsonString      string
@@ -44,7 +47,7 @@ var (
 	AttrECDH02         = AttributeType{"ECDH02", 0x02, 32, 32}
 	AttrECDH03         = AttributeType{"ECDH03", 0x03, 32, 32}
 	AttrScript         = AttributeType{"Script", 0x20, 20, 20}
-	AttrVote           = AttributeType{"Vote", 0x30, 0, 0}
+	AttrVote           = AttributeType{"Vote", 0x30, 32, 32}
 	AttrDescriptionUrl = AttributeType{"DescriptionUrl", 0x81, 255, 0}
 	AttrDescription    = AttributeType{"Description", 0x90, 65535, 0}
 
@@ -83,6 +86,7 @@ var (
 )
 
 const (
+	AddressVersion       = byte(0x17) // 地址版本号
 	PublicKeySize        = 33
 	DefaultTxVersion     = uint32(0)
 	MaxScriptElementSize = 520
@@ -107,6 +111,37 @@ const (
 	OpCheckMultiSig = byte(0xae)
 )
 
+// NEO 虚拟机操作码，用于构建调用脚本
+const (
+	OpPush0       = byte(0x00)
+	OpPushF       = OpPush0
+	OpPushBytes1  = byte(0x01)
+	OpPushBytes75 = byte(0x4b)
+	OpPushData1   = byte(0x4c)
+	OpPushData2   = byte(0x4d)
+	OpPushData4   = byte(0x4e)
+	OpPushM1      = byte(0x4f)
+	OpPush1       = byte(0x51)
+	OpPushT       = OpPush1
+	OpPush16      = byte(0x60)
+	OpNop         = byte(0x61)
+	OpJmp         = byte(0x62)
+	OpJmpIf       = byte(0x63)
+	OpJmpIfNot    = byte(0x64)
+	OpCall        = byte(0x65)
+	OpRet         = byte(0x66)
+	OpAppCall     = byte(0x67)
+	OpSysCall     = byte(0x68)
+	OpTailCall    = byte(0x69)
+	OpPack        = byte(0xc1)
+	OpCallI       = byte(0xe0)
+	OpCallE       = byte(0xe1)
+	OpCallED      = byte(0xe2)
+	OpCallET      = byte(0xe3)
+	OpCallEDT     = byte(0xe4)
+	OpThrowIfNot  = byte(0xf1)
+)
+
 var (
 	CurveOrder     = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE, 0xBA, 0xAE, 0xDC, 0xE6, 0xAF, 0x48, 0xA0, 0x3B, 0xBF, 0xD2, 0x5E, 0x8C, 0xD0, 0x36, 0x41, 0x41}
 	HalfCurveOrder = []byte{0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x5D, 0x57, 0x6E, 0x73, 0x57, 0xA4, 0x50, 0x1D, 0xDF, 0xE9, 0x2F, 0x46, 0x68, 0x1B, 0x20, 0xA0}
@@ -0,0 +1,132 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 资产类型
+type AssetType struct {
+	jsonString string
+	value      byte
+}
+
+var (
+	AssetGoverningToken = AssetType{"GoverningToken", 0x00}
+	AssetUtilityToken   = AssetType{"UtilityToken", 0x01}
+	AssetCurrency       = AssetType{"Currency", 0x08}
+	AssetShare          = AssetType{"Share", 0x90}
+	AssetInvoice        = AssetType{"Invoice", 0x98}
+	AssetToken          = AssetType{"Token", 0x60}
+)
+
+const (
+	MaxAssetNameLength   = 1024
+	MaxAssetPrecision    = 8
+	UnlimitedAssetAmount = int64(-1) // 不限总量，对应 -Fixed8.Satoshi
+)
+
+// 注册资产元数据
+// Type : 资产类型
+// Name : 资产名称，通常为 [{"lang":"en","name":"..."}] 格式的 JSON
+// Amount : 资产总量，Fixed8 原始值，UnlimitedAssetAmount 表示不限总量
+// Precision : 资产精度，0 到 8
+// Owner : 所有者公钥，十六进制压缩格式
+// Admin : 管理员地址，发行资产时需要其签名
+type Asset struct {
+	Type      AssetType
+	Name      string
+	Amount    int64
+	Precision byte
+	Owner     string
+	Admin     string
+}
+
+func (a *Asset) String() string {
+	return fmt.Sprintf("Asset : { type : %s, name : %s, amount : %d, precision : %d, owner : %s, admin : %s } ", a.Type.jsonString, a.Name, a.Amount, a.Precision, a.Owner, a.Admin)
+}
+
+// 根据名称获取资产类型
+func GetAssetTypeByName(name string) (*AssetType, error) {
+	for _, t := range []AssetType{AssetGoverningToken, AssetUtilityToken, AssetCurrency, AssetShare, AssetInvoice, AssetToken} {
+		if t.jsonString == name {
+			return &t, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown asset type : %s", name))
+}
+
+// 序列化注册资产数据
+func (a Asset) toBytes() ([]byte, error) {
+	if len(a.Name) == 0 || len(a.Name) > MaxAssetNameLength {
+		return nil, errors.New("Invalid asset name!")
+	}
+	if a.Amount == 0 || a.Amount < UnlimitedAssetAmount {
+		return nil, errors.New("Invalid asset amount!")
+	}
+	if a.Precision > MaxAssetPrecision {
+		return nil, errors.New("Invalid asset precision!")
+	}
+	if a.Amount != UnlimitedAssetAmount && a.Amount%pow10(MaxAssetPrecision-a.Precision) != 0 {
+		return nil, errors.New("Asset amount does not match precision!")
+	}
+	owner, err := hex.DecodeString(a.Owner)
+	if err != nil || len(owner) != PublicKeySize || (owner[0] != 0x02 && owner[0] != 0x03) {
+		return nil, errors.New("Invalid asset owner public key!")
+	}
+	admin, err := decodeAddressScriptHash(a.Admin)
+	if err != nil {
+		return nil, errors.New("Invalid asset admin address!")
+	}
+
+	ret := []byte{a.Type.value}
+	ret = append(ret, writeVarBytes([]byte(a.Name))...)
+	ret = append(ret, uint64ToLittleEndianBytes(uint64(a.Amount))...)
+	ret = append(ret, a.Precision)
+	ret = append(ret, owner...)
+	ret = append(ret, admin...)
+	return ret, nil
+}
+
+// 反序列化注册资产数据，返回所有者公钥
+// txBytes : 交易序列化数组
+// index : 对应在序列化数组中的索引
+func decodeAssetFromRawTrans(txBytes []byte, index int) ([]byte, int, error) {
+	if index+1 > len(txBytes) {
+		return nil, index, errors.New("Invalid register transaction asset type!")
+	}
+	index++
+	_, index, err := readVarBytes(txBytes, index)
+	if err != nil {
+		return nil, index, errors.New("Invalid register transaction asset name!")
+	}
+	if index+9 > len(txBytes) {
+		return nil, index, errors.New("Invalid register transaction asset amount!")
+	}
+	index += 9
+	if index+1 > len(txBytes) {
+		return nil, index, errors.New("Invalid register transaction asset owner!")
+	}
+	ownerLen := 1
+	switch txBytes[index] {
+	case 0x02, 0x03:
+		ownerLen = 33
+	case 0x04:
+		ownerLen = 65
+	}
+	if index+ownerLen+20 > len(txBytes) {
+		return nil, index, errors.New("Invalid register transaction asset owner!")
+	}
+	owner := txBytes[index : index+ownerLen]
+	index += ownerLen + 20
+	return owner, index, nil
+}
+
+func pow10(n byte) int64 {
+	ret := int64(1)
+	for i := byte(0); i < n; i++ {
+		ret *= 10
+	}
+	return ret
+}
@@ -0,0 +1,128 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// 调用脚本构建器，按 NEO 虚拟机的规则压入参数和操作码
+type ScriptBuilder struct {
+	script []byte
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{script: make([]byte, 0)}
+}
+
+// 写入操作码及其附带的数据
+// op : 操作码
+// arg : 附带数据
+func (sb *ScriptBuilder) Emit(op byte, arg ...byte) *ScriptBuilder {
+	sb.script = append(sb.script, op)
+	sb.script = append(sb.script, arg...)
+	return sb
+}
+
+// 压入整数，-1 到 16 使用对应的 PUSH 操作码，其它使用小端补码
+// number : 压入的整数
+func (sb *ScriptBuilder) EmitPushInteger(number *big.Int) *ScriptBuilder {
+	if number.Cmp(big.NewInt(-1)) == 0 {
+		return sb.Emit(OpPushM1)
+	}
+	if number.Sign() == 0 {
+		return sb.Emit(OpPush0)
+	}
+	if number.Sign() > 0 && number.Cmp(big.NewInt(16)) <= 0 {
+		return sb.Emit(OpPush1 - 1 + byte(number.Int64()))
+	}
+	return sb.EmitPushBytes(bigIntToNeoBytes(number))
+}
+
+// 压入字节数组
+// data : 压入的数据
+func (sb *ScriptBuilder) EmitPushBytes(data []byte) *ScriptBuilder {
+	length := len(data)
+	if length <= int(OpPushBytes75) {
+		sb.Emit(byte(length))
+	} else if length <= 0xff {
+		sb.Emit(OpPushData1, byte(length))
+	} else if length <= 0xffff {
+		sb.Emit(OpPushData2, uint16ToLittleEndianBytes(uint16(length))...)
+	} else {
+		sb.Emit(OpPushData4, uint32ToLittleEndianBytes(uint32(length))...)
+	}
+	sb.script = append(sb.script, data...)
+	return sb
+}
+
+// 压入字符串
+func (sb *ScriptBuilder) EmitPushString(data string) *ScriptBuilder {
+	return sb.EmitPushBytes([]byte(data))
+}
+
+// 压入布尔值
+func (sb *ScriptBuilder) EmitPushBool(data bool) *ScriptBuilder {
+	if data {
+		return sb.Emit(OpPushT)
+	}
+	return sb.Emit(OpPushF)
+}
+
+// 调用合约
+// scriptHash : 合约脚本哈希，小端序20字节
+// useTailCall : 是否使用 TAILCALL
+func (sb *ScriptBuilder) EmitAppCall(scriptHash []byte, useTailCall bool) (*ScriptBuilder, error) {
+	if len(scriptHash) != 20 {
+		return sb, errors.New("Invalid contract script hash!")
+	}
+	if useTailCall {
+		return sb.Emit(OpTailCall, scriptHash...), nil
+	}
+	return sb.Emit(OpAppCall, scriptHash...), nil
+}
+
+// 调用系统接口
+// api : 接口名称，如 Neo.Contract.Create
+func (sb *ScriptBuilder) EmitSysCall(api string) (*ScriptBuilder, error) {
+	if len(api) == 0 || len(api) > 252 {
+		return sb, errors.New("Invalid syscall api!")
+	}
+	return sb.Emit(OpSysCall, writeVarBytes([]byte(api))...), nil
+}
+
+// 获取构建的脚本
+func (sb *ScriptBuilder) ToBytes() []byte {
+	return sb.script
+}
+
+// 获取构建的脚本的十六进制
+func (sb *ScriptBuilder) ToHex() string {
+	return hex.EncodeToString(sb.script)
+}
+
+// 将大整数转换为 NEO 虚拟机使用的小端补码
+func bigIntToNeoBytes(number *big.Int) []byte {
+	if number.Sign() == 0 {
+		return []byte{}
+	}
+	if number.Sign() > 0 {
+		ret := reverseBytes(number.Bytes())
+		if ret[len(ret)-1]&0x80 != 0 {
+			ret = append(ret, 0x00)
+		}
+		return ret
+	}
+	// 负数：按位取反后加一
+	abs := new(big.Int).Neg(number)
+	length := len(abs.Bytes())
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(length*8))
+	twos := new(big.Int).Add(mod, number).Bytes()
+	ret := make([]byte, length)
+	copy(ret[length-len(twos):], twos)
+	ret = reverseBytes(ret)
+	if ret[len(ret)-1]&0x80 == 0 {
+		ret = append(ret, 0xff)
+	}
+	return ret
+}
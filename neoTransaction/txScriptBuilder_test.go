@@ -0,0 +1,67 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// 测试压入整数
+func TestScriptBuilder_EmitPushInteger(t *testing.T) {
+	cases := map[int64]string{
+		-1:        "4f",
+		0:         "00",
+		1:         "51",
+		16:        "60",
+		17:        "0111",
+		128:       "028000",
+		-128:      "0180",
+		-129:      "027fff",
+		100000000: "0400e1f505",
+	}
+	for number, want := range cases {
+		got := NewScriptBuilder().EmitPushInteger(big.NewInt(number)).ToHex()
+		if got != want {
+			t.Errorf("push %d : want %s, got %s", number, want, got)
+		}
+	}
+}
+
+// 测试压入不同长度的字节数组
+func TestScriptBuilder_EmitPushBytes(t *testing.T) {
+	for _, length := range []int{20, 75, 76, 255, 256} {
+		script := NewScriptBuilder().EmitPushBytes(make([]byte, length)).ToBytes()
+		fmt.Println(fmt.Sprintf("push %d bytes, prefix : %x", length, script[:3]))
+		switch {
+		case length <= 75:
+			if script[0] != byte(length) {
+				t.Errorf("push %d bytes : invalid prefix", length)
+			}
+		case length <= 0xff:
+			if script[0] != OpPushData1 || script[1] != byte(length) {
+				t.Errorf("push %d bytes : invalid prefix", length)
+			}
+		default:
+			if script[0] != OpPushData2 || littleEndianBytesToUint16(script[1:3]) != uint16(length) {
+				t.Errorf("push %d bytes : invalid prefix", length)
+			}
+		}
+	}
+}
+
+// 测试构建 NEP-5 转账脚本
+func TestBuildNEP5TransferScript(t *testing.T) {
+	script, err := BuildNEP5TransferScript("0xecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9",
+		"ANYZ11AmUfwiZFLbAWHoExFyBuqgLmfz88",
+		"AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC",
+		big.NewInt(100000000))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	want := "0400e1f50514accc9eba9934271301effd425f88d4d0e1d1ac6e144a43e85f3e0137a23998cdc6dbacfac0268bf03853c1087472616e7366657267f91d6b7085db7c5aaf09f19eeec1ca3c0db2c6ecf1"
+	if hex.EncodeToString(script) != want {
+		t.Errorf("NEP-5 transfer script : want %s, got %x", want, script)
+	}
+}
@@ -0,0 +1,193 @@
+package neoTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 状态描述类型
+type StateType struct {
+	jsonString string
+	value      byte
+}
+
+var (
+	StateTypeAccount   = StateType{"Account", 0x40}
+	StateTypeValidator = StateType{"Validator", 0x48}
+)
+
+const (
+	StateFieldVotes      = "Votes"
+	StateFieldRegistered = "Registered"
+	MaxVoteCandidates    = 1024
+)
+
+// 状态描述元数据
+// Type : 状态类型
+// Key : Account 为账户脚本哈希（小端序），Validator 为候选人公钥，十六进制
+// Field : 修改的字段，Votes 或 Registered
+// Value : 字段值，十六进制
+type StateDescriptor struct {
+	Type  StateType
+	Key   string
+	Field string
+	Value string
+}
+
+func (sd *StateDescriptor) String() string {
+	return fmt.Sprintf("StateDescriptor : { type : %s, key : %s, field : %s, value : %s } ", sd.Type.jsonString, sd.Key, sd.Field, sd.Value)
+}
+
+// 序列化后的状态描述
+type TxStateDescriptor struct {
+	stateType byte
+	key       []byte
+	field     []byte
+	value     []byte
+}
+
+// 创建投票状态描述
+// address : 投票账户地址
+// pubKeys : 候选人公钥，为空时取消投票
+func NewVoteStateDescriptor(address string, pubKeys []string) (*StateDescriptor, error) {
+	scriptHash, err := decodeAddressScriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(pubKeys) > MaxVoteCandidates {
+		return nil, errors.New("Too many vote candidates!")
+	}
+
+	votes := writeVarBytesLength(len(pubKeys))
+	for _, pubKey := range pubKeys {
+		pub, err := hex.DecodeString(pubKey)
+		if err != nil || len(pub) != PublicKeySize || (pub[0] != 0x02 && pub[0] != 0x03) {
+			return nil, errors.New(fmt.Sprintf("Invalid candidate public key : %s", pubKey))
+		}
+		votes = append(votes, pub...)
+	}
+
+	return &StateDescriptor{
+		Type:  StateTypeAccount,
+		Key:   hex.EncodeToString(scriptHash),
+		Field: StateFieldVotes,
+		Value: hex.EncodeToString(votes),
+	}, nil
+}
+
+// 创建候选人注册状态描述
+// pubKey : 候选人公钥
+// registered : 注册或注销
+func NewValidatorStateDescriptor(pubKey string, registered bool) (*StateDescriptor, error) {
+	pub, err := hex.DecodeString(pubKey)
+	if err != nil || len(pub) != PublicKeySize || (pub[0] != 0x02 && pub[0] != 0x03) {
+		return nil, errors.New(fmt.Sprintf("Invalid validator public key : %s", pubKey))
+	}
+	value := "00"
+	if registered {
+		value = "01"
+	}
+	return &StateDescriptor{
+		Type:  StateTypeValidator,
+		Key:   pubKey,
+		Field: StateFieldRegistered,
+		Value: value,
+	}, nil
+}
+
+// 创建状态描述并序列化
+// descriptors : 状态描述元数据
+func newTxStateDescriptorForEmptyTrans(descriptors []StateDescriptor) ([]TxStateDescriptor, error) {
+	if len(descriptors) == 0 {
+		return nil, errors.New("No state descriptor found!")
+	}
+
+	ret := make([]TxStateDescriptor, 0)
+	for _, d := range descriptors {
+		key, err := hex.DecodeString(d.Key)
+		if err != nil {
+			return nil, errors.New("Invalid state descriptor key!")
+		}
+		value, err := hex.DecodeString(d.Value)
+		if err != nil {
+			return nil, errors.New("Invalid state descriptor value!")
+		}
+		switch d.Type.value {
+		case StateTypeAccount.value:
+			if len(key) != 20 || d.Field != StateFieldVotes {
+				return nil, errors.New("Invalid account state descriptor!")
+			}
+		case StateTypeValidator.value:
+			if len(key) != PublicKeySize || d.Field != StateFieldRegistered || len(value) != 1 {
+				return nil, errors.New("Invalid validator state descriptor!")
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown state descriptor type : %x", d.Type.value))
+		}
+		ret = append(ret, TxStateDescriptor{d.Type.value, key, []byte(d.Field), value})
+	}
+	return ret, nil
+}
+
+// 反序列化状态描述
+// txBytes : 交易序列化数组
+// index : 对应在序列化数组中的索引
+func decodeTxStateDescriptorFromRawTrans(txBytes []byte, index int) ([]TxStateDescriptor, int, error) {
+	ret := make([]TxStateDescriptor, 0)
+	count, index, err := readLength(txBytes, index)
+	if err != nil {
+		return nil, index, errors.New("Invalid state descriptor count")
+	}
+	for i := uint64(0); i < count; i++ {
+		var d TxStateDescriptor
+		if index+1 > len(txBytes) {
+			return nil, index, errors.New("Invalid state descriptor type")
+		}
+		d.stateType = txBytes[index]
+		index++
+		d.key, index, err = readVarBytes(txBytes, index)
+		if err != nil {
+			return nil, index, errors.New("Invalid state descriptor key")
+		}
+		d.field, index, err = readVarBytes(txBytes, index)
+		if err != nil {
+			return nil, index, errors.New("Invalid state descriptor field")
+		}
+		d.value, index, err = readVarBytes(txBytes, index)
+		if err != nil {
+			return nil, index, errors.New("Invalid state descriptor value")
+		}
+		ret = append(ret, d)
+	}
+	return ret, index, nil
+}
+
+// 获取状态描述需要的见证人脚本哈希
+// Account 类型为账户本身，Validator 类型为候选人公钥的单签合约
+func (d TxStateDescriptor) getScriptHash() ([]byte, error) {
+	switch d.stateType {
+	case StateTypeAccount.value:
+		return d.key, nil
+	case StateTypeValidator.value:
+		verification, err := BuildVerification(hex.EncodeToString(d.key))
+		if err != nil {
+			return nil, err
+		}
+		return GetScriptHash(verification), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown state descriptor type : %x", d.stateType))
+}
+
+// 转换为字节数组
+func (d TxStateDescriptor) toBytes() []byte {
+	ret := []byte{d.stateType}
+	ret = append(ret, writeVarBytes(d.key)...)
+	ret = append(ret, writeVarBytes(d.field)...)
+	ret = append(ret, writeVarBytes(d.value)...)
+	return ret
+}
+
+func (d *TxStateDescriptor) String() string {
+	return fmt.Sprintf("{ type : %x, key : %x, field : %s, value : %x }", d.stateType, d.key, d.field, d.value)
+}
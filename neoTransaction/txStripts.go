@@ -3,7 +3,9 @@ package neoTransaction
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/pkg/errors"
+	"sort"
 )
 
 // 交易脚本
@@ -80,36 +82,319 @@ func createTxScript(pubKeyBytes, signBytes []byte) (*TxScript, error) {
 // index : 对应序列化数组的索引
 func decodeTxScriptVerificationFromRawTrans(txByte []byte, index int) ([]TxScript, int, error) {
 	var ret = make([]TxScript, 0)
-	scriptsCount := txByte[index]
-	index++
-	for i := byte(0); i < scriptsCount; i++ {
-		index++
-		if index+65 > len(txByte) {
+	scriptsCount, index, err := readLength(txByte, index)
+	if err != nil {
+		return ret, index, errors.New("Invalid transaction tx script count")
+	}
+	for i := uint64(0); i < scriptsCount; i++ {
+		invocationScript, newIndex, err := readVarBytes(txByte, index)
+		if err != nil {
 			return ret, index, errors.New("Invalid transaction tx script invocationScript")
 		}
-		invocationScript := txByte[index : index+65]
-		index += 65
-		index++
-		if index+35 > len(txByte) {
+		index = newIndex
+		verificationScript, newIndex, err := readVarBytes(txByte, index)
+		if err != nil {
 			return ret, index, errors.New("Invalid transaction tx script verificationScript")
 		}
-		verificationScript := txByte[index : index+35]
-		index += 35
+		index = newIndex
 		ret = append(ret, TxScript{invocationScript: invocationScript, verificationScript: verificationScript})
 	}
 	return ret, index, nil
 }
 
+// 获取验证脚本对应的脚本哈希 = RIPEMD160(SHA256(verification))
+// 返回值为小端序，与地址中的20字节一致
+func GetScriptHash(script []byte) []byte {
+	return Hash160(script)
+}
+
+// 计算 RIPEMD160(SHA256(data))
+// owcrypt 的 HASH_ALG_HASH160 会把32字节的 SHA256 结果写入20字节的输出缓冲区，造成越界写，这里分两步计算
+func Hash160(data []byte) []byte {
+	return owcrypt.Hash(owcrypt.Hash(data, 0, owcrypt.HASH_ALG_SHA256), 0, owcrypt.HASH_ALG_RIPEMD160)
+}
+
+// 获取调用脚本
+func (ts TxScript) GetInvocationScript() []byte {
+	return ts.invocationScript
+}
+
+// 获取验证脚本
+func (ts TxScript) GetVerificationScript() []byte {
+	return ts.verificationScript
+}
+
+// 获取见证人的脚本哈希
+func (ts TxScript) GetScriptHash() []byte {
+	return GetScriptHash(ts.verificationScript)
+}
+
+// 按脚本哈希从小到大排列见证人，与节点 GetScriptHashesForVerifying 的顺序一致
+// UInt160 比较时从最高位（小端序的最后一个字节）开始
+func sortTxScripts(scripts []TxScript) {
+	sort.SliceStable(scripts, func(i, j int) bool {
+		return compareScriptHash(scripts[i].GetScriptHash(), scripts[j].GetScriptHash()) < 0
+	})
+}
+
+// 比较两个小端序脚本哈希的大小
+func compareScriptHash(a, b []byte) int {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] > b[i] {
+			return 1
+		}
+		if a[i] < b[i] {
+			return -1
+		}
+	}
+	return 0
+}
+
 // 转换为 byte 数组
 func (ts TxScript) toBytes() ([]byte, error) {
 	var ret = make([]byte, 0)
-	ret = append(ret, byte(len(ts.invocationScript)))
-	ret = append(ret, ts.invocationScript...)
-	ret = append(ret, byte(len(ts.verificationScript)))
-	ret = append(ret, ts.verificationScript...)
+	ret = append(ret, writeVarBytes(ts.invocationScript)...)
+	ret = append(ret, writeVarBytes(ts.verificationScript)...)
 	return ret, nil
 }
 
 func (ts *TxScript) String() string {
 	return fmt.Sprintf("{ invocationScript : %x, verificationScript : %x }", ts.invocationScript, ts.verificationScript)
 }
+
+// 构建合约见证人的调用脚本，参数按倒序压栈，执行验证脚本时第一个参数位于栈顶
+// params : 合约参数
+func BuildInvocationByParameters(params []ContractParameter) ([]byte, error) {
+	sb := NewScriptBuilder()
+	for i := len(params) - 1; i >= 0; i-- {
+		err := sb.EmitPushParameter(params[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sb.ToBytes(), nil
+}
+
+// 创建任意验证合约的见证人，用于花费合约地址上的UTXO
+// verification : 验证脚本
+// params : 调用参数
+func NewContractTxScript(verification []byte, params []ContractParameter) (*TxScript, error) {
+	if len(verification) == 0 {
+		return nil, errors.New("Verification script is empty!")
+	}
+	invocation, err := BuildInvocationByParameters(params)
+	if err != nil {
+		return nil, err
+	}
+	return &TxScript{
+		invocationScript:   invocation,
+		verificationScript: verification,
+	}, nil
+}
+
+// 是否为单签标准验证脚本
+func (ts TxScript) isStandardVerification() bool {
+	return IsStandardVerification(ts.verificationScript)
+}
+
+// 判断验证脚本是否为单签标准脚本 PushBytes33 + 公钥 + CheckSig
+func IsStandardVerification(script []byte) bool {
+	return len(script) == 35 && script[0] == OpPushBytes33 && script[34] == OpCheckSig
+}
+
+// 脚本中的一条指令
+// op : 操作码
+// data : 压栈数据，非压栈操作码为 nil，PUSH0、PUSHM1、PUSH1 到 PUSH16 为空数组
+// offset : 操作码在脚本中的位置
+type scriptOp struct {
+	op     byte
+	data   []byte
+	offset int
+}
+
+// 读取脚本中的指令，非压栈操作码跳过其操作数
+// script : 脚本
+// onlyPush : 为 true 时遇到非压栈操作码返回错误，用于解析调用脚本
+func readScriptOps(script []byte, onlyPush bool) ([]scriptOp, error) {
+	ret := make([]scriptOp, 0)
+	index := 0
+	for index < len(script) {
+		offset := index
+		op := script[index]
+		index++
+		var size int
+		switch {
+		case op >= OpPushBytes1 && op <= OpPushBytes75:
+			size = int(op)
+		case op == OpPushData1:
+			if index+1 > len(script) {
+				return nil, errors.New("Invalid script push data!")
+			}
+			size = int(script[index])
+			index++
+		case op == OpPushData2:
+			if index+2 > len(script) {
+				return nil, errors.New("Invalid script push data!")
+			}
+			size = int(littleEndianBytesToUint16(script[index : index+2]))
+			index += 2
+		case op == OpPushData4:
+			if index+4 > len(script) {
+				return nil, errors.New("Invalid script push data!")
+			}
+			size = int(littleEndianBytesToUint32(script[index : index+4]))
+			index += 4
+		case op == OpPush0 || op == OpPushM1 || (op >= OpPush1 && op <= OpPush16):
+			ret = append(ret, scriptOp{op: op, data: []byte{}, offset: offset})
+			continue
+		default:
+			if onlyPush {
+				return nil, errors.New("Invocation script contains non-push opcode!")
+			}
+			skip, err := getOperandSize(script, index, op)
+			if err != nil {
+				return nil, err
+			}
+			index += skip
+			ret = append(ret, scriptOp{op: op, offset: offset})
+			continue
+		}
+		if size < 0 || index+size > len(script) {
+			return nil, errors.New("Invalid script push data!")
+		}
+		ret = append(ret, scriptOp{op: op, data: script[index : index+size], offset: offset})
+		index += size
+	}
+	return ret, nil
+}
+
+// 读取脚本中压入的数据，跳过其它操作码及其操作数
+// script : 脚本
+// onlyPush : 为 true 时遇到非压栈操作码返回错误，用于解析调用脚本
+func readScriptPushes(script []byte, onlyPush bool) ([][]byte, error) {
+	ops, err := readScriptOps(script, onlyPush)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([][]byte, 0)
+	for _, o := range ops {
+		if o.data != nil {
+			ret = append(ret, o.data)
+		}
+	}
+	return ret, nil
+}
+
+// 获取非压栈操作码的操作数长度
+func getOperandSize(script []byte, index int, op byte) (int, error) {
+	switch op {
+	case OpJmp, OpJmpIf, OpJmpIfNot, OpCall, OpCallED, OpCallEDT:
+		return 2, nil
+	case OpAppCall, OpTailCall:
+		return 20, nil
+	case OpCallI:
+		return 4, nil
+	case OpCallE, OpCallET:
+		return 22, nil
+	case OpSysCall:
+		length, newIndex, err := readLength(script, index)
+		if err != nil {
+			return 0, errors.New("Invalid syscall in script!")
+		}
+		return newIndex - index + int(length), nil
+	}
+	return 0, nil
+}
+
+// 获取验证脚本需要的签名数量和脚本中的公钥
+// 每个 CHECKSIG 需要一个签名，CHECKMULTISIG 需要其前面 m 个公钥 n 结构中的 m 个签名
+// script : 验证脚本
+func getContractSignatureRequirement(script []byte) (int, [][]byte, error) {
+	ops, err := readScriptOps(script, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	required := 0
+	pubkeys := make([][]byte, 0)
+	for i, o := range ops {
+		switch o.op {
+		case OpPushBytes33:
+			if o.data[0] == 0x02 || o.data[0] == 0x03 {
+				pubkeys = append(pubkeys, o.data)
+			}
+		case OpCheckSig:
+			required++
+		case OpCheckMultiSig:
+			if i == 0 {
+				return 0, nil, errors.New("Invalid multisig in verification script!")
+			}
+			n, _, err := readScriptInteger(script, ops[i-1].offset)
+			if err != nil || i < n+2 {
+				return 0, nil, errors.New("Invalid multisig in verification script!")
+			}
+			m, _, err := readScriptInteger(script, ops[i-n-2].offset)
+			if err != nil || m < 1 || m > n {
+				return 0, nil, errors.New("Invalid multisig in verification script!")
+			}
+			required += m
+		}
+	}
+	return required, pubkeys, nil
+}
+
+// 验证合约见证人中的签名
+// 传入参数类型列表时只验证其中的签名参数，每个签名都必须对应验证脚本中一个不同的公钥
+// 没有参数类型列表时按验证脚本中 CHECKSIG、CHECKMULTISIG 需要的数量查找有效签名，其它参数不视为签名
+// 时间锁、哈希锁等其它验证条件需要链上执行验证脚本，这里不做检查，不需要签名的合约直接通过
+// hash : 签名哈希
+// paramTypes : 合约的参数类型列表，可为 nil
+func (ts TxScript) verifyContractSignatures(hash []byte, paramTypes []ContractParameterType) bool {
+	pushes, err := readScriptPushes(ts.invocationScript, true)
+	if err != nil {
+		return false
+	}
+	required, pubkeys, err := getContractSignatureRequirement(ts.verificationScript)
+	if err != nil {
+		return false
+	}
+
+	// 调用脚本倒序压栈，最后压入的是第一个参数
+	params := make([][]byte, len(pushes))
+	for i, p := range pushes {
+		params[len(pushes)-1-i] = p
+	}
+
+	strict := paramTypes != nil
+	if strict && len(paramTypes) != len(params) {
+		return false
+	}
+
+	used := make(map[int]bool)
+	for i, sig := range params {
+		if strict && paramTypes[i] != ParamSignature {
+			continue
+		}
+		if len(sig) != 64 {
+			if strict {
+				return false
+			}
+			continue
+		}
+		matched := false
+		for j, pub := range pubkeys {
+			if used[j] {
+				continue
+			}
+			pubkey := owcrypt.PointDecompress(pub, owcrypt.ECC_CURVE_SECP256R1)[1:]
+			if owcrypt.Verify(pubkey, nil, 0, hash, 32, sig, owcrypt.ECC_CURVE_SECP256R1) == owcrypt.SUCCESS {
+				used[j] = true
+				matched = true
+				break
+			}
+		}
+		if !matched && strict {
+			return false
+		}
+	}
+	return len(used) >= required
+}
@@ -1,26 +1,31 @@
 package neoTransaction
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
 )
 
 type Transaction struct {
 	/*
 		type	uint8	交易类型
 		version	uint8	兼容版本
+		exclusive	bytes	交易类型专用数据
 		attributes	array	交易其他属性
 		outputs	array	资产的接收地址
 		inputs	array	交易的资产输入
 		scripts	array	用于验证交易的脚本
 	*/
 
-	Type       byte
-	Version    byte
-	Attributes []TxAttribute
-	Vouts      []TxOut
-	Vins       []TxIn
-	Scripts    []TxScript
+	Type          byte
+	Version       byte
+	ExclusiveData []byte
+	Attributes    []TxAttribute
+	Vouts         []TxOut
+	Vins          []TxIn
+	Scripts       []TxScript
 }
 
 // 创建空交易
@@ -30,6 +35,15 @@ type Transaction struct {
 // attributes : 交易附加信息
 func newEmptyTransaction(txType TransactionType, vins []Vin, vouts []Vout, attributes []Attribute) (*Transaction, error) {
 	txtype := txType.hexValue
+	if txtype == ContractTransaction.hexValue {
+		if len(vins) == 0 {
+			return nil, errors.New("No input found when create an empty transaction!")
+		}
+		if len(vouts) == 0 {
+			return nil, errors.New("No address to send when create an empty transaction!")
+		}
+	}
+
 	txIn, err := newTxInForEmptyTrans(vins)
 	if err != nil {
 		return nil, err
@@ -45,16 +59,21 @@ func newEmptyTransaction(txType TransactionType, vins []Vin, vouts []Vout, attri
 		return nil, err
 	}
 
-	version := byte(DefaultTxVersion)
-
-	return &Transaction{txtype, version, txAttributes, txOut, txIn, nil}, nil
+	return &Transaction{
+		Type:       txtype,
+		Version:    txType.version,
+		Attributes: txAttributes,
+		Vouts:      txOut,
+		Vins:       txIn,
+	}, nil
 }
 
 // 交易序列化组装
 func (t Transaction) encodeToBytes() (ret []byte, err error) {
 	ret = append(ret, t.Type)
 	ret = append(ret, t.Version)
-	ret = append(ret, byte(len(t.Attributes)))
+	ret = append(ret, t.ExclusiveData...)
+	ret = append(ret, writeVarBytesLength(len(t.Attributes))...)
 	for _, attr := range t.Attributes {
 		attrBytes, err := attr.toBytes()
 		if err != nil {
@@ -63,7 +82,7 @@ func (t Transaction) encodeToBytes() (ret []byte, err error) {
 		ret = append(ret, attrBytes...)
 	}
 
-	ret = append(ret, byte(len(t.Vins)))
+	ret = append(ret, writeVarBytesLength(len(t.Vins))...)
 	for _, vin := range t.Vins {
 		inBytes, err := vin.toBytes()
 		if err != nil {
@@ -72,7 +91,7 @@ func (t Transaction) encodeToBytes() (ret []byte, err error) {
 		ret = append(ret, inBytes...)
 	}
 
-	ret = append(ret, byte(len(t.Vouts)))
+	ret = append(ret, writeVarBytesLength(len(t.Vouts))...)
 	for _, vout := range t.Vouts {
 		outBytes, err := vout.toBytes()
 		if err != nil {
@@ -85,7 +104,7 @@ func (t Transaction) encodeToBytes() (ret []byte, err error) {
 		return ret, nil
 	}
 
-	ret = append(ret, byte(len(t.Scripts)))
+	ret = append(ret, writeVarBytesLength(len(t.Scripts))...)
 	for _, script := range t.Scripts {
 		scriptBytes, err := script.toBytes()
 		if err != nil {
@@ -105,60 +124,270 @@ func DecodeRawTransaction(txBytes []byte) (*Transaction, error) {
 		return nil, errors.New("Invalid transaction data!")
 	}
 
-	var rawTx Transaction
+	if 4 > limit {
+		return nil, errors.New("Invalid transaction data length!")
+	}
 
-	index := 0
+	rawTx, index, err := decodeTransactionBody(txBytes, 0)
+	if err != nil {
+		return nil, err
+	}
 
-	if index+4 > limit {
-		return nil, errors.New("Invalid transaction data length!")
+	if index == limit {
+		fmt.Println(rawTx.String())
+		return rawTx, nil
+	}
+	scrips, _, err := decodeTxScriptVerificationFromRawTrans(txBytes, index)
+	if err != nil {
+		return nil, err
 	}
+	rawTx.Scripts = scrips
 
-	if index > limit {
-		return nil, errors.New("Invalid transaction data length!")
+	return rawTx, nil
+}
+
+// 反序列化区块中的交易，交易必须带见证人，返回交易之后数据的索引
+// data : 区块序列化数据
+// index : 交易在数据中的索引
+func DecodeBlockTransaction(data []byte, index int) (*Transaction, int, error) {
+	rawTx, index, err := decodeTransactionBody(data, index)
+	if err != nil {
+		return nil, index, err
+	}
+	scripts, index, err := decodeTxScriptVerificationFromRawTrans(data, index)
+	if err != nil {
+		return nil, index, err
 	}
+	rawTx.Scripts = scripts
+	return rawTx, index, nil
+}
 
-	rawTx.Type = txBytes[index]
-	index++
+// 反序列化交易见证人之前的部分
+// txBytes : 序列化数据
+// index : 交易在数据中的索引
+func decodeTransactionBody(txBytes []byte, index int) (*Transaction, int, error) {
+	limit := len(txBytes)
 
-	if index > limit {
-		return nil, errors.New("Invalid transaction data length!")
+	var rawTx Transaction
+
+	if index+2 > limit {
+		return nil, index, errors.New("Invalid transaction data length!")
 	}
 
+	rawTx.Type = txBytes[index]
+	index++
+
 	rawTx.Version = txBytes[index]
 	index++
 
+	exclusive, newIndex, err := decodeExclusiveDataFromRawTrans(rawTx.Type, rawTx.Version, txBytes, index)
+	if err != nil {
+		return nil, index, err
+	}
+	index = newIndex
+	rawTx.ExclusiveData = exclusive
+
 	attrs, newIndex, err := decodeTxAttributeFromRawTrans(txBytes, index)
 	if err != nil {
-		return nil, err
+		return nil, index, err
 	}
 	index = newIndex
 	rawTx.Attributes = attrs
 
 	vins, newIndex, err := decodeTxInFromRawTrans(txBytes, index)
 	if err != nil {
-		return nil, err
+		return nil, index, err
 	}
 	index = newIndex
 	rawTx.Vins = vins
 
 	vouts, newIndex, err := decodeTxOutFromRawTrans(txBytes, index)
 	if err != nil {
-		return nil, err
+		return nil, index, err
 	}
 	index = newIndex
 	rawTx.Vouts = vouts
 
-	if index == limit {
-		fmt.Println(rawTx.String())
-		return &rawTx, nil
-	}
-	scrips, newIndex, err := decodeTxScriptVerificationFromRawTrans(txBytes, index)
+	return &rawTx, index, nil
+}
+
+// 计算交易哈希，即交易ID，大端序十六进制，不带0x
+func (t Transaction) GetHash() (string, error) {
+	emptyTrans := t.cloneEmpty()
+	emptyTransBytes, err := emptyTrans.encodeToBytes()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	rawTx.Scripts = scrips
+	hash := owcrypt.Hash(emptyTransBytes, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)
+	return reverseBytesToHex(hash), nil
+}
 
-	return &rawTx, nil
+// 获取交易类型名称，与节点 RPC 返回的 type 一致
+func (t Transaction) GetTypeName() string {
+	for _, txType := range transactionTypes {
+		if txType.hexValue == t.Type {
+			return txType.jsonValue
+		}
+	}
+	return fmt.Sprintf("0x%02x", t.Type)
+}
+
+// 反序列化交易类型专用数据
+// txType : 交易类型
+// version : 交易版本
+// txBytes : 交易序列化数组
+// index : 对应在序列化数组中的索引
+func decodeExclusiveDataFromRawTrans(txType, version byte, txBytes []byte, index int) ([]byte, int, error) {
+	start := index
+	switch txType {
+	case InvocationTransaction.hexValue:
+		_, newIndex, err := readVarBytes(txBytes, index)
+		if err != nil {
+			return nil, index, errors.New("Invalid invocation transaction script!")
+		}
+		index = newIndex
+		if version >= 1 {
+			if index+8 > len(txBytes) {
+				return nil, index, errors.New("Invalid invocation transaction gas!")
+			}
+			index += 8
+		}
+	case StateTransaction.hexValue:
+		_, newIndex, err := decodeTxStateDescriptorFromRawTrans(txBytes, index)
+		if err != nil {
+			return nil, index, err
+		}
+		index = newIndex
+	case RegisterTransaction.hexValue:
+		_, newIndex, err := decodeAssetFromRawTrans(txBytes, index)
+		if err != nil {
+			return nil, index, err
+		}
+		index = newIndex
+	case ClaimTransaction.hexValue:
+		// 提取项与交易输入的序列化格式相同
+		_, newIndex, err := decodeTxInFromRawTrans(txBytes, index)
+		if err != nil {
+			return nil, index, errors.New("Invalid claim transaction claims!")
+		}
+		index = newIndex
+	case MinerTransaction.hexValue:
+		// 4字节 nonce
+		if index+4 > len(txBytes) {
+			return nil, index, errors.New("Invalid miner transaction nonce!")
+		}
+		index += 4
+	case EnrollmentTransaction.hexValue:
+		// 压缩公钥，无穷远点只有1字节
+		if index+1 > len(txBytes) {
+			return nil, index, errors.New("Invalid enrollment transaction public key!")
+		}
+		if txBytes[index] != 0x00 {
+			if index+PublicKeySize > len(txBytes) {
+				return nil, index, errors.New("Invalid enrollment transaction public key!")
+			}
+			index += PublicKeySize
+		} else {
+			index++
+		}
+	case PublishTransaction.hexValue:
+		newIndex, err := skipPublishTransactionData(txBytes, index, version)
+		if err != nil {
+			return nil, index, errors.New("Invalid publish transaction data!")
+		}
+		index = newIndex
+	}
+	return txBytes[start:index], index, nil
+}
+
+// 跳过发布合约交易的专用数据 = 脚本 + 参数列表 + 返回类型 + [存储标记] + 名称 + 版本 + 作者 + 邮箱 + 描述
+func skipPublishTransactionData(txBytes []byte, index int, version byte) (int, error) {
+	for i := 0; i < 2; i++ {
+		_, newIndex, err := readVarBytes(txBytes, index)
+		if err != nil {
+			return index, err
+		}
+		index = newIndex
+	}
+	size := 1
+	if version >= 1 {
+		size++
+	}
+	if index+size > len(txBytes) {
+		return index, errors.New("Invalid publish transaction data length!")
+	}
+	index += size
+	for i := 0; i < 5; i++ {
+		_, newIndex, err := readVarBytes(txBytes, index)
+		if err != nil {
+			return index, err
+		}
+		index = newIndex
+	}
+	return index, nil
+}
+
+// 获取见证人需要覆盖的脚本哈希（Script 附加信息中声明的签名者）
+func (t Transaction) getAttributeScriptHashes() [][]byte {
+	hashes := make([][]byte, 0)
+	for _, attr := range t.Attributes {
+		if hash, ok := attr.GetScriptHash(); ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// 获取交易专用数据中声明的签名者
+// 状态交易为状态描述对应的账户，注册资产交易为资产所有者
+func (t Transaction) getExclusiveScriptHashes() ([][]byte, error) {
+	hashes := make([][]byte, 0)
+	switch t.Type {
+	case StateTransaction.hexValue:
+		descriptors, _, err := decodeTxStateDescriptorFromRawTrans(t.ExclusiveData, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range descriptors {
+			hash, err := d.getScriptHash()
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+	case RegisterTransaction.hexValue:
+		owner, _, err := decodeAssetFromRawTrans(t.ExclusiveData, 0)
+		if err != nil {
+			return nil, err
+		}
+		verification, err := BuildVerification(hex.EncodeToString(owner))
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, GetScriptHash(verification))
+	}
+	return hashes, nil
+}
+
+// 检查附加信息和交易专用数据中声明的签名者是否都有对应的见证人
+func (t Transaction) checkDeclaredWitnesses() error {
+	exclusiveHashes, err := t.getExclusiveScriptHashes()
+	if err != nil {
+		return err
+	}
+	for _, hash := range append(t.getAttributeScriptHashes(), exclusiveHashes...) {
+		found := false
+		for _, script := range t.Scripts {
+			if byteArrayCompare(script.GetScriptHash(), hash) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("No witness found for script hash %x!", hash))
+		}
+	}
+	return nil
 }
 
 // 复制空交易单
@@ -166,6 +395,7 @@ func (t Transaction) cloneEmpty() Transaction {
 	var ret Transaction
 	ret.Type = t.Type
 	ret.Version = t.Version
+	ret.ExclusiveData = append(ret.ExclusiveData, t.ExclusiveData...)
 	ret.Attributes = append(ret.Attributes, t.Attributes...)
 	ret.Vouts = append(ret.Vouts, t.Vouts...)
 	ret.Vins = append(ret.Vins, t.Vins...)
@@ -173,8 +403,8 @@ func (t Transaction) cloneEmpty() Transaction {
 }
 
 func (t *Transaction) String() string {
-	fmtStr := "{ Transaction : { Type : %x, version : %x, "
-	fmtParams := []interface{}{t.Type, t.Version}
+	fmtStr := "{ Transaction : { Type : %x, version : %x, exclusive : %x, "
+	fmtParams := []interface{}{t.Type, t.Version, t.ExclusiveData}
 
 	fmtStr += "Attribute : ["
 	for _, v := range t.Attributes {
@@ -157,6 +157,8 @@ func fixedDataLen(src []byte, length int) []byte {
 	}
 }
 
+// 序列化变长整数
+// v : 长度值
 func writeLength(v int64) (ret []byte, err error) {
 	if v < 0 {
 		return ret, errors.New("Length is error")
@@ -165,17 +167,72 @@ func writeLength(v int64) (ret []byte, err error) {
 		ret = append(ret, byte(v))
 	} else if v <= 0xFFFF {
 		ret = append(ret, byte(0xFD))
-		ret = append(ret, byte(v))
+		ret = append(ret, uint16ToLittleEndianBytes(uint16(v))...)
 	} else if v <= 0xFFFFFFFF {
 		ret = append(ret, byte(0xFE))
-		ret = append(ret, byte(v))
+		ret = append(ret, uint32ToLittleEndianBytes(uint32(v))...)
 	} else {
 		ret = append(ret, byte(0xFF))
-		ret = append(ret, byte(v))
+		ret = append(ret, uint64ToLittleEndianBytes(uint64(v))...)
 	}
 	return ret, nil
 }
 
+// 反序列化变长整数
+// txBytes : 序列化数组
+// index : 对应在序列化数组中的索引
+func readLength(txBytes []byte, index int) (uint64, int, error) {
+	if index+1 > len(txBytes) {
+		return 0, index, errors.New("Invalid var int length!")
+	}
+	prefix := txBytes[index]
+	index++
+	size := 0
+	switch prefix {
+	case 0xFD:
+		size = 2
+	case 0xFE:
+		size = 4
+	case 0xFF:
+		size = 8
+	default:
+		return uint64(prefix), index, nil
+	}
+	if index+size > len(txBytes) {
+		return 0, index, errors.New("Invalid var int length!")
+	}
+	var v uint64
+	switch size {
+	case 2:
+		v = uint64(littleEndianBytesToUint16(txBytes[index : index+2]))
+	case 4:
+		v = uint64(littleEndianBytesToUint32(txBytes[index : index+4]))
+	default:
+		v = littleEndianBytesToUint64(txBytes[index : index+8])
+	}
+	return v, index + size, nil
+}
+
+// 序列化变长字节数组 = 长度 + 数据
+func writeVarBytes(data []byte) []byte {
+	ret, _ := writeLength(int64(len(data)))
+	return append(ret, data...)
+}
+
+// 反序列化变长字节数组
+// txBytes : 序列化数组
+// index : 对应在序列化数组中的索引
+func readVarBytes(txBytes []byte, index int) ([]byte, int, error) {
+	length, index, err := readLength(txBytes, index)
+	if err != nil {
+		return nil, index, err
+	}
+	if uint64(index)+length > uint64(len(txBytes)) {
+		return nil, index, errors.New("Invalid var bytes length!")
+	}
+	return txBytes[index : index+int(length)], index + int(length), nil
+}
+
 func getAttributeTypeByUsage(usage byte) *AttributeType {
 	switch usage {
 	case AttrContractHash.value:
@@ -257,3 +314,9 @@ func getAttributeTypeByUsage(usage byte) *AttributeType {
 	}
 	return nil
 }
+
+// 序列化数组元素个数
+func writeVarBytesLength(count int) []byte {
+	ret, _ := writeLength(int64(count))
+	return ret
+}
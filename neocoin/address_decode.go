@@ -16,6 +16,10 @@
 package neocoin
 
 import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/blocktree/go-owcdrivers/addressEncoder"
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/openwallet"
@@ -24,14 +28,28 @@ import (
 type AddressDecoder interface {
 	openwallet.AddressDecoder
 	ScriptPubKeyToBech32Address(scriptPubKey []byte) (string, error)
+	ScriptToAddress(script []byte) (string, error)
+	PrivateKeyToNEP2(priv []byte, passphrase string) (string, error)
+	NEP2ToPrivateKey(nep2, passphrase string) ([]byte, error)
+	AddressVerify(address string) bool
+	AddressToScriptHash(address string, bigEndian bool) (string, error)
+	ScriptHashToAddress(scriptHash string, bigEndian bool) (string, error)
+	ScriptToScriptHash(script []byte, bigEndian bool) string
+	AddressScriptType(address string, verification []byte) (string, error)
+	VerifyMessage(address, message, salt, publicKey, signature string) (bool, error)
 }
 
 type addressDecoder struct {
 	wm *WalletManager //钱包管理者
 }
 
+//RedeemScriptToAddress 多签公钥转地址
 func (decoder *addressDecoder) RedeemScriptToAddress(pubs [][]byte, required uint64, isTestnet bool) (string, error) {
-	panic("implement me")
+	verification, err := neoTransaction.BuildMultiSigVerification(int(required), pubs)
+	if err != nil {
+		return "", err
+	}
+	return decoder.ScriptToAddress(verification)
 }
 
 func (decoder *addressDecoder) ScriptPubKeyToBech32Address(scriptPubKey []byte) (string, error) {
@@ -74,6 +92,32 @@ func (decoder *addressDecoder) PublicKeyToAddress(pub []byte, isTestnet bool) (s
 
 }
 
+//ScriptToAddress 验证脚本转地址
+func (decoder *addressDecoder) ScriptToAddress(script []byte) (string, error) {
+	cfg := NEO_mainnetAddressP2PKH
+	if decoder.wm.Config.IsTestNet {
+		cfg = NEO_testnetAddressP2PKH
+	}
+
+	if len(script) == 0 {
+		return "", fmt.Errorf("verification script is empty")
+	}
+
+	scriptHash := neoTransaction.Hash160(script)
+
+	return addressEncoder.AddressEncode(scriptHash, cfg), nil
+}
+
+//PrivateKeyToNEP2 私钥转NEP-2加密私钥
+func (decoder *addressDecoder) PrivateKeyToNEP2(priv []byte, passphrase string) (string, error) {
+	return neoTransaction.NEP2Encrypt(priv, passphrase, decoder.wm.Config.NEP2Scrypt)
+}
+
+//NEP2ToPrivateKey NEP-2加密私钥转私钥
+func (decoder *addressDecoder) NEP2ToPrivateKey(nep2, passphrase string) ([]byte, error) {
+	return neoTransaction.NEP2Decrypt(nep2, passphrase, decoder.wm.Config.NEP2Scrypt)
+}
+
 //WIFToPrivateKey WIF转私钥
 func (decoder *addressDecoder) WIFToPrivateKey(wif string, isTestnet bool) ([]byte, error) {
 
@@ -90,3 +134,89 @@ func (decoder *addressDecoder) WIFToPrivateKey(wif string, isTestnet bool) ([]by
 	return priv, err
 
 }
+
+//AddressVerify 校验地址的base58check校验和及版本号
+func (decoder *addressDecoder) AddressVerify(address string) bool {
+	_, err := decoder.decodeAddress(address)
+	return err == nil
+}
+
+//AddressToScriptHash 地址转脚本哈希，bigEndian为true时返回带0x前缀的大端序，否则返回小端序
+func (decoder *addressDecoder) AddressToScriptHash(address string, bigEndian bool) (string, error) {
+	scriptHash, err := decoder.decodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return neoTransaction.ScriptHashToHex(scriptHash, bigEndian), nil
+}
+
+//ScriptHashToAddress 脚本哈希转地址，bigEndian为true时输入为大端序，允许带0x前缀
+func (decoder *addressDecoder) ScriptHashToAddress(scriptHash string, bigEndian bool) (string, error) {
+	hash, err := neoTransaction.ScriptHashFromHex(scriptHash, bigEndian)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrAdressEncodeFailed, "invalid script hash: %s", scriptHash)
+	}
+	return neoTransaction.ScriptHashToAddress(hash, decoder.addressVersion())
+}
+
+//ScriptToScriptHash 任意验证脚本转脚本哈希
+func (decoder *addressDecoder) ScriptToScriptHash(script []byte, bigEndian bool) string {
+	return neoTransaction.ScriptHashToHex(neoTransaction.GetScriptHash(script), bigEndian)
+}
+
+//AddressScriptType 根据验证脚本判断地址类型，单签地址为standard，多签为multisig，其它为contract
+//验证脚本的哈希必须与地址一致
+func (decoder *addressDecoder) AddressScriptType(address string, verification []byte) (string, error) {
+	scriptHash, err := decoder.decodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	if len(verification) == 0 || hex.EncodeToString(neoTransaction.GetScriptHash(verification)) != hex.EncodeToString(scriptHash) {
+		return "", openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "verification script does not match address[%s]", address)
+	}
+	return neoTransaction.GetVerificationType(verification), nil
+}
+
+//VerifyMessage 校验消息签名，公钥必须对应地址，签名格式与NEO钱包的signMessage一致
+// address : 签名者地址
+// message : 消息原文
+// salt : 签名时使用的盐，未加盐时为空
+// publicKey : 签名者压缩公钥，十六进制
+// signature : 签名，十六进制
+func (decoder *addressDecoder) VerifyMessage(address, message, salt, publicKey, signature string) (bool, error) {
+	_, err := decoder.decodeAddress(address)
+	if err != nil {
+		return false, err
+	}
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil || len(pub) != neoTransaction.PublicKeySize {
+		return false, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid public key[%s]", publicKey)
+	}
+	pubAddress, err := decoder.PublicKeyToAddress(pub, decoder.wm.Config.IsTestNet)
+	if err != nil || pubAddress != address {
+		return false, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "public key does not match address[%s]", address)
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != 64 {
+		return false, fmt.Errorf("invalid signature")
+	}
+	return neoTransaction.VerifyMessage(message, salt, pub, sig), nil
+}
+
+//decodeAddress 解析地址为小端序脚本哈希
+func (decoder *addressDecoder) decodeAddress(address string) ([]byte, error) {
+	scriptHash, err := neoTransaction.AddressToScriptHash(address, decoder.addressVersion())
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid address[%s]: %v", address, err)
+	}
+	return scriptHash, nil
+}
+
+//addressVersion 地址版本号
+func (decoder *addressDecoder) addressVersion() byte {
+	cfg := NEO_mainnetAddressP2PKH
+	if decoder.wm.Config.IsTestNet {
+		cfg = NEO_testnetAddressP2PKH
+	}
+	return cfg.Prefix[0]
+}
@@ -18,7 +18,9 @@ package neocoin
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"github.com/blocktree/openwallet/hdkeystore"
 	"testing"
 )
 
@@ -121,3 +123,135 @@ func TestAddressDecoder_WIFToPrivateKey(t *testing.T) {
 	}
 	fmt.Println(fmt.Sprintf("Private key : %s", hex.EncodeToString(privKeyBytes)))
 }
+
+// 测试NEP-2加密私钥
+func TestAddressDecoder_NEP2(t *testing.T) {
+	ad := initAddressDecode()
+	privKeyBytes, _ := hex.DecodeString("cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5")
+	nep2Expect := "6PYVPVe1fQznphjbUxXP9KZJqPMVnVwCx5s5pr5axRJ8uHkMtZg97eT5kL"
+
+	nep2, err := ad.PrivateKeyToNEP2(privKeyBytes, "TestingOneTwoThree")
+	if err != nil {
+		t.Errorf("Private key to NEP-2 error : %s", err.Error())
+		return
+	}
+	if nep2 != nep2Expect {
+		t.Errorf("NEP-2 not be expected outcome : %s", nep2)
+	}
+
+	priv, err := ad.NEP2ToPrivateKey(nep2Expect, "TestingOneTwoThree")
+	if err != nil {
+		t.Errorf("NEP-2 to private key error : %s", err.Error())
+		return
+	}
+	if hex.EncodeToString(priv) != hex.EncodeToString(privKeyBytes) {
+		t.Error("NEP-2 to private key not be expected outcome!")
+	}
+}
+
+// 测试导入私钥地址的加解密
+func TestImportedKeyAddress(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.NEP2Scrypt = neoTransaction.ScryptParams{N: 256, R: 1, P: 1}
+
+	key, err := hdkeystore.NewHDKey([]byte("0123456789abcdef0123456789abcdef"), "test", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privKeyBytes, _ := hex.DecodeString("cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5")
+	addr, err := wm.newImportedKeyAddress(key, "acc", privKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Address != "AStZHy8E6StCqYQbzMqi4poH7YNDHQKxvt" || !isImportedKeyAddress(addr) {
+		t.Errorf("imported address wrong : %+v", addr)
+	}
+
+	priv, err := getImportedPrivateKey(key, addr)
+	if err != nil || hex.EncodeToString(priv) != hex.EncodeToString(privKeyBytes) {
+		t.Errorf("imported private key decrypt failed : %v", err)
+	}
+
+	nep2, err := wm.ExportNEP2Key(key, addr, "TestingOneTwoThree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err = wm.Decoder.NEP2ToPrivateKey(nep2, "TestingOneTwoThree")
+	if err != nil || hex.EncodeToString(priv) != hex.EncodeToString(privKeyBytes) {
+		t.Errorf("export NEP-2 failed : %v", err)
+	}
+}
+
+// 测试地址校验及脚本哈希转换
+func TestAddressDecoder_ScriptHash(t *testing.T) {
+	decoder := initAddressDecode()
+
+	address := "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC"
+	little := "accc9eba9934271301effd425f88d4d0e1d1ac6e"
+	big := "0x6eacd1e1d0d4885f42fdef0113273499ba9eccac"
+
+	if !decoder.AddressVerify(address) {
+		t.Errorf("valid address rejected")
+	}
+	for _, invalid := range []string{"", "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHD", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmu", "0OIl"} {
+		if decoder.AddressVerify(invalid) {
+			t.Errorf("invalid address accepted: %s", invalid)
+		}
+	}
+
+	hash, err := decoder.AddressToScriptHash(address, false)
+	if err != nil || hash != little {
+		t.Errorf("address to little endian script hash wrong: %s, %v", hash, err)
+	}
+	hash, err = decoder.AddressToScriptHash(address, true)
+	if err != nil || hash != big {
+		t.Errorf("address to big endian script hash wrong: %s, %v", hash, err)
+	}
+
+	addr, err := decoder.ScriptHashToAddress(little, false)
+	if err != nil || addr != address {
+		t.Errorf("little endian script hash to address wrong: %s, %v", addr, err)
+	}
+	addr, err = decoder.ScriptHashToAddress(big, true)
+	if err != nil || addr != address {
+		t.Errorf("big endian script hash to address wrong: %s, %v", addr, err)
+	}
+	if _, err := decoder.ScriptHashToAddress("0x1234", true); err == nil {
+		t.Errorf("invalid script hash accepted")
+	}
+
+	// 单签地址
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	sigPub, _ := neoTransaction.SignRawTransaction("00", privKey)
+	verification, _ := neoTransaction.BuildVerification(hex.EncodeToString(sigPub.Pubkey))
+	if standardAddress, _ := decoder.ScriptToAddress(verification); standardAddress != "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA" {
+		t.Errorf("standard verification to address wrong: %s", standardAddress)
+	}
+	scriptType, err := decoder.AddressScriptType("ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", verification)
+	if err != nil || scriptType != neoTransaction.VerificationStandard {
+		t.Errorf("standard address type wrong: %s, %v", scriptType, err)
+	}
+	if _, err := decoder.AddressScriptType(address, verification); err == nil {
+		t.Errorf("verification script of other address accepted")
+	}
+
+	// 多签地址
+	multiSig, _ := neoTransaction.BuildMultiSigVerification(1, [][]byte{sigPub.Pubkey})
+	multiSigAddress, _ := decoder.ScriptToAddress(multiSig)
+	scriptType, err = decoder.AddressScriptType(multiSigAddress, multiSig)
+	if err != nil || scriptType != neoTransaction.VerificationMultiSig {
+		t.Errorf("multisig address type wrong: %s, %v", scriptType, err)
+	}
+	if decoder.ScriptToScriptHash(multiSig, false) != hex.EncodeToString(neoTransaction.GetScriptHash(multiSig)) {
+		t.Errorf("script hash of verification wrong")
+	}
+
+	// 其它合约地址
+	contract := append([]byte{0x55, 0x9d}, verification...)
+	contractAddress, _ := decoder.ScriptToAddress(contract)
+	scriptType, err = decoder.AddressScriptType(contractAddress, contract)
+	if err != nil || scriptType != neoTransaction.VerificationContract {
+		t.Errorf("contract address type wrong: %s, %v", scriptType, err)
+	}
+}
@@ -0,0 +1,413 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	addressPoolBucket = "addressPool"
+
+	PoolAddressUnused    = "unused"    //已预派生，未分配
+	PoolAddressHandedOut = "handedOut" //已分配，未收款
+	PoolAddressFunded    = "funded"    //已收款
+)
+
+//PoolAddress 地址池中的地址记录，保存在钱包数据库
+type PoolAddress struct {
+	Address     string `json:"address" storm:"id"`
+	AccountID   string `json:"accountID" storm:"index"`
+	Index       uint64 `json:"index"`
+	Status      string `json:"status"`
+	HandedOutAt int64  `json:"handedOutAt"` //分配时间
+	FundedAt    uint64 `json:"fundedAt"`    //首次收款的区块高度
+}
+
+//AddressPool 账户的收款地址池
+//地址通过BIP44收款链 m/44'/888'/account'/0 的扩展公钥派生，补充地址不需要钱包密码
+//派生范围受间隔限制约束：最后一个已收款地址之后最多派生 gapLimit 个地址，恢复钱包时扫描这个范围即可找回全部地址
+type AddressPool struct {
+	wm         *WalletManager
+	wallet     *openwallet.Wallet
+	chain      *HDNode //收款链扩展公钥
+	chainPath  string  //收款链路径
+	size       uint64  //预派生的未分配地址数
+	gapLimit   uint64  //间隔限制
+	startIndex uint64  //地址池的起始索引，之前的地址由批量创建分配
+
+	mu        sync.Mutex
+	addresses map[string]*PoolAddress
+	nextIndex uint64
+	replenish chan struct{}
+	quit      chan struct{}
+}
+
+//OpenAddressPool 打开钱包的收款地址池，启动后台补充
+//普通钱包需要使用BIP44派生，用密码派生账户扩展公钥后不再保留私钥；观察钱包直接使用扩展公钥
+// walletID : 钱包ID
+// password : 钱包密码，观察钱包为空
+func (wm *WalletManager) OpenAddressPool(walletID, password string) (*AddressPool, error) {
+
+	wm.addressPoolsLock.Lock()
+	defer wm.addressPoolsLock.Unlock()
+
+	if pool, ok := wm.AddressPools[walletID]; ok {
+		return pool, nil
+	}
+
+	w, err := wm.GetWalletInfo(walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		chain     *HDNode
+		chainPath string
+	)
+	if w.WatchOnly {
+		chain, chainPath, err = wm.watchOnlyChain(w, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if wm.Config.HDDerivation != HDDerivationBIP44 {
+			return nil, fmt.Errorf("address pool requires bip44 derivation")
+		}
+		key, err := w.HDKey(password)
+		if err != nil {
+			return nil, err
+		}
+		xpub, err := wm.ExportAccountPublicKey(key, wm.Config.BIP44Account)
+		if err != nil {
+			return nil, err
+		}
+		account, err := NewHDNodeFromString(xpub)
+		if err != nil {
+			return nil, err
+		}
+		chain, err = account.Child(0)
+		if err != nil {
+			return nil, err
+		}
+		chainPath = BIP44ChainPath(wm.Config.BIP44Account, false)
+	}
+
+	pool := &AddressPool{
+		wm:        wm,
+		wallet:    w,
+		chain:     chain,
+		chainPath: chainPath,
+		size:      wm.Config.AddressPoolSize,
+		gapLimit:  wm.Config.AddressGapLimit,
+		addresses: make(map[string]*PoolAddress),
+		replenish: make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+	}
+
+	err = pool.load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = pool.Replenish()
+	if err != nil {
+		return nil, err
+	}
+
+	go pool.run()
+
+	wm.AddressPools[walletID] = pool
+	return pool, nil
+}
+
+//CloseAddressPool 关闭钱包的收款地址池，停止后台补充
+func (wm *WalletManager) CloseAddressPool(walletID string) {
+	wm.addressPoolsLock.Lock()
+	defer wm.addressPoolsLock.Unlock()
+
+	if pool, ok := wm.AddressPools[walletID]; ok {
+		close(pool.quit)
+		delete(wm.AddressPools, walletID)
+	}
+}
+
+//markPoolAddressFunded 扫描器发现地址收款后更新地址池状态
+func (wm *WalletManager) markPoolAddressFunded(address string, height uint64) {
+	wm.addressPoolsLock.RLock()
+	defer wm.addressPoolsLock.RUnlock()
+
+	for _, pool := range wm.AddressPools {
+		if pool.MarkFunded(address, height) {
+			return
+		}
+	}
+}
+
+//load 从钱包数据库加载地址池记录，新地址池从收款链的下一个索引开始
+func (p *AddressPool) load() error {
+	db, err := p.wallet.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var list []*PoolAddress
+	err = db.From(addressPoolBucket).Find("AccountID", p.wallet.WalletID, &list)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	p.startIndex = p.wm.nextAddressIndex(p.wallet, p.chainPath)
+	p.nextIndex = p.startIndex
+	for i, a := range list {
+		p.addresses[a.Address] = list[i]
+		if i == 0 || a.Index < p.startIndex {
+			p.startIndex = a.Index
+		}
+		if a.Index+1 > p.nextIndex {
+			p.nextIndex = a.Index + 1
+		}
+	}
+
+	return nil
+}
+
+//run 后台补充地址
+func (p *AddressPool) run() {
+	for {
+		select {
+		case <-p.replenish:
+			err := p.Replenish()
+			if err != nil {
+				p.wm.Log.Std.Warning("wallet[%s] replenish address pool failed, unexpected error: %v", p.wallet.WalletID, err)
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+//notifyReplenish 通知后台补充地址，不阻塞
+func (p *AddressPool) notifyReplenish() {
+	select {
+	case p.replenish <- struct{}{}:
+	default:
+	}
+}
+
+//gapIndex 间隔限制内允许派生的最大索引（不含）
+func (p *AddressPool) gapIndex() uint64 {
+	limit := p.startIndex + p.gapLimit
+	for _, a := range p.addresses {
+		if a.Status == PoolAddressFunded && a.Index+1+p.gapLimit > limit {
+			limit = a.Index + 1 + p.gapLimit
+		}
+	}
+	return limit
+}
+
+//Replenish 补充未分配地址到地址池大小，不超过间隔限制
+func (p *AddressPool) Replenish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	unused := uint64(0)
+	for _, a := range p.addresses {
+		if a.Status == PoolAddressUnused {
+			unused++
+		}
+	}
+
+	limit := p.gapIndex()
+	newAddrs := make([]*openwallet.Address, 0)
+	newRecords := make([]*PoolAddress, 0)
+	for index := p.nextIndex; unused < p.size && index < limit; index++ {
+		addr, err := p.wm.CreateWatchOnlyAddress(p.wallet.WalletID, p.chain, p.chainPath, index)
+		if err != nil {
+			return err
+		}
+		addr.WatchOnly = p.wallet.WatchOnly
+		newAddrs = append(newAddrs, addr)
+		newRecords = append(newRecords, &PoolAddress{
+			Address:   addr.Address,
+			AccountID: p.wallet.WalletID,
+			Index:     index,
+			Status:    PoolAddressUnused,
+		})
+		unused++
+	}
+
+	if len(newAddrs) == 0 {
+		return nil
+	}
+
+	err := p.wm.saveAddressToDB(newAddrs, p.wallet)
+	if err != nil {
+		return err
+	}
+
+	//登记观察地址，扫描器才能识别收款
+	err = p.wm.ImportWatchOnlyAddress(newAddrs...)
+	if err != nil {
+		return err
+	}
+
+	err = p.save(newRecords...)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range newRecords {
+		p.addresses[r.Address] = r
+	}
+	p.nextIndex = newRecords[len(newRecords)-1].Index + 1
+
+	p.wm.Log.Std.Info("wallet[%s] address pool replenished %d addresses", p.wallet.WalletID, len(newRecords))
+	return nil
+}
+
+//NextAddress 分配一个未使用的地址，索引小的优先
+//地址池为空时立即补充，达到间隔限制时返回错误，需要等待已分配的地址收款
+func (p *AddressPool) NextAddress() (*openwallet.Address, error) {
+	next, err := p.handOut()
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		err = p.Replenish()
+		if err != nil {
+			return nil, err
+		}
+		next, err = p.handOut()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "wallet[%s] address pool reached gap limit %d", p.wallet.WalletID, p.gapLimit)
+		}
+	}
+
+	p.notifyReplenish()
+
+	addr := p.wallet.GetAddress(next.Address)
+	if addr == nil {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "address[%s] not found in wallet", next.Address)
+	}
+	return addr, nil
+}
+
+//handOut 标记索引最小的未使用地址为已分配
+func (p *AddressPool) handOut() (*PoolAddress, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var next *PoolAddress
+	for _, a := range p.addresses {
+		if a.Status == PoolAddressUnused && (next == nil || a.Index < next.Index) {
+			next = a
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	handed := *next
+	handed.Status = PoolAddressHandedOut
+	handed.HandedOutAt = time.Now().Unix()
+	err := p.save(&handed)
+	if err != nil {
+		return nil, err
+	}
+	*next = handed
+	return next, nil
+}
+
+//MarkFunded 标记地址已收款，地址不在池中时返回false
+//收款后间隔限制向后移动，通知后台补充地址
+func (p *AddressPool) MarkFunded(address string, height uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.addresses[address]
+	if !ok {
+		return false
+	}
+	if a.Status == PoolAddressFunded {
+		return true
+	}
+
+	funded := *a
+	funded.Status = PoolAddressFunded
+	funded.FundedAt = height
+	err := p.save(&funded)
+	if err != nil {
+		p.wm.Log.Std.Warning("wallet[%s] mark address[%s] funded failed, unexpected error: %v", p.wallet.WalletID, address, err)
+		return true
+	}
+	*a = funded
+
+	p.notifyReplenish()
+	return true
+}
+
+//Addresses 按索引顺序获取指定状态的地址记录，status为空时返回全部
+func (p *AddressPool) Addresses(status string) []*PoolAddress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]*PoolAddress, 0)
+	for _, a := range p.addresses {
+		if len(status) == 0 || a.Status == status {
+			record := *a
+			ret = append(ret, &record)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+	return ret
+}
+
+//save 保存地址池记录到钱包数据库
+func (p *AddressPool) save(records ...*PoolAddress) error {
+	db, err := p.wallet.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.From(addressPoolBucket).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		err = tx.Save(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
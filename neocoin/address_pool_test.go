@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 地址池预派生、分配、收款及间隔限制
+func TestAddressPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-addresspool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.keyDir = filepath.Join(dir, "key")
+	wm.Config.DBPath = filepath.Join(dir, "db")
+	wm.Config.watchOnlyDir = filepath.Join(dir, "watchonly")
+	wm.Config.AddressPoolSize = 3
+	wm.Config.AddressGapLimit = 5
+
+	master, err := NewHDMasterNode(MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountNode, _ := master.DerivePath(BIP44AccountPath(0))
+	w, _, err := wm.CreateWatchOnlyWallet("deposit", accountNode.Neuter().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := wm.OpenAddressPool(w.WalletID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unused := pool.Addresses(PoolAddressUnused); len(unused) != 3 || unused[0].Index != 0 {
+		t.Fatalf("pre-derived addresses: %d, expected: 3", len(unused))
+	}
+
+	// 间隔限制内最多分配5个地址
+	handed := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		addr, err := pool.NextAddress()
+		if err != nil {
+			t.Fatalf("hand out address %d failed: %v", i, err)
+		}
+		if addr.HDPath != BIP44Path(0, false, uint64(i)) {
+			t.Errorf("hand out address path: %s, expected: %s", addr.HDPath, BIP44Path(0, false, uint64(i)))
+		}
+		handed = append(handed, addr.Address)
+	}
+	if handed[0] != "AJHeWQn2qKKqD4nBE82etebgT3GEM9HDRH" {
+		t.Errorf("first pool address wrong: %s", handed[0])
+	}
+	if _, err := pool.NextAddress(); err == nil {
+		t.Errorf("hand out beyond gap limit should fail")
+	}
+
+	// 扫描器发现收款后间隔限制后移
+	wm.markPoolAddressFunded(handed[2], 100)
+	if err := pool.Replenish(); err != nil {
+		t.Fatal(err)
+	}
+	if funded := pool.Addresses(PoolAddressFunded); len(funded) != 1 || funded[0].FundedAt != 100 {
+		t.Errorf("funded addresses wrong: %+v", funded)
+	}
+	if all := pool.Addresses(""); len(all) != 8 {
+		t.Errorf("pool addresses: %d, expected: 8", len(all))
+	}
+	addr, err := pool.NextAddress()
+	if err != nil || addr.HDPath != BIP44Path(0, false, 5) {
+		t.Errorf("hand out after funded failed: %v", err)
+	}
+
+	// 重新打开后状态从数据库恢复
+	wm.CloseAddressPool(w.WalletID)
+	pool, err = wm.OpenAddressPool(w.WalletID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.CloseAddressPool(w.WalletID)
+	if n := len(pool.Addresses(PoolAddressHandedOut)); n != 5 {
+		t.Errorf("handed out addresses after reopen: %d, expected: 5", n)
+	}
+	if n := len(pool.Addresses(PoolAddressFunded)); n != 1 {
+		t.Errorf("funded addresses after reopen: %d, expected: 1", n)
+	}
+}
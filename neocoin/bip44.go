@@ -0,0 +1,385 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//HD派生方式
+const (
+	HDDerivationOpenwallet = "openwallet" //openwallet默认派生，m/44'/88'/时间戳/索引
+	HDDerivationBIP44      = "bip44"      //标准BIP44派生，m/44'/888'/account'/change/index，兼容主流NEO钱包
+)
+
+const (
+	BIP44CoinType   = uint32(888)        //NEO在SLIP-0044中的币种编号
+	BIP44CoinPath   = "m/44'/888'"       //NEO的BIP44币种路径
+	HardenedKeyBase = uint32(0x80000000) //强化派生的起始索引
+	nist256p1Seed   = "Nist256p1 seed"   //SLIP-0010 secp256r1 根密钥的HMAC密钥
+	bip39SaltPrefix = "mnemonic"         //BIP39 种子的盐前缀
+	bip39Rounds     = 2048               //BIP39 种子的PBKDF2迭代次数
+)
+
+//扩展密钥序列化的版本号，secp256r1 密钥不使用BIP32的xpub/xprv版本号，避免被比特币钱包误用
+//序列化后扩展公钥以npub开头，扩展私钥以nprv开头
+var (
+	HDPublicKeyVersion  = []byte{0x03, 0xb8, 0xc8, 0x58}
+	HDPrivateKeyVersion = []byte{0x03, 0xb8, 0xc4, 0x1e}
+)
+
+//扩展密钥序列化后的长度：版本4 + 深度1 + 父指纹4 + 索引4 + 链码32 + 密钥33
+const hdSerializedKeyLength = 78
+
+//HDNode SLIP-0010 secp256r1 扩展密钥，PrivateKey为空时为扩展公钥
+type HDNode struct {
+	PrivateKey        []byte
+	PublicKey         []byte
+	ChainCode         []byte
+	Depth             uint8
+	ParentFingerprint []byte
+	ChildNumber       uint32
+}
+
+//NewHDMasterNode 通过种子创建根密钥
+func NewHDMasterNode(seed []byte) (*HDNode, error) {
+	if len(seed) < hdkeystore.MinSeedBytes || len(seed) > hdkeystore.MaxSeedBytes {
+		return nil, hdkeystore.ErrInvalidSeedLen
+	}
+
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, []byte(nist256p1Seed))
+		mac.Write(data)
+		i := mac.Sum(nil)
+		if isValidHDPrivateKey(i[:32]) {
+			return newPrivateHDNode(i[:32], i[32:], 0, []byte{0, 0, 0, 0}, 0)
+		}
+		//SLIP-0010：无效的私钥使用I重新计算
+		data = i
+	}
+}
+
+//Child 派生子密钥，扩展公钥不能进行强化派生
+func (n *HDNode) Child(index uint32) (*HDNode, error) {
+	if n.Depth == 0xff {
+		return nil, fmt.Errorf("cannot derive a key with more than 255 indices in its path")
+	}
+
+	hardened := index >= HardenedKeyBase
+	if hardened && !n.IsPrivate() {
+		return nil, fmt.Errorf("cannot derive a hardened key from a public key")
+	}
+
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(append(data, 0x00), n.PrivateKey...)
+	} else {
+		data = append(data, n.PublicKey...)
+	}
+
+	fingerprint := neoTransaction.Hash160(n.PublicKey)[:4]
+	curveOrder := new(big.Int).SetBytes(owcrypt.GetCurveOrder(owcrypt.ECC_CURVE_SECP256R1))
+
+	for {
+		i := hdChildHMAC(n.ChainCode, data, index)
+		il := new(big.Int).SetBytes(i[:32])
+
+		if il.Cmp(curveOrder) < 0 {
+			if n.IsPrivate() {
+				child := il.Add(il, new(big.Int).SetBytes(n.PrivateKey))
+				child.Mod(child, curveOrder)
+				if child.Sign() != 0 {
+					return newPrivateHDNode(paddedBytes(child, 32), i[32:], n.Depth+1, fingerprint, index)
+				}
+			} else {
+				point := owcrypt.PointDecompress(n.PublicKey, owcrypt.ECC_CURVE_SECP256R1)[1:]
+				child, isInfinity := owcrypt.Point_mulBaseG_add(point, i[:32], owcrypt.ECC_CURVE_SECP256R1)
+				if !isInfinity {
+					return &HDNode{
+						PublicKey:         owcrypt.PointCompress(child, owcrypt.ECC_CURVE_SECP256R1),
+						ChainCode:         i[32:],
+						Depth:             n.Depth + 1,
+						ParentFingerprint: fingerprint,
+						ChildNumber:       index,
+					}, nil
+				}
+			}
+		}
+
+		//SLIP-0010：无效的子密钥使用 0x01 || IR || index 重新计算
+		data = append([]byte{0x01}, i[32:]...)
+	}
+}
+
+//DerivePath 按路径派生子密钥，例如：m/44'/888'/0'/0/1
+func (n *HDNode) DerivePath(path string) (*HDNode, error) {
+	indexes, err := parseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+	node := n
+	for _, index := range indexes {
+		node, err = node.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+//IsPrivate 是否为扩展私钥
+func (n *HDNode) IsPrivate() bool {
+	return len(n.PrivateKey) > 0
+}
+
+//Neuter 转换为扩展公钥
+func (n *HDNode) Neuter() *HDNode {
+	return &HDNode{
+		PublicKey:         n.PublicKey,
+		ChainCode:         n.ChainCode,
+		Depth:             n.Depth,
+		ParentFingerprint: n.ParentFingerprint,
+		ChildNumber:       n.ChildNumber,
+	}
+}
+
+//String 按BIP32格式序列化扩展密钥，扩展公钥为npub，扩展私钥为nprv
+func (n *HDNode) String() string {
+	data := make([]byte, 0, hdSerializedKeyLength)
+	if n.IsPrivate() {
+		data = append(data, HDPrivateKeyVersion...)
+	} else {
+		data = append(data, HDPublicKeyVersion...)
+	}
+	data = append(data, n.Depth)
+	data = append(data, n.ParentFingerprint...)
+	childNumber := make([]byte, 4)
+	binary.BigEndian.PutUint32(childNumber, n.ChildNumber)
+	data = append(data, childNumber...)
+	data = append(data, n.ChainCode...)
+	if n.IsPrivate() {
+		data = append(append(data, 0x00), n.PrivateKey...)
+	} else {
+		data = append(data, n.PublicKey...)
+	}
+	return neoTransaction.EncodeCheck(data[:4], data[4:])
+}
+
+//NewHDNodeFromString 解析BIP32格式的扩展密钥，支持npub和nprv，其它版本号（如比特币的xpub/xprv）返回错误
+func NewHDNodeFromString(key string) (*HDNode, error) {
+	data, err := neoTransaction.Decode(key, neoTransaction.NeocoinAlphabet)
+	if err != nil || len(data) != hdSerializedKeyLength+4 {
+		return nil, fmt.Errorf("invalid extended key")
+	}
+	checksum := owcrypt.Hash(data[:hdSerializedKeyLength], 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+	if !bytes.Equal(checksum, data[hdSerializedKeyLength:]) {
+		return nil, fmt.Errorf("invalid extended key checksum")
+	}
+
+	version := data[:4]
+	depth := data[4]
+	parentFingerprint := append([]byte{}, data[5:9]...)
+	childNumber := binary.BigEndian.Uint32(data[9:13])
+	chainCode := append([]byte{}, data[13:45]...)
+	keyData := append([]byte{}, data[45:78]...)
+
+	switch {
+	case bytes.Equal(version, HDPrivateKeyVersion):
+		if keyData[0] != 0x00 || !isValidHDPrivateKey(keyData[1:]) {
+			return nil, fmt.Errorf("invalid extended private key")
+		}
+		return newPrivateHDNode(keyData[1:], chainCode, depth, parentFingerprint, childNumber)
+	case bytes.Equal(version, HDPublicKeyVersion):
+		if keyData[0] != 0x02 && keyData[0] != 0x03 {
+			return nil, fmt.Errorf("invalid extended public key")
+		}
+		point := owcrypt.PointDecompress(keyData, owcrypt.ECC_CURVE_SECP256R1)
+		if !elliptic.P256().IsOnCurve(new(big.Int).SetBytes(point[1:33]), new(big.Int).SetBytes(point[33:])) {
+			return nil, fmt.Errorf("invalid extended public key")
+		}
+		return &HDNode{
+			PublicKey:         keyData,
+			ChainCode:         chainCode,
+			Depth:             depth,
+			ParentFingerprint: parentFingerprint,
+			ChildNumber:       childNumber,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown extended key version")
+	}
+}
+
+//BIP44Path 获取BIP44地址路径 m/44'/888'/account'/change/index
+func BIP44Path(account uint32, change bool, index uint64) string {
+	return fmt.Sprintf("%s/%d", BIP44ChainPath(account, change), index)
+}
+
+//BIP44ChainPath 获取BIP44地址链路径 m/44'/888'/account'/change
+func BIP44ChainPath(account uint32, change bool) string {
+	chain := 0
+	if change {
+		chain = 1
+	}
+	return fmt.Sprintf("%s/%d", BIP44AccountPath(account), chain)
+}
+
+//BIP44AccountPath 获取BIP44账户路径 m/44'/888'/account'
+func BIP44AccountPath(account uint32) string {
+	return fmt.Sprintf("%s/%d'", BIP44CoinPath, account)
+}
+
+//IsBIP44Path 是否为BIP44派生的路径，openwallet默认派生使用 m/44'/88'
+func IsBIP44Path(path string) bool {
+	return strings.HasPrefix(path, BIP44CoinPath+"/")
+}
+
+//MnemonicToSeed 通过BIP39助记词生成种子
+//助记词和密码包含非ASCII字符时，调用方需要先做NFKD规范化
+func MnemonicToSeed(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte(bip39SaltPrefix+passphrase), bip39Rounds, 64, sha512.New)
+}
+
+//DerivePrivateKey 按地址路径派生私钥，BIP44路径使用SLIP-0010派生，其它路径使用openwallet的派生方式
+func (wm *WalletManager) DerivePrivateKey(key *hdkeystore.HDKey, hdPath string) ([]byte, error) {
+	if IsBIP44Path(hdPath) {
+		master, err := NewHDMasterNode(key.Seed())
+		if err != nil {
+			return nil, err
+		}
+		node, err := master.DerivePath(hdPath)
+		if err != nil {
+			return nil, err
+		}
+		return node.PrivateKey, nil
+	}
+
+	childKey, err := key.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	if err != nil {
+		return nil, err
+	}
+	return childKey.GetPrivateKeyBytes()
+}
+
+//addressChainPath 获取新地址的父路径
+//BIP44派生使用配置的账户和找零链，openwallet派生使用钱包根路径和时间戳
+func (wm *WalletManager) addressChainPath(key *hdkeystore.HDKey, change bool, timestamp uint64) string {
+	if wm.Config.HDDerivation == HDDerivationBIP44 {
+		return BIP44ChainPath(wm.Config.BIP44Account, change)
+	}
+	return fmt.Sprintf("%s/%d", key.RootPath, timestamp)
+}
+
+//nextAddressIndex 获取父路径下的下一个地址索引，openwallet派生每次使用新的时间戳路径，从0开始
+func (wm *WalletManager) nextAddressIndex(wallet *openwallet.Wallet, chainPath string) uint64 {
+	next := uint64(0)
+	if !IsBIP44Path(chainPath) {
+		return next
+	}
+	for _, a := range wallet.GetAddressesByAccount(wallet.WalletID) {
+		if !strings.HasPrefix(a.HDPath, chainPath+"/") {
+			continue
+		}
+		index, err := strconv.ParseUint(strings.TrimPrefix(a.HDPath, chainPath+"/"), 10, 64)
+		if err == nil && index+1 > next {
+			next = index + 1
+		}
+	}
+	return next
+}
+
+//newPrivateHDNode 通过私钥创建扩展私钥
+func newPrivateHDNode(privateKey, chainCode []byte, depth uint8, parentFingerprint []byte, childNumber uint32) (*HDNode, error) {
+	pub, ret := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return &HDNode{
+		PrivateKey:        privateKey,
+		PublicKey:         owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1),
+		ChainCode:         chainCode,
+		Depth:             depth,
+		ParentFingerprint: parentFingerprint,
+		ChildNumber:       childNumber,
+	}, nil
+}
+
+//hdChildHMAC 计算 HMAC-SHA512(chainCode, data || index)
+func hdChildHMAC(chainCode, data []byte, index uint32) []byte {
+	serialized := make([]byte, 4)
+	binary.BigEndian.PutUint32(serialized, index)
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	mac.Write(serialized)
+	return mac.Sum(nil)
+}
+
+//isValidHDPrivateKey 私钥是否在 (0, n) 范围内
+func isValidHDPrivateKey(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(new(big.Int).SetBytes(owcrypt.GetCurveOrder(owcrypt.ECC_CURVE_SECP256R1))) < 0
+}
+
+//paddedBytes 大整数转换为定长字节
+func paddedBytes(n *big.Int, size int) []byte {
+	ret := make([]byte, size)
+	b := n.Bytes()
+	copy(ret[size-len(b):], b)
+	return ret
+}
+
+//parseHDPath 解析派生路径，支持 ' 和 h 表示强化派生
+func parseHDPath(path string) ([]uint32, error) {
+	path = strings.Replace(path, " ", "", -1)
+	if path == "m" || path == "" {
+		return []uint32{}, nil
+	}
+	if !strings.HasPrefix(path, "m/") {
+		return nil, fmt.Errorf("invalid derived path: %s", path)
+	}
+
+	indexes := make([]uint32, 0)
+	for _, elem := range strings.Split(path[2:], "/") {
+		hardened := strings.HasSuffix(elem, "'") || strings.HasSuffix(elem, "h")
+		if hardened {
+			elem = elem[:len(elem)-1]
+		}
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyBase {
+			return nil, fmt.Errorf("invalid derived path: %s", path)
+		}
+		if hardened {
+			index += uint64(HardenedKeyBase)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// SLIP-0010 secp256r1 测试向量1
+func TestHDNode_SLIP10(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewHDMasterNode(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		chainCode string
+		priv      string
+		pub       string
+	}{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c", "0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+		{"m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129", "03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+		{"m/0'/1/2'", "98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318", "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7", "0359cf160040778a4b14c5f4d7b76e327ccc8c4a6086dd9451b7482b5a4972dda0"},
+		{"m/0'/1/2'/2", "ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0", "5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa", "029f871f4cb9e1c97f9f4de9ccd0d4a2f2a171110c61178f84430062230833ff20"},
+		{"m/0'/1/2'/2/1000000000", "b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059", "21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119", "02216cd26d31147f72427a453c443ed2cde8a1e53c9cc44e5ddf739725413fe3f4"},
+	}
+
+	for _, test := range tests {
+		node, err := master.DerivePath(test.path)
+		if err != nil {
+			t.Errorf("derive %s failed: %v", test.path, err)
+			continue
+		}
+		if hex.EncodeToString(node.ChainCode) != test.chainCode ||
+			hex.EncodeToString(node.PrivateKey) != test.priv ||
+			hex.EncodeToString(node.PublicKey) != test.pub {
+			t.Errorf("derive %s wrong: %x, %x, %x", test.path, node.ChainCode, node.PrivateKey, node.PublicKey)
+		}
+	}
+
+	// 扩展公钥派生与私钥派生一致，且不能强化派生
+	parent, _ := master.DerivePath("m/0'")
+	child, err := parent.Neuter().Child(1)
+	if err != nil || hex.EncodeToString(child.PublicKey) != tests[2].pub || child.IsPrivate() {
+		t.Errorf("public derivation wrong: %v", err)
+	}
+	if _, err := parent.Neuter().Child(HardenedKeyBase); err == nil {
+		t.Errorf("hardened derivation from public key should fail")
+	}
+}
+
+// BIP39 官方向量的种子、neon-js 的密钥地址向量及 m/44'/888'/0'/0/i 路径
+func TestBIP44Derivation(t *testing.T) {
+	seed := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "TREZOR")
+	if hex.EncodeToString(seed) != "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" {
+		t.Errorf("mnemonic seed wrong: %x", seed)
+	}
+
+	if BIP44Path(0, false, 5) != "m/44'/888'/0'/0/5" || BIP44Path(2, true, 0) != "m/44'/888'/2'/1/0" {
+		t.Errorf("bip44 path wrong")
+	}
+	if !IsBIP44Path("m/44'/888'/0'/0/5") || IsBIP44Path("m/44'/88'/1/5") {
+		t.Errorf("bip44 path detection wrong")
+	}
+	if _, err := parseHDPath("m/44'/x"); err == nil {
+		t.Errorf("invalid path should fail")
+	}
+
+	wm := NewWalletManager()
+	wm.Decoder = NewAddressDecoder(wm)
+
+	// neon-js 公开的密钥向量：私钥、公钥与地址
+	priv, _ := hex.DecodeString("7d128a6d096f0c14c3a25a2b0c41cf79661bfcb4a8cc95aaaea28bde4d732344")
+	key, err := newPrivateHDNode(priv, nil, 0, nil, 0)
+	if err != nil || hex.EncodeToString(key.PublicKey) != "02028a99826edc0c97d18e22b6932373d908d323aa7f92656a77ec26e8861699ef" {
+		t.Errorf("public key wrong: %v", err)
+		return
+	}
+	address, _ := wm.Decoder.PublicKeyToAddress(key.PublicKey, false)
+	if address != "ALq7AWrhAueN6mJNqk6FHJjnsEoPRytLdW" {
+		t.Errorf("address wrong: %s", address)
+	}
+
+	// BIP44 路径按 SLIP-0010 派生，派生算法由上面的官方向量验证
+	master, err := NewHDMasterNode(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := master.DerivePath(BIP44Path(0, false, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, _ := master.DerivePath("m/44'/888'/0'/0/0")
+	if node.Depth != 5 || !node.IsPrivate() || hex.EncodeToString(node.PrivateKey) != hex.EncodeToString(explicit.PrivateKey) {
+		t.Errorf("bip44 path derivation wrong")
+	}
+}
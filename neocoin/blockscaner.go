@@ -19,17 +19,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
-	"net/url"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/asdine/storm"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
-	"github.com/graarh/golang-socketio"
-	"github.com/graarh/golang-socketio/transport"
 	"github.com/shopspring/decimal"
 )
 
@@ -40,20 +38,29 @@ const (
 
 	RPCServerCore     = 0 //RPC服务，bitcoin核心钱包
 	RPCServerExplorer = 1 //RPC服务，insight-API
+	RPCServerP2P      = 2 //NEO P2P协议，直接连接节点
 )
 
 //NEOBlockScanner bitcoin的区块链扫描器
 type NEOBlockScanner struct {
 	*openwallet.BlockScannerBase
 
-	CurrentBlockHeight   uint64             //当前区块高度
-	extractingCH         chan struct{}      //扫描工作令牌
-	wm                   *WalletManager     //钱包管理者
-	IsScanMemPool        bool               //是否扫描交易池
-	RescanLastBlockCount uint64             //重扫上N个区块数量
-	socketIO             *gosocketio.Client //socketIO客户端
-	setupSocketIOOnce    sync.Once
-	stopSocketIO         chan struct{}
+	CurrentBlockHeight   uint64         //当前区块高度
+	extractingCH         chan struct{}  //扫描工作令牌
+	wm                   *WalletManager //钱包管理者
+	IsScanMemPool        bool           //是否扫描交易池
+	RescanLastBlockCount uint64         //重扫上N个区块数量
+	pushSubscriber       PushSubscriber //节点推送订阅者
+	pushStop             chan struct{}
+	scanTrigger          chan struct{}               //推送触发的扫描请求
+	scanTaskLock         sync.Mutex                  //定时任务和推送触发的扫描不同时执行
+	outputs              *outputCache                //最近出现的交易输出
+	rescanJobs           map[string]*rescanJobRunner //运行中的重扫任务
+	rescanJobsLock       sync.Mutex
+	headerChainErr       error //区块头链验证失败，扫描器停止扫描
+	headerChainLock      sync.Mutex
+	offline              bool       //离线导入，不查询节点
+	pendingTxLock        sync.Mutex //交易池扫描和推送的交易单不同时处理
 
 	//用于实现浏览器
 	IsSkipFailedBlock bool                                    //是否跳过失败区块
@@ -64,6 +71,7 @@ type NEOBlockScanner struct {
 type ExtractResult struct {
 	extractData     map[string]*openwallet.TxExtractData
 	extractOmniData map[string]*openwallet.TxExtractData //代币交易
+	nep5Transfers   []*NEP5Transfer                      //观察地址的NEP-5转账，写入本地记录
 	TxID            string
 	BlockHeight     uint64
 	Success         bool
@@ -87,9 +95,13 @@ func NewNEOBlockScanner(wm *WalletManager) *NEOBlockScanner {
 	bs.wm = wm
 	bs.IsScanMemPool = true
 	bs.RescanLastBlockCount = 0
-	bs.stopSocketIO = make(chan struct{})
+	bs.scanTrigger = make(chan struct{}, 1)
+	bs.outputs = newOutputCache(wm.Config.OutputCacheSize)
+	bs.rescanJobs = make(map[string]*rescanJobRunner)
 	bs.NEOBlockObservers = make(map[NEOBlockScanNotificationObject]bool)
 	//bs.RPCServer = RPCServerCore
+	//默认以本地观察地址登记表判断地址归属，可通过SetBlockScanAddressFunc替换
+	bs.ScanAddressFunc = wm.WatchOnly.Lookup
 
 	//设置扫描任务
 	bs.SetTask(bs.ScanBlockTask)
@@ -115,8 +127,12 @@ func (bs *NEOBlockScanner) SetRescanBlockHeight(height uint64) error {
 }
 
 //ScanBlockTask 扫描任务
+//区块通过流水线预取并提取交易，扫描高度的保存和观察者通知按高度顺序执行
 func (bs *NEOBlockScanner) ScanBlockTask() {
 
+	bs.scanTaskLock.Lock()
+	defer bs.scanTaskLock.Unlock()
+
 	//获取本地区块高度
 	blockHeader, err := bs.GetScannedBlockHeader()
 	if err != nil {
@@ -127,6 +143,13 @@ func (bs *NEOBlockScanner) ScanBlockTask() {
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+	//区块头链验证失败后不再扫描，避免入账伪造链上的充值
+	if err := bs.HeaderChainError(); err != nil {
+		bs.wm.Log.Std.Error("block scanner is halted by header chain verification: %v", err)
+		return
+	}
+
+scanLoop:
 	for {
 
 		if !bs.Scanning {
@@ -152,124 +175,158 @@ func (bs *NEOBlockScanner) ScanBlockTask() {
 			break
 		}
 
-		//继续扫描下一个区块
-		currentHeight = currentHeight + 1
+		//预取下一个高度到最新高度的区块
+		quit := make(chan struct{})
+		pending := bs.prefetchBlocks(currentHeight+1, maxHeight, quit)
 
-		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
+		for fetching := range pending {
 
-		hash, err := bs.wm.GetBlockHash(currentHeight)
-		if err != nil {
-			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
-			break
-		}
+			fetched := <-fetching
 
-		if bs.wm.Config.OmniSupport {
-			//判断omni的区块高度是否一致
-			omniBlockHash, err := bs.wm.GetOmniBlockHash(currentHeight)
-			if err != nil {
-				bs.wm.Log.Std.Error("omni block is not synced to the same height of mainnet")
+			if !bs.Scanning {
+				close(quit)
 				return
 			}
 
-			//判断omni的hash是否与hc节点的hash一致
-			if omniBlockHash != hash {
-				bs.wm.Log.Std.Error("omni block is not synced to the same hash of mainnet")
+			//继续扫描下一个区块
+			currentHeight = fetched.height
+
+			bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
+
+			if fetched.hashErr != nil {
+				//下一个高度找不到会报异常
+				bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", fetched.hashErr)
+				close(quit)
+				break scanLoop
+			}
+
+			if fetched.omniErr != nil {
+				bs.wm.Log.Std.Error("%v", fetched.omniErr)
+				close(quit)
 				return
 			}
-		}
 
-		block, err := bs.wm.GetBlock(hash)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+			if fetched.blockErr != nil {
+				bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", fetched.blockErr)
 
-			//记录未扫区块
-			unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
-			bs.SaveUnscanRecord(unscanRecord)
-			bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
-			continue
-		}
-
-		isFork := false
+				//记录未扫区块
+				unscanRecord := NewUnscanRecord(currentHeight, "", fetched.blockErr.Error())
+				bs.SaveUnscanRecord(unscanRecord)
+				bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
+				continue
+			}
 
-		//判断hash是否上一区块的hash
-		if currentHash != block.Previousblockhash {
+			block := fetched.block
 
-			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
-			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
-			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.Previousblockhash)
+			//浏览器数据源需要验证区块头链，验证失败停止扫描
+			var chainHeader *ChainHeader
+			if bs.verifyHeaderChain() {
+				chainHeader, err = bs.verifyBlockHeader(block)
+				if err != nil {
+					close(quit)
+					bs.haltHeaderChain(err)
+					return
+				}
+			}
 
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
+			//判断hash是否上一区块的hash
+			if currentHash != block.Previousblockhash {
 
-			//查询本地分叉的区块
-			forkBlock, _ := bs.wm.GetLocalBlock(currentHeight - 1)
+				//分叉后预取的区块作废
+				close(quit)
 
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			//删除上一区块链的未扫记录
-			bs.wm.DeleteUnscanRecord(currentHeight - 1)
-			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
-			}
+				bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
+				bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
+				bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.Previousblockhash)
 
-			localBlock, err := bs.wm.GetLocalBlock(currentHeight)
-			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+				bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
 
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+				//查询本地分叉的区块
+				forkBlock, _ := bs.wm.GetLocalBlock(currentHeight - 1)
 
-				prevHash, err := bs.wm.GetBlockHash(currentHeight)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
+				//删除上一区块链的所有充值记录
+				//bs.DeleteRechargesByHeight(currentHeight - 1)
+				//删除上一区块链的未扫记录
+				bs.wm.DeleteUnscanRecord(currentHeight - 1)
+				currentHeight = currentHeight - 2 //倒退2个区块重新扫描
+				if currentHeight <= 0 {
+					currentHeight = 1
 				}
 
-				localBlock, err = bs.wm.GetBlock(prevHash)
+				localBlock, err := bs.wm.GetLocalBlock(currentHeight)
 				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
+					bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+
+					//查找core钱包的RPC
+					bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+
+					prevHash, err := bs.wm.GetBlockHash(currentHeight)
+					if err != nil {
+						bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
+						break scanLoop
+					}
+
+					localBlock, err = bs.wm.GetBlock(prevHash)
+					if err != nil {
+						bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
+						break scanLoop
+					}
+
 				}
 
-			}
+				//重置当前区块的hash
+				currentHash = localBlock.Hash
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+				bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
 
-			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
+				//重新记录一个新扫描起点
+				bs.wm.SaveLocalNewBlock(localBlock.Height, localBlock.Hash)
 
-			//重新记录一个新扫描起点
-			bs.wm.SaveLocalNewBlock(localBlock.Height, localBlock.Hash)
+				//回滚分叉区块写入的未花费索引
+				err = bs.wm.rollbackUnspentIndex(localBlock.Height)
+				if err != nil {
+					bs.wm.Log.Std.Error("block scanner can not rollback unspent index; unexpected error: %v", err)
+				}
 
-			isFork = true
+				if forkBlock != nil {
 
-			if forkBlock != nil {
+					//通知分叉区块给观测者，异步处理
+					bs.newBlockNotify(forkBlock, true)
+				}
 
-				//通知分叉区块给观测者，异步处理
-				bs.newBlockNotify(forkBlock, isFork)
+				continue scanLoop
 			}
 
-		} else {
+			if chainHeader != nil {
+				err = bs.wm.saveChainHeader(chainHeader)
+				if err != nil {
+					bs.wm.Log.Std.Error("block scanner can not save block header; unexpected error: %v", err)
+					close(quit)
+					break scanLoop
+				}
+			}
 
-			err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+			err = bs.commitExtractResults(block.Height, fetched.results)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			}
 
 			//重置当前区块的hash
-			currentHash = hash
+			currentHash = fetched.hash
 
-			//保存本地新高度
-			bs.wm.SaveLocalNewBlock(currentHeight, currentHash)
+			//保存本地新高度，同时更新未花费索引
+			err = bs.wm.saveScannedBlock(currentHeight, currentHash, fetched.results)
+			if err != nil {
+				bs.wm.Log.Std.Error("block scanner can not save scanned block; unexpected error: %v", err)
+				break scanLoop
+			}
 			bs.wm.SaveLocalBlock(block)
 
-			isFork = false
-
 			//通知新区块给观测者，异步处理
-			bs.newBlockNotify(block, isFork)
+			bs.newBlockNotify(block, false)
 		}
 
+		close(quit)
 	}
 
 	//重扫前N个块，为保证记录找到
@@ -287,6 +344,97 @@ func (bs *NEOBlockScanner) ScanBlockTask() {
 
 }
 
+//prefetchedBlock 流水线预取的区块及交易提取结果
+type prefetchedBlock struct {
+	height   uint64
+	hash     string
+	block    *Block
+	results  []ExtractResult
+	hashErr  error //获取区块hash失败
+	blockErr error //获取区块数据失败
+	omniErr  error //omni节点与主网不同步
+}
+
+//scanLookAhead 预取区块数，不超过并发扫描线程数
+func (bs *NEOBlockScanner) scanLookAhead() int {
+	lookAhead := bs.wm.Config.ScanLookAhead
+	if lookAhead < 1 {
+		lookAhead = 1
+	}
+	if lookAhead > maxExtractingSize {
+		lookAhead = maxExtractingSize
+	}
+	return lookAhead
+}
+
+//prefetchBlocks 并发预取 start 到 end 高度的区块并提取交易
+//返回的通道按高度顺序排列每个区块的结果，最多预取 scanLookAhead 个区块，关闭 quit 后停止预取
+func (bs *NEOBlockScanner) prefetchBlocks(start, end uint64, quit chan struct{}) <-chan chan *prefetchedBlock {
+
+	lookAhead := bs.scanLookAhead()
+
+	//有序的结果队列，加上消费者正在等待的区块即预取窗口
+	pending := make(chan chan *prefetchedBlock, lookAhead-1)
+
+	go func() {
+		defer close(pending)
+		for height := start; height <= end; height++ {
+
+			fetching := make(chan *prefetchedBlock, 1)
+
+			select {
+			case pending <- fetching:
+			case <-quit:
+				return
+			}
+
+			go func(mHeight uint64, mFetching chan<- *prefetchedBlock) {
+				mFetching <- bs.fetchBlock(mHeight)
+			}(height, fetching)
+		}
+	}()
+
+	return pending
+}
+
+//fetchBlock 获取指定高度的区块并提取交易，不通知观察者
+func (bs *NEOBlockScanner) fetchBlock(height uint64) *prefetchedBlock {
+
+	fetched := &prefetchedBlock{height: height}
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		fetched.hashErr = err
+		return fetched
+	}
+	fetched.hash = hash
+
+	if bs.wm.Config.OmniSupport {
+		//判断omni的区块高度是否一致
+		omniBlockHash, err := bs.wm.GetOmniBlockHash(height)
+		if err != nil {
+			fetched.omniErr = fmt.Errorf("omni block is not synced to the same height of mainnet")
+			return fetched
+		}
+
+		//判断omni的hash是否与hc节点的hash一致
+		if omniBlockHash != hash {
+			fetched.omniErr = fmt.Errorf("omni block is not synced to the same hash of mainnet")
+			return fetched
+		}
+	}
+
+	block, err := bs.wm.GetBlock(hash)
+	if err != nil {
+		fetched.blockErr = err
+		return fetched
+	}
+	fetched.block = block
+	fetched.results = bs.extractBlock(block, bs.ScanAddressFunc)
+
+	return fetched
+}
+
 //ScanBlock 扫描指定高度区块
 func (bs *NEOBlockScanner) ScanBlock(height uint64) error {
 
@@ -321,13 +469,28 @@ func (bs *NEOBlockScanner) scanBlock(height uint64) (*Block, error) {
 		return nil, err
 	}
 
+	err = bs.checkStoredHeader(block)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not rescan block; unexpected error: %v", err)
+		return nil, err
+	}
+
 	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+	results := bs.extractBlock(block, bs.ScanAddressFunc)
+
+	err = bs.commitExtractResults(block.Height, results)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
 
+	//与主扫描流程一样把提取成功的交易写入未花费索引，不改变扫描高度
+	err = bs.wm.saveBackfillUnspents(block.Height, results, false)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not save unspent index; unexpected error: %v", err)
+		return nil, err
+	}
+
 	//保存区块
 	//bs.wm.SaveLocalBlock(block)
 
@@ -346,11 +509,14 @@ func (bs *NEOBlockScanner) ScanTxMemPool() {
 		return
 	}
 
+	//更新已通知的未确认交易单，报告被交易池丢弃的交易单
+	bs.refreshPendingTxs(txIDsInMemPool)
+
 	if txIDsInMemPool == nil || len(txIDsInMemPool) == 0 {
 		return
 	}
 
-	err = bs.BatchExtractTransaction(0, "", txIDsInMemPool)
+	err = bs.extractPendingTxs(txIDsInMemPool)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
@@ -390,34 +556,51 @@ func (bs *NEOBlockScanner) RescanFailedRecord() {
 			continue
 		}
 
-		var hash string
+		var (
+			results []ExtractResult
+		)
 
 		bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
 
-		if len(txs) == 0 {
+		hash, err := bs.wm.GetBlockHash(height)
+		if err != nil {
+			//下一个高度找不到会报异常
+			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+			continue
+		}
 
-			hash, err := bs.wm.GetBlockHash(height)
-			if err != nil {
-				//下一个高度找不到会报异常
-				bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
-				continue
-			}
+		block, err := bs.wm.GetBlock(hash)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+			continue
+		}
 
-			block, err := bs.wm.GetBlock(hash)
-			if err != nil {
-				bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
-				continue
-			}
+		//只重扫部分交易时同样检查区块与本地区块头链一致
+		err = bs.checkStoredHeader(block)
+		if err != nil {
+			bs.wm.Log.Std.Error("block scanner can not rescan block; unexpected error: %v", err)
+			continue
+		}
 
-			txs = block.tx
+		if len(txs) == 0 {
+			results = bs.extractBlock(block, bs.ScanAddressFunc)
+		} else {
+			results = bs.extractTransactions(height, block.Hash, txs, bs.ScanAddressFunc)
 		}
 
-		err = bs.BatchExtractTransaction(height, hash, txs)
+		err = bs.commitExtractResults(height, results)
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			continue
 		}
 
+		//主扫描流程跳过的区块和提取失败的交易没有写入未花费索引，重扫成功后补上
+		err = bs.wm.saveBackfillUnspents(height, results, false)
+		if err != nil {
+			bs.wm.Log.Std.Error("block scanner can not save unspent index; unexpected error: %v", err)
+			continue
+		}
+
 		//删除未扫记录
 		bs.wm.DeleteUnscanRecord(height)
 	}
@@ -437,141 +620,142 @@ func (bs *NEOBlockScanner) newBlockNotify(block *Block, isFork bool) {
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *NEOBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []string) error {
 
-	var (
-		quit       = make(chan struct{})
-		done       = 0 //完成标记
-		failed     = 0
-		shouldDone = len(txs) //需要完成的总数
-	)
-
 	if len(txs) == 0 {
 		return errors.New("BatchExtractTransaction block is nil.")
 	}
 
-	//生产通道
-	producer := make(chan ExtractResult)
-	defer close(producer)
+	return bs.commitExtractResults(blockHeight, bs.extractTransactions(blockHeight, blockHash, txs, bs.ScanAddressFunc))
+}
 
-	//消费通道
-	worker := make(chan ExtractResult)
-	defer close(worker)
+//extractBlock 提取区块内的交易单，完整的区块直接使用区块内的交易数据
+func (bs *NEOBlockScanner) extractBlock(block *Block, scanAddressFunc openwallet.BlockScanAddressFunc) []ExtractResult {
 
-	//保存工作
-	saveWork := func(height uint64, result chan ExtractResult) {
-		//回收创建的地址
-		for gets := range result {
+	if !block.isVerbose {
+		return bs.extractTransactions(block.Height, block.Hash, block.tx, scanAddressFunc)
+	}
 
-			if gets.Success {
+	//先缓存区块内全部输出，同一区块内的花费无需查询节点
+	for _, trx := range block.txDetails {
+		bs.outputs.Add(trx.TxID, trx.Vouts)
+	}
 
-				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
-				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
-				if notifyErr != nil {
-					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
-				}
+	return bs.extractConcurrently(len(block.txDetails), func(i int) ExtractResult {
+		trx := block.txDetails[i]
+		if len(trx.BlockHash) == 0 {
+			trx.BlockHash = block.Hash
+		}
+		if trx.Blocktime == 0 {
+			trx.Blocktime = int64(block.Time)
+		}
+		return bs.extractTransactionDetail(block.Height, block.Hash, trx, scanAddressFunc)
+	})
+}
 
-				notifyErr = nil
-				notifyErr = bs.newExtractDataNotify(height, gets.extractOmniData)
-				if notifyErr != nil {
-					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
-				}
+//extractTransactions 多线程提取交易单，结果按交易顺序返回
+func (bs *NEOBlockScanner) extractTransactions(blockHeight uint64, blockHash string, txs []string, scanAddressFunc openwallet.BlockScanAddressFunc) []ExtractResult {
+	return bs.extractConcurrently(len(txs), func(i int) ExtractResult {
+		return bs.ExtractTransaction(blockHeight, blockHash, txs[i], scanAddressFunc)
+	})
+}
 
-			} else {
-				//记录未扫区块
-				unscanRecord := NewUnscanRecord(height, "", "")
-				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
-				failed++ //标记保存失败数
-			}
-			//累计完成的线程数
-			done++
-			if done == shouldDone {
-				//bs.wm.Log.Std.Info("done = %d, shouldDone = %d ", done, len(txs))
-				close(quit) //关闭通道，等于给通道传入nil
-			}
-		}
-	}
+//extractConcurrently 多线程执行 count 个提取工作，结果按序号返回
+//所有区块共用扫描工作令牌，同时提取的交易数不超过 maxExtractingSize
+func (bs *NEOBlockScanner) extractConcurrently(count int, extract func(i int) ExtractResult) []ExtractResult {
 
-	//提取工作
-	extractWork := func(eblockHeight uint64, eBlockHash string, mTxs []string, eProducer chan ExtractResult) {
-		for _, txid := range mTxs {
-			bs.extractingCH <- struct{}{}
-			//shouldDone++
-			go func(mBlockHeight uint64, mTxid string, end chan struct{}, mProducer chan<- ExtractResult) {
+	var (
+		wg      sync.WaitGroup
+		results = make([]ExtractResult, count)
+	)
 
-				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, mTxid, bs.ScanAddressFunc)
-				//释放
-				<-end
+	for i := 0; i < count; i++ {
+		bs.extractingCH <- struct{}{}
+		wg.Add(1)
+		go func(mIndex int, end chan struct{}) {
+			defer wg.Done()
 
-			}(eblockHeight, txid, bs.extractingCH, eProducer)
-		}
+			//导出提出的交易
+			results[mIndex] = extract(mIndex)
+			//释放
+			<-end
+
+		}(i, bs.extractingCH)
 	}
 
-	/*	开启导出的线程	*/
+	wg.Wait()
 
-	//独立线程运行消费
-	go saveWork(blockHeight, worker)
+	return results
+}
 
-	//独立线程运行生产
-	go extractWork(blockHeight, blockHash, txs, producer)
+//commitExtractResults 按顺序通知提取结果，提取失败的记录未扫区块
+func (bs *NEOBlockScanner) commitExtractResults(height uint64, results []ExtractResult) error {
 
-	//以下使用生产消费模式
-	bs.extractRuntime(producer, worker, quit)
+	failed := 0
 
-	if failed > 0 {
-		return fmt.Errorf("block scanner saveWork failed")
-	} else {
-		return nil
+	//已上链的交易单关联之前的未确认通知
+	if height > 0 {
+		bs.confirmPendingTxs(results)
 	}
 
-	//return nil
-}
+	for _, gets := range results {
 
-//extractRuntime 提取运行时
-func (bs *NEOBlockScanner) extractRuntime(producer chan ExtractResult, worker chan ExtractResult, quit chan struct{}) {
+		if gets.Success {
 
-	var (
-		values = make([]ExtractResult, 0)
-	)
+			notifyErr := bs.newExtractDataNotify(height, gets.extractData)
+			if notifyErr != nil {
+				failed++ //标记保存失败数
+				bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+			}
 
-	for {
+			notifyErr = bs.newExtractDataNotify(height, gets.extractOmniData)
+			if notifyErr != nil {
+				failed++ //标记保存失败数
+				bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+			}
 
-		var activeWorker chan<- ExtractResult
-		var activeValue ExtractResult
+		} else {
+			//记录未扫区块
+			unscanRecord := NewUnscanRecord(height, "", "")
+			bs.SaveUnscanRecord(unscanRecord)
+			bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+			failed++ //标记保存失败数
+		}
+	}
 
-		//当数据队列有数据时，释放顶部，传输给消费者
-		if len(values) > 0 {
-			activeWorker = worker
-			activeValue = values[0]
+	if failed > 0 {
+		return fmt.Errorf("block scanner saveWork failed")
+	}
 
-		}
+	return nil
+}
+
+//ExtractTransaction 提取交易单
+func (bs *NEOBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
 
-		select {
+	//bs.wm.Log.Std.Debug("block scanner scanning tx: %s ...", txid)
+	//获取bitcoin的交易单
+	trx, err := bs.getVerifiedTransaction(txid)
 
-		//生成者不断生成数据，插入到数据队列尾部
-		case pa := <-producer:
-			values = append(values, pa)
-		case <-quit:
-			//退出
-			//bs.wm.Log.Std.Info("block scanner have been scanned!")
-			return
-		case activeWorker <- activeValue:
-			//wm.Log.Std.Info("Get %d", len(activeValue))
-			values = values[1:]
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
+		return ExtractResult{
+			BlockHeight:     blockHeight,
+			TxID:            txid,
+			extractData:     make(map[string]*openwallet.TxExtractData),
+			extractOmniData: make(map[string]*openwallet.TxExtractData),
+			Success:         false,
 		}
 	}
 
+	return bs.extractTransactionDetail(blockHeight, blockHash, trx, scanAddressFunc)
 }
 
-//ExtractTransaction 提取交易单
-func (bs *NEOBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
+//extractTransactionDetail 提取已获取的交易单，交易单可来自 getrawtransaction 或完整的 getblock
+func (bs *NEOBlockScanner) extractTransactionDetail(blockHeight uint64, blockHash string, trx *Transaction, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
 
 	var (
 		result = ExtractResult{
 			BlockHeight:     blockHeight,
-			TxID:            txid,
+			TxID:            trx.TxID,
 			extractData:     make(map[string]*openwallet.TxExtractData),
 			extractOmniData: make(map[string]*openwallet.TxExtractData),
 		}
@@ -579,52 +763,53 @@ func (bs *NEOBlockScanner) ExtractTransaction(blockHeight uint64, blockHash stri
 		omniTrx *OmniTransaction
 	)
 
-	//bs.wm.Log.Std.Debug("block scanner scanning tx: %s ...", txid)
-	//获取bitcoin的交易单
-	trx, err := bs.wm.GetTransaction(txid)
-
-	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
-		result.Success = false
-		return result
-	}
-
 	//优先使用传入的高度
 	if blockHeight > 0 && trx.BlockHeight == 0 {
 		trx.BlockHeight = blockHeight
 		trx.BlockHash = blockHash
 	}
 
-	if bs.wm.Config.OmniSupport {
-		//获取omni的交易单
-		omniTrx, _ = bs.wm.GetOmniTransaction(txid)
+	//本地创建的注册资产交易已上链，登记全局资产
+	if trx.BlockHeight > 0 {
+		err := bs.wm.confirmUTXOAssetRegistration(trx.TxID)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not register utxo asset; unexpected error: %v", err)
+			result.Success = false
+			return result
+		}
 	}
 
-	if omniTrx != nil {
-		result.IsOmniTransfer = true
+	//离线导入没有合约执行日志，只提取全局资产
+	if bs.wm.Config.OmniSupport && !bs.offline {
+		//获取omni的交易单
+		omniTrx, _ = bs.wm.GetOmniTransaction(trx.TxID)
 	}
 
-	bs.extractTransaction(trx, &result, scanAddressFunc)
-
 	if omniTrx != nil {
-		bs.extractOmniTransaction(omniTrx, &result, scanAddressFunc)
+		result.IsOmniTransfer = true
 	}
 
-	/*//bs.wm.Log.Debug("start extractTransaction")
 	bs.extractTransaction(trx, &result, scanAddressFunc)
-	//bs.wm.Log.Debug("end extractTransaction")
 
-	if bs.wm.Config.OmniSupport {
-		//获取omni的交易单
-		omniTrx, err := bs.wm.GetOmniTransaction(txid)
+	//使用本地索引时，从应用日志提取观察地址的NEP-5转账
+	if result.Success && bs.wm.Config.LocalUnspentIndex && bs.wm.Config.RPCServerType == RPCServerCore &&
+		!bs.offline && trx.Type == "InvocationTransaction" {
+		transfers, err := bs.wm.GetNEP5Transfers(trx.TxID)
 		if err != nil {
-			//bs.wm.Log.Std.Info("block scanner can not extract omni transaction data; unexpected error: %v", err)
-			result.Success = true
+			bs.wm.Log.Std.Info("block scanner can not get nep5 transfers; unexpected error: %v", err)
+			result.Success = false
 			return result
 		}
+		for _, transfer := range transfers {
+			if _, ok := scanAddressFunc(transfer.Address); ok {
+				result.nep5Transfers = append(result.nep5Transfers, transfer)
+			}
+		}
+	}
 
+	if omniTrx != nil {
 		bs.extractOmniTransaction(omniTrx, &result, scanAddressFunc)
-	}*/
+	}
 
 	return result
 
@@ -786,26 +971,27 @@ func (bs *NEOBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 				intxid := input.TxID
 				vout := input.Vout
 
-				preTx, err := bs.wm.GetTransaction(intxid)
+				//交易池中的交易，引用的输出尚未花费
+				preOut, err := bs.resolvePrevOutput(intxid, vout, trx.BlockHeight == 0)
 				if err != nil {
 					success = false
 					break
-				} else {
-					preVouts := preTx.Vouts
-					if len(preVouts) > int(vout) {
-						preOut := preVouts[vout]
-						input.Addr = preOut.Addr
-						input.Value = preOut.Value
-						//vinout = append(vinout, output[vout])
-						success = true
-						//bs.wm.Log.Debug("GetTxOut:", output[vout])
-					}
+				} else if preOut != nil {
+					input.Addr = preOut.Addr
+					input.Value = preOut.Value
+					input.Asset = preOut.Asset
+					//vinout = append(vinout, output[vout])
+					success = true
+					//bs.wm.Log.Debug("GetTxOut:", output[vout])
 				}
 
 			}
 
 		}
 
+		//缓存本交易的输出，后续交易的输入可直接引用
+		bs.outputs.Add(trx.TxID, trx.Vouts)
+
 		if success {
 
 			//提取出账部分记录
@@ -818,13 +1004,10 @@ func (bs *NEOBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 
 			for _, extractData := range result.extractData {
 				tx := &openwallet.Transaction{
-					From: from,
-					To:   to,
-					Fees: totalSpent.Sub(totalReceived).StringFixed(bs.wm.Decimal()),
-					Coin: openwallet.Coin{
-						Symbol:     bs.wm.Symbol(),
-						IsContract: false,
-					},
+					From:        from,
+					To:          to,
+					Fees:        totalSpent.Sub(totalReceived).StringFixed(bs.wm.Decimal()),
+					Coin:        extractDataCoin(extractData),
 					BlockHash:   trx.BlockHash,
 					BlockHeight: trx.BlockHeight,
 					TxID:        trx.TxID,
@@ -848,6 +1031,41 @@ func (bs *NEOBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 	result.Success = success
 }
 
+//resolvePrevOutput 查找交易输入引用的上一笔输出，先查最近输出缓存，未命中再查询节点
+//unspent 为 true 时输出应未花费，先用 gettxout 查询，否则直接获取上一笔交易
+//离线导入时只查询本地未花费索引
+func (bs *NEOBlockScanner) resolvePrevOutput(txid string, n uint64, unspent bool) (*Vout, error) {
+
+	if output, ok := bs.outputs.Get(txid, n); ok {
+		return output, nil
+	}
+
+	if bs.offline {
+		return bs.wm.getIndexedOutput(txid, n)
+	}
+
+	//验证区块头链时 gettxout 的结果无法与原始交易核对，直接获取上一笔交易
+	if unspent && !bs.verifyHeaderChain() {
+		output, err := bs.wm.GetTxOut(txid, n)
+		if err == nil && len(output.Addr) > 0 {
+			output.N = n
+			return output, nil
+		}
+	}
+
+	preTx, err := bs.getVerifiedTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	bs.outputs.Add(txid, preTx.Vouts)
+
+	if len(preTx.Vouts) > int(n) {
+		return preTx.Vouts[n], nil
+	}
+
+	return nil, nil
+}
+
 //ExtractTxInput 提取交易单输入部分
 func (bs *NEOBlockScanner) extractTxInput(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) ([]string, decimal.Decimal) {
 
@@ -878,8 +1096,11 @@ func (bs *NEOBlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 
 		amount := output.Value
 		addr := output.Addr
+		asset, registered := bs.wm.GetUTXOAsset(output.Asset)
 		sourceKey, ok := scanAddressFunc(addr)
-		if ok {
+		//未登记的全局资产不提取
+		if ok && registered {
+			coin := bs.wm.GetUTXOAssetCoin(asset)
 			input := openwallet.TxInput{}
 			input.SourceTxID = txid
 			input.SourceIndex = vout
@@ -887,12 +1108,9 @@ func (bs *NEOBlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 			input.Address = addr
 			//transaction.AccountID = a.AccountID
 			input.Amount = amount
-			input.Coin = openwallet.Coin{
-				Symbol:     bs.wm.Symbol(),
-				IsContract: false,
-			}
+			input.Coin = coin
 			input.Index = output.N
-			input.Sid = openwallet.GenTxInputSID(txid, bs.wm.Symbol(), "", uint64(i))
+			input.Sid = openwallet.GenTxInputSID(txid, bs.wm.Symbol(), coin.ContractID, uint64(i))
 			//input.Sid = base64.StdEncoding.EncodeToString(crypto.SHA1([]byte(fmt.Sprintf("input_%s_%d_%s", result.txID, i, addr))))
 			input.CreateAt = createAt
 			//在哪个区块高度时消费
@@ -913,8 +1131,11 @@ func (bs *NEOBlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 		}
 
 		from = append(from, addr+":"+amount)
-		dAmount, _ := decimal.NewFromString(amount)
-		totalAmount = totalAmount.Add(dAmount)
+		//手续费以GAS支付，只统计GAS
+		if normalizeAssetID(output.Asset) == neoTransaction.NeoGasAssetId {
+			dAmount, _ := decimal.NewFromString(amount)
+			totalAmount = totalAmount.Add(dAmount)
+		}
 
 	}
 	return from, totalAmount
@@ -943,8 +1164,11 @@ func (bs *NEOBlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 		amount := output.Value
 		n := output.N
 		addr := output.Addr
+		asset, registered := bs.wm.GetUTXOAsset(output.Asset)
 		sourceKey, ok := scanAddressFunc(addr)
-		if ok {
+		//未登记的全局资产不提取
+		if ok && registered {
+			coin := bs.wm.GetUTXOAssetCoin(asset)
 
 			//a := wallet.GetAddress(addr)
 			//if a == nil {
@@ -956,12 +1180,9 @@ func (bs *NEOBlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 			outPut.Address = addr
 			//transaction.AccountID = a.AccountID
 			outPut.Amount = amount
-			outPut.Coin = openwallet.Coin{
-				Symbol:     bs.wm.Symbol(),
-				IsContract: false,
-			}
+			outPut.Coin = coin
 			outPut.Index = n
-			outPut.Sid = openwallet.GenTxOutPutSID(txid, bs.wm.Symbol(), "", n)
+			outPut.Sid = openwallet.GenTxOutPutSID(txid, bs.wm.Symbol(), coin.ContractID, n)
 			//outPut.Sid = base64.StdEncoding.EncodeToString(crypto.SHA1([]byte(fmt.Sprintf("output_%s_%d_%s", txid, n, addr))))
 
 			//保存utxo到扩展字段
@@ -985,17 +1206,39 @@ func (bs *NEOBlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 		}
 
 		to = append(to, addr+":"+amount)
-		dAmount, _ := decimal.NewFromString(amount)
-		totalAmount = totalAmount.Add(dAmount)
+		if normalizeAssetID(output.Asset) == neoTransaction.NeoGasAssetId {
+			dAmount, _ := decimal.NewFromString(amount)
+			totalAmount = totalAmount.Add(dAmount)
+		}
 
 	}
 
 	return to, totalAmount
 }
 
+//extractDataCoin 提取数据对应的币种，取第一个输入或输出的资产
+func extractDataCoin(extractData *openwallet.TxExtractData) openwallet.Coin {
+	if len(extractData.TxInputs) > 0 {
+		return extractData.TxInputs[0].Coin
+	}
+	if len(extractData.TxOutputs) > 0 {
+		return extractData.TxOutputs[0].Coin
+	}
+	return openwallet.Coin{}
+}
+
 //newExtractDataNotify 发送通知
 func (bs *NEOBlockScanner) newExtractDataNotify(height uint64, extractData map[string]*openwallet.TxExtractData) error {
 
+	//已上链的收款更新地址池状态
+	if height > 0 {
+		for _, data := range extractData {
+			for _, output := range data.TxOutputs {
+				bs.wm.markPoolAddressFunded(output.Address, height)
+			}
+		}
+	}
+
 	for o, _ := range bs.Observers {
 		for key, data := range extractData {
 			err := o.BlockExtractDataNotify(key, data)
@@ -1271,9 +1514,12 @@ func (bs *NEOBlockScanner) SaveUnscanRecord(record *UnscanRecord) error {
 //GetBlockHeight 获取区块链高度
 func (wm *WalletManager) GetBlockHeight() (uint64, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getBlockHeightByExplorer()
-	} else {
+	case RPCServerP2P:
+		return wm.getBlockHeightByP2P()
+	default:
 		return wm.getBlockHeightByCore()
 	}
 }
@@ -1339,9 +1585,12 @@ func (wm *WalletManager) SaveLocalBlock(block *Block) {
 //GetBlockHash 根据区块高度获得区块hash
 func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getBlockHashByExplorer(height)
-	} else {
+	case RPCServerP2P:
+		return wm.getBlockHashByP2P(height)
+	default:
 		return wm.getBlockHashByCore(height)
 	}
 }
@@ -1386,9 +1635,12 @@ func (wm *WalletManager) GetLocalBlock(height uint64) (*Block, error) {
 //GetBlock 获取区块数据
 func (wm *WalletManager) GetBlock(hash string) (*Block, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getBlockByExplorer(hash)
-	} else {
+	case RPCServerP2P:
+		return wm.getBlockByP2P(hash)
+	default:
 		return wm.getBlockByCore(hash)
 	}
 }
@@ -1416,9 +1668,12 @@ func (wm *WalletManager) getBlockByCore(hash string, format ...uint64) (*Block,
 //GetTxIDsInMemPool 获取待处理的交易池中的交易单IDs
 func (wm *WalletManager) GetTxIDsInMemPool() ([]string, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getTxIDsInMemPoolByExplorer()
-	} else {
+	case RPCServerP2P:
+		return wm.getTxIDsInMemPoolByP2P()
+	default:
 		return wm.getTxIDsInMemPoolByCore()
 	}
 }
@@ -1451,9 +1706,12 @@ func (wm *WalletManager) getTxIDsInMemPoolByCore() ([]string, error) {
 //GetTransaction 获取交易单
 func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getTransactionByExplorer(txid)
-	} else {
+	case RPCServerP2P:
+		return wm.getTransactionByP2P(txid)
+	default:
 		return wm.getTransactionByCore(txid)
 	}
 }
@@ -1491,9 +1749,12 @@ func (wm *WalletManager) getTransactionByCore(txid string) (*Transaction, error)
 //GetTxOut 获取交易单输出信息，用于追溯交易单输入源头
 func (wm *WalletManager) GetTxOut(txid string, vout uint64) (*Vout, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.getTxOutByExplorer(txid, vout)
-	} else {
+	case RPCServerP2P:
+		return wm.getTxOutByP2P(txid, vout)
+	default:
 		return wm.getTxOutByCore(txid, vout)
 	}
 }
@@ -1671,28 +1932,25 @@ func (bs *NEOBlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 //Run 运行
 func (bs *NEOBlockScanner) Run() error {
 
-	//使用浏览器，开启socketIO监听内存池交易
-	if bs.wm.Config.RPCServerType == RPCServerExplorer {
-		if bs.socketIO == nil {
-			go bs.setupSocketIO()
-		}
-	}
+	//配置了节点推送，收到新区块立即扫描
+	bs.startPushSubscriber()
 
 	bs.BlockScannerBase.Run()
 
+	//继续未完成的重扫任务
+	bs.resumeRescanJobs()
+
 	return nil
 }
 
 ////Stop 停止扫描
 func (bs *NEOBlockScanner) Stop() error {
 
-	if bs.socketIO != nil {
-		bs.socketIO.Close()
-		bs.socketIO = nil
-	}
+	bs.stopPushSubscriber()
 
-	//通知停止线程
-	bs.stopSocketIO <- struct{}{}
+	if bs.wm.P2PClient != nil {
+		bs.wm.P2PClient.Close()
+	}
 
 	bs.BlockScannerBase.Stop()
 	return nil
@@ -1719,144 +1977,6 @@ func (bs *NEOBlockScanner) Stop() error {
 //	return nil
 //}
 
-/******************* 使用insight socket.io 监听区块 *******************/
-
-func (bs *NEOBlockScanner) connectSocketIO(disconnected chan struct{}) (*gosocketio.Client, error) {
-
-	var (
-		room = "inv"
-	)
-
-	apiUrl, err := url.Parse(bs.wm.Config.ServerAPI)
-	if err != nil {
-		return nil, err
-	}
-	domain := apiUrl.Hostname()
-	port := common.NewString(apiUrl.Port()).Int()
-	bs.wm.Log.Info("block scanner socketIO connecting")
-	socketIO, err := gosocketio.Dial(
-		gosocketio.GetUrl(domain, port, false),
-		transport.GetDefaultWebsocketTransport())
-	if err != nil {
-		return nil, err
-	}
-
-	err = socketIO.On("tx", func(h *gosocketio.Channel, args interface{}) {
-		//bs.wm.Log.Info("block scanner socketIO get new transaction received: ", args)
-		txMap, ok := args.(map[string]interface{})
-		if ok {
-			txid := txMap["txid"].(string)
-			//bs.wm.Log.Debugf("new tx: %s", txid)
-			errInner := bs.BatchExtractTransaction(0, "", []string{txid})
-			if errInner != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", errInner)
-			}
-		}
-
-	})
-	if err != nil {
-		socketIO.Close()
-		return nil, err
-	}
-
-	/*
-		err = bs.socketIO.On("block", func(h *gosocketio.Channel, args interface{}) {
-			bs.wm.Log.Info("block scanner socketIO get new block received: ", args)
-			hash, ok := args.(string)
-			if ok {
-
-				block, errInner := bs.wm.GetBlock(hash)
-				if errInner != nil {
-					bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", errInner)
-				}
-
-				errInner = bs.scanBlock(block)
-				if errInner != nil {
-					bs.wm.Log.Std.Info("block scanner can not block: %d; unexpected error: %v", block.Height, errInner)
-				}
-			}
-
-		})
-		if err != nil {
-			return err
-		}
-	*/
-
-	err = socketIO.On(gosocketio.OnDisconnection, func(h *gosocketio.Channel) {
-		bs.wm.Log.Info("block scanner socketIO disconnected")
-		disconnected <- struct{}{}
-	})
-	if err != nil {
-		socketIO.Close()
-		return nil, err
-	}
-
-	err = socketIO.On(gosocketio.OnConnection, func(h *gosocketio.Channel) {
-		bs.wm.Log.Info("block scanner socketIO connected")
-		h.Emit("subscribe", room)
-	})
-	if err != nil {
-		socketIO.Close()
-		return nil, err
-	}
-	return socketIO, nil
-}
-
-//setupSocketIO 配置socketIO监听新区块
-func (bs *NEOBlockScanner) setupSocketIO() error {
-
-	bs.wm.Log.Info("block scanner use socketIO to listen new data")
-
-	var (
-		err error
-		//连接状态通道
-		reconnect = make(chan bool, 1)
-		//断开状态通道
-		disconnected = make(chan struct{}, 1)
-		//重连时的等待时间
-		reconnectWait = 5
-		socketIO      *gosocketio.Client
-	)
-
-	defer func() {
-		close(reconnect)
-		close(disconnected)
-	}()
-
-	//启动连接
-	reconnect <- true
-
-	//重连运行时
-	for {
-		select {
-		case <-reconnect:
-			//重新连接
-			socketIO, err = bs.connectSocketIO(disconnected)
-			bs.socketIO = socketIO
-			if err != nil {
-				bs.wm.Log.Errorf("Connect socketIO failed unexpected error: %v", err)
-				disconnected <- struct{}{}
-			}
-
-		case <-disconnected:
-
-			if bs.socketIO != nil {
-				bs.socketIO.Close()
-			}
-
-			//重新连接，前等待
-			bs.wm.Log.Info("Auto reconnect after", reconnectWait, "seconds...")
-			time.Sleep(time.Duration(reconnectWait) * time.Second)
-			reconnect <- true
-		case <-bs.stopSocketIO:
-			bs.wm.Log.Info("block scanner socketIO has been stopped")
-			return nil
-		}
-	}
-
-	return nil
-}
-
 // GetBlockByHeight 获取指定区块高度的区块信息
 func (wm *WalletManager) GetBlockByHeight(height uint64, format ...interface{}) (*Block, error) {
 	return wm.getBlockByHeightOnCore(height, format)
@@ -0,0 +1,396 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/shopspring/decimal"
+)
+
+//chain.{start}.acc 格式的文件带起始高度
+var chainAccStartPattern = regexp.MustCompile(`^chain\.(\d+)\.acc$`)
+
+//ChainAccReader 顺序读取 neo-cli 导出的 chain.acc 离线区块文件，支持 chain.acc.zip 压缩包
+//文件格式：[起始高度 uint32] + 区块数量 uint32 + 逐个区块的 长度 int32 + 区块序列化数据
+type ChainAccReader struct {
+	closers []io.Closer
+	reader  *bufio.Reader
+	start   uint64
+	count   uint64
+	next    uint64 //下一个区块的序号
+	offset  int64  //已读取的字节数，用于定位损坏的数据
+}
+
+//OpenChainAcc 打开离线区块文件
+// path : chain.acc、chain.{start}.acc 或者对应的 zip 压缩包
+func OpenChainAcc(path string) (*ChainAccReader, error) {
+
+	r := &ChainAccReader{}
+
+	name := filepath.Base(path)
+	var stream io.Reader
+
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, archive)
+
+		var entry *zip.File
+		for _, f := range archive.File {
+			if strings.HasSuffix(f.Name, ".acc") {
+				entry = f
+				break
+			}
+		}
+		if entry == nil {
+			r.Close()
+			return nil, fmt.Errorf("no .acc file in %s", name)
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.closers = append(r.closers, rc)
+		stream = rc
+		name = filepath.Base(entry.Name)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, f)
+		stream = f
+	}
+
+	r.reader = bufio.NewReaderSize(stream, 1<<20)
+
+	if chainAccStartPattern.MatchString(name) {
+		start, err := r.readUint32()
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("invalid chain.acc start height: %v", err)
+		}
+		r.start = uint64(start)
+	}
+
+	count, err := r.readUint32()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("invalid chain.acc block count: %v", err)
+	}
+	r.count = uint64(count)
+
+	return r, nil
+}
+
+//Start 文件中第一个区块的高度
+func (r *ChainAccReader) Start() uint64 {
+	return r.start
+}
+
+//Count 文件中的区块数量
+func (r *ChainAccReader) Count() uint64 {
+	return r.count
+}
+
+//Next 读取下一个区块，读完返回 io.EOF
+func (r *ChainAccReader) Next() (uint64, *neoTransaction.Block, error) {
+	height, data, err := r.nextRaw()
+	if err != nil {
+		return height, nil, err
+	}
+	block, err := neoTransaction.DecodeBlock(data)
+	if err != nil {
+		return height, nil, fmt.Errorf("decode block %d failed: %v", height, err)
+	}
+	if uint64(block.Index) != height {
+		return height, nil, fmt.Errorf("block index %d does not match its position %d in chain.acc", block.Index, height)
+	}
+	return height, block, nil
+}
+
+//Close 关闭文件
+func (r *ChainAccReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if e := r.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+//nextRaw 读取下一个区块的序列化数据
+func (r *ChainAccReader) nextRaw() (uint64, []byte, error) {
+	height := r.start + r.next
+	if r.next >= r.count {
+		return height, nil, io.EOF
+	}
+	offset := r.offset
+	size, err := r.readUint32()
+	if err != nil {
+		return height, nil, fmt.Errorf("read block %d size failed: %v", height, err)
+	}
+	//区块必须能放入一个P2P消息，超出的长度来自损坏的文件，不分配内存
+	if int32(size) <= 0 || size > p2pMaxPayloadSize {
+		return height, nil, fmt.Errorf("invalid block %d size: %d at offset %d", height, int32(size), offset)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return height, nil, fmt.Errorf("read block %d failed: %v", height, err)
+	}
+	r.offset += int64(size)
+	r.next++
+	return height, data, nil
+}
+
+func (r *ChainAccReader) readUint32() (uint32, error) {
+	var v uint32
+	err := binary.Read(r.reader, binary.LittleEndian, &v)
+	if err == nil {
+		r.offset += 4
+	}
+	return v, err
+}
+
+//ImportChainAcc 从离线区块文件导入区块，与RPC数据源使用相同的交易提取流程
+//紧接本地扫描高度的区块推进扫描高度，用于初始化；已扫描过的区块重新提取并通知，用于离线审计
+//导入期间不查询节点，交易输入只从文件中已读取的输出和本地未花费索引中查找
+// path : 离线区块文件
+// startHeight : 开始导入的高度
+// endHeight : 结束导入的高度，0表示导入到文件末尾
+//返回最后导入的区块高度
+func (bs *NEOBlockScanner) ImportChainAcc(path string, startHeight, endHeight uint64) (uint64, error) {
+
+	if bs.Scanning {
+		return 0, fmt.Errorf("block scanner is running, pause it before importing blocks")
+	}
+
+	r, err := OpenChainAcc(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	if startHeight < r.Start() {
+		startHeight = r.Start()
+	}
+
+	importer := bs.newOfflineScanner()
+
+	imported := uint64(0)
+	for {
+		height, raw, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		if endHeight > 0 && height > endHeight {
+			break
+		}
+
+		block, err := bs.wm.newBlockByRaw(raw)
+		if err != nil {
+			return imported, err
+		}
+
+		//开始高度之前的区块只缓存输出，用于查找之后交易的输入
+		if height < startHeight {
+			for _, trx := range block.txDetails {
+				importer.outputs.Add(trx.TxID, trx.Vouts)
+			}
+			continue
+		}
+
+		err = importer.importBlock(block)
+		if err != nil {
+			return imported, err
+		}
+		imported = height
+	}
+
+	return imported, nil
+}
+
+//newOfflineScanner 创建离线导入使用的扫描器，共享地址查询和观察者
+func (bs *NEOBlockScanner) newOfflineScanner() *NEOBlockScanner {
+	importer := NewNEOBlockScanner(bs.wm)
+	importer.offline = true
+	importer.ScanAddressFunc = bs.ScanAddressFunc
+	importer.Observers = bs.Observers
+	importer.NEOBlockObservers = bs.NEOBlockObservers
+	return importer
+}
+
+//importBlock 提取离线区块的交易并保存
+func (bs *NEOBlockScanner) importBlock(block *Block) error {
+
+	merkleRoot, err := neoTransaction.ComputeMerkleRoot(block.tx)
+	if err != nil {
+		return err
+	}
+	if merkleRoot != normalizeAssetID(block.Merkleroot) {
+		return fmt.Errorf("block %d merkle root does not match its transactions", block.Height)
+	}
+
+	bs.wm.Log.Std.Info("block scanner importing height: %d ...", block.Height)
+
+	results := bs.extractBlock(block, bs.ScanAddressFunc)
+
+	localHeight, localHash := bs.wm.GetLocalNewBlock()
+
+	//紧接本地扫描高度，或者本地尚未扫描
+	if block.Height == localHeight+1 || (block.Height >= localHeight && len(localHash) == 0) {
+
+		if len(localHash) > 0 && normalizeAssetID(localHash) != normalizeAssetID(block.Previousblockhash) {
+			return fmt.Errorf("block %d does not link to local block %s", block.Height, localHash)
+		}
+
+		//浏览器模式下导入的区块同样加入本地区块头链
+		if bs.verifyHeaderChain() {
+			chainHeader, err := bs.verifyBlockHeader(block)
+			if err != nil {
+				return err
+			}
+			err = bs.wm.saveChainHeader(chainHeader)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = bs.commitExtractResults(block.Height, results)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+		}
+
+		err = bs.wm.saveScannedBlock(block.Height, block.Hash, results)
+		if err != nil {
+			return err
+		}
+		bs.wm.SaveLocalBlock(block)
+
+		bs.newBlockNotify(block, false)
+		return nil
+	}
+
+	err = bs.commitExtractResults(block.Height, results)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+	}
+
+	//重新提取的输出同样写入未花费索引
+	return bs.wm.saveBackfillUnspents(block.Height, results, false)
+}
+
+//newBlockByRaw 离线区块转换为与 getblock 详细模式一致的区块数据
+func (wm *WalletManager) newBlockByRaw(raw *neoTransaction.Block) (*Block, error) {
+
+	hash, err := raw.GetHash()
+	if err != nil {
+		return nil, err
+	}
+
+	nextConsensus, err := wm.Decoder.ScriptHashToAddress(hex.EncodeToString(raw.NextConsensus), false)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		Hash:              "0x" + hash,
+		Merkleroot:        "0x" + raw.MerkleRoot,
+		Previousblockhash: "0x" + raw.PrevHash,
+		Height:            uint64(raw.Index),
+		Version:           uint64(raw.Version),
+		Time:              uint64(raw.Timestamp),
+		Nonce:             fmt.Sprintf("%016x", raw.ConsensusData),
+		NextConsensus:     nextConsensus,
+		Invocation:        hex.EncodeToString(raw.Script.GetInvocationScript()),
+		Verification:      hex.EncodeToString(raw.Script.GetVerificationScript()),
+		isVerbose:         true,
+	}
+
+	for _, rawTx := range raw.Transactions {
+		trx, err := wm.newTxByRaw(rawTx)
+		if err != nil {
+			return nil, err
+		}
+		trx.BlockHash = block.Hash
+		trx.BlockHeight = block.Height
+		trx.Blocktime = int64(block.Time)
+		block.tx = append(block.tx, trx.TxID)
+		block.txDetails = append(block.txDetails, trx)
+	}
+
+	return block, nil
+}
+
+//newTxByRaw 离线交易转换为与 getrawtransaction 详细模式一致的交易数据
+func (wm *WalletManager) newTxByRaw(rawTx *neoTransaction.Transaction) (*Transaction, error) {
+
+	txid, err := rawTx.GetHash()
+	if err != nil {
+		return nil, err
+	}
+
+	trx := &Transaction{
+		TxID:       "0x" + txid,
+		Type:       rawTx.GetTypeName(),
+		Version:    uint64(rawTx.Version),
+		Attributes: new([]Attribute),
+		Vins:       make([]*Vin, 0),
+		Vouts:      make([]*Vout, 0),
+	}
+
+	for _, in := range rawTx.Vins {
+		trx.Vins = append(trx.Vins, &Vin{
+			TxID: "0x" + in.GetTxID(),
+			Vout: uint64(in.GetVout()),
+		})
+	}
+
+	for n, out := range rawTx.Vouts {
+		address, err := wm.Decoder.ScriptHashToAddress(hex.EncodeToString(out.GetScriptHash()), false)
+		if err != nil {
+			return nil, err
+		}
+		trx.Vouts = append(trx.Vouts, &Vout{
+			N:     uint64(n),
+			Addr:  address,
+			Value: decimal.New(int64(out.GetValue()), -8).String(),
+			Asset: "0x" + out.GetAssetID(),
+		})
+	}
+
+	return trx, nil
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//newChainAccBlocks 生成 count 个区块，每个区块一笔向 address 转账 i+1 GAS 的交易，花费上一区块交易的输出
+func newChainAccBlocks(t *testing.T, count int, address string) []*neoTransaction.Block {
+	blocks := make([]*neoTransaction.Block, 0, count)
+	prevHash := hex.EncodeToString(make([]byte, 32))
+	prevTxID := hex.EncodeToString(bytes.Repeat([]byte{0x11}, 32))
+	for i := 0; i < count; i++ {
+		txHex, err := neoTransaction.CreateEmptyRawTransaction(neoTransaction.ContractTransaction,
+			[]neoTransaction.Vin{{TxID: prevTxID, Vout: 0}},
+			[]neoTransaction.Vout{{Asset: neoTransaction.NeoGasAssetId, Address: address, Value: uint64(i+1) * 100000000}},
+			nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txBytes, _ := hex.DecodeString(txHex)
+		tx, err := neoTransaction.DecodeRawTransaction(txBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txid, err := tx.GetHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		merkleRoot, err := neoTransaction.ComputeMerkleRoot([]string{txid})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block := &neoTransaction.Block{
+			BlockHeader: neoTransaction.BlockHeader{
+				PrevHash:      prevHash,
+				MerkleRoot:    merkleRoot,
+				Timestamp:     uint32(1500000000 + i),
+				Index:         uint32(i),
+				ConsensusData: uint64(i),
+				NextConsensus: bytes.Repeat([]byte{0x22}, 20),
+				Script:        neoTransaction.NewBlockWitness([]byte{}, []byte{0x51}),
+			},
+			Transactions: []*neoTransaction.Transaction{tx},
+		}
+		prevHash, err = block.GetHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevTxID = txid
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+//writeChainAcc 按 neo-cli 导出格式写入区块，withStart 为 true 时写入起始高度
+func writeChainAcc(t *testing.T, w io.Writer, blocks []*neoTransaction.Block, withStart bool) {
+	if withStart {
+		binary.Write(w, binary.LittleEndian, blocks[0].Index)
+	}
+	binary.Write(w, binary.LittleEndian, uint32(len(blocks)))
+	for _, block := range blocks {
+		data, err := block.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.Write(w, binary.LittleEndian, int32(len(data)))
+		w.Write(data)
+	}
+}
+
+func TestNEOBlockScanner_ImportChainAcc(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	dir, err := ioutil.TempDir("", "neo-chain-acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blocks := newChainAccBlocks(t, 8, address)
+
+	//区块 0 - 4 导出为 chain.acc
+	accFile := filepath.Join(dir, "chain.acc")
+	buf := new(bytes.Buffer)
+	writeChainAcc(t, buf, blocks[:5], false)
+	err = ioutil.WriteFile(accFile, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//区块 5 - 7 导出为 chain.5.acc 并压缩
+	zipFile := filepath.Join(dir, "chain.acc.zip")
+	f, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	entry, err := zw.Create("chain.5.acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChainAcc(t, entry, blocks[5:], true)
+	zw.Close()
+	f.Close()
+
+	//没有可用的节点，导入期间的任何查询都会失败
+	wm, cleanup := newScanTestWallet(t, "http://127.0.0.1:1", address, "account1")
+	defer cleanup()
+	wm.Config.LocalUnspentIndex = true
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, 16)}
+	bs.AddObserver(recorder)
+
+	checkUnspent := func(height int) {
+		utxo, err := wm.ListUnspent(address)
+		if err != nil {
+			t.Fatalf("ListUnspent failed: %v", err)
+		}
+		if utxo.GASUnspent == nil {
+			t.Fatalf("gas unspent not found at %d", height)
+		}
+		txid, _ := blocks[height].Transactions[0].GetHash()
+		txs := *utxo.GASUnspent.UnspentTxs
+		if len(txs) != 1 || txs[0].TxID != txid || utxo.GASUnspent.Amount != fmt.Sprintf("%d", height+1) {
+			t.Fatalf("unspent wrong at %d: %+v, %+v", height, utxo.GASUnspent, txs)
+		}
+	}
+
+	height, err := bs.ImportChainAcc(accFile, 0, 0)
+	if err != nil {
+		t.Fatalf("ImportChainAcc failed: %v", err)
+	}
+	hash, _ := blocks[4].GetHash()
+	localHeight, localHash := wm.GetLocalNewBlock()
+	if height != 4 || localHeight != 4 || localHash != "0x"+hash {
+		t.Fatalf("imported height wrong: %d, %d, %s", height, localHeight, localHash)
+	}
+	if len(recorder.heights) != 5 {
+		t.Fatalf("extract notify count wrong: %v", recorder.heights)
+	}
+	for i, h := range recorder.heights {
+		if h != uint64(i) {
+			t.Fatalf("extract notify out of order: %v", recorder.heights)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-recorder.headers:
+		case <-time.After(time.Second):
+			t.Fatalf("block notify %d not received", i)
+		}
+	}
+	checkUnspent(4)
+
+	//新的导入从未花费索引查找上一文件中的输出
+	height, err = bs.ImportChainAcc(zipFile, 0, 6)
+	if err != nil {
+		t.Fatalf("ImportChainAcc zip failed: %v", err)
+	}
+	if height != 6 {
+		t.Fatalf("imported zip height wrong: %d", height)
+	}
+	data := recorder.data[len(recorder.data)-2]
+	prevTxID, _ := blocks[4].Transactions[0].GetHash()
+	if data.Transaction.BlockHeight != 5 || len(data.TxInputs) != 1 ||
+		data.TxInputs[0].SourceTxID != "0x"+prevTxID || data.TxInputs[0].Amount != "5" {
+		t.Fatalf("input of imported zip block wrong: %+v", data.TxInputs)
+	}
+	checkUnspent(6)
+
+	//已扫描的区块重新提取，不改变扫描高度
+	height, err = bs.ImportChainAcc(accFile, 2, 3)
+	if err != nil {
+		t.Fatalf("ImportChainAcc range failed: %v", err)
+	}
+	if height != 3 || len(recorder.heights) != 9 {
+		t.Fatalf("reimported range wrong: %d, %v", height, recorder.heights)
+	}
+	if localHeight, _ := wm.GetLocalNewBlock(); localHeight != 6 {
+		t.Fatalf("scanned height changed by reimport: %d", localHeight)
+	}
+	checkUnspent(6)
+
+	_, err = bs.ImportChainAcc(zipFile, 0, 0)
+	if err != nil {
+		t.Fatalf("ImportChainAcc remaining zip failed: %v", err)
+	}
+	checkUnspent(7)
+}
+
+func TestChainAccReader_OversizedBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-chain-acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//第二个区块的长度超过P2P消息上限，读取时不分配内存
+	blocks := newChainAccBlocks(t, 1, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	buf := new(bytes.Buffer)
+	writeChainAcc(t, buf, blocks, false)
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data, 2)
+	offset := len(data)
+	data = append(data, 0xff, 0xff, 0xff, 0x7f)
+	accFile := filepath.Join(dir, "chain.acc")
+	err = ioutil.WriteFile(accFile, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenChainAcc(accFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	_, _, err = reader.Next()
+	if err != nil {
+		t.Fatalf("first block should be read: %v", err)
+	}
+	_, _, err = reader.Next()
+	expect := fmt.Sprintf("invalid block 1 size: %d at offset %d", 0x7fffffff, offset)
+	if err == nil || err.Error() != expect {
+		t.Fatalf("oversized block error wrong: %v", err)
+	}
+}
@@ -49,6 +49,9 @@ const (
 	AssetSymbolGAS = "GAS" // UTXO 中的 GAS 符号
 	AssetSymbolNEO = "NEO" // UTXO 中的 NEO 符号
 
+	UTXOAssetProtocol = "utxo" // 全局资产在 openwallet.SmartContract 中的协议名
+	NEP5Protocol      = "nep5" // NEP-5 代币在 openwallet.SmartContract 中的协议名
+
 )
 
 // 将交易地址前缀信息移到适配器中
@@ -80,6 +83,8 @@ type WalletConfig struct {
 	keyDir string
 	//地址导出路径
 	addressDir string
+	//观察钱包描述文件路径
+	watchOnlyDir string
 	//配置文件路径
 	configFilePath string
 	//配置文件名
@@ -146,6 +151,48 @@ type WalletConfig struct {
 	TransFeesScale decimal.Decimal
 	// 超出限制固定值
 	TransFeesFixed decimal.Decimal
+	//注册资产的系统费，私链可配置为0
+	RegisterAssetFee decimal.Decimal
+	//发行资产的系统费，私链可配置为0
+	IssueAssetFee decimal.Decimal
+	//已登记的全局资产，key为资产ID
+	UTXOAssets map[string]*UTXOAsset
+	//NEP-2 加密私钥的 scrypt 参数
+	NEP2Scrypt neoTransaction.ScryptParams
+	//HD派生方式，openwallet 或 bip44
+	HDDerivation string
+	//BIP44派生使用的账户索引
+	BIP44Account uint32
+	//远程签名服务地址，为空时在本地派生私钥签名
+	SignerURL string
+	//远程签名服务的访问令牌
+	SignerToken string
+	//地址池预派生的未分配地址数
+	AddressPoolSize uint64
+	//地址池的间隔限制，最后一个收款地址之后最多派生的地址数
+	AddressGapLimit uint64
+	//扫描区块时预取的区块数，不超过并发扫描线程数
+	ScanLookAhead int
+	//扫描器缓存的最近交易输出数量，用于填充交易输入
+	OutputCacheSize int
+	//是否使用扫描器维护的本地未花费索引，不依赖节点的 getunspents 插件
+	LocalUnspentIndex bool
+	//浏览器数据源时是否验证区块头链，验证失败停止扫描
+	VerifyHeaderChain bool
+	//P2P数据源的网络标识
+	P2PMagic uint32
+	//P2P数据源的创世区块哈希，本地没有扫描记录时作为区块头同步的起点
+	P2PGenesisHash string
+	//节点通知插件的 WebSocket 推送地址，为空时只按定时任务扫描
+	PushURL string
+	//连接推送服务后发送的订阅消息
+	PushSubscribeMessage string
+	//推送连接断开后重连的等待时间
+	PushReconnectWait time.Duration
+	//未确认交易单离开交易池后超过此区块数仍未上链，通知为被丢弃
+	PendingTxDropBlocks uint64
+	//浏览器数据源查询交易池的接口路径
+	ExplorerMemPoolPath string
 }
 
 func NewConfig(symbol string, curveType uint32, decimals int32) *WalletConfig {
@@ -166,6 +213,8 @@ func NewConfig(symbol string, curveType uint32, decimals int32) *WalletConfig {
 	c.keyDir = filepath.Join("data", strings.ToLower(c.Symbol), "key")
 	//地址导出路径
 	c.addressDir = filepath.Join("data", strings.ToLower(c.Symbol), "address")
+	//观察钱包描述文件路径
+	c.watchOnlyDir = filepath.Join("data", strings.ToLower(c.Symbol), "watchonly")
 	//区块链数据
 	//blockchainDir = filepath.Join("data", strings.ToLower(Symbol), "blockchain")
 	//配置文件路径
@@ -210,6 +259,30 @@ func NewConfig(symbol string, curveType uint32, decimals int32) *WalletConfig {
 	c.MinFees = decimal.Zero
 	c.MainNetAddressPrefix = MainNetAddressPrefix
 	c.TestNetAddressPrefix = TestNetAddressPrefix
+	//注册、发行资产的系统费，与主网 protocol.json 一致
+	c.RegisterAssetFee = decimal.New(10000, 0)
+	c.IssueAssetFee = decimal.New(500, 0)
+	//默认登记 NEO 与 GAS
+	c.UTXOAssets = map[string]*UTXOAsset{
+		neoTransaction.NeoAssetId:    {AssetID: neoTransaction.NeoAssetId, Symbol: AssetSymbolNEO, Precision: 0},
+		neoTransaction.NeoGasAssetId: {AssetID: neoTransaction.NeoGasAssetId, Symbol: AssetSymbolGAS, Precision: 8},
+	}
+	//NEP-2 标准 scrypt 参数
+	c.NEP2Scrypt = neoTransaction.DefaultScryptParams
+	//默认沿用openwallet的派生方式，兼容已创建的钱包
+	c.HDDerivation = HDDerivationOpenwallet
+	c.BIP44Account = 0
+	//BIP44 建议的间隔限制
+	c.AddressPoolSize = 20
+	c.AddressGapLimit = 20
+	//追块时并发预取区块
+	c.ScanLookAhead = 5
+	c.OutputCacheSize = 100000
+	c.VerifyHeaderChain = true
+	c.P2PMagic = P2PMagicMainNet
+	c.PushReconnectWait = 5 * time.Second
+	c.PendingTxDropBlocks = 20
+	c.ExplorerMemPoolPath = "mempool"
 
 	//创建目录
 	//file.MkdirAll(c.dbPath)
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+//NewContractAddress 创建验证合约地址，合约地址的 PublicKey 为验证脚本，ExtParam 记录调用参数模板
+//签名参数的 Value 填写签名者的公钥，签名时由该公钥对应的账户地址签名并替换为签名结果
+// accountID : 所属账户
+// verification : 验证脚本
+// params : 调用参数模板
+func (wm *WalletManager) NewContractAddress(accountID string, verification []byte, params []neoTransaction.ContractParameter) (*openwallet.Address, error) {
+
+	if neoTransaction.IsStandardVerification(verification) {
+		return nil, fmt.Errorf("standard verification script should use the public key address")
+	}
+
+	for _, p := range params {
+		if p.Type == neoTransaction.ParamSignature {
+			pub, err := hex.DecodeString(p.Value)
+			if err != nil || len(pub) != neoTransaction.PublicKeySize {
+				return nil, fmt.Errorf("signature parameter should be the public key of signer")
+			}
+		}
+	}
+
+	address, err := wm.Decoder.ScriptToAddress(verification)
+	if err != nil {
+		return nil, err
+	}
+
+	ext, err := json.Marshal(map[string]interface{}{"parameters": params})
+	if err != nil {
+		return nil, err
+	}
+
+	return &openwallet.Address{
+		AccountID: accountID,
+		Address:   address,
+		PublicKey: hex.EncodeToString(verification),
+		Symbol:    wm.Symbol(),
+		WatchOnly: true,
+		ExtParam:  string(ext),
+	}, nil
+}
+
+//isContractAddress 是否为验证合约地址
+func isContractAddress(addr *openwallet.Address) bool {
+	pub, err := hex.DecodeString(addr.PublicKey)
+	if err != nil || len(pub) == 0 {
+		return false
+	}
+	return !neoTransaction.IsStandardVerification(append(append([]byte{neoTransaction.OpPushBytes33}, pub...), neoTransaction.OpCheckSig))
+}
+
+//getContractParameters 获取合约地址的调用参数模板
+func getContractParameters(addr *openwallet.Address) ([]neoTransaction.ContractParameter, error) {
+	params := make([]neoTransaction.ContractParameter, 0)
+	raw := gjson.Get(addr.ExtParam, "parameters")
+	if !raw.Exists() {
+		return params, nil
+	}
+	err := json.Unmarshal([]byte(raw.Raw), &params)
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+//contractWitnessesKey 交易单扩展参数中记录合约地址见证人的字段
+const contractWitnessesKey = "contractWitnesses"
+
+//ContractWitness 合约地址的见证人，合约地址没有私钥，由参数模板中的签名者签名
+type ContractWitness struct {
+	Address    *openwallet.Address        `json:"address"`    //合约地址
+	Signatures []*openwallet.KeySignature `json:"signatures"` //参数模板中签名者的签名
+}
+
+//getContractWitnesses 获取交易单扩展参数中的合约地址见证人
+func getContractWitnesses(rawTx *openwallet.RawTransaction) ([]*ContractWitness, error) {
+	witnesses := make([]*ContractWitness, 0)
+	raw := rawTx.GetExtParam().Get(contractWitnessesKey)
+	if !raw.Exists() {
+		return witnesses, nil
+	}
+	err := json.Unmarshal([]byte(raw.Raw), &witnesses)
+	if err != nil {
+		return nil, err
+	}
+	return witnesses, nil
+}
+
+//appendAddressKeySignatures 添加地址需要的签名，普通地址添加到签名列表，合约地址的见证人记录到交易单扩展参数
+func (decoder *TransactionDecoder) appendAddressKeySignatures(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, keySigs []*openwallet.KeySignature, addr *openwallet.Address) ([]*openwallet.KeySignature, error) {
+
+	if !isContractAddress(addr) {
+		keySigs = append(keySigs, &openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: addr,
+			Message: "",
+		})
+		return keySigs, nil
+	}
+
+	params, err := getContractParameters(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	witness := &ContractWitness{
+		Address:    addr,
+		Signatures: make([]*openwallet.KeySignature, 0),
+	}
+	for _, p := range params {
+		if p.Type != neoTransaction.ParamSignature {
+			continue
+		}
+		signers, err := wrapper.GetAddressList(0, -1, "PublicKey", p.Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(signers) == 0 {
+			return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "signer[%s] of contract address[%s] not found", p.Value, addr.Address)
+		}
+		witness.Signatures = append(witness.Signatures, &openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: signers[0],
+			Message: "",
+		})
+	}
+
+	witnesses, err := getContractWitnesses(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	err = rawTx.SetExtParam(contractWitnessesKey, append(witnesses, witness))
+	if err != nil {
+		return nil, err
+	}
+
+	return keySigs, nil
+}
+
+//newContractTxHash 用签名结果填充合约地址的调用参数，缺少任一签名者的签名时返回错误
+func newContractTxHash(witness *ContractWitness) (*neoTransaction.TxHash, error) {
+
+	addr := witness.Address
+	verification, err := hex.DecodeString(addr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := getContractParameters(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range params {
+		if p.Type != neoTransaction.ParamSignature {
+			continue
+		}
+		found := false
+		for _, keySignature := range witness.Signatures {
+			if keySignature.Address.PublicKey == p.Value && len(keySignature.Signature) > 0 {
+				params[i].Value = keySignature.Signature
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("signature of [%s] for contract address[%s] not found", p.Value, addr.Address)
+		}
+	}
+
+	return &neoTransaction.TxHash{
+		Contract: &neoTransaction.ContractTx{
+			Verification: verification,
+			Parameters:   params,
+		},
+	}, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestContractAddress_Witness(t *testing.T) {
+	wm := &WalletManager{Config: NewConfig(Symbol, CurveType, Decimals)}
+	wm.Decoder = NewAddressDecoder(wm)
+
+	privKey, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	sigPub, err := neoTransaction.SignRawTransaction("00", privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubHex := hex.EncodeToString(sigPub.Pubkey)
+
+	// PUSH5 NUMEQUALVERIFY PUSHBYTES33 <pubkey> CHECKSIG
+	verification := append([]byte{0x55, 0x9d, 0x21}, sigPub.Pubkey...)
+	verification = append(verification, neoTransaction.OpCheckSig)
+
+	contract, err := wm.NewContractAddress("acc", verification, []neoTransaction.ContractParameter{
+		{Type: neoTransaction.ParamSignature, Value: pubHex},
+		neoTransaction.NewIntegerParameter(big.NewInt(5)),
+	})
+	if err != nil {
+		t.Fatalf("NewContractAddress failed: %v", err)
+	}
+	t.Logf("contract address: %s", contract.Address)
+
+	if !isContractAddress(contract) {
+		t.Errorf("contract address not detected")
+	}
+	signer := &openwallet.Address{AccountID: "acc", Address: "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", PublicKey: pubHex}
+	if isContractAddress(signer) {
+		t.Errorf("public key address detected as contract")
+	}
+
+	emptyTrans, err := neoTransaction.CreateEmptyRawTransaction(neoTransaction.ContractTransaction,
+		[]neoTransaction.Vin{{TxID: "eee7e5f815a54b070980c75b3bd0aaf34d197af7566704156faddaaf55d9543b", Vout: 0}},
+		[]neoTransaction.Vout{{Asset: neoTransaction.NeoAssetId, Address: signer.Address, Value: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := neoTransaction.SignRawTransaction(emptyTrans, privKey)
+
+	rawTx := &openwallet.RawTransaction{RawHex: emptyTrans}
+	err = rawTx.SetExtParam(contractWitnessesKey, []*ContractWitness{{
+		Address:    contract,
+		Signatures: []*openwallet.KeySignature{{Address: signer, Signature: hex.EncodeToString(sig.Signature)}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnesses, err := getContractWitnesses(rawTx)
+	if err != nil || len(witnesses) != 1 || witnesses[0].Address.Address != contract.Address {
+		t.Fatalf("contract witnesses wrong: %v", err)
+	}
+
+	txHash, err := newContractTxHash(witnesses[0])
+	if err != nil {
+		t.Fatalf("newContractTxHash failed: %v", err)
+	}
+
+	signed, err := neoTransaction.InsertSignatureIntoEmptyTransaction(emptyTrans, []neoTransaction.TxHash{*txHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !neoTransaction.VerifyRawTransaction(hex.EncodeToString(signed)) {
+		t.Errorf("contract witness verify failed")
+	}
+
+	// 缺少签名者的签名
+	_, err = newContractTxHash(&ContractWitness{Address: contract})
+	if err == nil {
+		t.Errorf("missing signer signature should fail")
+	}
+
+	// 合约见证人没有签名
+	unsigned, err := neoTransaction.InsertSignatureIntoEmptyTransaction(emptyTrans, []neoTransaction.TxHash{{
+		Contract: &neoTransaction.ContractTx{
+			Verification: verification,
+			Parameters:   []neoTransaction.ContractParameter{neoTransaction.NewIntegerParameter(big.NewInt(5))},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if neoTransaction.VerifyRawTransaction(hex.EncodeToString(unsigned)) {
+		t.Errorf("contract witness without signature should not be verified")
+	}
+}
@@ -144,10 +144,36 @@ func (wm *WalletManager) getBlockHeightByExplorer() (uint64, error) {
 	return height, nil
 }
 
-//getTxIDsInMemPoolByExplorer 获取待处理的交易池中的交易单IDs
+//getTxIDsInMemPoolByExplorer 获取待处理的交易池中的交易单IDs，接口路径由 ExplorerMemPoolPath 配置
+//接口返回交易ID数组，或带有 txids 数组的对象，数组元素也可以是带有 txid 的交易对象
 func (wm *WalletManager) getTxIDsInMemPoolByExplorer() ([]string, error) {
 
-	return nil, nil
+	path := wm.Config.ExplorerMemPoolPath
+
+	result, err := wm.ExplorerClient.Call(path, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	list := *result
+	if !list.IsArray() {
+		list = result.Get("txids")
+	}
+	if !list.IsArray() {
+		return nil, errors.New("no query record")
+	}
+
+	txids := make([]string, 0)
+	for _, item := range list.Array() {
+		if item.IsObject() {
+			item = item.Get("txid")
+		}
+		if len(item.String()) > 0 {
+			txids = append(txids, item.String())
+		}
+	}
+
+	return txids, nil
 }
 
 //GetTransaction 获取交易单
@@ -166,6 +192,24 @@ func (wm *WalletManager) getTransactionByExplorer(txid string) (*Transaction, er
 
 }
 
+//getRawTransactionByExplorer 获取原始交易的十六进制数据
+func (wm *WalletManager) getRawTransactionByExplorer(txid string) (string, error) {
+
+	path := fmt.Sprintf("rawtx/%s", txid)
+
+	result, err := wm.ExplorerClient.Call(path, nil, "GET")
+	if err != nil {
+		return "", err
+	}
+
+	rawHex := result.Get("rawtx").String()
+	if len(rawHex) == 0 {
+		return "", fmt.Errorf("raw transaction %s not found", txid)
+	}
+
+	return rawHex, nil
+}
+
 //listUnspentByExplorer 获取未花交易
 func (wm *WalletManager) listUnspentByExplorer(min uint64, address ...string) ([]*UnspentBalance, error) {
 
@@ -229,8 +273,12 @@ func newBlockByExplorer(json *gjson.Result) *Block {
 	obj.tx = txs
 	obj.Previousblockhash = gjson.Get(json.Raw, "previousblockhash").String()
 	obj.Height = gjson.Get(json.Raw, "height").Uint()
-	//obj.Version = gjson.Get(json.Raw, "version").String()
+	obj.Version = gjson.Get(json.Raw, "version").Uint()
 	obj.Time = gjson.Get(json.Raw, "time").Uint()
+	obj.Nonce = gjson.Get(json.Raw, "nonce").String()
+	obj.NextConsensus = gjson.Get(json.Raw, "nextconsensus").String()
+	obj.Invocation = gjson.Get(json.Raw, "script.invocation").String()
+	obj.Verification = gjson.Get(json.Raw, "script.verification").String()
 
 	return obj
 }
@@ -0,0 +1,322 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/asdine/storm"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	headerChainBucket = "headerChain"
+)
+
+//ChainHeader 已验证的区块头，保存在区块链数据库
+type ChainHeader struct {
+	Height        uint64 `json:"height" storm:"id"`
+	Hash          string `json:"hash"`           //小写，不带0x
+	NextConsensus string `json:"next_consensus"` //下一轮共识节点多签脚本哈希，小端序十六进制
+}
+
+//verifyHeaderChain 是否验证区块头链，浏览器数据源不可信，需要验证
+func (bs *NEOBlockScanner) verifyHeaderChain() bool {
+	return bs.wm.Config.VerifyHeaderChain && bs.wm.Config.RPCServerType == RPCServerExplorer
+}
+
+//HeaderChainError 区块头链验证失败的原因，不为nil时扫描器停止扫描
+func (bs *NEOBlockScanner) HeaderChainError() error {
+	bs.headerChainLock.Lock()
+	defer bs.headerChainLock.Unlock()
+	return bs.headerChainErr
+}
+
+//haltHeaderChain 区块头链验证失败，停止扫描
+func (bs *NEOBlockScanner) haltHeaderChain(err error) {
+	bs.headerChainLock.Lock()
+	defer bs.headerChainLock.Unlock()
+	bs.headerChainErr = err
+	bs.wm.Log.Std.Error("block scanner halted, header chain verify failed: %v", err)
+}
+
+//ResetHeaderChain 清空本地区块头链并恢复扫描，下一个扫描的区块作为新的信任起点
+//用于人工确认数据源可信之后
+func (bs *NEOBlockScanner) ResetHeaderChain() error {
+
+	db, err := storm.Open(filepath.Join(bs.wm.Config.DBPath, bs.wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.From(headerChainBucket).Select().Delete(new(ChainHeader))
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	bs.headerChainLock.Lock()
+	defer bs.headerChainLock.Unlock()
+	bs.headerChainErr = nil
+
+	return nil
+}
+
+//verifyBlockHeader 验证区块头并与本地区块头链衔接，返回待保存的区块头
+//区块哈希由区块头计算，默克尔根由交易ID计算，见证人由上一区块的 NextConsensus 验证
+func (bs *NEOBlockScanner) verifyBlockHeader(block *Block) (*ChainHeader, error) {
+
+	header, err := bs.wm.newBlockHeader(block)
+	if err != nil {
+		return nil, fmt.Errorf("block %d header is invalid: %v", block.Height, err)
+	}
+
+	hash, err := header.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("block %d header is invalid: %v", block.Height, err)
+	}
+	if hash != normalizeAssetID(block.Hash) {
+		return nil, fmt.Errorf("block %d hash %s does not match its header, computed hash: %s", block.Height, block.Hash, hash)
+	}
+
+	merkleRoot, err := neoTransaction.ComputeMerkleRoot(block.tx)
+	if err != nil {
+		return nil, fmt.Errorf("block %d merkle root can not be computed: %v", block.Height, err)
+	}
+	if merkleRoot != header.MerkleRoot {
+		return nil, fmt.Errorf("block %d merkle root %s does not match its transactions, computed root: %s", block.Height, header.MerkleRoot, merkleRoot)
+	}
+
+	chainHeader := &ChainHeader{
+		Height:        block.Height,
+		Hash:          hash,
+		NextConsensus: hex.EncodeToString(header.NextConsensus),
+	}
+
+	//已验证过的高度，区块必须与本地区块头一致
+	stored, err := bs.wm.getChainHeader(block.Height)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		if stored.Hash != hash {
+			return nil, fmt.Errorf("block %d hash %s conflicts with local header chain hash %s", block.Height, hash, stored.Hash)
+		}
+		return chainHeader, nil
+	}
+
+	prev, err := bs.wm.getChainHeader(block.Height - 1)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		count, err := bs.wm.countChainHeaders()
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("block %d can not link to local header chain, previous header is missing", block.Height)
+		}
+		//本地区块头链为空，第一个区块作为信任起点
+		bs.wm.Log.Std.Warning("header chain is anchored at block %d hash %s, please verify it out of band", block.Height, hash)
+		return chainHeader, nil
+	}
+
+	if header.PrevHash != prev.Hash {
+		return nil, fmt.Errorf("block %d previous hash %s does not link to local header chain hash %s", block.Height, header.PrevHash, prev.Hash)
+	}
+
+	nextConsensus, err := hex.DecodeString(prev.NextConsensus)
+	if err != nil {
+		return nil, err
+	}
+	err = header.VerifyWitness(nextConsensus)
+	if err != nil {
+		return nil, fmt.Errorf("block %d witness is invalid: %v", block.Height, err)
+	}
+
+	return chainHeader, nil
+}
+
+//checkStoredHeader 重扫区块时检查区块是否与本地区块头链一致，本地没有的高度不检查
+func (bs *NEOBlockScanner) checkStoredHeader(block *Block) error {
+	if !bs.verifyHeaderChain() {
+		return nil
+	}
+	stored, err := bs.wm.getChainHeader(block.Height)
+	if err != nil {
+		return err
+	}
+	if stored != nil && stored.Hash != normalizeAssetID(block.Hash) {
+		return fmt.Errorf("block %d hash %s conflicts with local header chain hash %s", block.Height, block.Hash, stored.Hash)
+	}
+	return nil
+}
+
+//getVerifiedTransaction 获取交易单，验证区块头链时交易单同样来自不可信的数据源，需要与原始交易核对
+func (bs *NEOBlockScanner) getVerifiedTransaction(txid string) (*Transaction, error) {
+
+	trx, err := bs.wm.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	if bs.verifyHeaderChain() {
+		err = bs.verifyTransactionBody(txid, trx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return trx, nil
+}
+
+//verifyTransactionBody 获取原始交易并计算交易ID，交易ID以及交易单的输入输出必须与原始交易一致
+//交易ID已由区块的默克尔根验证，原始交易与之一致才能确认交易单未被篡改
+func (bs *NEOBlockScanner) verifyTransactionBody(txid string, trx *Transaction) error {
+
+	rawHex, err := bs.wm.getRawTransactionByExplorer(txid)
+	if err != nil {
+		return err
+	}
+	txBytes, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return fmt.Errorf("transaction %s raw data is invalid: %v", txid, err)
+	}
+	raw, err := neoTransaction.DecodeRawTransaction(txBytes)
+	if err != nil {
+		return fmt.Errorf("transaction %s raw data is invalid: %v", txid, err)
+	}
+
+	hash, err := raw.GetHash()
+	if err != nil {
+		return fmt.Errorf("transaction %s raw data is invalid: %v", txid, err)
+	}
+	if hash != normalizeAssetID(txid) || hash != normalizeAssetID(trx.TxID) {
+		return fmt.Errorf("transaction %s does not match its raw data, computed hash: %s", txid, hash)
+	}
+
+	if len(trx.Vins) != len(raw.Vins) {
+		return fmt.Errorf("transaction %s inputs do not match its raw data", txid)
+	}
+	for i, in := range raw.Vins {
+		vin := trx.Vins[i]
+		if normalizeAssetID(vin.TxID) != in.GetTxID() || vin.Vout != uint64(in.GetVout()) {
+			return fmt.Errorf("transaction %s input %d does not match its raw data", txid, i)
+		}
+	}
+
+	if len(trx.Vouts) != len(raw.Vouts) {
+		return fmt.Errorf("transaction %s outputs do not match its raw data", txid)
+	}
+	for i, out := range raw.Vouts {
+		vout := trx.Vouts[i]
+		address, err := bs.wm.Decoder.ScriptHashToAddress(hex.EncodeToString(out.GetScriptHash()), false)
+		if err != nil {
+			return err
+		}
+		value, err := decimal.NewFromString(vout.Value)
+		if err != nil || !value.Equal(decimal.New(int64(out.GetValue()), -8)) || vout.Addr != address ||
+			(len(vout.Asset) > 0 && normalizeAssetID(vout.Asset) != out.GetAssetID()) {
+			return fmt.Errorf("transaction %s output %d does not match its raw data", txid, i)
+		}
+	}
+
+	return nil
+}
+
+//newBlockHeader 区块数据转换为区块头
+func (wm *WalletManager) newBlockHeader(block *Block) (*neoTransaction.BlockHeader, error) {
+
+	nonce, err := strconv.ParseUint(block.Nonce, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %s", block.Nonce)
+	}
+
+	scriptHash, err := wm.Decoder.AddressToScriptHash(block.NextConsensus, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid next consensus: %s", block.NextConsensus)
+	}
+	nextConsensus, _ := hex.DecodeString(scriptHash)
+
+	invocation, err := hex.DecodeString(block.Invocation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invocation script: %s", block.Invocation)
+	}
+	verification, err := hex.DecodeString(block.Verification)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification script: %s", block.Verification)
+	}
+
+	return &neoTransaction.BlockHeader{
+		Version:       uint32(block.Version),
+		PrevHash:      normalizeAssetID(block.Previousblockhash),
+		MerkleRoot:    normalizeAssetID(block.Merkleroot),
+		Timestamp:     uint32(block.Time),
+		Index:         uint32(block.Height),
+		ConsensusData: nonce,
+		NextConsensus: nextConsensus,
+		Script:        neoTransaction.NewBlockWitness(invocation, verification),
+	}, nil
+}
+
+//saveChainHeader 保存已验证的区块头
+func (wm *WalletManager) saveChainHeader(header *ChainHeader) error {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.From(headerChainBucket).Save(header)
+}
+
+//getChainHeader 获取本地区块头链指定高度的区块头，不存在返回nil
+func (wm *WalletManager) getChainHeader(height uint64) (*ChainHeader, error) {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var header ChainHeader
+	err = db.From(headerChainBucket).One("Height", height, &header)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+//countChainHeaders 本地区块头链的区块头数量
+func (wm *WalletManager) countChainHeaders() (int, error) {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return db.From(headerChainBucket).Count(new(ChainHeader))
+}
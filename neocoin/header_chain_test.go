@@ -0,0 +1,391 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/tidwall/gjson"
+)
+
+//consensusStandIn 模拟 3/4 共识节点
+type consensusStandIn struct {
+	prikeys      [][]byte //按多签脚本中的公钥顺序排列
+	verification []byte
+}
+
+func newConsensusStandIn(t *testing.T, seed byte) *consensusStandIn {
+	prikeys := make(map[string][]byte)
+	pubkeys := make([][]byte, 0)
+	for i := byte(1); i <= 4; i++ {
+		prikey := bytes.Repeat([]byte{seed + i}, 32)
+		sp, err := neoTransaction.SignDigest(make([]byte, 32), prikey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prikeys[hex.EncodeToString(sp.Pubkey)] = prikey
+		pubkeys = append(pubkeys, sp.Pubkey)
+	}
+	verification, err := neoTransaction.BuildMultiSigVerification(3, pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ordered, _ := neoTransaction.ParseMultiSigVerification(verification)
+	c := &consensusStandIn{verification: verification}
+	for _, pub := range ordered {
+		c.prikeys = append(c.prikeys, prikeys[hex.EncodeToString(pub)])
+	}
+	return c
+}
+
+//sign 前三个共识节点签名区块头，返回调用脚本
+func (c *consensusStandIn) sign(t *testing.T, header *neoTransaction.BlockHeader) []byte {
+	digest, err := header.GetSignDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := neoTransaction.NewScriptBuilder()
+	for _, prikey := range c.prikeys[:3] {
+		sp, err := neoTransaction.SignDigest(digest, prikey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb.EmitPushBytes(sp.Signature)
+	}
+	header.Script = neoTransaction.NewBlockWitness(sb.ToBytes(), c.verification)
+	return sb.ToBytes()
+}
+
+//explorerChainStandIn 模拟浏览器API返回的区块链数据
+type explorerChainStandIn struct {
+	mu     sync.Mutex
+	blocks []map[string]interface{}
+	txs    map[string]map[string]interface{}
+	raws   map[string]string
+	calls  map[string]int
+}
+
+//newExplorerChainStandIn 生成由共识节点签名的区块链，signer 返回区块的签名节点
+func newExplorerChainStandIn(t *testing.T, wm *WalletManager, count int, signer func(height int) *consensusStandIn) *explorerChainStandIn {
+	chain := &explorerChainStandIn{
+		txs:   make(map[string]map[string]interface{}),
+		raws:  make(map[string]string),
+		calls: make(map[string]int),
+	}
+	prev := strings.Repeat("0", 64)
+	for i := 0; i < count; i++ {
+		chain.appendBlock(t, wm, i, prev, signer(i))
+		prev = strings.TrimPrefix(chain.blocks[i]["hash"].(string), "0x")
+	}
+	return chain
+}
+
+//appendBlock 添加一个区块，区块内一笔花费上一区块交易输出的转账
+func (chain *explorerChainStandIn) appendBlock(t *testing.T, wm *WalletManager, height int, prev string, signer *consensusStandIn) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+	prevTxID := fmt.Sprintf("%064x", 0xc0000)
+	if height > 0 {
+		prevTxID = strings.TrimPrefix(chain.blocks[height-1]["merkleroot"].(string), "0x")
+	}
+	rawHex, err := neoTransaction.CreateEmptyRawTransaction(neoTransaction.ContractTransaction,
+		[]neoTransaction.Vin{{TxID: prevTxID, Vout: 0}},
+		[]neoTransaction.Vout{{Asset: neoTransaction.NeoGasAssetId, Address: address, Value: uint64(height+1) * 100000000}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txid, _ := neoTransaction.GetTransactionHash(rawHex)
+	chain.raws[txid] = rawHex
+	chain.txs[txid] = map[string]interface{}{
+		"txid": "0x" + txid,
+		"vin":  []interface{}{map[string]interface{}{"txid": "0x" + prevTxID, "vout": 0}},
+		"vout": []interface{}{map[string]interface{}{"n": 0, "value": fmt.Sprintf("%d", height+1), "scriptPubKey": map[string]interface{}{"addresses": []interface{}{address}}}},
+	}
+
+	nextConsensus, err := wm.Decoder.ScriptToAddress(signer.verification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &neoTransaction.BlockHeader{
+		PrevHash:      prev,
+		MerkleRoot:    txid,
+		Timestamp:     uint32(1500000000 + height),
+		Index:         uint32(height),
+		ConsensusData: uint64(0x1000 + height),
+		NextConsensus: neoTransaction.GetScriptHash(signer.verification),
+	}
+	invocation := signer.sign(t, header)
+	hash, _ := header.GetHash()
+
+	chain.blocks = append(chain.blocks, map[string]interface{}{
+		"hash":              "0x" + hash,
+		"height":            height,
+		"version":           0,
+		"previousblockhash": "0x" + prev,
+		"merkleroot":        "0x" + txid,
+		"time":              1500000000 + height,
+		"nonce":             fmt.Sprintf("%016x", 0x1000+height),
+		"nextconsensus":     nextConsensus,
+		"script":            map[string]interface{}{"invocation": hex.EncodeToString(invocation), "verification": hex.EncodeToString(signer.verification)},
+		"tx":                []interface{}{txid},
+	})
+}
+
+func (chain *explorerChainStandIn) callCount(path string) int {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	return chain.calls[path]
+}
+
+func (chain *explorerChainStandIn) serve() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		chain.calls[strings.Split(path, "/")[0]]++
+
+		var result interface{}
+		switch {
+		case path == "status":
+			result = map[string]interface{}{"info": map[string]interface{}{"blocks": len(chain.blocks)}}
+		case strings.HasPrefix(path, "block-index/"):
+			var height int
+			fmt.Sscanf(path, "block-index/%d", &height)
+			if height < len(chain.blocks) {
+				result = map[string]interface{}{"blockHash": chain.blocks[height]["hash"]}
+			}
+		case strings.HasPrefix(path, "block/"):
+			for _, b := range chain.blocks {
+				if b["hash"] == strings.TrimPrefix(path, "block/") {
+					result = b
+				}
+			}
+		case strings.HasPrefix(path, "tx/"):
+			if tx, ok := chain.txs[normalizeAssetID(strings.TrimPrefix(path, "tx/"))]; ok {
+				result = tx
+			}
+		case strings.HasPrefix(path, "rawtx/"):
+			if raw, ok := chain.raws[normalizeAssetID(strings.TrimPrefix(path, "rawtx/"))]; ok {
+				result = map[string]interface{}{"rawtx": raw}
+			}
+		}
+		if result == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+//newHeaderChainTestWallet 使用浏览器数据源的测试钱包
+func newHeaderChainTestWallet(t *testing.T) (*WalletManager, func()) {
+	wm, cleanup := newScanTestWallet(t, "", "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", "account1")
+	wm.Config.RPCServerType = RPCServerExplorer
+	wm.Blockscanner.IsScanMemPool = false
+	wm.Blockscanner.Scanning = true
+	return wm, cleanup
+}
+
+func TestNEOBlockScanner_VerifyHeaderChain(t *testing.T) {
+	wm, cleanup := newHeaderChainTestWallet(t)
+	defer cleanup()
+
+	validators := newConsensusStandIn(t, 0)
+	chain := newExplorerChainStandIn(t, wm, 8, func(height int) *consensusStandIn { return validators })
+	server := chain.serve()
+	defer server.Close()
+	wm.ExplorerClient = NewExplorer(server.URL+"/", false)
+
+	bs := wm.Blockscanner
+	wm.SaveLocalNewBlock(1, chain.blocks[1]["hash"].(string))
+	bs.ScanBlockTask()
+
+	if height, _ := wm.GetLocalNewBlock(); height != 7 {
+		t.Fatalf("scanned height wrong: %d", height)
+	}
+	if err := bs.HeaderChainError(); err != nil {
+		t.Fatalf("honest chain should pass: %v", err)
+	}
+	if records, _ := wm.GetUnscanRecords(); len(records) != 0 {
+		t.Fatalf("honest transactions should be extracted: %d", len(records))
+	}
+	//第一个扫描的区块作为信任起点
+	if count, _ := wm.countChainHeaders(); count != 6 {
+		t.Fatalf("header chain count wrong: %d", count)
+	}
+
+	//伪造的共识节点签名的区块
+	forger := newConsensusStandIn(t, 100)
+	chain.mu.Lock()
+	chain.appendBlock(t, wm, 8, strings.TrimPrefix(chain.blocks[7]["hash"].(string), "0x"), forger)
+	chain.mu.Unlock()
+
+	bs.ScanBlockTask()
+
+	if height, _ := wm.GetLocalNewBlock(); height != 7 {
+		t.Fatalf("forged block should not be scanned, height: %d", height)
+	}
+	err := bs.HeaderChainError()
+	if err == nil || !strings.Contains(err.Error(), "block 8 witness is invalid") {
+		t.Fatalf("header chain error wrong: %v", err)
+	}
+
+	//停止后不再请求区块
+	calls := chain.callCount("block")
+	bs.ScanBlockTask()
+	if chain.callCount("block") != calls {
+		t.Fatal("halted scanner should not fetch blocks")
+	}
+
+	//人工确认后重置区块头链
+	err = bs.ResetHeaderChain()
+	if err != nil || bs.HeaderChainError() != nil {
+		t.Fatalf("ResetHeaderChain failed: %v", err)
+	}
+	if count, _ := wm.countChainHeaders(); count != 0 {
+		t.Fatalf("header chain not reset: %d", count)
+	}
+}
+
+func TestNEOBlockScanner_VerifyBlockHeader(t *testing.T) {
+	wm, cleanup := newHeaderChainTestWallet(t)
+	defer cleanup()
+
+	validators := newConsensusStandIn(t, 0)
+	chain := newExplorerChainStandIn(t, wm, 3, func(height int) *consensusStandIn { return validators })
+	bs := wm.Blockscanner
+
+	block := func(height int, modify func(b map[string]interface{})) *Block {
+		raw := make(map[string]interface{})
+		for k, v := range chain.blocks[height] {
+			raw[k] = v
+		}
+		if modify != nil {
+			modify(raw)
+		}
+		data, _ := json.Marshal(raw)
+		result := gjson.ParseBytes(data)
+		return newBlockByExplorer(&result)
+	}
+
+	header, err := bs.verifyBlockHeader(block(1, nil))
+	if err != nil {
+		t.Fatalf("anchor block should pass: %v", err)
+	}
+	wm.saveChainHeader(header)
+
+	cases := map[string]func(b map[string]interface{}){
+		"does not match its header":       func(b map[string]interface{}) { b["time"] = 1 },
+		"does not match its transactions": func(b map[string]interface{}) { b["tx"] = []interface{}{fmt.Sprintf("%064x", 1)} },
+		"header is invalid":               func(b map[string]interface{}) { b["nextconsensus"] = "invalid" },
+	}
+	for reason, modify := range cases {
+		_, err = bs.verifyBlockHeader(block(2, modify))
+		if err == nil || !strings.Contains(err.Error(), reason) {
+			t.Fatalf("expected %q, got: %v", reason, err)
+		}
+	}
+
+	//没有衔接到本地区块头链
+	wm.saveChainHeader(&ChainHeader{Height: 1, Hash: strings.Repeat("1", 64), NextConsensus: header.NextConsensus})
+	_, err = bs.verifyBlockHeader(block(2, nil))
+	if err == nil || !strings.Contains(err.Error(), "does not link to local header chain") {
+		t.Fatalf("unlinked block should fail: %v", err)
+	}
+
+	//本地区块头链有缺口
+	_, err = bs.verifyBlockHeader(block(0, nil))
+	if err == nil || !strings.Contains(err.Error(), "previous header is missing") {
+		t.Fatalf("block before local header chain should fail: %v", err)
+	}
+
+	//重扫已验证高度
+	wm.saveChainHeader(header)
+	if err = bs.checkStoredHeader(block(1, nil)); err != nil {
+		t.Fatalf("stored block should pass: %v", err)
+	}
+	wm.saveChainHeader(&ChainHeader{Height: 1, Hash: strings.Repeat("1", 64), NextConsensus: header.NextConsensus})
+	if err = bs.checkStoredHeader(block(1, nil)); err == nil {
+		t.Fatal("conflicting block should fail")
+	}
+}
+
+func TestNEOBlockScanner_VerifyTransactionBody(t *testing.T) {
+	wm, cleanup := newHeaderChainTestWallet(t)
+	defer cleanup()
+	wm.Config.VerifyHeaderChain = true
+
+	validators := newConsensusStandIn(t, 0)
+	chain := newExplorerChainStandIn(t, wm, 5, func(height int) *consensusStandIn { return validators })
+	server := chain.serve()
+	defer server.Close()
+	wm.ExplorerClient = NewExplorer(server.URL+"/", false)
+
+	bs := wm.Blockscanner
+	txid := strings.TrimPrefix(chain.blocks[3]["merkleroot"].(string), "0x")
+
+	trx, err := bs.getVerifiedTransaction(txid)
+	if err != nil || len(trx.Vouts) != 1 {
+		t.Fatalf("honest transaction should pass: %v", err)
+	}
+
+	//篡改交易单的输出金额
+	chain.mu.Lock()
+	tampered := chain.txs[txid]["vout"].([]interface{})[0].(map[string]interface{})
+	tampered["value"] = "100"
+	chain.mu.Unlock()
+	_, err = bs.getVerifiedTransaction(txid)
+	if err == nil || !strings.Contains(err.Error(), "output 0 does not match its raw data") {
+		t.Fatalf("tampered output should fail: %v", err)
+	}
+	chain.mu.Lock()
+	tampered["value"] = "4"
+	chain.mu.Unlock()
+
+	//原始交易与交易ID不一致
+	chain.mu.Lock()
+	chain.raws[txid] = chain.raws[strings.TrimPrefix(chain.blocks[2]["merkleroot"].(string), "0x")]
+	chain.mu.Unlock()
+	_, err = bs.getVerifiedTransaction(txid)
+	if err == nil || !strings.Contains(err.Error(), "does not match its raw data, computed hash") {
+		t.Fatalf("raw transaction with other hash should fail: %v", err)
+	}
+
+	//只重扫部分交易时，与本地区块头链冲突的区块不重扫
+	err = wm.saveChainHeader(&ChainHeader{Height: 4, Hash: strings.Repeat("f", 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txid4 := strings.TrimPrefix(chain.blocks[4]["merkleroot"].(string), "0x")
+	bs.SaveUnscanRecord(NewUnscanRecord(4, txid4, ""))
+	calls := chain.callCount("tx")
+	bs.RescanFailedRecord()
+	if chain.callCount("tx") != calls {
+		t.Fatal("transactions of conflicting block should not be fetched")
+	}
+	if records, _ := wm.GetUnscanRecords(); len(records) != 1 {
+		t.Fatalf("unscan record of conflicting block should be kept: %d", len(records))
+	}
+}
@@ -16,16 +16,19 @@
 package neocoin
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/asdine/storm/q"
 	"github.com/astaxie/beego/config"
-	"github.com/blocktree/go-owcdrivers/owkeychain"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/common/file"
 	"github.com/blocktree/openwallet/hdkeystore"
@@ -51,6 +54,7 @@ type WalletManager struct {
 	WalletClient    *Client                       // 节点客户端
 	OnmiClient      *Client                       // Omni代币节点客户端
 	ExplorerClient  *Explorer                     // 浏览器API客户端
+	P2PClient       *P2PClient                    // P2P协议客户端
 	Config          *WalletConfig                 //钱包管理配置
 	WalletsInSum    map[string]*openwallet.Wallet //参与汇总的钱包
 	Blockscanner    *NEOBlockScanner              //区块扫描器
@@ -58,6 +62,13 @@ type WalletManager struct {
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
 	ContractDecoder *ContractDecoder              //智能合约解析器
+	Signer          Signer                        //交易签名器
+	AddressPools    map[string]*AddressPool       //收款地址池，key为钱包ID
+	WatchOnly       *WatchOnlyRegistry            //观察地址登记表
+
+	addressPoolsLock       sync.RWMutex
+	utxoAssetsLock         sync.RWMutex                      //全局资产登记表的读写锁，扫描器并发读取
+	utxoAssetRegistrations map[string]*UTXOAssetRegistration //待上链确认的注册资产交易
 }
 
 func NewWalletManager() *WalletManager {
@@ -67,12 +78,16 @@ func NewWalletManager() *WalletManager {
 	wm.Storage = storage
 	//参与汇总的钱包
 	wm.WalletsInSum = make(map[string]*openwallet.Wallet)
+	//观察地址登记表，需要在扫描器之前创建
+	wm.WatchOnly = NewWatchOnlyRegistry(&wm)
 	//区块扫描器
 	wm.Blockscanner = NewNEOBlockScanner(&wm)
 	wm.Decoder = NewAddressDecoder(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
 	wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.Signer = NewLocalSigner(&wm)
+	wm.AddressPools = make(map[string]*AddressPool)
 	return &wm
 }
 
@@ -336,8 +351,17 @@ func (wm *WalletManager) CreateBatchAddress(name, password string, count uint64)
 		return "", nil, err
 	}
 
-	//加载钱包
-	key, err := w.HDKey(password)
+	//加载钱包，观察钱包通过扩展公钥派生地址，不需要密码
+	var (
+		key         *hdkeystore.HDKey
+		chain       *HDNode
+		derivedPath string
+	)
+	if w.WatchOnly {
+		chain, derivedPath, err = wm.watchOnlyChain(w, false)
+	} else {
+		key, err = w.HDKey(password)
+	}
 	if err != nil {
 		return "", nil, err
 	}
@@ -382,10 +406,27 @@ func (wm *WalletManager) CreateBatchAddress(name, password string, count uint64)
 		}
 	}
 
-	//解锁钱包
-	err = wm.UnlockWallet(password, 3600)
-	if err != nil {
-		return "", nil, err
+	if !w.WatchOnly {
+		//解锁钱包
+		err = wm.UnlockWallet(password, 3600)
+		if err != nil {
+			return "", nil, err
+		}
+
+		//新地址的父路径
+		derivedPath = wm.addressChainPath(key, false, uint64(timestamp.Unix()))
+	}
+
+	//新地址的起始索引
+	offset := wm.nextAddressIndex(w, derivedPath)
+
+	//创建地址的线程，观察钱包只派生公钥
+	addressWork := func(s, e uint64) {
+		if w.WatchOnly {
+			wm.createWatchOnlyAddressWork(chain, producer, name, derivedPath, s, e)
+		} else {
+			wm.createAddressWork(key, producer, name, derivedPath, s, e)
+		}
 	}
 
 	/*	开启导出的线程，监听新地址，批量导出	*/
@@ -404,9 +445,9 @@ func (wm *WalletManager) CreateBatchAddress(name, password string, count uint64)
 
 			//开始创建地址
 			wm.Log.Std.Info("Start create address thread[%d]", i)
-			s := i * runCount
-			e := (i + 1) * runCount
-			go wm.createAddressWork(key, producer, name, uint64(timestamp.Unix()), s, e)
+			s := offset + i*runCount
+			e := offset + (i+1)*runCount
+			go addressWork(s, e)
 
 			shouldDone++
 		}
@@ -416,9 +457,9 @@ func (wm *WalletManager) CreateBatchAddress(name, password string, count uint64)
 
 		//开始创建地址
 		wm.Log.Std.Info("Start create address thread[REST]")
-		s := count - otherCount
-		e := count
-		go wm.createAddressWork(key, producer, name, uint64(timestamp.Unix()), s, e)
+		s := offset + count - otherCount
+		e := offset + count
+		go addressWork(s, e)
 
 		shouldDone++
 	}
@@ -509,7 +550,30 @@ func (wm *WalletManager) CreateNewWallet(name, password string) (*openwallet.Wal
 		return nil, "", err
 	}
 
-	key, keyFile, err := hdkeystore.StoreHDKeyWithSeed(wm.Config.keyDir, name, password, extSeed, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+	return wm.createWalletWithSeed(name, password, extSeed)
+}
+
+//CreateWalletWithMnemonic 通过BIP39助记词创建钱包，配合BIP44派生可以恢复主流NEO钱包的地址
+func (wm *WalletManager) CreateWalletWithMnemonic(name, password, mnemonic, passphrase string) (*openwallet.Wallet, string, error) {
+
+	//检查钱包名是否存在
+	wallets, err := wm.GetWallets()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, w := range wallets {
+		if w.Alias == name {
+			return nil, "", errors.New("The wallet's alias is duplicated!")
+		}
+	}
+
+	return wm.createWalletWithSeed(name, password, MnemonicToSeed(mnemonic, passphrase))
+}
+
+//createWalletWithSeed 保存种子文件并创建钱包
+func (wm *WalletManager) createWalletWithSeed(name, password string, seed []byte) (*openwallet.Wallet, string, error) {
+
+	key, keyFile, err := hdkeystore.StoreHDKeyWithSeed(wm.Config.keyDir, name, password, seed, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
 	if err != nil {
 		return nil, "", err
 	}
@@ -549,7 +613,7 @@ func (wm *WalletManager) EncryptWallet(password string) error {
 func (wm *WalletManager) GetWallets() ([]*openwallet.Wallet, error) {
 
 	wallets, err := openwallet.GetWalletsByKeyDir(wm.Config.keyDir)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
@@ -557,6 +621,13 @@ func (wm *WalletManager) GetWallets() ([]*openwallet.Wallet, error) {
 		w.DBFile = filepath.Join(wm.Config.DBPath, w.FileName()+".db")
 	}
 
+	//观察钱包没有种子文件，单独加载
+	watchOnlyWallets, err := wm.loadWatchOnlyWallets()
+	if err != nil {
+		return nil, err
+	}
+	wallets = append(wallets, watchOnlyWallets...)
+
 	return wallets, nil
 
 }
@@ -674,17 +745,11 @@ func (wm *WalletManager) GetAddressBalance(walletID, address string) string {
 }
 
 //CreateNewPrivateKey 创建私钥，返回私钥wif格式字符串
-func (wm *WalletManager) CreateNewPrivateKey(accountID string, key *owkeychain.ExtendedKey, derivedPath string, index uint64) (string, *openwallet.Address, error) {
+func (wm *WalletManager) CreateNewPrivateKey(accountID string, key *hdkeystore.HDKey, derivedPath string, index uint64) (string, *openwallet.Address, error) {
 
 	derivedPath = fmt.Sprintf("%s/%d", derivedPath, index)
 	//fmt.Printf("derivedPath = %s\n", derivedPath)
-	childKey, err := key.GenPrivateChild(uint32(index))
-	//childKey, err := key.DerivedKeyWithPath(derivedPath, wm.Config.CurveType)
-	if err != nil {
-		return "", nil, err
-	}
-
-	keyBytes, err := childKey.GetPrivateKeyBytes()
+	keyBytes, err := wm.DerivePrivateKey(key, derivedPath)
 	if err != nil {
 		return "", nil, err
 	}
@@ -706,7 +771,11 @@ func (wm *WalletManager) CreateNewPrivateKey(accountID string, key *owkeychain.E
 	//	return "", nil, err
 	//}
 
-	publicKey := childKey.GetPublicKeyBytes()
+	publicKey, ret := owcrypt.GenPubkey(keyBytes, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return "", nil, fmt.Errorf("invalid private key")
+	}
+	publicKey = owcrypt.PointCompress(publicKey, owcrypt.ECC_CURVE_SECP256R1)
 
 	address, err := wm.Decoder.PublicKeyToAddress(publicKey, wm.Config.IsTestNet)
 
@@ -720,6 +789,7 @@ func (wm *WalletManager) CreateNewPrivateKey(accountID string, key *owkeychain.E
 	addr := openwallet.Address{
 		Address:     address,
 		AccountID:   accountID,
+		PublicKey:   hex.EncodeToString(publicKey),
 		HDPath:      derivedPath,
 		CreatedTime: time.Now().Unix(),
 		Symbol:      wm.Config.Symbol,
@@ -757,49 +827,29 @@ func (wm *WalletManager) CreateNewPrivateKey(accountID string, key *owkeychain.E
 //
 //}
 
-//BackupWalletData 备份钱包
-func (wm *WalletManager) BackupWalletData(dest string) error {
-
-	request := []interface{}{
-		dest,
-	}
-
-	_, err := wm.WalletClient.Call("backupwallet", request)
-	if err != nil {
-		return err
-	}
-
-	return nil
-
-}
-
-//BackupWallet 备份数据
-func (wm *WalletManager) BackupWallet(walletID string) (string, error) {
+//BackupWallet 备份数据，复制种子文件和地址数据库，并导出NEP-6钱包文件
+//NEP-6钱包的私钥使用钱包密码加密，可以直接用neo-cli或NEO-GUI打开
+func (wm *WalletManager) BackupWallet(walletID, password string) (string, error) {
 	w, err := wm.GetWalletInfo(walletID)
 	if err != nil {
 		return "", err
 	}
 
+	//观察钱包没有私钥，不导出NEP-6钱包文件
+	if w.WatchOnly {
+		return wm.backupWatchOnlyWallet(w)
+	}
+
 	//创建备份文件夹
 	newBackupDir := filepath.Join(wm.Config.backupDir, w.FileName()+"-"+common.TimeFormat("20060102150405"))
 	file.MkdirAll(newBackupDir)
 
-	//创建临时备份文件wallet.dat
-	tmpWalletDat := fmt.Sprintf("tmp-walllet-%d.dat", time.Now().Unix())
-	tmpWalletDat = filepath.Join(wm.Config.WalletDataPath, tmpWalletDat)
-
-	//1. 备份核心钱包的wallet.dat
-	err = wm.BackupWalletData(tmpWalletDat)
+	//1. 导出NEP-6钱包文件
+	err = wm.DumpWallet(w, password, w.WalletID, password, filepath.Join(newBackupDir, w.FileName()+".json"))
 	if err != nil {
 		return "", err
 	}
 
-	//复制临时文件到备份文件夹
-	file.Copy(tmpWalletDat, filepath.Join(newBackupDir, "wallet.dat"))
-
-	//删除临时文件
-	file.Delete(tmpWalletDat)
-
 	//2. 备份种子文件
 	file.Copy(w.KeyFile, newBackupDir)
 
@@ -810,183 +860,114 @@ func (wm *WalletManager) BackupWallet(walletID string) (string, error) {
 }
 
 //RestoreWallet 恢复钱包
-func (wm *WalletManager) RestoreWallet(keyFile, dbFile, datFile, password string) error {
-
-	//根据流程，提供种子文件路径，wallet.dat文件的路径，钱包数据库文件的路径。
-	//输入钱包密码。
-	//先备份核心钱包原来的wallet.dat到临时文件夹。
-	//关闭钱包节点，复制wallet.dat到钱包的data目录下。
-	//启动钱包，通过GetCoreWalletinfo检查钱包是否启动了。
-	//检查密码是否可以解析种子文件，是否可以解锁钱包。
-	//如果密码错误，关闭钱包节点，恢复原钱包的wallet.dat。
-	//重新启动钱包。
-	//复制种子文件到data/btc/key/。
-	//复制钱包数据库文件到data/btc/db/。
+//复制种子文件和地址数据库，如果提供了NEP-6钱包文件，再导入其中不在数据库的账户
+func (wm *WalletManager) RestoreWallet(keyFile, dbFile, nep6File, password string) error {
 
 	var (
-		restoreSuccess = false
-		err            error
-		key            *hdkeystore.HDKey
-		sleepTime      = 30 * time.Second
+		err error
+		key *hdkeystore.HDKey
 	)
 
 	fmt.Printf("Validating key file... \n")
 
-	//检查密码是否可以解析种子文件，是否可以解锁钱包。
+	//检查密码是否可以解析种子文件
 	key, err = wm.Storage.GetKey("", keyFile, password)
 	if err != nil {
 		return errors.New("Passowrd is incorrect!")
 	}
 
-	//钱包当前的dat文件
-	curretWDFile := filepath.Join(wm.Config.WalletDataPath, "wallet.dat")
-
-	//创建临时备份文件wallet.dat，备份
-	tmpWalletDat := fmt.Sprintf("restore-walllet-%d.dat", time.Now().Unix())
-	tmpWalletDat = filepath.Join(wm.Config.WalletDataPath, tmpWalletDat)
-
-	fmt.Printf("Backup current wallet.dat file... \n")
+	fmt.Printf("Restore wallet key and datebase file... \n")
 
-	err = wm.BackupWalletData(tmpWalletDat)
+	//复制种子文件到data/neo/key/
+	file.MkdirAll(wm.Config.keyDir)
+	err = file.Copy(keyFile, filepath.Join(wm.Config.keyDir, key.FileName()+".key"))
 	if err != nil {
 		return err
 	}
 
-	//调试使用
-	//file.Copy(curretWDFile, tmpWalletDat)
-
-	fmt.Printf("Stop node server... \n")
-
-	//关闭钱包节点
-	wm.stopNode()
-	time.Sleep(sleepTime)
-
-	fmt.Printf("Restore wallet.dat file... \n")
-
-	//删除当前钱包文件
-	file.Delete(curretWDFile)
-
-	//恢复备份dat到钱包数据目录
-	err = file.Copy(datFile, wm.Config.WalletDataPath)
+	//复制钱包数据库文件到data/neo/db/
+	file.MkdirAll(wm.Config.DBPath)
+	err = file.Copy(dbFile, filepath.Join(wm.Config.DBPath, key.FileName()+".db"))
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Start node server... \n")
+	if len(nep6File) > 0 {
+		fmt.Printf("Import NEP-6 wallet file... \n")
 
-	//重新启动钱包
-	wm.startNode()
-	time.Sleep(sleepTime)
-
-	fmt.Printf("Validating wallet password... \n")
+		w, err := wm.GetWalletInfo(key.KeyID)
+		if err != nil {
+			return err
+		}
 
-	//检查wallet.dat是否可以解锁钱包
-	err = wm.UnlockWallet(password, 1)
-	if err != nil {
-		restoreSuccess = false
-		err = errors.New("Password is incorrect!")
-	} else {
-		restoreSuccess = true
+		_, err = wm.ImportWallet(w, password, w.WalletID, nep6File, password)
+		if err != nil {
+			return err
+		}
 	}
 
-	if restoreSuccess {
-		/* 恢复成功 */
-
-		fmt.Printf("Restore wallet key and datebase file... \n")
+	fmt.Printf("Backup wallet has been restored. \n")
 
-		//复制种子文件到data/btc/key/
-		file.MkdirAll(wm.Config.keyDir)
-		file.Copy(keyFile, filepath.Join(wm.Config.keyDir, key.FileName()+".key"))
-
-		//复制钱包数据库文件到data/btc/db/
-		file.MkdirAll(wm.Config.DBPath)
-		file.Copy(dbFile, filepath.Join(wm.Config.DBPath, key.FileName()+".db"))
-
-		fmt.Printf("Backup wallet has been restored. \n")
-
-		err = nil
-	} else {
-		/* 恢复失败还远原来的文件 */
-
-		fmt.Printf("Wallet unlock password is incorrect. \n")
-
-		fmt.Printf("Stop node server... \n")
-
-		//关闭钱包节点
-		wm.stopNode()
-		time.Sleep(sleepTime)
-
-		fmt.Printf("Restore original wallet.data... \n")
-
-		//删除当前钱包文件
-		file.Delete(curretWDFile)
-
-		file.Copy(tmpWalletDat, curretWDFile)
-
-		fmt.Printf("Start node server... \n")
-
-		//重新启动钱包
-		wm.startNode()
-		time.Sleep(sleepTime)
+	return nil
+}
 
-		fmt.Printf("Original wallet has been restored. \n")
+//GetBlockChainInfo 获取钱包区块链信息
+func (wm *WalletManager) GetBlockChainInfo() (*BlockchainInfo, error) {
 
+	result, err := wm.WalletClient.Call("getblockchaininfo", nil)
+	if err != nil {
+		return nil, err
 	}
 
-	//删除临时备份的dat文件
-	file.Delete(tmpWalletDat)
+	blockchain := NewBlockchainInfo(result)
 
-	return err
-}
+	return blockchain, nil
 
-//DumpWallet 导出钱包所有私钥文件
-func (wm *WalletManager) DumpWallet(filename string) error {
+}
 
-	request := []interface{}{
-		filename,
-	}
+//GetValidators 获取共识候选人列表，包含当前票数及是否为共识节点
+func (wm *WalletManager) GetValidators() ([]*Validator, error) {
 
-	_, err := wm.WalletClient.Call("dumpwallet", request)
+	result, err := wm.WalletClient.Call("getvalidators", nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	validators := make([]*Validator, 0)
+	if result.IsArray() {
+		for _, v := range result.Array() {
+			validators = append(validators, NewValidator(&v))
+		}
+	}
 
+	return validators, nil
 }
 
-//ImportWallet 导入钱包私钥文件
-func (wm *WalletManager) ImportWallet(filename string) error {
+//GetAssetAdmin 获取全局资产的管理员地址，发行资产需要管理员签名
+func (wm *WalletManager) GetAssetAdmin(assetID string) (string, error) {
 
 	request := []interface{}{
-		filename,
+		"0x" + normalizeAssetID(assetID),
 	}
 
-	_, err := wm.WalletClient.Call("importwallet", request)
+	result, err := wm.WalletClient.Call("getassetstate", request)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
-
-}
-
-//GetBlockChainInfo 获取钱包区块链信息
-func (wm *WalletManager) GetBlockChainInfo() (*BlockchainInfo, error) {
-
-	result, err := wm.WalletClient.Call("getblockchaininfo", nil)
-	if err != nil {
-		return nil, err
+	admin := result.Get("admin").String()
+	if len(admin) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrContractNotFound, "asset [%s] admin not found", assetID)
 	}
 
-	blockchain := NewBlockchainInfo(result)
-
-	return blockchain, nil
-
+	return admin, nil
 }
 
-//ListUnspent 获取未花记录
+//ListUnspent 获取未花记录，启用本地未花费索引时不再查询节点
 func (wm *WalletManager) ListUnspent(address string) (*UnspentBalance, error) {
+	if wm.Config.LocalUnspentIndex {
+		return wm.listUnspentByIndex(address)
+	}
 	utxo, err := wm.getListUnspentByCore(address)
 	if err != nil {
 		return nil, err
@@ -1187,9 +1168,7 @@ func (wm *WalletManager) SignRawTransactionInCoreWallet(txHex, walletID string,
 	//查找未花签名需要的私钥
 	for _, u := range utxos {
 
-		childKey, err := key.DerivedKeyWithPath(u.HDAddress.HDPath, wm.Config.CurveType)
-
-		keyBytes, err := childKey.GetPrivateKeyBytes()
+		keyBytes, err := wm.DerivePrivateKey(key, u.HDAddress.HDPath)
 		if err != nil {
 			return "", err
 		}
@@ -1233,9 +1212,12 @@ func (wm *WalletManager) SignRawTransactionInCoreWallet(txHex, walletID string,
 //SendRawTransaction 广播交易
 func (wm *WalletManager) SendRawTransaction(txHex string) (string, error) {
 
-	if wm.Config.RPCServerType == RPCServerExplorer {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		return wm.sendRawTransactionByExplorer(txHex)
-	} else {
+	case RPCServerP2P:
+		return wm.sendRawTransactionByP2P(txHex)
+	default:
 		return wm.sendRawTransactionByCore(txHex)
 	}
 }
@@ -1650,11 +1632,37 @@ func (wm *WalletManager) SendBatchTransaction(walletID string, to []string, amou
 //CreateChangeAddress 创建找零地址
 func (wm *WalletManager) CreateChangeAddress(walletID string, key *hdkeystore.HDKey) (*openwallet.Address, error) {
 
+	wallet, err := wm.GetWalletInfo(walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		chain       *HDNode
+		derivedPath string
+	)
+	if wallet.WatchOnly {
+		//观察钱包通过扩展公钥派生找零地址
+		chain, derivedPath, err = wm.watchOnlyChain(wallet, true)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		derivedPath = wm.addressChainPath(key, true, uint64(time.Now().Unix()))
+	}
+
+	//BIP44派生使用找零链的下一个索引
+	offset := wm.nextAddressIndex(wallet, derivedPath)
+
 	//生产通道
 	producer := make(chan []*openwallet.Address)
 	defer close(producer)
 
-	go wm.createAddressWork(key, producer, walletID, uint64(time.Now().Unix()), 0, 1)
+	if wallet.WatchOnly {
+		go wm.createWatchOnlyAddressWork(chain, producer, walletID, derivedPath, offset, offset+1)
+	} else {
+		go wm.createAddressWork(key, producer, walletID, derivedPath, offset, offset+1)
+	}
 
 	//回收创建的地址
 	getAddrs := <-producer
@@ -1663,12 +1671,12 @@ func (wm *WalletManager) CreateChangeAddress(walletID string, key *hdkeystore.HD
 		return nil, errors.New("Change address creation failed!")
 	}
 
-	//批量写入数据库
-	wallet, err := wm.GetWalletInfo(walletID)
-	if err != nil {
-		return nil, err
+	for _, a := range getAddrs {
+		a.IsChange = true
 	}
 
+	//批量写入数据库
+
 	err = wm.saveAddressToDB(getAddrs, wallet)
 	if err != nil {
 		return nil, err
@@ -1800,21 +1808,13 @@ func (wm *WalletManager) clearUnspends(utxos []*Unspent, wallet *openwallet.Wall
 }
 
 //createAddressWork 创建地址过程
-func (wm *WalletManager) createAddressWork(k *hdkeystore.HDKey, producer chan<- []*openwallet.Address, walletID string, index, start, end uint64) {
+func (wm *WalletManager) createAddressWork(k *hdkeystore.HDKey, producer chan<- []*openwallet.Address, walletID string, derivedPath string, start, end uint64) {
 
 	runAddress := make([]*openwallet.Address, 0)
-	runWIFs := make([]string, 0)
-
-	derivedPath := fmt.Sprintf("%s/%d", k.RootPath, index)
-	childKey, err := k.DerivedKeyWithPath(derivedPath, wm.Config.CurveType)
-	if err != nil {
-		producer <- make([]*openwallet.Address, 0)
-		return
-	}
 
 	for i := start; i < end; i++ {
 		// 生成地址
-		wif, address, errRun := wm.CreateNewPrivateKey(k.KeyID, childKey, derivedPath, i)
+		_, address, errRun := wm.CreateNewPrivateKey(k.KeyID, k, derivedPath, i)
 		if errRun != nil {
 			wm.Log.Std.Info("Create new privKey failed unexpected error: %v", errRun)
 			continue
@@ -1828,21 +1828,16 @@ func (wm *WalletManager) createAddressWork(k *hdkeystore.HDKey, producer chan<-
 		//}
 
 		runAddress = append(runAddress, address)
-		runWIFs = append(runWIFs, wif)
 	}
 
-	//批量导入私钥
-	failed, errRun := wm.ImportMulti(runAddress, runWIFs, true)
+	//批量登记观察地址，私钥不导入节点
+	errRun := wm.ImportWatchOnlyAddress(runAddress...)
 	if errRun != nil {
+		wm.Log.Std.Info("Import watch-only address failed unexpected error: %v", errRun)
 		producer <- make([]*openwallet.Address, 0)
 		return
 	}
 
-	//删除导入失败的
-	for _, fi := range failed {
-		runAddress = append(runAddress[:fi], runAddress[fi+1:]...)
-	}
-
 	//生成完成
 	producer <- runAddress
 }
@@ -24,7 +24,6 @@ import (
 	"math"
 	"path/filepath"
 	"testing"
-	"time"
 )
 
 var (
@@ -226,11 +225,10 @@ func TestCreateNewPrivateKey(t *testing.T) {
 	t.Logf("CreateNewPrivateKey timestamp = %v \n", timestamp)
 
 	derivedPath := fmt.Sprintf("%s/%d", key.RootPath, timestamp)
-	childKey, _ := key.DerivedKeyWithPath(derivedPath, tw.Config.CurveType)
 
 	for i := 0; i < count; i++ {
 
-		wif, a, err := tw.CreateNewPrivateKey(key.KeyID, childKey, derivedPath, uint64(i))
+		wif, a, err := tw.CreateNewPrivateKey(key.KeyID, key, derivedPath, uint64(i))
 		if err != nil {
 			t.Errorf("CreateNewPrivateKey[%d] failed unexpected error: %v\n", i, err)
 			continue
@@ -300,7 +298,7 @@ func TestGetWalleInfo(t *testing.T) {
 
 func TestBackupWallet(t *testing.T) {
 
-	backupFile, err := tw.BackupWallet("W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV")
+	backupFile, err := tw.BackupWallet("W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV", "1234qwer")
 	if err != nil {
 		t.Errorf("BackupWallet failed unexpected error: %v\n", err)
 	} else {
@@ -308,22 +306,14 @@ func TestBackupWallet(t *testing.T) {
 	}
 }
 
-func TestBackupWalletData(t *testing.T) {
-	tw.Config.WalletDataPath = "/home/www/btc/testdata/testnet3/"
-	tmpWalletDat := fmt.Sprintf("tmp-walllet-%d.dat", time.Now().Unix())
-	backupFile := filepath.Join(tw.Config.WalletDataPath, tmpWalletDat)
-	err := tw.BackupWalletData(backupFile)
+func TestDumpWallet(t *testing.T) {
+	w, err := tw.GetWalletInfo("W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV")
 	if err != nil {
-		t.Errorf("BackupWallet failed unexpected error: %v\n", err)
-	} else {
-		t.Errorf("BackupWallet filePath: %v\n", backupFile)
+		t.Errorf("GetWalletInfo failed unexpected error: %v\n", err)
+		return
 	}
-}
-
-func TestDumpWallet(t *testing.T) {
-	tw.UnlockWallet("1234qwer", 120)
-	file := filepath.Join(".", "dump.txt")
-	err := tw.DumpWallet(file)
+	file := filepath.Join(".", "dump.json")
+	err = tw.DumpWallet(w, "1234qwer", w.WalletID, "1234qwer", file)
 	if err != nil {
 		t.Errorf("DumpWallet failed unexpected error: %v\n", err)
 	} else {
@@ -351,6 +341,17 @@ func TestGetBlockChainInfo(t *testing.T) {
 	}
 }
 
+func TestGetValidators(t *testing.T) {
+	validators, err := tw.GetValidators()
+	if err != nil {
+		t.Errorf("GetValidators failed unexpected error: %v\n", err)
+		return
+	}
+	for _, v := range validators {
+		log.Infof("validator: %+v\n", v)
+	}
+}
+
 func TestListUnspent(t *testing.T) {
 	//msHemmfSZ3au6h9S1annGcTGrTVryRbSFV
 	//mtHT3JkeKnJZCejqp6nxScxxvbW6Wn8e92
@@ -505,9 +506,9 @@ func TestPrintConfig(t *testing.T) {
 func TestRestoreWallet(t *testing.T) {
 	keyFile := "/myspace/workplace/go-workspace/projects/bin/data/btc/key/MacOS-W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV.key"
 	dbFile := "/myspace/workplace/go-workspace/projects/bin/data/btc/db/MacOS-W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV.db"
-	datFile := "/myspace/workplace/go-workspace/projects/bin/testdatfile/wallet.dat"
+	nep6File := "/myspace/workplace/go-workspace/projects/bin/data/btc/backup/MacOS-W9JyC464XAZEJgdiAZxUXbPpsZZ2JeAujV.json"
 	tw.LoadConfig()
-	err := tw.RestoreWallet(keyFile, dbFile, datFile, "1234qwer")
+	err := tw.RestoreWallet(keyFile, dbFile, nep6File, "1234qwer")
 	if err != nil {
 		t.Errorf("RestoreWallet failed unexpected error: %v\n", err)
 	}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//SignedMessage 签名消息，字段与NEO钱包 dAPI signMessage 的返回值一致
+type SignedMessage struct {
+	Address   string `json:"address"`   //签名者地址
+	PublicKey string `json:"publicKey"` //签名者压缩公钥，十六进制
+	Message   string `json:"message"`   //消息原文
+	Salt      string `json:"salt"`      //盐，十六进制，未加盐时为空
+	Data      string `json:"data"`      //签名，十六进制
+}
+
+//SignMessage 使用地址的私钥签名消息，用于证明地址的所有权
+//私钥由签名器提供，可以是本地派生或远程签名服务
+// wrapper : 钱包
+// address : 签名者地址，必须是钱包中的单签地址
+// message : 消息原文，例如服务端下发的挑战码
+// withSalt : 是否加随机盐，与 signMessage 一致默认加盐
+func (wm *WalletManager) SignMessage(wrapper openwallet.WalletDAI, address, message string, withSalt bool) (*SignedMessage, error) {
+
+	addr, err := wrapper.GetAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if addr == nil {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "address[%s] not found", address)
+	}
+	if isContractAddress(addr) {
+		return nil, fmt.Errorf("contract address[%s] can not sign message", address)
+	}
+	if len(addr.PublicKey) == 0 {
+		return nil, fmt.Errorf("public key of address[%s] is empty", address)
+	}
+
+	decoder, ok := wm.TxDecoder.(*TransactionDecoder)
+	if !ok {
+		return nil, fmt.Errorf("transaction decoder is not supported")
+	}
+
+	salt := ""
+	if withSalt {
+		salt, err = neoTransaction.GenerateMessageSalt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//签名器校验签名者公钥与地址一致
+	signature, err := decoder.signDigest(wrapper, addr, neoTransaction.GetMessageDigest(message, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedMessage{
+		Address:   addr.Address,
+		PublicKey: addr.PublicKey,
+		Message:   message,
+		Salt:      salt,
+		Data:      hex.EncodeToString(signature),
+	}, nil
+}
+
+//VerifyMessage 校验签名消息，公钥必须对应签名者地址
+func (wm *WalletManager) VerifyMessage(signed *SignedMessage) (bool, error) {
+	return wm.Decoder.VerifyMessage(signed.Address, signed.Message, signed.Salt, signed.PublicKey, signed.Data)
+}
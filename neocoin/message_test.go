@@ -0,0 +1,71 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestSignMessage(t *testing.T) {
+	wm := NewWalletManager()
+
+	key, err := hdkeystore.NewHDKey([]byte("0123456789abcdef0123456789abcdef"), "test", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	addr, err := wm.newImportedKeyAddress(key, "test", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := &signerTestWallet{key: key, addrs: []*openwallet.Address{addr}}
+
+	for _, withSalt := range []bool{true, false} {
+		signed, err := wm.SignMessage(wallet, addr.Address, "challenge-123", withSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed.PublicKey != addr.PublicKey || (len(signed.Salt) > 0) != withSalt {
+			t.Errorf("signed message wrong: %+v", signed)
+		}
+		ok, err := wm.VerifyMessage(signed)
+		if err != nil || !ok {
+			t.Errorf("verify message failed: %v", err)
+		}
+
+		// 篡改消息
+		tampered := *signed
+		tampered.Message = "challenge-124"
+		if ok, _ := wm.VerifyMessage(&tampered); ok {
+			t.Errorf("tampered message should not be verified")
+		}
+
+		// 公钥与地址不一致
+		tampered = *signed
+		tampered.Address = "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC"
+		if _, err := wm.VerifyMessage(&tampered); err == nil {
+			t.Errorf("public key of other address should be rejected")
+		}
+	}
+
+	if _, err := wm.SignMessage(wallet, "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC", "challenge-123", true); err == nil {
+		t.Errorf("address not in wallet should fail")
+	}
+}
@@ -18,6 +18,7 @@ package neocoin
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/blocktree/openwallet/crypto"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/btcsuite/btcd/txscript"
@@ -54,6 +55,74 @@ func NewBlockchainInfo(json *gjson.Result) *BlockchainInfo {
 	return b
 }
 
+//Validator 共识候选人
+type Validator struct {
+	PublicKey string `json:"publickey"`
+	Votes     string `json:"votes"`
+	Active    bool   `json:"active"`
+}
+
+func NewValidator(json *gjson.Result) *Validator {
+	v := &Validator{}
+	//解析json
+	v.PublicKey = gjson.Get(json.Raw, "publickey").String()
+	v.Votes = gjson.Get(json.Raw, "votes").String()
+	v.Active = gjson.Get(json.Raw, "active").Bool()
+	return v
+}
+
+//UTXOAsset 全局资产，NEO、GAS 以及通过 RegisterTransaction 注册的资产
+type UTXOAsset struct {
+	AssetID   string `json:"asset_id" storm:"id"` // 资产ID，大端序，不带0x
+	Symbol    string `json:"symbol"`              // 资产符号
+	Precision int32  `json:"precision"`           // 资产精度
+}
+
+//ContractManifest 部署合约的描述参数
+type ContractManifest struct {
+	Parameters    []string `json:"parameters"`    // 参数类型列表，名称或十六进制值，如 Signature 或 00
+	ReturnType    string   `json:"returntype"`    // 返回值类型
+	NeedStorage   bool     `json:"needstorage"`   // 是否使用存储区
+	DynamicInvoke bool     `json:"dynamicinvoke"` // 是否动态调用
+	Payable       bool     `json:"payable"`       // 是否可接收全局资产
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Author        string   `json:"author"`
+	Email         string   `json:"email"`
+	Description   string   `json:"description"`
+}
+
+//NewContractDeployment 通过合约脚本及描述参数创建部署元数据
+func (m *ContractManifest) NewContractDeployment(script []byte) (*neoTransaction.ContractDeployment, error) {
+	params := make([]neoTransaction.ContractParameterType, 0, len(m.Parameters))
+	for _, name := range m.Parameters {
+		pt, err := neoTransaction.GetContractParameterType(name)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, *pt)
+	}
+
+	returnType, err := neoTransaction.GetContractParameterType(m.ReturnType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &neoTransaction.ContractDeployment{
+		Script:        script,
+		ParameterList: params,
+		ReturnType:    *returnType,
+		NeedStorage:   m.NeedStorage,
+		DynamicInvoke: m.DynamicInvoke,
+		Payable:       m.Payable,
+		Name:          m.Name,
+		Version:       m.Version,
+		Author:        m.Author,
+		Email:         m.Email,
+		Description:   m.Description,
+	}, nil
+}
+
 // 账户余额 包含 NEO 主币 与 交易费用 GAS
 type UnspentBalance struct {
 	/*
@@ -87,14 +156,23 @@ type UnspentBalance struct {
 		],
 		"address": "AGofsxAUDwt52KjaB664GYsqVAkULYvKNt"
 	*/
-	Key        string   `storm:"id"`
-	NEOUnspent *Unspent `json:"neo_unspent"` // 未花费的 NEO
-	GASUnspent *Unspent `json:"gas_unspent"` // 未花费的 GAS
-	AccountID  string   `json:"account_id" storm:"index"`
-	Address    string   `json:"address"` // 地址
+	Key        string              `storm:"id"`
+	NEOUnspent *Unspent            `json:"neo_unspent"` // 未花费的 NEO
+	GASUnspent *Unspent            `json:"gas_unspent"` // 未花费的 GAS
+	Unspents   map[string]*Unspent `json:"unspents"`    // 全部资产的未花费，key为资产ID
+	AccountID  string              `json:"account_id" storm:"index"`
+	Address    string              `json:"address"` // 地址
 	HDAddress  openwallet.Address
 }
 
+//GetUnspent 获取指定资产的未花费
+func (ub *UnspentBalance) GetUnspent(assetID string) *Unspent {
+	if ub.Unspents == nil {
+		return nil
+	}
+	return ub.Unspents[normalizeAssetID(assetID)]
+}
+
 //Unspent 未花记录
 type Unspent struct {
 	/*
@@ -135,14 +213,17 @@ type UnspentTx struct {
 }
 
 func NewUnspentBalance(json *gjson.Result) *UnspentBalance {
-	obj := &UnspentBalance{}
+	obj := &UnspentBalance{Unspents: make(map[string]*Unspent)}
 	//解析json
 	arr := json.Get("balance").Array()
 	for _, a := range arr {
 		unspent := NewUnspent(&a)
-		if unspent.AssetSymbol == AssetSymbolGAS {
+		assetID := normalizeAssetID(unspent.AssetHash)
+		obj.Unspents[assetID] = unspent
+		switch assetID {
+		case neoTransaction.NeoGasAssetId:
 			obj.GASUnspent = unspent
-		} else {
+		case neoTransaction.NeoAssetId:
 			obj.NEOUnspent = unspent
 		}
 	}
@@ -237,6 +318,10 @@ type Block struct {
 	Version           uint64
 	Time              uint64
 	Fork              bool
+	Nonce             string //共识数据，十六进制
+	NextConsensus     string //下一轮共识节点地址
+	Invocation        string //见证人调用脚本，十六进制
+	Verification      string //见证人验证脚本，十六进制
 	txDetails         []*Transaction
 	isVerbose         bool
 }
@@ -251,6 +336,10 @@ func (wm *WalletManager) NewBlock(json *gjson.Result) *Block {
 	obj.Previousblockhash = gjson.Get(json.Raw, "previousblockhash").String()
 	obj.Version = gjson.Get(json.Raw, "version").Uint()
 	obj.Time = gjson.Get(json.Raw, "time").Uint()
+	obj.Nonce = gjson.Get(json.Raw, "nonce").String()
+	obj.NextConsensus = gjson.Get(json.Raw, "nextconsensus").String()
+	obj.Invocation = gjson.Get(json.Raw, "script.invocation").String()
+	obj.Verification = gjson.Get(json.Raw, "script.verification").String()
 
 	txs := make([]string, 0)
 	txDetails := make([]*Transaction, 0)
@@ -363,6 +452,7 @@ type Vin struct {
 	N        uint64
 	Addr     string
 	Value    string
+	Asset    string
 }
 
 // 交易输出
@@ -18,6 +18,7 @@ package neocoin
 import (
 	"errors"
 	"fmt"
+	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/console"
@@ -27,6 +28,7 @@ import (
 	"github.com/shopspring/decimal"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 //初始化配置流程
@@ -62,6 +64,24 @@ func (wm *WalletManager) CreateWalletFlow() error {
 	// 等待用户输入钱包名字
 	name, err = console.InputText("Enter wallet's name: ", true)
 
+	// 输入账户扩展公钥则创建观察钱包，热钱包服务器不保存种子
+	xpub, err := console.InputText("Enter account extended public key to create watch-only wallet (leave empty to create a new seed): ", false)
+	if err != nil {
+		return err
+	}
+
+	if len(xpub) > 0 {
+		w, _, err := wm.CreateWatchOnlyWallet(name, xpub)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n")
+		fmt.Printf("Watch-only wallet create successfully, wallet ID: %s, account path: %s\n", w.WalletID, w.RootPath)
+
+		return nil
+	}
+
 	// 等待用户输入密码
 	password, err = console.InputPassword(false, 3)
 
@@ -120,8 +140,14 @@ func (wm *WalletManager) CreateAddressFlow() error {
 		return errors.New(fmt.Sprintf("The number of addresses can not exceed %d", maxAddresNum))
 	}
 
-	//输入密码
-	password, err := console.InputPassword(false, 3)
+	//输入密码，观察钱包不需要密码
+	password := ""
+	if !account.WatchOnly {
+		password, err = console.InputPassword(false, 3)
+		if err != nil {
+			return err
+		}
+	}
 
 	log.Std.Info("Start batch creation")
 	log.Std.Info("-------------------------------------------------")
@@ -285,7 +311,13 @@ func (wm *WalletManager) BackupWalletFlow() error {
 
 	wallet := list[num]
 
-	backupPath, err = wm.BackupWallet(wallet.WalletID)
+	//输入密码，NEP-6钱包的私钥使用钱包密码加密
+	password, err := console.InputPassword(false, 3)
+	if err != nil {
+		return err
+	}
+
+	backupPath, err = wm.BackupWallet(wallet.WalletID, password)
 	if err != nil {
 		return err
 	}
@@ -397,7 +429,7 @@ func (wm *WalletManager) RestoreWalletFlow() error {
 		err      error
 		keyFile  string
 		dbFile   string
-		datFile  string
+		nep6File string
 		password string
 	)
 
@@ -418,7 +450,7 @@ func (wm *WalletManager) RestoreWalletFlow() error {
 		return err
 	}
 
-	datFile, err = console.InputText("Enter backup wallet.db file path: ", true)
+	nep6File, err = console.InputText("Enter backup NEP-6 wallet file path (optional): ", false)
 	if err != nil {
 		return err
 	}
@@ -429,7 +461,7 @@ func (wm *WalletManager) RestoreWalletFlow() error {
 	}
 
 	fmt.Printf("Wallet restoring, please wait a moment...\n")
-	err = wm.RestoreWallet(keyFile, dbFile, datFile, password)
+	err = wm.RestoreWallet(keyFile, dbFile, nep6File, password)
 	if err != nil {
 		return err
 	}
@@ -528,51 +560,9 @@ func (wm *WalletManager) GetBlockScanner() openwallet.BlockScanner {
 	return wm.Blockscanner
 }
 
-//ImportWatchOnlyAddress 导入观测地址
+//ImportWatchOnlyAddress 导入观测地址，登记到本地观察地址表，扫描器据此识别充值
 func (wm *WalletManager) ImportWatchOnlyAddress(address ...*openwallet.Address) error {
-
-	//先加载是否有配置文件
-	//err := wm.LoadConfig()
-	//if err != nil {
-	//	return nil
-	//}
-
-	var (
-		failedIndex = make([]int, 0)
-	)
-
-	//for i, a := range address {
-	//	log.Debug("start ImportAddress")
-	//	err = wm.ImportAddress(a)
-	//	if err != nil {
-	//		log.Error("import address failed, unexpected error:", err)
-	//		failedIndex = append(failedIndex, i)
-	//	}
-	//	log.Debug("end ImportAddress")
-	//}
-
-	if len(wm.Config.WalletPassword) > 0 {
-		wm.UnlockWallet(wm.Config.WalletPassword, 600)
-	}
-
-	failedIndex, err := wm.ImportMulti(address, nil, true)
-	if err != nil {
-		return err
-	}
-
-	if len(failedIndex) > 0 {
-		failedReason := ""
-
-		for _, index := range failedIndex {
-			failedReason = failedReason + address[index].Address + ", "
-		}
-
-		failedReason = failedReason + "import failed"
-
-		return fmt.Errorf(failedReason)
-	}
-
-	return nil
+	return wm.WatchOnly.Import(newWatchOnlyAddresses(address)...)
 }
 
 //GetAddressWithBalance
@@ -638,21 +628,79 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.TransFeesScale, _ = decimal.NewFromString(c.String("transFeesScale"))
 	wm.Config.TransFeesFixed, _ = decimal.NewFromString(c.String("transFeesFixed"))
 	wm.Config.MaxTxInputs = c.DefaultInt("summaryMaxInput", 1)
+	if fee, err := decimal.NewFromString(c.String("registerAssetFee")); err == nil {
+		wm.Config.RegisterAssetFee = fee
+	}
+	if fee, err := decimal.NewFromString(c.String("issueAssetFee")); err == nil {
+		wm.Config.IssueAssetFee = fee
+	}
+	wm.Config.NEP2Scrypt.N = c.DefaultInt("nep2ScryptN", neoTransaction.DefaultScryptParams.N)
+	wm.Config.NEP2Scrypt.R = c.DefaultInt("nep2ScryptR", neoTransaction.DefaultScryptParams.R)
+	wm.Config.NEP2Scrypt.P = c.DefaultInt("nep2ScryptP", neoTransaction.DefaultScryptParams.P)
+	wm.Config.HDDerivation = c.DefaultString("hdDerivation", HDDerivationOpenwallet)
+	if wm.Config.HDDerivation != HDDerivationBIP44 {
+		wm.Config.HDDerivation = HDDerivationOpenwallet
+	}
+	wm.Config.BIP44Account = uint32(c.DefaultInt("bip44Account", 0))
+	wm.Config.SignerURL = c.String("signerURL")
+	wm.Config.SignerToken = c.String("signerToken")
+	wm.Config.AddressPoolSize = uint64(c.DefaultInt("addressPoolSize", 20))
+	wm.Config.AddressGapLimit = uint64(c.DefaultInt("addressGapLimit", 20))
+	wm.Config.ScanLookAhead = c.DefaultInt("scanLookAhead", 5)
+	wm.Config.OutputCacheSize = c.DefaultInt("outputCacheSize", 100000)
+	wm.Config.LocalUnspentIndex, _ = c.Bool("localUnspentIndex")
+	wm.Config.VerifyHeaderChain = c.DefaultBool("verifyHeaderChain", true)
+	if wm.Config.IsTestNet {
+		wm.Config.P2PMagic = uint32(c.DefaultInt("p2pMagic", P2PMagicTestNet))
+	} else {
+		wm.Config.P2PMagic = uint32(c.DefaultInt("p2pMagic", P2PMagicMainNet))
+	}
+	wm.Config.P2PGenesisHash = c.String("p2pGenesisHash")
+	wm.Config.PushURL = c.String("pushURL")
+	wm.Config.PushSubscribeMessage = c.String("pushSubscribeMessage")
+	wm.Config.PushReconnectWait = time.Duration(c.DefaultInt("pushReconnectWait", 5)) * time.Second
+	wm.Config.PendingTxDropBlocks = uint64(c.DefaultInt("pendingTxDropBlocks", 20))
+	wm.Config.ExplorerMemPoolPath = c.DefaultString("explorerMemPoolPath", "mempool")
+
+	//按配置重建输出缓存
+	wm.Blockscanner.outputs = newOutputCache(wm.Config.OutputCacheSize)
 
 	//数据文件夹
 	wm.Config.makeDataDir()
 
+	//加载已登记的全局资产
+	err := wm.loadUTXOAssets()
+	if err != nil {
+		wm.Log.Errorf("load utxo assets failed, err: %v", err)
+	}
+
+	//加载已登记的观察地址
+	err = wm.WatchOnly.Load()
+	if err != nil {
+		wm.Log.Errorf("load watch-only addresses failed, err: %v", err)
+	}
+
 	token := BasicAuth(wm.Config.RpcUser, wm.Config.RpcPassword)
 	omniToken := BasicAuth(wm.Config.OmniRPCUser, wm.Config.OmniRPCPassword)
 
-	if wm.Config.RPCServerType == RPCServerCore {
-		wm.WalletClient = NewClient(wm.Config.ServerAPI, token, false)
-	} else {
+	switch wm.Config.RPCServerType {
+	case RPCServerExplorer:
 		wm.ExplorerClient = NewExplorer(wm.Config.ServerAPI, false)
+	case RPCServerP2P:
+		wm.P2PClient = NewP2PClient(wm.Config.ServerAPI, wm.Config.P2PMagic, false)
+	default:
+		wm.WalletClient = NewClient(wm.Config.ServerAPI, token, false)
 	}
 
 	wm.OnmiClient = NewClient(wm.Config.OmniCoreAPI, omniToken, false)
 
+	//配置了签名服务则使用远程签名，私钥不进入适配器
+	if len(wm.Config.SignerURL) > 0 {
+		wm.Signer = NewRemoteSigner(wm.Config.SignerURL, wm.Config.SignerToken)
+	} else {
+		wm.Signer = NewLocalSigner(wm)
+	}
+
 	return nil
 }
 
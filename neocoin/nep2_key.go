@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	nep2ExtParamKey   = "nep2"   // 导入私钥在地址扩展字段中的键
+	scryptExtParamKey = "scrypt" // 导入私钥的 scrypt 参数
+)
+
+//ImportNEP2Key 导入NEP-2加密私钥为钱包账户的地址
+//私钥用钱包种子派生的密码重新加密后保存在地址扩展字段，签名时通过钱包HDKey解密
+// wallet : 钱包
+// password : 钱包密码
+// accountID : 导入的资产账户
+// nep2 : NEP-2加密私钥
+// passphrase : NEP-2密码
+func (wm *WalletManager) ImportNEP2Key(wallet *openwallet.Wallet, password, accountID, nep2, passphrase string) (*openwallet.Address, error) {
+
+	priv, err := wm.Decoder.NEP2ToPrivateKey(nep2, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := wallet.HDKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := wm.newImportedKeyAddress(key, accountID, priv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wm.saveAddressToDB([]*openwallet.Address{addr}, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	wm.Log.Std.Info("Import NEP-2 key: %s", addr.Address)
+
+	return addr, nil
+}
+
+//ExportNEP2Key 导出导入地址的私钥为NEP-2加密私钥
+func (wm *WalletManager) ExportNEP2Key(key *hdkeystore.HDKey, addr *openwallet.Address, passphrase string) (string, error) {
+	priv, err := getImportedPrivateKey(key, addr)
+	if err != nil {
+		return "", err
+	}
+	return wm.Decoder.PrivateKeyToNEP2(priv, passphrase)
+}
+
+//newImportedKeyAddress 通过私钥创建导入地址
+func (wm *WalletManager) newImportedKeyAddress(key *hdkeystore.HDKey, accountID string, priv []byte) (*openwallet.Address, error) {
+
+	pub, ret := owcrypt.GenPubkey(priv, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1)
+
+	address, err := wm.Decoder.PublicKeyToAddress(pub, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, err
+	}
+
+	params := wm.Config.NEP2Scrypt
+	encrypted, err := neoTransaction.NEP2Encrypt(priv, importedKeyPassphrase(key), params)
+	if err != nil {
+		return nil, err
+	}
+
+	ext, err := json.Marshal(map[string]interface{}{
+		nep2ExtParamKey:   encrypted,
+		scryptExtParamKey: map[string]int{"n": params.N, "r": params.R, "p": params.P},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &openwallet.Address{
+		AccountID: accountID,
+		Address:   address,
+		PublicKey: hex.EncodeToString(pub),
+		Symbol:    wm.Symbol(),
+		WatchOnly: false,
+		ExtParam:  string(ext),
+	}, nil
+}
+
+//isImportedKeyAddress 是否为导入私钥的地址
+func isImportedKeyAddress(addr *openwallet.Address) bool {
+	return len(addr.HDPath) == 0 && gjson.Get(addr.ExtParam, nep2ExtParamKey).Exists()
+}
+
+//getImportedPrivateKey 解密导入地址的私钥
+func getImportedPrivateKey(key *hdkeystore.HDKey, addr *openwallet.Address) ([]byte, error) {
+	nep2 := gjson.Get(addr.ExtParam, nep2ExtParamKey).String()
+	if len(nep2) == 0 {
+		return nil, fmt.Errorf("address[%s] is not an imported key", addr.Address)
+	}
+	params := neoTransaction.ScryptParams{
+		N: int(gjson.Get(addr.ExtParam, scryptExtParamKey+".n").Int()),
+		R: int(gjson.Get(addr.ExtParam, scryptExtParamKey+".r").Int()),
+		P: int(gjson.Get(addr.ExtParam, scryptExtParamKey+".p").Int()),
+	}
+	if params.N == 0 {
+		params = neoTransaction.DefaultScryptParams
+	}
+	return neoTransaction.NEP2Decrypt(nep2, importedKeyPassphrase(key), params)
+}
+
+//importedKeyPassphrase 导入私钥的加密密码，由钱包种子派生
+func importedKeyPassphrase(key *hdkeystore.HDKey) string {
+	return hex.EncodeToString(owcrypt.Hash(key.Seed(), 0, owcrypt.HASh_ALG_DOUBLE_SHA256))
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+// InvokeFunction 以只读方式调用合约方法，不会上链
+func (wm *WalletManager) InvokeFunction(contractHash, method string, params ...interface{}) (*gjson.Result, error) {
+	request := []interface{}{
+		contractHash,
+		method,
+	}
+	if len(params) > 0 {
+		request = append(request, params)
+	}
+
+	result, err := wm.WalletClient.Call("invokefunction", request)
+	if err != nil {
+		return nil, err
+	}
+
+	if state := result.Get("state").String(); state != "" && !isVMStateHalt(state) {
+		return nil, fmt.Errorf("invoke function %s failed, vm state: %s", method, state)
+	}
+
+	return result, nil
+}
+
+// GetNEP5Balance 获取地址的NEP-5代币余额
+// contractHash : 合约脚本哈希，大端序十六进制
+// decimals : 合约精度
+// address : 查询地址
+func (wm *WalletManager) GetNEP5Balance(contractHash string, decimals int32, address string) (decimal.Decimal, error) {
+	scriptHash, err := addressToScriptHashHex(address)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	param := map[string]interface{}{
+		"type":  "Hash160",
+		"value": scriptHash,
+	}
+
+	result, err := wm.InvokeFunction(contractHash, neoTransaction.NEP5MethodBalanceOf, param)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	stack := result.Get("stack").Array()
+	if len(stack) == 0 {
+		return decimal.Zero, fmt.Errorf("balanceOf return empty stack")
+	}
+
+	balance, err := parseStackInteger(stack[0])
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decimal.NewFromBigInt(balance, -decimals), nil
+}
+
+// GetNEP5Balances 通过 getnep5balances 获取地址持有的全部NEP-5代币，需要节点开启 RpcNep5Tracker 插件
+// 返回值 key 为大端序合约脚本哈希（不带0x），value 为未按精度缩小的代币数量
+func (wm *WalletManager) GetNEP5Balances(address string) (map[string]*big.Int, error) {
+	result, err := wm.WalletClient.Call("getnep5balances", []interface{}{address})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]*big.Int)
+	for _, b := range result.Get("balance").Array() {
+		contractHash := strings.TrimPrefix(strings.ToLower(b.Get("asset_hash").String()), "0x")
+		amount, ok := new(big.Int).SetString(b.Get("amount").String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid nep5 balance of %s: %s", contractHash, b.Get("amount").String())
+		}
+		if amount.Sign() > 0 {
+			balances[contractHash] = amount
+		}
+	}
+
+	return balances, nil
+}
+
+// GetNEP5TokenInfo 获取NEP-5代币的符号和精度
+// contractHash : 合约脚本哈希，大端序十六进制
+func (wm *WalletManager) GetNEP5TokenInfo(contractHash string) (string, int32, error) {
+	result, err := wm.InvokeFunction(contractHash, neoTransaction.NEP5MethodDecimals)
+	if err != nil {
+		return "", 0, err
+	}
+	stack := result.Get("stack").Array()
+	if len(stack) == 0 {
+		return "", 0, fmt.Errorf("decimals return empty stack")
+	}
+	decimals, err := parseStackInteger(stack[0])
+	if err != nil {
+		return "", 0, err
+	}
+
+	result, err = wm.InvokeFunction(contractHash, neoTransaction.NEP5MethodSymbol)
+	if err != nil {
+		return "", 0, err
+	}
+	stack = result.Get("stack").Array()
+	if len(stack) == 0 {
+		return "", 0, fmt.Errorf("symbol return empty stack")
+	}
+	symbol := stack[0].Get("value").String()
+	if stack[0].Get("type").String() == "ByteArray" {
+		data, err := hex.DecodeString(symbol)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid symbol stack item: %s", symbol)
+		}
+		symbol = string(data)
+	}
+
+	return symbol, int32(decimals.Int64()), nil
+}
+
+// parseStackInteger 解析虚拟机返回栈中的整数，ByteArray 为小端补码
+func parseStackInteger(item gjson.Result) (*big.Int, error) {
+	value := item.Get("value").String()
+	switch item.Get("type").String() {
+	case "Integer":
+		number, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer stack item: %s", value)
+		}
+		return number, nil
+	case "ByteArray":
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte array stack item: %s", value)
+		}
+		return neoBytesToBigInt(data), nil
+	case "Boolean":
+		if item.Get("value").Bool() {
+			return big.NewInt(1), nil
+		}
+		return big.NewInt(0), nil
+	}
+	return nil, fmt.Errorf("unsupported stack item type: %s", item.Get("type").String())
+}
+
+// neoBytesToBigInt 小端补码转换为整数
+func neoBytesToBigInt(data []byte) *big.Int {
+	if len(data) == 0 {
+		return big.NewInt(0)
+	}
+	be := make([]byte, len(data))
+	for i, b := range data {
+		be[len(data)-1-i] = b
+	}
+	number := new(big.Int).SetBytes(be)
+	if be[0]&0x80 != 0 {
+		number.Sub(number, new(big.Int).Lsh(big.NewInt(1), uint(len(be)*8)))
+	}
+	return number
+}
+
+// addressToScriptHashHex 地址转换为大端序脚本哈希，RPC参数使用
+func addressToScriptHashHex(address string) (string, error) {
+	_, hash, err := neoTransaction.DecodeCheck(address)
+	if err != nil || len(hash) != 20 {
+		return "", fmt.Errorf("invalid address: %s", address)
+	}
+	be := make([]byte, len(hash))
+	for i, b := range hash {
+		be[len(hash)-1-i] = b
+	}
+	return hex.EncodeToString(be), nil
+}
+
+// isVMStateHalt 虚拟机是否正常结束
+func isVMStateHalt(state string) bool {
+	return state == "HALT" || state == "HALT, BREAK"
+}
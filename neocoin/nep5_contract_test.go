@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseStackInteger(t *testing.T) {
+	cases := map[string]string{
+		`{"type":"ByteArray","value":"00e1f505"}`: "100000000",
+		`{"type":"ByteArray","value":""}`:         "0",
+		`{"type":"ByteArray","value":"ff"}`:       "-1",
+		`{"type":"Integer","value":"12345"}`:      "12345",
+	}
+	for item, want := range cases {
+		number, err := parseStackInteger(gjson.Parse(item))
+		if err != nil {
+			t.Errorf("parseStackInteger failed unexpected error: %v\n", err)
+			continue
+		}
+		if number.String() != want {
+			t.Errorf("parseStackInteger %s: want %s, got %s", item, want, number.String())
+		}
+	}
+}
+
+func TestAddressToScriptHashHex(t *testing.T) {
+	scriptHash, err := addressToScriptHashHex("ANYZ11AmUfwiZFLbAWHoExFyBuqgLmfz88")
+	if err != nil {
+		t.Errorf("addressToScriptHashHex failed unexpected error: %v\n", err)
+		return
+	}
+	if scriptHash != "38f08b26c0faacdbc6cd9839a237013e5fe8434a" {
+		t.Errorf("addressToScriptHashHex: got %s", scriptHash)
+	}
+}
+
+func TestWalletManager_GetNEP5Balance(t *testing.T) {
+	var params []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Method != "invokefunction" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		params = request.Params
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": map[string]interface{}{
+			"state":        "HALT, BREAK",
+			"gas_consumed": "0.338",
+			"stack": []interface{}{
+				map[string]interface{}{"type": "ByteArray", "value": "00c2eb0b"},
+			},
+		}})
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.WalletClient = NewClient(server.URL, "", false)
+
+	balance, err := wm.GetNEP5Balance("ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", 8, "ANYZ11AmUfwiZFLbAWHoExFyBuqgLmfz88")
+	if err != nil {
+		t.Errorf("GetNEP5Balance failed unexpected error: %v\n", err)
+		return
+	}
+	if balance.String() != "2" {
+		t.Errorf("GetNEP5Balance: got %s", balance.String())
+	}
+
+	//balanceOf 的参数为大端序脚本哈希
+	if len(params) != 3 || params[0] != "ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9" || params[1] != "balanceOf" {
+		t.Fatalf("invokefunction params wrong: %v", params)
+	}
+	arg := params[2].([]interface{})[0].(map[string]interface{})
+	if arg["type"] != "Hash160" || arg["value"] != "38f08b26c0faacdbc6cd9839a237013e5fe8434a" {
+		t.Errorf("balanceOf param wrong: %v", arg)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/common/file"
+)
+
+const (
+	nep5TransferBucket = "nep5Transfers"
+
+	//NEP-5 transfer 通知的事件名，十六进制
+	nep5TransferEvent = "7472616e73666572"
+)
+
+//NEP5Transfer 扫描器从应用日志提取的观察地址NEP-5转账，保存在区块链数据库
+//地址余额为全部记录的金额之和
+type NEP5Transfer struct {
+	Key          string `json:"key" storm:"id"` //交易ID:通知序号:地址，对账修复的记录为 repair:高度:地址:合约
+	Address      string `json:"address" storm:"index"`
+	ContractHash string `json:"contract_hash"` //大端序，小写，不带0x
+	TxID         string `json:"txid"`
+	Amount       string `json:"amount"` //未按精度缩小的代币数量，转出为负数
+	BlockHeight  uint64 `json:"block_height" storm:"index"`
+}
+
+//GetNEP5Transfers 通过 getapplicationlog 获取交易的NEP-5转账，需要节点开启 ApplicationLogs 插件
+//每笔转账返回转出和转入两条记录，铸币和销毁只有一条
+func (wm *WalletManager) GetNEP5Transfers(txid string) ([]*NEP5Transfer, error) {
+	result, err := wm.WalletClient.Call("getapplicationlog", []interface{}{txid})
+	if err != nil {
+		return nil, err
+	}
+
+	txid = normalizeAssetID(txid)
+	transfers := make([]*NEP5Transfer, 0)
+	index := 0
+	for _, execution := range result.Get("executions").Array() {
+		if !isVMStateHalt(execution.Get("vmstate").String()) {
+			continue
+		}
+		for _, notification := range execution.Get("notifications").Array() {
+			index++
+			state := notification.Get("state.value").Array()
+			if len(state) != 4 || state[0].Get("value").String() != nep5TransferEvent {
+				continue
+			}
+			contractHash := normalizeAssetID(notification.Get("contract").String())
+			amount, err := parseStackInteger(state[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid nep5 transfer amount of %s: %v", txid, err)
+			}
+			from, to := state[1].Get("value").String(), state[2].Get("value").String()
+			if from == to {
+				continue
+			}
+			for _, side := range []struct {
+				scriptHash string
+				amount     *big.Int
+			}{
+				{from, new(big.Int).Neg(amount)},
+				{to, amount},
+			} {
+				//铸币的转出方和销毁的转入方为空
+				if side.scriptHash == "" {
+					continue
+				}
+				address, err := wm.Decoder.ScriptHashToAddress(side.scriptHash, false)
+				if err != nil {
+					return nil, err
+				}
+				transfers = append(transfers, &NEP5Transfer{
+					Key:          fmt.Sprintf("%s:%d:%s", txid, index-1, address),
+					Address:      address,
+					ContractHash: contractHash,
+					TxID:         txid,
+					Amount:       side.amount.String(),
+				})
+			}
+		}
+	}
+
+	return transfers, nil
+}
+
+//indexNEP5Transfers 把区块提取结果中的NEP-5转账写入本地记录
+//记录的key由交易和通知序号确定，重复提取不会重复计入余额
+func (wm *WalletManager) indexNEP5Transfers(node storm.Node, height uint64, results []ExtractResult) error {
+
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		for _, transfer := range result.nep5Transfers {
+			transfer.BlockHeight = height
+			err := node.Save(transfer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//listLocalNEP5Balances 汇总本地NEP-5转账记录得到地址余额，格式与 GetNEP5Balances 一致
+func (wm *WalletManager) listLocalNEP5Balances(address string) (map[string]*big.Int, error) {
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return make(map[string]*big.Int), nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var list []*NEP5Transfer
+	err = db.From(nep5TransferBucket).Select(q.Eq("Address", address)).Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return sumNEP5Transfers(list)
+}
+
+//sumNEP5Transfers 按合约汇总NEP-5转账记录，不返回余额为0的合约
+func sumNEP5Transfers(list []*NEP5Transfer) (map[string]*big.Int, error) {
+
+	balances := make(map[string]*big.Int)
+	for _, t := range list {
+		amount, ok := new(big.Int).SetString(t.Amount, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid local nep5 transfer of %s: %s", t.Key, t.Amount)
+		}
+		contractHash := strings.ToLower(t.ContractHash)
+		if balance, ok := balances[contractHash]; ok {
+			balance.Add(balance, amount)
+		} else {
+			balances[contractHash] = amount
+		}
+	}
+
+	for contractHash, balance := range balances {
+		if balance.Sign() == 0 {
+			delete(balances, contractHash)
+		}
+	}
+
+	return balances, nil
+}
@@ -0,0 +1,427 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const NEP6Version = "1.0"
+
+//NEP6Wallet NEP-6 钱包文件，neo-cli 和 NEO-GUI 使用的钱包格式
+type NEP6Wallet struct {
+	Name     *string        `json:"name"`
+	Version  string         `json:"version"`
+	Scrypt   NEP6Scrypt     `json:"scrypt"`
+	Accounts []*NEP6Account `json:"accounts"`
+	Extra    interface{}    `json:"extra"`
+}
+
+//NEP6Scrypt 钱包中NEP-2私钥使用的scrypt参数
+type NEP6Scrypt struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+//NEP6Account NEP-6 账户，Key 为NEP-2加密私钥，观察账户为空
+type NEP6Account struct {
+	Address   string        `json:"address"`
+	Label     *string       `json:"label"`
+	IsDefault bool          `json:"isDefault"`
+	Lock      bool          `json:"lock"`
+	Key       *string       `json:"key"`
+	Contract  *NEP6Contract `json:"contract"`
+	Extra     interface{}   `json:"extra"`
+}
+
+//NEP6Contract NEP-6 账户的验证合约
+type NEP6Contract struct {
+	Script     string          `json:"script"`
+	Parameters []NEP6Parameter `json:"parameters"`
+	Deployed   bool            `json:"deployed"`
+}
+
+//NEP6Parameter 验证合约的参数声明
+type NEP6Parameter struct {
+	Name string                               `json:"name"`
+	Type neoTransaction.ContractParameterType `json:"type"`
+}
+
+//DumpWallet 导出资产账户的地址为NEP-6钱包文件，私钥使用passphrase加密为NEP-2
+// wallet : 钱包
+// password : 钱包密码
+// accountID : 资产账户
+// passphrase : NEP-6钱包密码
+// filename : 导出的文件路径
+func (wm *WalletManager) DumpWallet(wallet *openwallet.Wallet, password, accountID, passphrase, filename string) error {
+
+	key, err := wallet.HDKey(password)
+	if err != nil {
+		return err
+	}
+
+	addrs := wallet.GetAddressesByAccount(accountID)
+	if len(addrs) == 0 {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "account[%s] has no address", accountID)
+	}
+
+	nep6, err := wm.ExportNEP6Wallet(key, wallet.Alias, addrs, passphrase)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(nep6, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filename, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	wm.Log.Std.Info("Dump %d addresses to NEP-6 wallet: %s", len(nep6.Accounts), filename)
+
+	return nil
+}
+
+//ImportWallet 导入NEP-6钱包文件的账户到资产账户
+// wallet : 钱包
+// password : 钱包密码
+// accountID : 导入的资产账户
+// filename : NEP-6钱包文件路径
+// passphrase : NEP-6钱包密码
+func (wm *WalletManager) ImportWallet(wallet *openwallet.Wallet, password, accountID, filename, passphrase string) ([]*openwallet.Address, error) {
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var nep6 NEP6Wallet
+	err = json.Unmarshal(content, &nep6)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NEP-6 wallet file: %v", err)
+	}
+
+	key, err := wallet.HDKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]*openwallet.Address)
+	for _, a := range wallet.GetAddressesByAccount(accountID) {
+		exists[a.Address] = a
+	}
+
+	addrs, err := wm.ImportNEP6Wallet(key, accountID, &nep6, passphrase, exists)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wm.saveAddressToDB(addrs, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	wm.Log.Std.Info("Import %d addresses from NEP-6 wallet: %s", len(addrs), filename)
+
+	return addrs, nil
+}
+
+//ExportNEP6Wallet 转换地址为NEP-6钱包
+//HD地址和导入私钥的地址导出NEP-2私钥，合约地址导出验证脚本和参数，观察地址只导出标准验证脚本
+func (wm *WalletManager) ExportNEP6Wallet(key *hdkeystore.HDKey, name string, addrs []*openwallet.Address, passphrase string) (*NEP6Wallet, error) {
+
+	params := wm.Config.NEP2Scrypt
+	nep6 := &NEP6Wallet{
+		Version:  NEP6Version,
+		Scrypt:   NEP6Scrypt{N: params.N, R: params.R, P: params.P},
+		Accounts: make([]*NEP6Account, 0, len(addrs)),
+	}
+	if len(name) > 0 {
+		nep6.Name = &name
+	}
+
+	for _, addr := range addrs {
+		account := &NEP6Account{
+			Address: addr.Address,
+		}
+
+		label := addr.Alias
+		if len(label) == 0 {
+			label = addr.Tag
+		}
+		if len(label) > 0 {
+			account.Label = &label
+		}
+
+		if isContractAddress(addr) {
+			contract, err := newNEP6Contract(addr)
+			if err != nil {
+				return nil, err
+			}
+			account.Contract = contract
+			nep6.Accounts = append(nep6.Accounts, account)
+			continue
+		}
+
+		publicKey := addr.PublicKey
+		if !addr.WatchOnly {
+			priv, pub, err := wm.getAddressPrivateKey(key, addr)
+			if err != nil {
+				return nil, err
+			}
+			encrypted, err := neoTransaction.NEP2Encrypt(priv, passphrase, params)
+			if err != nil {
+				return nil, err
+			}
+			account.Key = &encrypted
+			publicKey = hex.EncodeToString(pub)
+		}
+
+		account.Contract = &NEP6Contract{
+			Script:     "21" + publicKey + "ac",
+			Parameters: []NEP6Parameter{{Name: "signature", Type: neoTransaction.ParamSignature}},
+		}
+
+		nep6.Accounts = append(nep6.Accounts, account)
+	}
+
+	if len(nep6.Accounts) > 0 {
+		nep6.Accounts[0].IsDefault = true
+	}
+
+	return nep6, nil
+}
+
+//ImportNEP6Wallet 转换NEP-6钱包的账户为地址
+//有私钥的账户作为导入私钥地址，多签合约账户优先使用钱包持有私钥的公钥作为签名者，其它合约账户作为观察地址
+// exists : 资产账户中已存在的地址，已存在的地址不会重复导入
+func (wm *WalletManager) ImportNEP6Wallet(key *hdkeystore.HDKey, accountID string, nep6 *NEP6Wallet, passphrase string, exists map[string]*openwallet.Address) ([]*openwallet.Address, error) {
+
+	params := neoTransaction.ScryptParams{N: nep6.Scrypt.N, R: nep6.Scrypt.R, P: nep6.Scrypt.P}
+	if params.N == 0 {
+		params = neoTransaction.DefaultScryptParams
+	}
+
+	if exists == nil {
+		exists = make(map[string]*openwallet.Address)
+	}
+
+	//持有私钥的公钥
+	owned := make(map[string]bool)
+	for _, a := range exists {
+		if !a.WatchOnly {
+			owned[a.PublicKey] = true
+		}
+	}
+
+	addrs := make([]*openwallet.Address, 0)
+	contracts := make([]*NEP6Account, 0)
+
+	//先导入私钥账户，多签合约账户需要用到钱包持有的公钥
+	for _, account := range nep6.Accounts {
+		if account.Key == nil || len(*account.Key) == 0 {
+			contracts = append(contracts, account)
+			continue
+		}
+
+		if _, ok := exists[account.Address]; ok {
+			continue
+		}
+
+		priv, err := neoTransaction.NEP2Decrypt(*account.Key, passphrase, params)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt key of account[%s] failed: %v", account.Address, err)
+		}
+
+		addr, err := wm.newImportedKeyAddress(key, accountID, priv)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Address != account.Address {
+			//neo-cli 的合约账户保存签名者的私钥，合约地址在后面导入
+			if account.Contract == nil || isNEP6StandardContract(account.Contract) {
+				return nil, fmt.Errorf("key of account[%s] does not match the address", account.Address)
+			}
+			contracts = append(contracts, account)
+		} else {
+			setNEP6Label(addr, account)
+		}
+
+		owned[addr.PublicKey] = true
+		if _, ok := exists[addr.Address]; ok {
+			continue
+		}
+		exists[addr.Address] = addr
+		addrs = append(addrs, addr)
+	}
+
+	for _, account := range contracts {
+		if _, ok := exists[account.Address]; ok {
+			continue
+		}
+		if account.Contract == nil {
+			wm.Log.Std.Warning("NEP-6 account[%s] has neither key nor contract, skipped", account.Address)
+			continue
+		}
+
+		addr, err := wm.newNEP6ContractAddress(accountID, account.Contract, owned)
+		if err != nil {
+			return nil, err
+		}
+		if addr == nil {
+			wm.Log.Std.Warning("NEP-6 account[%s] contract has parameters that can not be filled, skipped", account.Address)
+			continue
+		}
+		if addr.Address != account.Address {
+			return nil, fmt.Errorf("contract script of account[%s] does not match the address", account.Address)
+		}
+		setNEP6Label(addr, account)
+
+		exists[addr.Address] = addr
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+//newNEP6ContractAddress 通过NEP-6合约创建地址，标准验证脚本作为观察地址，无法确定参数值的合约返回nil
+func (wm *WalletManager) newNEP6ContractAddress(accountID string, contract *NEP6Contract, owned map[string]bool) (*openwallet.Address, error) {
+
+	verification, err := hex.DecodeString(contract.Script)
+	if err != nil || len(verification) == 0 {
+		return nil, fmt.Errorf("invalid contract script: %s", contract.Script)
+	}
+
+	if neoTransaction.IsStandardVerification(verification) {
+		address, err := wm.Decoder.ScriptToAddress(verification)
+		if err != nil {
+			return nil, err
+		}
+		return &openwallet.Address{
+			AccountID: accountID,
+			Address:   address,
+			PublicKey: hex.EncodeToString(verification[1:34]),
+			Symbol:    wm.Symbol(),
+			WatchOnly: true,
+		}, nil
+	}
+
+	required, pubkeys, err := neoTransaction.ParseMultiSigVerification(verification)
+	if err != nil {
+		return nil, nil
+	}
+	if len(contract.Parameters) != required {
+		return nil, fmt.Errorf("multisig contract requires %d signatures but declares %d parameters", required, len(contract.Parameters))
+	}
+
+	//选择签名者：优先钱包持有私钥的公钥，签名参数按公钥在脚本中的位置倒序排列
+	selected := make([]int, 0, required)
+	for i, pub := range pubkeys {
+		if len(selected) < required && owned[hex.EncodeToString(pub)] {
+			selected = append(selected, i)
+		}
+	}
+	for i, pub := range pubkeys {
+		if len(selected) < required && !owned[hex.EncodeToString(pub)] {
+			selected = append(selected, i)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(selected)))
+
+	params := make([]neoTransaction.ContractParameter, 0, required)
+	for _, i := range selected {
+		params = append(params, neoTransaction.ContractParameter{
+			Type:  neoTransaction.ParamSignature,
+			Value: hex.EncodeToString(pubkeys[i]),
+		})
+	}
+
+	return wm.NewContractAddress(accountID, verification, params)
+}
+
+//newNEP6Contract 转换合约地址为NEP-6合约
+func newNEP6Contract(addr *openwallet.Address) (*NEP6Contract, error) {
+	params, err := getContractParameters(addr)
+	if err != nil {
+		return nil, err
+	}
+	contract := &NEP6Contract{
+		Script:     addr.PublicKey,
+		Parameters: make([]NEP6Parameter, 0, len(params)),
+	}
+	for i, p := range params {
+		contract.Parameters = append(contract.Parameters, NEP6Parameter{
+			Name: fmt.Sprintf("parameter%d", i),
+			Type: p.Type,
+		})
+	}
+	return contract, nil
+}
+
+//isNEP6StandardContract 是否为单签标准验证合约
+func isNEP6StandardContract(contract *NEP6Contract) bool {
+	verification, err := hex.DecodeString(contract.Script)
+	return err == nil && neoTransaction.IsStandardVerification(verification)
+}
+
+//setNEP6Label 设置地址别名为NEP-6账户标签
+func setNEP6Label(addr *openwallet.Address, account *NEP6Account) {
+	if account.Label != nil {
+		addr.Alias = *account.Label
+	}
+}
+
+//getAddressPrivateKey 获取HD地址或导入地址的私钥及压缩公钥，并校验私钥与地址一致
+func (wm *WalletManager) getAddressPrivateKey(key *hdkeystore.HDKey, addr *openwallet.Address) ([]byte, []byte, error) {
+	var (
+		priv []byte
+		err  error
+	)
+	if isImportedKeyAddress(addr) {
+		priv, err = getImportedPrivateKey(key, addr)
+	} else if len(addr.HDPath) > 0 {
+		priv, err = wm.DerivePrivateKey(key, addr.HDPath)
+	} else {
+		return nil, nil, fmt.Errorf("address[%s] has no private key", addr.Address)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, ret := owcrypt.GenPubkey(priv, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return nil, nil, fmt.Errorf("invalid private key of address[%s]", addr.Address)
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1)
+	address, err := wm.Decoder.PublicKeyToAddress(pub, wm.Config.IsTestNet)
+	if err != nil || address != addr.Address {
+		return nil, nil, fmt.Errorf("private key of address[%s] does not match the address", addr.Address)
+	}
+	return priv, pub, nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+// 测试NEP-6钱包的导出和导入，包括HD地址、导入私钥、多签合约和观察地址
+func TestNEP6Wallet(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.NEP2Scrypt = neoTransaction.ScryptParams{N: 256, R: 1, P: 1}
+
+	key, err := hdkeystore.NewHDKey([]byte("0123456789abcdef0123456789abcdef"), "test", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HD地址
+	hdPath := BIP44Path(0, false, 0)
+	master, err := NewHDMasterNode(key.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	childKey, err := master.DerivePath(hdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdPub := childKey.PublicKey
+	hdAddress, _ := wm.Decoder.PublicKeyToAddress(hdPub, false)
+	hdAddr := &openwallet.Address{AccountID: "acc", Address: hdAddress, PublicKey: hex.EncodeToString(hdPub), HDPath: hdPath, Alias: "hd"}
+
+	// 导入私钥地址
+	privKeyBytes, _ := hex.DecodeString("cbf4b9f70470856bb4f40f80b87edb90865997ffee6df315ab166d713af433a5")
+	importedAddr, err := wm.newImportedKeyAddress(key, "acc", privKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2/3 多签合约地址，第三个公钥不在钱包中
+	otherPub, _ := hex.DecodeString("03b209fd4f53a7170ea4444e0cb0a6bb6a53c2bd016926989cf85f9b0fba17a70c")
+	importedPub, _ := hex.DecodeString(importedAddr.PublicKey)
+	verification, err := neoTransaction.BuildMultiSigVerification(2, [][]byte{hdPub, importedPub, otherPub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiSigAddress, _ := wm.Decoder.RedeemScriptToAddress([][]byte{otherPub, importedPub, hdPub}, 2, false)
+	multiSigAddr, err := wm.NewContractAddress("acc", verification, []neoTransaction.ContractParameter{
+		{Type: neoTransaction.ParamSignature, Value: hex.EncodeToString(importedPub)},
+		{Type: neoTransaction.ParamSignature, Value: hex.EncodeToString(hdPub)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multiSigAddr.Address != multiSigAddress {
+		t.Errorf("multisig address wrong : %s, %s", multiSigAddr.Address, multiSigAddress)
+	}
+	multiSigAddr.Alias = "multisig"
+
+	// 观察地址
+	watchAddress, _ := wm.Decoder.PublicKeyToAddress(otherPub, false)
+	watchAddr := &openwallet.Address{AccountID: "acc", Address: watchAddress, PublicKey: hex.EncodeToString(otherPub), WatchOnly: true}
+
+	nep6, err := wm.ExportNEP6Wallet(key, "test", []*openwallet.Address{hdAddr, importedAddr, multiSigAddr, watchAddr}, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := json.Marshal(nep6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("nep6: %s", content)
+
+	var decoded NEP6Wallet
+	err = json.Unmarshal(content, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != NEP6Version || len(decoded.Accounts) != 4 || decoded.Accounts[2].Key != nil || decoded.Accounts[3].Key != nil {
+		t.Fatalf("decoded nep6 wrong : %s", content)
+	}
+
+	// 导入到另一个钱包
+	other, err := hdkeystore.NewHDKey([]byte("fedcba9876543210fedcba9876543210"), "other", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := wm.ImportNEP6Wallet(other, "acc2", &decoded, "wrong", nil); err == nil {
+		t.Errorf("wrong passphrase should fail")
+	}
+
+	addrs, err := wm.ImportNEP6Wallet(other, "acc2", &decoded, "passphrase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 4 {
+		t.Fatalf("imported addresses count wrong : %d", len(addrs))
+	}
+
+	imported := make(map[string]*openwallet.Address)
+	for _, a := range addrs {
+		imported[a.Address] = a
+	}
+
+	a := imported[hdAddress]
+	if a == nil || !isImportedKeyAddress(a) || a.Alias != "hd" {
+		t.Fatalf("hd address import wrong : %+v", a)
+	}
+	priv, err := getImportedPrivateKey(other, a)
+	if err != nil || hex.EncodeToString(priv) != hex.EncodeToString(childKey.PrivateKey) {
+		t.Errorf("hd private key import wrong : %v", err)
+	}
+
+	a = imported[multiSigAddress]
+	if a == nil || !isContractAddress(a) || a.Alias != "multisig" {
+		t.Fatalf("multisig address import wrong : %+v", a)
+	}
+	params, _ := getContractParameters(a)
+	if len(params) != 2 {
+		t.Fatalf("multisig parameters wrong : %+v", params)
+	}
+	for _, p := range params {
+		if p.Value == hex.EncodeToString(otherPub) {
+			t.Errorf("signer without private key selected : %+v", params)
+		}
+	}
+
+	a = imported[watchAddress]
+	if a == nil || !a.WatchOnly || a.PublicKey != hex.EncodeToString(otherPub) {
+		t.Errorf("watch only address import wrong : %+v", a)
+	}
+
+	// 已存在的地址不会重复导入
+	addrs, err = wm.ImportNEP6Wallet(other, "acc2", &decoded, "passphrase", imported)
+	if err != nil || len(addrs) != 0 {
+		t.Errorf("existing addresses imported again : %d, %v", len(addrs), err)
+	}
+}
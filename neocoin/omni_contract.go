@@ -16,7 +16,6 @@
 package neocoin
 
 import (
-	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
 	"github.com/tidwall/gjson"
@@ -147,12 +146,10 @@ func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sma
 
 	var tokenBalanceList []*openwallet.TokenBalance
 
-	for i:=0; i<len(address); i++ {
-		propertyID := common.NewString(contract.Address).UInt64()
-		balance, err := decoder.wm.GetOmniBalance(propertyID, address[i])
-		balance = balance.Shift(decoder.wm.Decimal()).Shift(-int32(contract.Decimals))
+	for i := 0; i < len(address); i++ {
+		balance, err := decoder.wm.GetNEP5Balance(contract.Address, int32(contract.Decimals), address[i])
 		if err != nil {
-			decoder.wm.Log.Errorf("get address[%v] omni token balance failed, err: %v", address[i], err)
+			decoder.wm.Log.Errorf("get address[%v] nep5 token balance failed, err: %v", address[i], err)
 		}
 
 		tokenBalance := &openwallet.TokenBalance{
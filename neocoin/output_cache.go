@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//outputCache 最近出现的交易输出缓存，用于填充交易输入的地址和金额
+//容量有限，超出时淘汰最久未使用的输出
+type outputCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type outputCacheEntry struct {
+	key  string
+	vout *Vout
+}
+
+//newOutputCache 创建输出缓存，size为缓存的输出数量上限
+func newOutputCache(size int) *outputCache {
+	if size < 1 {
+		size = 1
+	}
+	return &outputCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+//outputCacheKey 缓存键，交易ID统一为小写且不带0x前缀
+func outputCacheKey(txid string, n uint64) string {
+	return fmt.Sprintf("%s:%d", strings.TrimPrefix(strings.ToLower(txid), "0x"), n)
+}
+
+//Get 查找交易输出
+func (c *outputCache) Get(txid string, n uint64) (*Vout, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[outputCacheKey(txid, n)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*outputCacheEntry).vout, true
+}
+
+//Add 缓存交易的全部输出
+func (c *outputCache) Add(txid string, vouts []*Vout) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, vout := range vouts {
+		key := outputCacheKey(txid, vout.N)
+		if elem, ok := c.items[key]; ok {
+			elem.Value.(*outputCacheEntry).vout = vout
+			c.order.MoveToFront(elem)
+			continue
+		}
+		c.items[key] = c.order.PushFront(&outputCacheEntry{key: key, vout: vout})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*outputCacheEntry).key)
+		}
+	}
+}
+
+//Len 缓存的输出数量
+func (c *outputCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
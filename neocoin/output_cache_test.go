@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestOutputCache(t *testing.T) {
+	cache := newOutputCache(3)
+	cache.Add("0xAA", []*Vout{{N: 0, Addr: "a0"}, {N: 1, Addr: "a1"}})
+	cache.Add("bb", []*Vout{{N: 0, Addr: "b0"}})
+
+	//访问后 aa:0 变为最近使用
+	if vout, ok := cache.Get("aa", 0); !ok || vout.Addr != "a0" {
+		t.Fatalf("get aa:0 failed: %+v", vout)
+	}
+
+	cache.Add("cc", []*Vout{{N: 0, Addr: "c0"}})
+	if cache.Len() != 3 {
+		t.Fatalf("cache size wrong: %d", cache.Len())
+	}
+	if _, ok := cache.Get("aa", 1); ok {
+		t.Fatalf("least recently used output should be evicted")
+	}
+	for _, key := range []struct {
+		txid string
+		n    uint64
+	}{{"0xaa", 0}, {"BB", 0}, {"cc", 0}} {
+		if _, ok := cache.Get(key.txid, key.n); !ok {
+			t.Errorf("output %s:%d should be cached", key.txid, key.n)
+		}
+	}
+}
+
+func TestNEOBlockScanner_ExtractVerboseBlock(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(12, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.ScanLookAhead = 1
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.ScanBlockTask()
+
+	//只有第一个区块引用的输出需要查询节点
+	if n := chain.callCount("getrawtransaction"); n != 1 {
+		t.Errorf("getrawtransaction called %d times, want 1", n)
+	}
+	if n := chain.callCount("gettxout"); n != 0 {
+		t.Errorf("gettxout called %d times, want 0", n)
+	}
+
+	if len(recorder.data) != 10 {
+		t.Fatalf("extract notify count wrong: %d", len(recorder.data))
+	}
+	for i, data := range recorder.data {
+		height := i + 2
+		if len(data.TxInputs) != 1 || len(data.TxOutputs) != 1 {
+			t.Fatalf("height %d extract data wrong: %+v", height, data)
+		}
+		input := data.TxInputs[0]
+		if input.Address != address || input.Amount != fmt.Sprintf("%d", height) {
+			t.Errorf("height %d input wrong: %+v", height, input)
+		}
+		if data.Transaction.BlockHash != chain.blockHash(height) || data.Transaction.Fees != "-1.00000000" {
+			t.Errorf("height %d transaction wrong: %+v", height, data.Transaction)
+		}
+	}
+
+	//交易池的交易引用未花费输出，缓存未命中时先查 gettxout
+	output, err := bs.resolvePrevOutput(fmt.Sprintf("0x%064x", 100), 0, true)
+	if err == nil || output != nil {
+		t.Errorf("unknown output should not be resolved: %+v", output)
+	}
+	if n := chain.callCount("gettxout"); n != 1 {
+		t.Errorf("gettxout called %d times, want 1", n)
+	}
+}
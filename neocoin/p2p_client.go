@@ -0,0 +1,998 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/log"
+)
+
+const (
+	P2PMagicMainNet = 7630401    //主网网络标识
+	P2PMagicTestNet = 1953787457 //测试网网络标识
+
+	p2pProtocolVersion    = 0
+	p2pServiceNodeNetwork = 1
+	p2pCommandSize        = 12
+	p2pMaxPayloadSize     = 0x02000000
+	p2pMaxHeadersCount    = 2000
+	p2pMaxInventoryCount  = 0xFFFF
+
+	//区块头索引默认最多保存的区块头数量，以及同步起点之前保留的数量
+	p2pHeaderWindow  = 10 * p2pMaxHeadersCount
+	p2pHeaderReserve = 1000
+
+	p2pInventoryTX    = 0x01
+	p2pInventoryBlock = 0x02
+
+	//发送 mempool 后，节点在这段时间内没有新的 inv 视为交易池已返回完毕
+	p2pMemPoolQuiet = 500 * time.Millisecond
+
+	//默认最多保存的节点通告交易数量，与 neo-cli 交易池的默认容量一致
+	p2pMemPoolLimit = 50000
+)
+
+//P2PClient NEO 2 P2P 协议客户端，直接向节点获取区块头、区块和交易，并广播交易
+//节点在请求前自动连接，连接断开后下一次请求重新连接并握手
+type P2PClient struct {
+	Address   string        //节点地址，host:port
+	Magic     uint32        //网络标识
+	UserAgent string        //握手时发送的客户端标识
+	Timeout   time.Duration //等待节点响应的超时时间
+	Debug     bool
+
+	HeaderWindow  uint64 //区块头索引最多保存的区块头数量
+	HeaderReserve uint64 //同步起点之前保留的区块头数量，用于分叉回退
+	MemPoolLimit  int    //最多保存的节点通告交易数量，超出后忽略新的通告
+
+	conn       net.Conn
+	connLock   sync.Mutex
+	writeLock  sync.Mutex
+	peerHeight uint32 //握手时节点的区块高度
+	tipHeight  uint32 //回复 ping 使用的区块高度
+
+	waiters     map[string][]chan []byte //等待响应的请求，key为命令或命令:哈希
+	mempool     map[string]bool          //节点通告的交易
+	invNotify   chan struct{}
+	waitersLock sync.Mutex
+
+	headers     map[uint64]string //区块高度对应的区块哈希，大端序不带0x
+	base        uint64            //区块头索引的起点高度
+	tip         uint64            //区块头索引的最高高度
+	headersLock sync.Mutex
+}
+
+//NewP2PClient 创建P2P客户端
+// address : 节点地址，host:port
+// magic : 网络标识
+func NewP2PClient(address string, magic uint32, debug bool) *P2PClient {
+	c := P2PClient{
+		Address:   address,
+		Magic:     magic,
+		UserAgent: "/openwallet-neo-adapter/",
+		Timeout:   30 * time.Second,
+		Debug:     debug,
+		waiters:   make(map[string][]chan []byte),
+		mempool:   make(map[string]bool),
+		invNotify: make(chan struct{}, 1),
+		headers:   make(map[uint64]string),
+
+		HeaderWindow:  p2pHeaderWindow,
+		HeaderReserve: p2pHeaderReserve,
+		MemPoolLimit:  p2pMemPoolLimit,
+	}
+	return &c
+}
+
+//Connect 连接节点并完成 version/verack 握手，已连接时直接返回
+func (c *P2PClient) Connect() error {
+	_, err := c.connect()
+	return err
+}
+
+//Close 断开与节点的连接
+func (c *P2PClient) Close() error {
+	c.connLock.Lock()
+	conn := c.conn
+	c.connLock.Unlock()
+	if conn != nil {
+		c.disconnect(conn, errors.New("p2p client closed"))
+	}
+	return nil
+}
+
+//PeerHeight 握手时节点的区块高度
+func (c *P2PClient) PeerHeight() uint64 {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return uint64(c.peerHeight)
+}
+
+func (c *P2PClient) connect() (net.Conn, error) {
+
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := c.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("p2p handshake with %s failed: %v", c.Address, err)
+	}
+
+	c.conn = conn
+	c.peerHeight = height
+	go c.readLoop(conn)
+
+	if c.Debug {
+		log.Std.Debug("p2p connected to %s, peer height: %d", c.Address, height)
+	}
+
+	return conn, nil
+}
+
+//handshake 交换 version 和 verack，返回节点的区块高度
+func (c *P2PClient) handshake(conn net.Conn) (uint32, error) {
+
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	port := uint16(0)
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		port = uint16(addr.Port)
+	}
+
+	version := new(bytes.Buffer)
+	binary.Write(version, binary.LittleEndian, uint32(p2pProtocolVersion))
+	binary.Write(version, binary.LittleEndian, uint64(p2pServiceNodeNetwork))
+	binary.Write(version, binary.LittleEndian, uint32(time.Now().Unix()))
+	binary.Write(version, binary.LittleEndian, port)
+	binary.Write(version, binary.LittleEndian, rand.Uint32())
+	writeP2PVarBytes(version, []byte(c.UserAgent))
+	binary.Write(version, binary.LittleEndian, uint32(0))
+	version.WriteByte(1)
+
+	err := writeP2PMessage(conn, c.Magic, "version", version.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		height     uint32
+		gotVersion bool
+		gotVerack  bool
+	)
+
+	for !gotVersion || !gotVerack {
+		command, payload, err := readP2PMessage(conn, c.Magic)
+		if err != nil {
+			return 0, err
+		}
+		switch command {
+		case "version":
+			height, err = parseP2PVersionHeight(payload)
+			if err != nil {
+				return 0, err
+			}
+			err = writeP2PMessage(conn, c.Magic, "verack", nil)
+			if err != nil {
+				return 0, err
+			}
+			gotVersion = true
+		case "verack":
+			gotVerack = true
+		}
+	}
+
+	return height, nil
+}
+
+//readLoop 读取节点消息并分发给等待的请求
+func (c *P2PClient) readLoop(conn net.Conn) {
+	for {
+		command, payload, err := readP2PMessage(conn, c.Magic)
+		if err != nil {
+			c.disconnect(conn, err)
+			return
+		}
+		c.safeHandleMessage(command, payload)
+	}
+}
+
+//safeHandleMessage 处理单个消息，节点发送的异常数据导致的 panic 不中断读取循环
+func (c *P2PClient) safeHandleMessage(command string, payload []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Std.Error("p2p handle %s message from %s failed: %v", command, c.Address, r)
+		}
+	}()
+	c.handleMessage(command, payload)
+}
+
+func (c *P2PClient) handleMessage(command string, payload []byte) {
+
+	switch command {
+	case "ping":
+		//用相同的 nonce 回复 pong
+		if len(payload) == 12 {
+			pong := make([]byte, 12)
+			binary.LittleEndian.PutUint32(pong, atomic.LoadUint32(&c.tipHeight))
+			copy(pong[4:], payload[4:])
+			go c.send("pong", pong)
+		}
+	case "pong", "headers":
+		c.deliver(command, payload)
+	case "block":
+		header, _, err := neoTransaction.DecodeBlockHeader(payload, 0)
+		if err != nil {
+			return
+		}
+		hash, err := header.GetHash()
+		if err != nil {
+			return
+		}
+		c.removeMemPoolTxs(payload)
+		c.deliver("block:"+hash, payload)
+	case "tx":
+		tx, _, err := neoTransaction.DecodeBlockTransaction(payload, 0)
+		if err != nil {
+			return
+		}
+		hash, err := tx.GetHash()
+		if err != nil {
+			return
+		}
+		c.deliver("tx:"+hash, payload)
+	case "inv":
+		invType, hashes, err := parseP2PInventory(payload)
+		if err != nil || invType != p2pInventoryTX {
+			return
+		}
+		c.waitersLock.Lock()
+		for _, hash := range hashes {
+			if len(c.mempool) >= c.MemPoolLimit {
+				break
+			}
+			c.mempool[hash] = true
+		}
+		c.waitersLock.Unlock()
+		select {
+		case c.invNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//removeMemPoolTxs 已打包进区块的交易从通告记录中删除
+func (c *P2PClient) removeMemPoolTxs(payload []byte) {
+
+	c.waitersLock.Lock()
+	defer c.waitersLock.Unlock()
+
+	if len(c.mempool) == 0 {
+		return
+	}
+
+	block, err := neoTransaction.DecodeBlock(payload)
+	if err != nil {
+		return
+	}
+	for _, tx := range block.Transactions {
+		hash, err := tx.GetHash()
+		if err == nil {
+			delete(c.mempool, hash)
+		}
+	}
+}
+
+//disconnect 关闭连接，正在等待响应的请求全部失败
+func (c *P2PClient) disconnect(conn net.Conn, err error) {
+
+	c.connLock.Lock()
+	current := c.conn == conn
+	if current {
+		c.conn = nil
+	}
+	c.connLock.Unlock()
+
+	conn.Close()
+
+	//已经断开过的旧连接，不影响新连接上的请求
+	if !current {
+		return
+	}
+
+	c.waitersLock.Lock()
+	for key, list := range c.waiters {
+		for _, ch := range list {
+			close(ch)
+		}
+		delete(c.waiters, key)
+	}
+	c.waitersLock.Unlock()
+
+	if c.Debug {
+		log.Std.Debug("p2p disconnected from %s: %v", c.Address, err)
+	}
+}
+
+func (c *P2PClient) wait(key string) chan []byte {
+	ch := make(chan []byte, 1)
+	c.waitersLock.Lock()
+	c.waiters[key] = append(c.waiters[key], ch)
+	c.waitersLock.Unlock()
+	return ch
+}
+
+func (c *P2PClient) cancel(key string, ch chan []byte) {
+	c.waitersLock.Lock()
+	defer c.waitersLock.Unlock()
+	list := c.waiters[key]
+	for i, w := range list {
+		if w == ch {
+			c.waiters[key] = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(c.waiters[key]) == 0 {
+		delete(c.waiters, key)
+	}
+}
+
+func (c *P2PClient) deliver(key string, payload []byte) {
+	c.waitersLock.Lock()
+	list := c.waiters[key]
+	delete(c.waiters, key)
+	c.waitersLock.Unlock()
+	for _, ch := range list {
+		ch <- payload
+	}
+}
+
+//send 发送消息，未连接时先连接节点
+func (c *P2PClient) send(command string, payload []byte) error {
+
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	err = writeP2PMessage(conn, c.Magic, command, payload)
+	c.writeLock.Unlock()
+	if err != nil {
+		c.disconnect(conn, err)
+		return err
+	}
+
+	if c.Debug {
+		log.Std.Debug("p2p send %s, payload size: %d", command, len(payload))
+	}
+
+	return nil
+}
+
+//request 发送消息并等待指定的响应
+func (c *P2PClient) request(command string, payload []byte, key string) ([]byte, error) {
+
+	ch := c.wait(key)
+
+	err := c.send(command, payload)
+	if err != nil {
+		c.cancel(key, ch)
+		return nil, err
+	}
+
+	select {
+	case data, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("p2p connection to %s is closed", c.Address)
+		}
+		return data, nil
+	case <-time.After(c.Timeout):
+		c.cancel(key, ch)
+		return nil, fmt.Errorf("p2p %s request timeout", command)
+	}
+}
+
+//Ping 查询节点当前的区块高度
+func (c *P2PClient) Ping() (uint64, error) {
+
+	ping := make([]byte, 12)
+	binary.LittleEndian.PutUint32(ping[4:], uint32(time.Now().Unix()))
+	binary.LittleEndian.PutUint32(ping[8:], rand.Uint32())
+
+	pong, err := c.request("ping", ping, "pong")
+	if err != nil {
+		return 0, err
+	}
+	if len(pong) < 4 {
+		return 0, errors.New("invalid p2p pong payload")
+	}
+
+	return uint64(binary.LittleEndian.Uint32(pong)), nil
+}
+
+//GetHeaders 获取指定区块之后的区块头，每次最多2000个
+// hashStart : 开始的区块哈希，返回的区块头不包含该区块
+func (c *P2PClient) GetHeaders(hashStart string) ([]*neoTransaction.BlockHeader, error) {
+
+	start, err := p2pHashBytes(hashStart)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := new(bytes.Buffer)
+	writeP2PVarInt(payload, 1)
+	payload.Write(start)
+	payload.Write(make([]byte, neoTransaction.BlockHashSize))
+
+	data, err := c.request("getheaders", payload.Bytes(), "headers")
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+	count, err := readP2PVarInt(r)
+	if err != nil || count > p2pMaxHeadersCount {
+		return nil, errors.New("invalid p2p headers payload")
+	}
+
+	headers := make([]*neoTransaction.BlockHeader, 0, count)
+	index := len(data) - r.Len()
+	for i := uint64(0); i < count; i++ {
+		header, next, err := neoTransaction.DecodeBlockHeader(data, index)
+		if err != nil {
+			return nil, err
+		}
+		//区块头之后是交易数量 0
+		if next >= len(data) || data[next] != 0x00 {
+			return nil, errors.New("invalid p2p headers payload")
+		}
+		index = next + 1
+		headers = append(headers, header)
+	}
+
+	return headers, nil
+}
+
+//GetBlock 获取区块
+// hash : 区块哈希
+func (c *P2PClient) GetBlock(hash string) (*neoTransaction.Block, error) {
+
+	payload, err := p2pInventoryPayload(p2pInventoryBlock, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.request("getdata", payload, "block:"+normalizeAssetID(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return neoTransaction.DecodeBlock(data)
+}
+
+//GetTransaction 获取交易，节点从交易池和已确认的区块中查找
+// txid : 交易ID
+func (c *P2PClient) GetTransaction(txid string) (*neoTransaction.Transaction, error) {
+
+	payload, err := p2pInventoryPayload(p2pInventoryTX, txid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.request("getdata", payload, "tx:"+normalizeAssetID(txid))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, _, err := neoTransaction.DecodeBlockTransaction(data, 0)
+	return tx, err
+}
+
+//GetMemPool 获取节点交易池的交易ID，包括上次获取之后节点通告的交易
+func (c *P2PClient) GetMemPool() ([]string, error) {
+
+	//清除之前的通知，只等待 mempool 返回的 inv
+	select {
+	case <-c.invNotify:
+	default:
+	}
+
+	err := c.send("mempool", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case <-c.invNotify:
+			continue
+		case <-time.After(p2pMemPoolQuiet):
+		}
+		break
+	}
+
+	c.waitersLock.Lock()
+	txids := make([]string, 0, len(c.mempool))
+	for hash := range c.mempool {
+		txids = append(txids, hash)
+	}
+	c.mempool = make(map[string]bool)
+	c.waitersLock.Unlock()
+
+	return txids, nil
+}
+
+//RelayTransaction 向节点广播交易，确认交易进入节点的交易池后返回交易ID
+// rawTx : 已签名的交易
+func (c *P2PClient) RelayTransaction(rawTx []byte) (string, error) {
+
+	tx, index, err := neoTransaction.DecodeBlockTransaction(rawTx, 0)
+	if err != nil {
+		return "", err
+	}
+	if index != len(rawTx) {
+		return "", errors.New("invalid raw transaction data length")
+	}
+	txid, err := tx.GetHash()
+	if err != nil {
+		return "", err
+	}
+
+	getdata, err := p2pInventoryPayload(p2pInventoryTX, txid)
+	if err != nil {
+		return "", err
+	}
+
+	key := "tx:" + txid
+	ch := c.wait(key)
+	defer c.cancel(key, ch)
+
+	err = c.send("tx", rawTx)
+	if err != nil {
+		return "", err
+	}
+
+	//节点不回复验证结果，交易通过验证进入交易池后才能获取，定时查询直到超时
+	ticker := time.NewTicker(p2pMemPoolQuiet)
+	defer ticker.Stop()
+	timeout := time.After(c.Timeout)
+	for {
+		err = c.send("getdata", getdata)
+		if err != nil {
+			return "", err
+		}
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return "", fmt.Errorf("p2p connection to %s is closed", c.Address)
+			}
+			return txid, nil
+		case <-ticker.C:
+		case <-timeout:
+			return "", fmt.Errorf("transaction %s is not accepted by p2p node", txid)
+		}
+	}
+}
+
+//SyncHeaders 从区块头索引的最高高度开始同步到节点的最新高度，返回同步后的最高高度
+//索引为空时以 anchorHeight、anchorHash 为起点，节点不认识最高的区块头时逐个回退
+//索引只保存起点之前 HeaderReserve 个和之后的区块头，总数不超过 HeaderWindow，超过时本次同步到窗口为止
+// anchorHeight : 起点区块高度
+// anchorHash : 起点区块哈希
+func (c *P2PClient) SyncHeaders(anchorHeight uint64, anchorHash string) (uint64, error) {
+
+	c.headersLock.Lock()
+	defer c.headersLock.Unlock()
+
+	if len(c.headers) == 0 {
+		if len(anchorHash) == 0 {
+			return 0, errors.New("p2p header index has no anchor block")
+		}
+		c.resetHeaders(anchorHeight, anchorHash)
+	} else if anchorHeight > c.tip && len(anchorHash) > 0 {
+		//起点超过索引的最高高度，从起点重新建立索引
+		c.resetHeaders(anchorHeight, anchorHash)
+	} else if anchorHeight <= c.tip && anchorHeight > c.base+c.HeaderReserve {
+		//起点之前只保留分叉回退需要的区块头
+		for height := c.base; height < anchorHeight-c.HeaderReserve; height++ {
+			delete(c.headers, height)
+		}
+		c.base = anchorHeight - c.HeaderReserve
+	}
+
+	peerHeight, err := c.Ping()
+	if err != nil {
+		return c.tip, err
+	}
+
+	for c.tip < peerHeight && !c.headersFull() {
+
+		headers, err := c.GetHeaders(c.headers[c.tip])
+		if err != nil {
+			//节点不回复不在主链上的区块，回退一个区块头重新同步
+			if c.tip == c.base {
+				return c.tip, err
+			}
+			c.rollbackHeader()
+			continue
+		}
+		if len(headers) == 0 {
+			break
+		}
+
+		for _, header := range headers {
+			if c.headersFull() {
+				break
+			}
+			if uint64(header.Index) != c.tip+1 || header.PrevHash != c.headers[c.tip] {
+				if c.tip == c.base {
+					return c.tip, fmt.Errorf("p2p header %d does not link to the anchor block", header.Index)
+				}
+				c.rollbackHeader()
+				break
+			}
+			hash, err := header.GetHash()
+			if err != nil {
+				return c.tip, err
+			}
+			c.tip++
+			c.headers[c.tip] = hash
+		}
+	}
+
+	atomic.StoreUint32(&c.tipHeight, uint32(c.tip))
+
+	return c.tip, nil
+}
+
+//resetHeaders 清空区块头索引，以指定区块为起点
+func (c *P2PClient) resetHeaders(height uint64, hash string) {
+	c.headers = make(map[uint64]string)
+	c.headers[height] = normalizeAssetID(hash)
+	c.base = height
+	c.tip = height
+}
+
+//headersFull 区块头索引已达到 HeaderWindow
+func (c *P2PClient) headersFull() bool {
+	return c.HeaderWindow > 0 && c.tip-c.base+1 >= c.HeaderWindow
+}
+
+func (c *P2PClient) rollbackHeader() {
+	delete(c.headers, c.tip)
+	c.tip--
+}
+
+//HeaderHash 从区块头索引查询区块哈希
+func (c *P2PClient) HeaderHash(height uint64) (string, bool) {
+	c.headersLock.Lock()
+	defer c.headersLock.Unlock()
+	hash, ok := c.headers[height]
+	return hash, ok
+}
+
+//p2pAnchor 区块头索引的起点，优先使用本地已扫描的区块，没有时使用创世区块
+func (wm *WalletManager) p2pAnchor() (uint64, string) {
+	height, hash := wm.GetLocalNewBlock()
+	if len(hash) > 0 {
+		return height, hash
+	}
+	return 0, wm.Config.P2PGenesisHash
+}
+
+//getBlockHeightByP2P 同步区块头，返回区块数量，与 getblockcount 一致
+//扫描器落后超过区块头索引窗口时返回窗口内的高度，随扫描推进逐步同步
+func (wm *WalletManager) getBlockHeightByP2P() (uint64, error) {
+
+	tip, err := wm.P2PClient.SyncHeaders(wm.p2pAnchor())
+	if err != nil {
+		return 0, err
+	}
+
+	return tip + 1, nil
+}
+
+//getBlockHashByP2P 从区块头索引获得区块hash，未同步的高度先同步区块头
+func (wm *WalletManager) getBlockHashByP2P(height uint64) (string, error) {
+
+	hash, ok := wm.P2PClient.HeaderHash(height)
+	if !ok {
+		_, err := wm.P2PClient.SyncHeaders(wm.p2pAnchor())
+		if err != nil {
+			return "", err
+		}
+		hash, ok = wm.P2PClient.HeaderHash(height)
+	}
+	if !ok {
+		return "", fmt.Errorf("block %d header is not synced from p2p node", height)
+	}
+
+	return "0x" + hash, nil
+}
+
+//getBlockByP2P 获取区块数据
+func (wm *WalletManager) getBlockByP2P(hash string) (*Block, error) {
+
+	raw, err := wm.P2PClient.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return wm.newBlockByRaw(raw)
+}
+
+//getTransactionByP2P 获取交易单
+func (wm *WalletManager) getTransactionByP2P(txid string) (*Transaction, error) {
+
+	raw, err := wm.P2PClient.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	return wm.newTxByRaw(raw)
+}
+
+//getTxOutByP2P P2P协议不能查询未花费的输出，由调用者获取上一笔交易
+func (wm *WalletManager) getTxOutByP2P(txid string, vout uint64) (*Vout, error) {
+	return nil, errors.New("p2p node does not support gettxout")
+}
+
+//getTxIDsInMemPoolByP2P 获取待处理的交易池中的交易单IDs
+func (wm *WalletManager) getTxIDsInMemPoolByP2P() ([]string, error) {
+
+	hashes, err := wm.P2PClient.GetMemPool()
+	if err != nil {
+		return nil, err
+	}
+
+	txids := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		txids = append(txids, "0x"+hash)
+	}
+
+	return txids, nil
+}
+
+//sendRawTransactionByP2P 广播交易
+func (wm *WalletManager) sendRawTransactionByP2P(txHex string) (string, error) {
+
+	rawTx, err := hex.DecodeString(strings.TrimPrefix(txHex, "0x"))
+	if err != nil {
+		return "", err
+	}
+
+	txid, err := wm.P2PClient.RelayTransaction(rawTx)
+	if err != nil {
+		return "", err
+	}
+
+	return "0x" + txid, nil
+}
+
+//writeP2PMessage 写入消息 = 网络标识 + 命令 + 数据长度 + 校验和 + 数据
+func writeP2PMessage(w io.Writer, magic uint32, command string, payload []byte) error {
+
+	if len(command) > p2pCommandSize {
+		return fmt.Errorf("invalid p2p command: %s", command)
+	}
+
+	msg := make([]byte, 24+len(payload))
+	binary.LittleEndian.PutUint32(msg, magic)
+	copy(msg[4:16], command)
+	binary.LittleEndian.PutUint32(msg[16:], uint32(len(payload)))
+	copy(msg[20:24], p2pChecksum(payload))
+	copy(msg[24:], payload)
+
+	_, err := w.Write(msg)
+	return err
+}
+
+//readP2PMessage 读取消息，校验网络标识和校验和
+func readP2PMessage(r io.Reader, magic uint32) (string, []byte, error) {
+
+	header := make([]byte, 24)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if binary.LittleEndian.Uint32(header) != magic {
+		return "", nil, fmt.Errorf("p2p message magic %d does not match network %d", binary.LittleEndian.Uint32(header), magic)
+	}
+
+	command := strings.TrimRight(string(header[4:16]), "\x00")
+	length := binary.LittleEndian.Uint32(header[16:])
+	if length > p2pMaxPayloadSize {
+		return "", nil, fmt.Errorf("p2p message %s payload is too large: %d", command, length)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !bytes.Equal(header[20:24], p2pChecksum(payload)) {
+		return "", nil, fmt.Errorf("p2p message %s checksum mismatch", command)
+	}
+
+	return command, payload, nil
+}
+
+//p2pChecksum 校验和 = SHA256(SHA256(数据))的前4个字节
+func p2pChecksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+//parseP2PVersionHeight 解析 version 消息中节点的区块高度
+func parseP2PVersionHeight(payload []byte) (uint32, error) {
+
+	//version + services + timestamp + port + nonce
+	r := bytes.NewReader(payload)
+	if _, err := r.Seek(4+8+4+2+4, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	agentSize, err := readP2PVarInt(r)
+	if err != nil || agentSize > uint64(r.Len()) {
+		return 0, errors.New("invalid p2p version payload")
+	}
+	r.Seek(int64(agentSize), io.SeekCurrent)
+
+	var height uint32
+	err = binary.Read(r, binary.LittleEndian, &height)
+	if err != nil {
+		return 0, errors.New("invalid p2p version payload")
+	}
+
+	return height, nil
+}
+
+//p2pInventoryPayload inv、getdata 的数据 = 类型 + 哈希数量 + 哈希
+func p2pInventoryPayload(invType byte, hashes ...string) ([]byte, error) {
+
+	payload := new(bytes.Buffer)
+	payload.WriteByte(invType)
+	writeP2PVarInt(payload, uint64(len(hashes)))
+	for _, hash := range hashes {
+		data, err := p2pHashBytes(hash)
+		if err != nil {
+			return nil, err
+		}
+		payload.Write(data)
+	}
+
+	return payload.Bytes(), nil
+}
+
+//parseP2PInventory 解析 inv、getdata 的数据，哈希为大端序不带0x
+func parseP2PInventory(payload []byte) (byte, []string, error) {
+
+	r := bytes.NewReader(payload)
+	invType, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	//先比较数量再相乘，避免溢出
+	count, err := readP2PVarInt(r)
+	if err != nil || count > p2pMaxInventoryCount || count > uint64(r.Len())/neoTransaction.BlockHashSize ||
+		count*neoTransaction.BlockHashSize != uint64(r.Len()) {
+		return 0, nil, errors.New("invalid p2p inventory payload")
+	}
+
+	hashes := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		data := make([]byte, neoTransaction.BlockHashSize)
+		r.Read(data)
+		hashes = append(hashes, p2pHashString(data))
+	}
+
+	return invType, hashes, nil
+}
+
+//p2pHashBytes 大端序哈希转为序列化使用的小端序
+func p2pHashBytes(hash string) ([]byte, error) {
+	data, err := hex.DecodeString(normalizeAssetID(hash))
+	if err != nil || len(data) != neoTransaction.BlockHashSize {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return data, nil
+}
+
+//p2pHashString 序列化的小端序哈希转为大端序十六进制
+func p2pHashString(data []byte) string {
+	reversed := make([]byte, len(data))
+	for i := range data {
+		reversed[len(data)-1-i] = data[i]
+	}
+	return hex.EncodeToString(reversed)
+}
+
+func writeP2PVarInt(w *bytes.Buffer, v uint64) {
+	switch {
+	case v < 0xfd:
+		w.WriteByte(byte(v))
+	case v <= 0xffff:
+		w.WriteByte(0xfd)
+		binary.Write(w, binary.LittleEndian, uint16(v))
+	case v <= 0xffffffff:
+		w.WriteByte(0xfe)
+		binary.Write(w, binary.LittleEndian, uint32(v))
+	default:
+		w.WriteByte(0xff)
+		binary.Write(w, binary.LittleEndian, v)
+	}
+}
+
+func writeP2PVarBytes(w *bytes.Buffer, data []byte) {
+	writeP2PVarInt(w, uint64(len(data)))
+	w.Write(data)
+}
+
+func readP2PVarInt(r *bytes.Reader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch prefix {
+	case 0xfd:
+		var v uint16
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xfe:
+		var v uint32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xff:
+		var v uint64
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return v, err
+	default:
+		return uint64(prefix), nil
+	}
+}
@@ -0,0 +1,491 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//p2pPeerStandIn 模拟 neo-cli 节点的P2P协议
+type p2pPeerStandIn struct {
+	t        *testing.T
+	magic    uint32
+	listener net.Listener
+
+	mu       sync.Mutex
+	blocks   []*neoTransaction.Block
+	txs      map[string][]byte //交易ID对应的交易数据，包括区块内的交易和交易池
+	mempool  []string
+	rejectTx bool
+	calls    map[string]int
+}
+
+func newP2PPeerStandIn(t *testing.T, magic uint32, blocks []*neoTransaction.Block) *p2pPeerStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &p2pPeerStandIn{
+		t:        t,
+		magic:    magic,
+		listener: listener,
+		txs:      make(map[string][]byte),
+		calls:    make(map[string]int),
+	}
+	peer.setBlocks(blocks)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go peer.serve(conn)
+		}
+	}()
+	return peer
+}
+
+func (peer *p2pPeerStandIn) address() string {
+	return peer.listener.Addr().String()
+}
+
+func (peer *p2pPeerStandIn) close() {
+	peer.listener.Close()
+}
+
+//setBlocks 替换节点的区块链，用于模拟分叉
+func (peer *p2pPeerStandIn) setBlocks(blocks []*neoTransaction.Block) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	peer.blocks = blocks
+	for _, block := range blocks {
+		data, err := block.Encode()
+		if err != nil {
+			peer.t.Fatal(err)
+		}
+		header, _ := block.BlockHeader.Encode()
+		//测试区块只有一笔交易，交易数量之后就是交易数据
+		txid, _ := block.Transactions[0].GetHash()
+		peer.txs[txid] = data[len(header)+1:]
+	}
+}
+
+func (peer *p2pPeerStandIn) callCount(command string) int {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	return peer.calls[command]
+}
+
+func (peer *p2pPeerStandIn) height() uint32 {
+	return peer.blocks[len(peer.blocks)-1].Index
+}
+
+func (peer *p2pPeerStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		command, payload, err := readP2PMessage(conn, peer.magic)
+		if err != nil {
+			return
+		}
+		peer.mu.Lock()
+		peer.calls[command]++
+		replies := peer.reply(command, payload)
+		peer.mu.Unlock()
+		for _, reply := range replies {
+			if err := writeP2PMessage(conn, peer.magic, reply.command, reply.payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type p2pStandInReply struct {
+	command string
+	payload []byte
+}
+
+func (peer *p2pPeerStandIn) reply(command string, payload []byte) []p2pStandInReply {
+
+	switch command {
+	case "version":
+		version := new(bytes.Buffer)
+		version.Write(make([]byte, 4+8+4+2+4))
+		writeP2PVarBytes(version, []byte("/stand-in/"))
+		binary.Write(version, binary.LittleEndian, peer.height())
+		version.WriteByte(1)
+		return []p2pStandInReply{{"version", version.Bytes()}, {"verack", nil}}
+	case "ping":
+		pong := append([]byte{}, payload...)
+		binary.LittleEndian.PutUint32(pong, peer.height())
+		return []p2pStandInReply{{"pong", pong}}
+	case "getheaders":
+		//与 neo-cli 一致，不认识的区块和没有更多区块头时不回复
+		start := p2pHashString(payload[1 : 1+32])
+		for i, block := range peer.blocks {
+			hash, _ := block.GetHash()
+			if hash != start || i == len(peer.blocks)-1 {
+				continue
+			}
+			headers := new(bytes.Buffer)
+			writeP2PVarInt(headers, uint64(len(peer.blocks)-i-1))
+			for _, next := range peer.blocks[i+1:] {
+				data, _ := next.BlockHeader.Encode()
+				headers.Write(data)
+				headers.WriteByte(0x00)
+			}
+			return []p2pStandInReply{{"headers", headers.Bytes()}}
+		}
+	case "getdata":
+		invType, hashes, _ := parseP2PInventory(payload)
+		replies := make([]p2pStandInReply, 0)
+		for _, hash := range hashes {
+			if invType == p2pInventoryTX {
+				if data, ok := peer.txs[hash]; ok {
+					replies = append(replies, p2pStandInReply{"tx", data})
+				}
+				continue
+			}
+			for _, block := range peer.blocks {
+				if blockHash, _ := block.GetHash(); blockHash == hash {
+					data, _ := block.Encode()
+					replies = append(replies, p2pStandInReply{"block", data})
+				}
+			}
+		}
+		return replies
+	case "mempool":
+		if len(peer.mempool) > 0 {
+			inv, _ := p2pInventoryPayload(p2pInventoryTX, peer.mempool...)
+			return []p2pStandInReply{{"inv", inv}}
+		}
+	case "tx":
+		if peer.rejectTx {
+			return nil
+		}
+		tx, _, err := neoTransaction.DecodeBlockTransaction(payload, 0)
+		if err != nil {
+			return nil
+		}
+		txid, _ := tx.GetHash()
+		peer.txs[txid] = payload
+		peer.mempool = append(peer.mempool, txid)
+	}
+	return nil
+}
+
+//forkChainAccBlocks 从 from 高度开始生成另一条分叉链，比原链多 extra 个区块
+func forkChainAccBlocks(t *testing.T, blocks []*neoTransaction.Block, from, extra int) []*neoTransaction.Block {
+	fork := append([]*neoTransaction.Block{}, blocks[:from]...)
+	prevHash, _ := blocks[from-1].GetHash()
+	for i := from; i < len(blocks)+extra; i++ {
+		source := blocks[from+(i-from)%(len(blocks)-from)]
+		block := *source
+		block.Index = uint32(i)
+		block.Timestamp += 1000
+		block.PrevHash = prevHash
+		var err error
+		prevHash, err = block.GetHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork = append(fork, &block)
+	}
+	return fork
+}
+
+func TestP2PClient_Handshake(t *testing.T) {
+	blocks := newChainAccBlocks(t, 3, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	peer := newP2PPeerStandIn(t, P2PMagicTestNet, blocks)
+	defer peer.close()
+
+	client := NewP2PClient(peer.address(), P2PMagicMainNet, false)
+	client.Timeout = time.Second
+	if err := client.Connect(); err == nil {
+		t.Fatal("handshake with wrong network magic should fail")
+	}
+
+	client = NewP2PClient(peer.address(), P2PMagicTestNet, false)
+	client.Timeout = time.Second
+	defer client.Close()
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if client.PeerHeight() != 2 {
+		t.Fatalf("peer height wrong: %d", client.PeerHeight())
+	}
+
+	height, err := client.Ping()
+	if err != nil || height != 2 {
+		t.Fatalf("Ping wrong: %d, %v", height, err)
+	}
+
+	//连接断开后下一次请求自动重连
+	client.Close()
+	hash, _ := blocks[1].GetHash()
+	block, err := client.GetBlock(hash)
+	if err != nil {
+		t.Fatalf("GetBlock after reconnect failed: %v", err)
+	}
+	if block.Index != 1 {
+		t.Fatalf("block wrong: %+v", block.BlockHeader)
+	}
+	//网络标识不一致的消息被节点丢弃
+	if peer.callCount("version") != 2 {
+		t.Fatalf("handshake count wrong: %d", peer.callCount("version"))
+	}
+}
+
+func TestP2PClient_SyncHeaders(t *testing.T) {
+	blocks := newChainAccBlocks(t, 8, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	peer := newP2PPeerStandIn(t, P2PMagicTestNet, blocks)
+	defer peer.close()
+
+	client := NewP2PClient(peer.address(), P2PMagicTestNet, false)
+	client.Timeout = 200 * time.Millisecond
+	defer client.Close()
+
+	genesis, _ := blocks[0].GetHash()
+	tip, err := client.SyncHeaders(0, "0x"+genesis)
+	if err != nil || tip != 7 {
+		t.Fatalf("SyncHeaders wrong: %d, %v", tip, err)
+	}
+	for i, block := range blocks {
+		want, _ := block.GetHash()
+		if hash, ok := client.HeaderHash(uint64(i)); !ok || hash != want {
+			t.Fatalf("header %d wrong: %s", i, hash)
+		}
+	}
+
+	//节点切换到从高度 6 分叉的更长链，回退到分叉点重新同步
+	fork := forkChainAccBlocks(t, blocks, 6, 1)
+	peer.setBlocks(fork)
+	tip, err = client.SyncHeaders(0, "")
+	if err != nil || tip != 8 {
+		t.Fatalf("SyncHeaders after fork wrong: %d, %v", tip, err)
+	}
+	for i, block := range fork {
+		want, _ := block.GetHash()
+		if hash, _ := client.HeaderHash(uint64(i)); hash != want {
+			t.Fatalf("header %d after fork wrong: %s", i, hash)
+		}
+	}
+}
+
+func TestP2PClient_SyncHeadersWindow(t *testing.T) {
+	blocks := newChainAccBlocks(t, 8, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	peer := newP2PPeerStandIn(t, P2PMagicTestNet, blocks)
+	defer peer.close()
+
+	client := NewP2PClient(peer.address(), P2PMagicTestNet, false)
+	client.Timeout = 200 * time.Millisecond
+	client.HeaderWindow = 4
+	client.HeaderReserve = 1
+	defer client.Close()
+
+	hashes := make([]string, len(blocks))
+	for i, block := range blocks {
+		hashes[i], _ = block.GetHash()
+	}
+
+	//每次同步不超过窗口，起点推进后丢弃保留区之前的区块头
+	for _, step := range []struct {
+		anchor uint64
+		tip    uint64
+		base   uint64
+	}{
+		{0, 3, 0},
+		{3, 5, 2},
+		{5, 7, 4},
+	} {
+		tip, err := client.SyncHeaders(step.anchor, "0x"+hashes[step.anchor])
+		if err != nil || tip != step.tip {
+			t.Fatalf("SyncHeaders from %d wrong: %d, %v", step.anchor, tip, err)
+		}
+		if len(client.headers) > 4 {
+			t.Fatalf("header index exceeds window: %d", len(client.headers))
+		}
+		if hash, ok := client.HeaderHash(step.base); !ok || hash != hashes[step.base] {
+			t.Fatalf("header %d wrong: %s", step.base, hash)
+		}
+		if _, ok := client.HeaderHash(step.base - 1); step.base > 0 && ok {
+			t.Fatalf("header %d not evicted", step.base-1)
+		}
+	}
+}
+
+func TestNEOBlockScanner_ScanBlockTaskByP2P(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	blocks := newChainAccBlocks(t, 8, address)
+	peer := newP2PPeerStandIn(t, P2PMagicTestNet, blocks)
+	defer peer.close()
+
+	wm, cleanup := newScanTestWallet(t, "http://127.0.0.1:1", address, "account1")
+	defer cleanup()
+	wm.Config.RPCServerType = RPCServerP2P
+	wm.P2PClient = NewP2PClient(peer.address(), P2PMagicTestNet, false)
+	wm.P2PClient.Timeout = time.Second
+	defer wm.P2PClient.Close()
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(blocks))}
+	bs.AddObserver(recorder)
+	hash, _ := blocks[1].GetHash()
+	wm.SaveLocalNewBlock(1, "0x"+hash)
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.ScanBlockTask()
+
+	height, localHash := wm.GetLocalNewBlock()
+	hash, _ = blocks[7].GetHash()
+	if height != 7 || localHash != "0x"+hash {
+		t.Fatalf("scanned height wrong: %d, %s", height, localHash)
+	}
+	if len(recorder.heights) != 6 {
+		t.Fatalf("extract notify count wrong: %v", recorder.heights)
+	}
+	for i, h := range recorder.heights {
+		if h != uint64(i+2) {
+			t.Fatalf("extract notify out of order: %v", recorder.heights)
+		}
+	}
+
+	//区块 2 的输入引用未扫描的区块 1，通过 getdata 获取上一笔交易
+	data := recorder.data[0]
+	prevTxID, _ := blocks[1].Transactions[0].GetHash()
+	if len(data.TxInputs) != 1 || data.TxInputs[0].SourceTxID != "0x"+prevTxID || data.TxInputs[0].Amount != "2" {
+		t.Fatalf("input of block 2 wrong: %+v", data.TxInputs)
+	}
+	if peer.callCount("getdata") < 6 {
+		t.Fatalf("getdata count wrong: %d", peer.callCount("getdata"))
+	}
+}
+
+func TestWalletManager_SendRawTransactionByP2P(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	blocks := newChainAccBlocks(t, 2, address)
+	peer := newP2PPeerStandIn(t, P2PMagicTestNet, blocks)
+	defer peer.close()
+
+	wm := NewWalletManager()
+	wm.Config.RPCServerType = RPCServerP2P
+	wm.P2PClient = NewP2PClient(peer.address(), P2PMagicTestNet, false)
+	wm.P2PClient.Timeout = time.Second
+	defer wm.P2PClient.Close()
+
+	txids, err := wm.GetTxIDsInMemPool()
+	if err != nil || len(txids) != 0 {
+		t.Fatalf("empty mempool wrong: %v, %v", txids, err)
+	}
+
+	prevTxID, _ := blocks[1].Transactions[0].GetHash()
+	txHex, err := neoTransaction.CreateEmptyRawTransaction(neoTransaction.ContractTransaction,
+		[]neoTransaction.Vin{{TxID: prevTxID, Vout: 0}},
+		[]neoTransaction.Vout{{Asset: neoTransaction.NeoGasAssetId, Address: address, Value: 200000000}},
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//未签名交易的见证人数量为 0
+	txHex += "00"
+	want, _ := neoTransaction.GetTransactionHash(txHex)
+
+	txid, err := wm.SendRawTransaction(txHex)
+	if err != nil {
+		t.Fatalf("SendRawTransaction failed: %v", err)
+	}
+	if txid != "0x"+want {
+		t.Fatalf("txid wrong: %s, want %s", txid, want)
+	}
+
+	txids, err = wm.GetTxIDsInMemPool()
+	if err != nil || len(txids) != 1 || txids[0] != txid {
+		t.Fatalf("mempool wrong: %v, %v", txids, err)
+	}
+
+	trx, err := wm.GetTransaction(txid)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if len(trx.Vins) != 1 || trx.Vins[0].TxID != "0x"+prevTxID || len(trx.Vouts) != 1 ||
+		trx.Vouts[0].Addr != address || trx.Vouts[0].Value != "2" {
+		t.Fatalf("transaction wrong: %+v", trx)
+	}
+
+	//节点没有接受的交易返回错误
+	peer.mu.Lock()
+	peer.rejectTx = true
+	peer.mu.Unlock()
+	rejected := strings.Replace(txHex, hex.EncodeToString([]byte{0x00, 0xc2, 0xeb, 0x0b}), hex.EncodeToString([]byte{0x00, 0x84, 0xd7, 0x17}), 1)
+	if _, err := wm.SendRawTransaction(rejected); err == nil {
+		t.Fatal("transaction rejected by node should fail")
+	}
+}
+
+func TestP2PClient_Inventory(t *testing.T) {
+	//数量乘以哈希长度溢出后与剩余长度相等
+	buf := new(bytes.Buffer)
+	buf.WriteByte(p2pInventoryTX)
+	writeP2PVarInt(buf, 1<<59)
+	if _, _, err := parseP2PInventory(buf.Bytes()); err == nil {
+		t.Fatal("overflowed inventory count should fail")
+	}
+
+	//超过协议上限的数量
+	hashes := make([]string, p2pMaxInventoryCount+1)
+	for i := range hashes {
+		hashes[i] = strings.Repeat("0", 56) + hex.EncodeToString([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+	}
+	payload, _ := p2pInventoryPayload(p2pInventoryTX, hashes...)
+	if _, _, err := parseP2PInventory(payload); err == nil {
+		t.Fatal("inventory over protocol limit should fail")
+	}
+	payload, _ = p2pInventoryPayload(p2pInventoryTX, hashes[:3]...)
+	if _, parsed, err := parseP2PInventory(payload); err != nil || len(parsed) != 3 || parsed[2] != hashes[2] {
+		t.Fatalf("parse inventory failed: %v, %v", parsed, err)
+	}
+
+	//异常消息不中断读取循环
+	client := NewP2PClient("127.0.0.1:0", P2PMagicMainNet, false)
+	client.safeHandleMessage("inv", buf.Bytes())
+
+	//通告的交易数量不超过上限，打包进区块的交易删除
+	blocks := newChainAccBlocks(t, 1, "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	blockTxID, _ := blocks[0].Transactions[0].GetHash()
+	client.MemPoolLimit = 2
+	payload, _ = p2pInventoryPayload(p2pInventoryTX, blockTxID, hashes[0], hashes[1])
+	client.safeHandleMessage("inv", payload)
+	if len(client.mempool) != 2 || !client.mempool[blockTxID] || client.mempool[hashes[1]] {
+		t.Fatalf("mempool limit wrong: %v", client.mempool)
+	}
+	data, _ := blocks[0].Encode()
+	client.safeHandleMessage("block", data)
+	if len(client.mempool) != 1 || client.mempool[blockTxID] {
+		t.Fatalf("confirmed transaction not removed: %v", client.mempool)
+	}
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	pendingTxBucket = "pendingTxs"
+
+	//PendingExtParamKey 已上链或被丢弃的交易单的扩展参数中带有此标记，值为之前未确认通知的 PendingTxRef
+	PendingExtParamKey = "pending"
+
+	//PendingTxDroppedReason 交易池丢弃的交易单通知的失败原因
+	PendingTxDroppedReason = "dropped from mempool"
+)
+
+//PendingTx 已通知的未确认交易单，上链或被交易池丢弃后删除
+type PendingTx struct {
+	TxID            string                               `json:"txid" storm:"id"` //小写不带0x的交易ID
+	ExtractData     map[string]*openwallet.TxExtractData `json:"extractData"`     //未确认时通知的数据
+	OmniExtractData map[string]*openwallet.TxExtractData `json:"omniExtractData"` //未确认时通知的代币数据
+	FirstSeen       int64                                `json:"firstSeen"`       //首次在交易池发现的时间
+	LastSeenHeight  uint64                               `json:"lastSeenHeight"`  //最后一次在交易池中时的本地扫描高度
+}
+
+//PendingTxRef 上链或被丢弃的交易单关联的未确认通知
+type PendingTxRef struct {
+	WxID      string `json:"wxid"`
+	FirstSeen int64  `json:"firstSeen"`
+}
+
+//pendingTxID 统一交易ID格式，节点和浏览器返回的交易ID可能带0x前缀
+func pendingTxID(txid string) string {
+	return strings.TrimPrefix(strings.ToLower(txid), "0x")
+}
+
+//extractPendingTxs 提取交易池中的交易单，已通知过的未确认交易单不再重复通知
+func (bs *NEOBlockScanner) extractPendingTxs(txids []string) error {
+
+	bs.pendingTxLock.Lock()
+	defer bs.pendingTxLock.Unlock()
+
+	height, _ := bs.wm.GetLocalNewBlock()
+
+	pendings, err := bs.wm.GetPendingTxs()
+	if err != nil {
+		return err
+	}
+
+	notified := make(map[string]bool)
+	for _, p := range pendings {
+		notified[p.TxID] = true
+	}
+
+	newTxIDs := make([]string, 0, len(txids))
+	for _, txid := range txids {
+		if !notified[pendingTxID(txid)] {
+			newTxIDs = append(newTxIDs, txid)
+		}
+	}
+
+	if len(newTxIDs) == 0 {
+		return nil
+	}
+
+	results := bs.extractConcurrently(len(newTxIDs), func(i int) ExtractResult {
+
+		trx, err := bs.wm.GetTransaction(newTxIDs[i])
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
+			return ExtractResult{
+				TxID:            newTxIDs[i],
+				extractData:     make(map[string]*openwallet.TxExtractData),
+				extractOmniData: make(map[string]*openwallet.TxExtractData),
+				Success:         false,
+			}
+		}
+
+		//交易池列表滞后时交易单可能已上链，由区块扫描通知
+		if len(trx.BlockHash) > 0 {
+			return ExtractResult{
+				TxID:            trx.TxID,
+				extractData:     make(map[string]*openwallet.TxExtractData),
+				extractOmniData: make(map[string]*openwallet.TxExtractData),
+				Success:         true,
+			}
+		}
+
+		return bs.extractTransactionDetail(0, "", trx, bs.ScanAddressFunc)
+	})
+
+	commitErr := bs.commitExtractResults(0, results)
+
+	now := time.Now().Unix()
+	newPendings := make([]*PendingTx, 0)
+	for _, result := range results {
+		if !result.Success || len(result.extractData)+len(result.extractOmniData) == 0 {
+			continue
+		}
+		newPendings = append(newPendings, &PendingTx{
+			TxID:            pendingTxID(result.TxID),
+			ExtractData:     result.extractData,
+			OmniExtractData: result.extractOmniData,
+			FirstSeen:       now,
+			LastSeenHeight:  height,
+		})
+	}
+
+	err = bs.wm.savePendingTxs(newPendings)
+	if err != nil {
+		return err
+	}
+
+	return commitErr
+}
+
+//refreshPendingTxs 更新仍在交易池中的未确认交易单，离开交易池后超过 PendingTxDropBlocks 个区块仍未上链的通知为丢弃
+func (bs *NEOBlockScanner) refreshPendingTxs(txids []string) {
+
+	bs.pendingTxLock.Lock()
+	defer bs.pendingTxLock.Unlock()
+
+	height, _ := bs.wm.GetLocalNewBlock()
+
+	inMemPool := make(map[string]bool)
+	for _, txid := range txids {
+		inMemPool[pendingTxID(txid)] = true
+	}
+
+	candidates, err := bs.wm.updatePendingTxs(height, inMemPool)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not update pending transactions; unexpected error: %v", err)
+		return
+	}
+
+	//交易池列表可能不完整，向节点确认交易不存在或仍未上链后才报告丢弃
+	droppedIDs := make([]string, 0, len(candidates))
+	for _, p := range candidates {
+		if bs.isPendingTxDropped(p.TxID) {
+			droppedIDs = append(droppedIDs, p.TxID)
+		}
+	}
+	if len(droppedIDs) == 0 {
+		return
+	}
+
+	dropped, err := bs.wm.takePendingTxs(droppedIDs)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not delete dropped pending transactions; unexpected error: %v", err)
+		return
+	}
+
+	for _, txid := range droppedIDs {
+		p, exist := dropped[txid]
+		if !exist {
+			continue
+		}
+		bs.wm.Log.Std.Info("block scanner pending transaction: %s dropped from mempool", p.TxID)
+		markDropped(p.ExtractData, p)
+		markDropped(p.OmniExtractData, p)
+		bs.newExtractDataNotify(0, p.ExtractData)
+		bs.newExtractDataNotify(0, p.OmniExtractData)
+	}
+}
+
+//isPendingTxDropped 查询节点确认未确认交易单已被丢弃：节点返回交易不存在，或交易仍没有所在区块
+//查询失败时无法确认，等下次刷新再查询
+func (bs *NEOBlockScanner) isPendingTxDropped(txid string) bool {
+	trx, err := bs.wm.GetTransaction("0x" + txid)
+	if err != nil {
+		if isUnknownTransactionError(err) {
+			return true
+		}
+		bs.wm.Log.Std.Info("block scanner can not get pending transaction: %s; unexpected error: %v", txid, err)
+		return false
+	}
+	return len(trx.BlockHash) == 0
+}
+
+//isUnknownTransactionError 节点明确回复交易不存在，neo-cli 返回 [-100]Unknown transaction，浏览器返回 not found
+func isUnknownTransactionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unknown transaction") || strings.Contains(msg, "not found")
+}
+
+//confirmPendingTxs 已上链的交易单关联之前的未确认通知，并删除未确认记录
+func (bs *NEOBlockScanner) confirmPendingTxs(results []ExtractResult) {
+
+	txids := make([]string, 0)
+	for _, result := range results {
+		if result.Success && len(result.extractData)+len(result.extractOmniData) > 0 {
+			txids = append(txids, pendingTxID(result.TxID))
+		}
+	}
+
+	if len(txids) == 0 {
+		return
+	}
+
+	bs.pendingTxLock.Lock()
+	defer bs.pendingTxLock.Unlock()
+
+	pendings, err := bs.wm.takePendingTxs(txids)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not confirm pending transactions; unexpected error: %v", err)
+		return
+	}
+
+	for _, result := range results {
+		p, exist := pendings[pendingTxID(result.TxID)]
+		if !exist {
+			continue
+		}
+		markPending(result.extractData, p.ExtractData, p.FirstSeen)
+		markPending(result.extractOmniData, p.OmniExtractData, p.FirstSeen)
+	}
+}
+
+//markPending 在交易单的扩展参数中关联同一来源之前的未确认通知，提交时间为首次在交易池发现的时间
+func markPending(extractData, pendingData map[string]*openwallet.TxExtractData, firstSeen int64) {
+	for key, data := range extractData {
+		pending, exist := pendingData[key]
+		if !exist || pending.Transaction == nil || data.Transaction == nil {
+			continue
+		}
+		data.Transaction.SubmitTime = firstSeen
+		data.Transaction.SetExtParam(PendingExtParamKey, PendingTxRef{
+			WxID:      pending.Transaction.WxID,
+			FirstSeen: firstSeen,
+		})
+	}
+}
+
+//markDropped 标记被交易池丢弃的交易单为失败
+func markDropped(extractData map[string]*openwallet.TxExtractData, pending *PendingTx) {
+	for _, data := range extractData {
+		if data.Transaction == nil {
+			continue
+		}
+		data.Transaction.Status = openwallet.TxStatusFail
+		data.Transaction.Reason = PendingTxDroppedReason
+		data.Transaction.SetExtParam(PendingExtParamKey, PendingTxRef{
+			WxID:      data.Transaction.WxID,
+			FirstSeen: pending.FirstSeen,
+		})
+	}
+}
+
+//GetPendingTxs 获取已通知的未确认交易单
+func (wm *WalletManager) GetPendingTxs() ([]*PendingTx, error) {
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var pendings []*PendingTx
+	err = db.From(pendingTxBucket).All(&pendings)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return pendings, nil
+}
+
+//savePendingTxs 保存新通知的未确认交易单
+func (wm *WalletManager) savePendingTxs(pendings []*PendingTx) error {
+
+	if len(pendings) == 0 {
+		return nil
+	}
+
+	file.MkdirAll(wm.Config.DBPath)
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range pendings {
+		err = tx.From(pendingTxBucket).Save(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//updatePendingTxs 记录仍在交易池中的未确认交易单的扫描高度，返回超过丢弃区块数未出现在交易池中的交易单
+//返回的交易单需要向节点确认后再删除
+//height : 本地扫描高度
+//inMemPool : 交易池中的交易ID
+func (wm *WalletManager) updatePendingTxs(height uint64, inMemPool map[string]bool) ([]*PendingTx, error) {
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pendings []*PendingTx
+	err = tx.From(pendingTxBucket).All(&pendings)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	dropped := make([]*PendingTx, 0)
+	for _, p := range pendings {
+		if inMemPool[p.TxID] {
+			if p.LastSeenHeight == height {
+				continue
+			}
+			p.LastSeenHeight = height
+			err = tx.From(pendingTxBucket).Save(p)
+		} else if height >= p.LastSeenHeight+wm.Config.PendingTxDropBlocks {
+			dropped = append(dropped, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+//takePendingTxs 删除并返回指定交易ID的未确认交易单
+func (wm *WalletManager) takePendingTxs(txids []string) (map[string]*PendingTx, error) {
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pendings := make(map[string]*PendingTx)
+	for _, txid := range txids {
+		var p PendingTx
+		err = tx.From(pendingTxBucket).One("TxID", txid, &p)
+		if err == storm.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = tx.From(pendingTxBucket).DeleteStruct(&p)
+		if err != nil {
+			return nil, err
+		}
+		pendings[txid] = &p
+	}
+
+	return pendings, tx.Commit()
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//addMemPoolTx 在交易池中加入一笔向 address 转账 GAS 的交易
+func (chain *chainStandIn) addMemPoolTx(txid, address string) map[string]interface{} {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	tx := map[string]interface{}{
+		"txid": txid,
+		"type": "ContractTransaction",
+		"vin":  []interface{}{},
+		"vout": []interface{}{
+			map[string]interface{}{"n": 0, "asset": "0x" + neoTransaction.NeoGasAssetId, "value": "1", "address": address},
+		},
+	}
+	chain.txs[txid] = tx
+	chain.mempool = append(chain.mempool, txid)
+	return tx
+}
+
+//removeMemPoolTx 从交易池中移除交易
+func (chain *chainStandIn) removeMemPoolTx(txid string) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	for i, id := range chain.mempool {
+		if id == txid {
+			chain.mempool = append(chain.mempool[:i], chain.mempool[i+1:]...)
+			return
+		}
+	}
+}
+
+//confirmMemPoolTx 交易从交易池移除，打包进新区块
+func (chain *chainStandIn) confirmMemPoolTx(tx map[string]interface{}) {
+	chain.removeMemPoolTx(tx["txid"].(string))
+
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	i := len(chain.blocks)
+	tx["blockhash"] = chain.blockHash(i)
+	tx["blocktime"] = 1500000000 + i
+	chain.blocks = append(chain.blocks, map[string]interface{}{
+		"index":             i,
+		"hash":              chain.blockHash(i),
+		"previousblockhash": chain.blockHash(i - 1),
+		"tx":                []interface{}{tx},
+	})
+}
+
+func TestNEOBlockScanner_PendingTxConfirmed(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(3, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, 10)}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(2, chain.blockHash(2))
+
+	tx := chain.addMemPoolTx(fmt.Sprintf("0x%064x", 0xf001), address)
+
+	//同一交易单多次扫描交易池只通知一次
+	bs.ScanTxMemPool()
+	bs.ScanTxMemPool()
+
+	if len(recorder.data) != 1 || recorder.heights[0] != 0 {
+		t.Fatalf("pending notify wrong: %v", recorder.heights)
+	}
+	pendingWxID := recorder.data[0].Transaction.WxID
+
+	pendings, err := wm.GetPendingTxs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pendings) != 1 || pendings[0].TxID != fmt.Sprintf("%064x", 0xf001) || pendings[0].LastSeenHeight != 2 {
+		t.Fatalf("pending store wrong: %+v", pendings)
+	}
+	firstSeen := pendings[0].FirstSeen
+
+	chain.confirmMemPoolTx(tx)
+	bs.IsScanMemPool = true
+	bs.Scanning = true
+	bs.ScanBlockTask()
+
+	if len(recorder.data) != 2 || recorder.heights[1] != 3 {
+		t.Fatalf("confirmed notify wrong: %v", recorder.heights)
+	}
+	confirmed := recorder.data[1].Transaction
+	if confirmed.Status != openwallet.TxStatusSuccess || confirmed.SubmitTime != firstSeen {
+		t.Fatalf("confirmed transaction wrong: %+v", confirmed)
+	}
+	ref := confirmed.GetExtParam().Get(PendingExtParamKey)
+	if ref.Get("wxid").String() != pendingWxID || ref.Get("firstSeen").Int() != firstSeen {
+		t.Fatalf("confirmed transaction pending reference wrong: %s", confirmed.ExtParam)
+	}
+
+	pendings, err = wm.GetPendingTxs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pendings) != 0 {
+		t.Fatalf("confirmed transaction still pending: %+v", pendings)
+	}
+}
+
+func TestNEOBlockScanner_PendingTxDropped(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(3, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.PendingTxDropBlocks = 2
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, 10)}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(2, chain.blockHash(2))
+
+	txid := fmt.Sprintf("0x%064x", 0xf002)
+	chain.addMemPoolTx(txid, address)
+	bs.ScanTxMemPool()
+
+	//仍在交易池中，扫描高度增加不算丢弃
+	wm.SaveLocalNewBlock(5, chain.blockHash(5))
+	bs.ScanTxMemPool()
+
+	chain.removeMemPoolTx(txid)
+	wm.SaveLocalNewBlock(6, chain.blockHash(6))
+	bs.ScanTxMemPool()
+
+	if len(recorder.data) != 1 {
+		t.Fatalf("transaction dropped too early: %v", recorder.heights)
+	}
+
+	wm.SaveLocalNewBlock(7, chain.blockHash(7))
+	bs.ScanTxMemPool()
+
+	if len(recorder.data) != 2 {
+		t.Fatalf("dropped notify wrong: %v", recorder.heights)
+	}
+	dropped := recorder.data[1].Transaction
+	if dropped.Status != openwallet.TxStatusFail || dropped.Reason != PendingTxDroppedReason || dropped.BlockHeight != 0 {
+		t.Fatalf("dropped transaction wrong: %+v", dropped)
+	}
+	if dropped.GetExtParam().Get(PendingExtParamKey+".wxid").String() != recorder.data[0].Transaction.WxID {
+		t.Fatalf("dropped transaction pending reference wrong: %s", dropped.ExtParam)
+	}
+
+	pendings, err := wm.GetPendingTxs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pendings) != 0 {
+		t.Fatalf("dropped transaction still pending: %+v", pendings)
+	}
+}
+
+func TestNEOBlockScanner_PendingTxDropConfirmed(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(3, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.PendingTxDropBlocks = 2
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, 10)}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(2, chain.blockHash(2))
+
+	unknown := fmt.Sprintf("0x%064x", 0xf003)
+	mined := fmt.Sprintf("0x%064x", 0xf004)
+	failed := fmt.Sprintf("0x%064x", 0xf005)
+	chain.addMemPoolTx(unknown, address)
+	minedTx := chain.addMemPoolTx(mined, address)
+	chain.addMemPoolTx(failed, address)
+	bs.ScanTxMemPool()
+
+	if len(recorder.data) != 3 {
+		t.Fatalf("pending notify wrong: %v", recorder.heights)
+	}
+
+	//节点不再认识的交易被丢弃，已打包但区块未扫描的交易和查询失败的交易保持未确认
+	chain.mu.Lock()
+	chain.mempool = nil
+	delete(chain.txs, unknown)
+	minedTx["blockhash"] = chain.blockHash(3)
+	chain.fail = func(method string, params []interface{}) bool {
+		return method == "getrawtransaction" && params[0] == failed
+	}
+	chain.mu.Unlock()
+
+	wm.SaveLocalNewBlock(7, chain.blockHash(7))
+	bs.ScanTxMemPool()
+
+	if len(recorder.data) != 4 {
+		t.Fatalf("dropped notify wrong: %v", recorder.heights)
+	}
+	if dropped := recorder.data[3].Transaction; dropped.Status != openwallet.TxStatusFail || dropped.TxID != unknown {
+		t.Fatalf("dropped transaction wrong: %+v", dropped)
+	}
+
+	pendings, err := wm.GetPendingTxs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pendings) != 2 {
+		t.Fatalf("unconfirmed drops removed: %+v", pendings)
+	}
+	for _, p := range pendings {
+		if p.TxID == pendingTxID(unknown) {
+			t.Fatalf("dropped transaction still pending: %+v", p)
+		}
+	}
+}
+
+func TestGetTxIDsInMemPoolByExplorer(t *testing.T) {
+	tests := []struct {
+		path     string
+		response string
+	}{
+		{"", `["0xaa01","0xaa02"]`},
+		{"", `{"txids":["0xaa01","0xaa02"]}`},
+		{"", `[{"txid":"0xaa01"},{"txid":"0xaa02"}]`},
+		{"api/v1/txs/mempool", `{"txids":["0xaa01","0xaa02"]}`},
+	}
+
+	for _, test := range tests {
+		wm := NewWalletManager()
+		if len(test.path) > 0 {
+			wm.Config.ExplorerMemPoolPath = test.path
+		}
+		wantPath := "/" + wm.Config.ExplorerMemPoolPath
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != wantPath {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(test.response))
+		}))
+
+		wm.ExplorerClient = NewExplorer(server.URL+"/", false)
+		txids, err := wm.getTxIDsInMemPoolByExplorer()
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("%s %s: %v", wantPath, test.response, err)
+		}
+		if len(txids) != 2 || txids[0] != "0xaa01" || txids[1] != "0xaa02" {
+			t.Fatalf("%s %s: txids wrong: %v", wantPath, test.response, txids)
+		}
+	}
+
+	//不支持的返回格式报错，不当作空交易池
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"transactions":[]}`))
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.ExplorerClient = NewExplorer(server.URL+"/", false)
+	if _, err := wm.getTxIDsInMemPoolByExplorer(); err == nil {
+		t.Fatal("unsupported mempool response accepted")
+	}
+}
+
+func TestPendingTxID(t *testing.T) {
+	for _, txid := range []string{"0xABCD", "abcd", "0xabcd"} {
+		if got := pendingTxID(txid); got != "abcd" {
+			t.Errorf("pendingTxID(%s) = %s", txid, got)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	PushNewBlock = "block" //新区块通知
+	PushNewTx    = "tx"    //新交易通知
+)
+
+//PushNotification 节点推送的新区块、新交易通知
+type PushNotification struct {
+	Type   string //PushNewBlock 或 PushNewTx
+	Hash   string //区块哈希或交易ID
+	Height uint64 //区块高度，交易通知为0
+}
+
+//PushSubscriber 节点推送订阅者，扫描器负责断线重连和补扫
+//可通过 SetPushSubscriber 替换为其他推送来源
+type PushSubscriber interface {
+	//Connect 连接推送服务并订阅通知
+	Connect() error
+	//Receive 阻塞读取下一条通知，连接断开时返回错误
+	Receive() (*PushNotification, error)
+	//Close 断开连接，正在等待的 Receive 返回错误
+	Close() error
+}
+
+//WebSocketSubscriber 通过 WebSocket 订阅节点通知插件推送的新区块、新交易
+type WebSocketSubscriber struct {
+	URL              string //推送服务地址，ws:// 或 wss://
+	SubscribeMessage string //连接后发送的订阅消息，为空不发送
+	Timeout          time.Duration
+
+	conn     *websocket.Conn
+	connLock sync.Mutex
+}
+
+//NewWebSocketSubscriber 创建 WebSocket 推送订阅者
+// url : 推送服务地址
+// subscribeMessage : 连接后发送的订阅消息，为空不发送
+func NewWebSocketSubscriber(url, subscribeMessage string) *WebSocketSubscriber {
+	return &WebSocketSubscriber{
+		URL:              url,
+		SubscribeMessage: subscribeMessage,
+		Timeout:          30 * time.Second,
+	}
+}
+
+//Connect 连接推送服务并发送订阅消息
+func (s *WebSocketSubscriber) Connect() error {
+
+	dialer := websocket.Dialer{HandshakeTimeout: s.Timeout}
+	conn, _, err := dialer.Dial(s.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(s.SubscribeMessage) > 0 {
+		err = conn.WriteMessage(websocket.TextMessage, []byte(s.SubscribeMessage))
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	s.connLock.Lock()
+	s.conn = conn
+	s.connLock.Unlock()
+
+	return nil
+}
+
+//Receive 读取下一条通知，跳过无法识别的消息
+func (s *WebSocketSubscriber) Receive() (*PushNotification, error) {
+
+	s.connLock.Lock()
+	conn := s.conn
+	s.connLock.Unlock()
+
+	if conn == nil {
+		return nil, errors.New("push subscriber is not connected")
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if notification, ok := parsePushNotification(data); ok {
+			return notification, nil
+		}
+	}
+}
+
+//Close 断开连接
+func (s *WebSocketSubscriber) Close() error {
+
+	s.connLock.Lock()
+	conn := s.conn
+	s.conn = nil
+	s.connLock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
+}
+
+//parsePushNotification 解析推送消息，兼容通知插件常用的字段名
+//消息类型取 type 或 event，包含 block 为新区块，包含 tx、transaction 为新交易
+func parsePushNotification(data []byte) (*PushNotification, bool) {
+
+	if !gjson.ValidBytes(data) {
+		return nil, false
+	}
+	json := gjson.ParseBytes(data)
+
+	event := strings.ToLower(firstPushField(json, "type", "event").String())
+
+	notification := &PushNotification{}
+	switch {
+	case strings.Contains(event, "block"):
+		notification.Type = PushNewBlock
+		notification.Hash = firstPushField(json, "hash", "block.hash", "blockhash").String()
+		notification.Height = firstPushField(json, "height", "index", "block.index").Uint()
+	case strings.Contains(event, "tx"), strings.Contains(event, "transaction"):
+		notification.Type = PushNewTx
+		notification.Hash = firstPushField(json, "txid", "hash", "tx.txid").String()
+		if len(notification.Hash) == 0 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	return notification, true
+}
+
+func firstPushField(json gjson.Result, paths ...string) gjson.Result {
+	for _, path := range paths {
+		if value := json.Get(path); value.Exists() {
+			return value
+		}
+	}
+	return gjson.Result{}
+}
+
+//SetPushSubscriber 设置节点推送订阅者，Run 时启动
+func (bs *NEOBlockScanner) SetPushSubscriber(subscriber PushSubscriber) {
+	bs.pushSubscriber = subscriber
+}
+
+//startPushSubscriber 启动推送订阅，未配置订阅者时只按定时任务扫描
+func (bs *NEOBlockScanner) startPushSubscriber() {
+
+	if bs.pushSubscriber == nil && len(bs.wm.Config.PushURL) > 0 {
+		bs.pushSubscriber = NewWebSocketSubscriber(bs.wm.Config.PushURL, bs.wm.Config.PushSubscribeMessage)
+	}
+
+	if bs.pushSubscriber == nil || bs.pushStop != nil {
+		return
+	}
+
+	bs.pushStop = make(chan struct{})
+	go bs.runPushSubscriber(bs.pushSubscriber, bs.pushStop)
+	go bs.runTriggeredScan(bs.pushStop)
+}
+
+//stopPushSubscriber 停止推送订阅
+func (bs *NEOBlockScanner) stopPushSubscriber() {
+
+	if bs.pushStop == nil {
+		return
+	}
+
+	close(bs.pushStop)
+	bs.pushStop = nil
+	bs.pushSubscriber.Close()
+}
+
+//runPushSubscriber 接收推送通知，连接断开后等待重连，重连后通过RPC补扫断线期间的区块和交易
+func (bs *NEOBlockScanner) runPushSubscriber(subscriber PushSubscriber, stop chan struct{}) {
+
+	bs.wm.Log.Info("block scanner use push subscriber to listen new data")
+
+	connected := false
+
+	for {
+
+		err := subscriber.Connect()
+		if err == nil {
+			//连接期间已停止订阅，Close 可能早于连接建立，需要再次断开
+			select {
+			case <-stop:
+				subscriber.Close()
+				bs.wm.Log.Info("block scanner push subscriber has been stopped")
+				return
+			default:
+			}
+
+			bs.wm.Log.Info("block scanner push subscriber connected")
+
+			if connected {
+				//断线期间没有收到推送，立即扫描补齐
+				bs.triggerScan()
+			}
+			connected = true
+
+			err = bs.receivePush(subscriber)
+			subscriber.Close()
+		}
+
+		select {
+		case <-stop:
+			bs.wm.Log.Info("block scanner push subscriber has been stopped")
+			return
+		default:
+		}
+
+		bs.wm.Log.Std.Error("block scanner push subscriber disconnected: %v, reconnect after %v", err, bs.wm.Config.PushReconnectWait)
+
+		select {
+		case <-stop:
+			bs.wm.Log.Info("block scanner push subscriber has been stopped")
+			return
+		case <-time.After(bs.wm.Config.PushReconnectWait):
+		}
+	}
+}
+
+//receivePush 处理推送通知直到连接断开
+func (bs *NEOBlockScanner) receivePush(subscriber PushSubscriber) error {
+
+	for {
+		notification, err := subscriber.Receive()
+		if err != nil {
+			return err
+		}
+
+		switch notification.Type {
+		case PushNewBlock:
+			bs.wm.Log.Std.Info("block scanner received new block: %d %s", notification.Height, notification.Hash)
+			bs.triggerScan()
+		case PushNewTx:
+			//扫描器暂停期间不提取推送的交易
+			if !bs.Scanning {
+				continue
+			}
+			err = bs.extractPendingTxs([]string{notification.Hash})
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+			}
+		}
+	}
+}
+
+//triggerScan 请求立即执行扫描任务，正在扫描时合并为下一次扫描
+func (bs *NEOBlockScanner) triggerScan() {
+	select {
+	case bs.scanTrigger <- struct{}{}:
+	default:
+	}
+}
+
+//runTriggeredScan 执行推送触发的扫描任务，扫描器暂停期间的触发直接丢弃
+func (bs *NEOBlockScanner) runTriggeredScan(stop chan struct{}) {
+	for {
+		select {
+		case <-bs.scanTrigger:
+			if !bs.Scanning {
+				continue
+			}
+			bs.ScanBlockTask()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/gorilla/websocket"
+)
+
+//pushStandIn 模拟节点通知插件的 WebSocket 推送服务
+type pushStandIn struct {
+	mu          sync.Mutex
+	conn        *websocket.Conn
+	connections int
+	subscribes  []string
+	connected   chan struct{}
+}
+
+func (push *pushStandIn) serve() *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		push.mu.Lock()
+		push.conn = conn
+		push.connections++
+		push.subscribes = append(push.subscribes, string(msg))
+		push.mu.Unlock()
+		push.connected <- struct{}{}
+	}))
+}
+
+func (push *pushStandIn) send(t *testing.T, msg string) {
+	push.mu.Lock()
+	defer push.mu.Unlock()
+	if err := push.conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//drop 断开当前连接
+func (push *pushStandIn) drop() {
+	push.mu.Lock()
+	defer push.mu.Unlock()
+	push.conn.Close()
+}
+
+//waitHeight 等待扫描器通知指定高度的新区块
+func waitHeight(t *testing.T, recorder *scanRecorder, height uint64) {
+	for {
+		select {
+		case header := <-recorder.headers:
+			if header.Height == height {
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("block %d is not scanned", height)
+		}
+	}
+}
+
+func TestParsePushNotification(t *testing.T) {
+	for _, c := range []struct {
+		msg  string
+		want *PushNotification
+	}{
+		{`{"type":"block","hash":"0xab","index":12}`, &PushNotification{Type: PushNewBlock, Hash: "0xab", Height: 12}},
+		{`{"event":"new_block","block":{"hash":"0xcd","index":13}}`, &PushNotification{Type: PushNewBlock, Hash: "0xcd", Height: 13}},
+		{`{"type":"transaction","txid":"0xef"}`, &PushNotification{Type: PushNewTx, Hash: "0xef"}},
+		{`{"event":"tx","tx":{"txid":"0x01"}}`, &PushNotification{Type: PushNewTx, Hash: "0x01"}},
+		{`{"event":"tx"}`, nil},
+		{`{"type":"notify"}`, nil},
+		{`not json`, nil},
+	} {
+		got, ok := parsePushNotification([]byte(c.msg))
+		if c.want == nil {
+			if ok {
+				t.Errorf("%s should be skipped, got %+v", c.msg, got)
+			}
+			continue
+		}
+		if !ok || *got != *c.want {
+			t.Errorf("%s parsed wrong: %+v", c.msg, got)
+		}
+	}
+}
+
+func TestNEOBlockScanner_PushSubscriber(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(8, address)
+	blocks := chain.blocks
+	//节点开始只有 4 个区块
+	chain.blocks = blocks[:4]
+	server := chain.serve()
+	defer server.Close()
+
+	push := &pushStandIn{connected: make(chan struct{}, 4)}
+	pushServer := push.serve()
+	defer pushServer.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.PushURL = "ws" + strings.TrimPrefix(pushServer.URL, "http")
+	wm.Config.PushSubscribeMessage = `{"subscribe":["block","tx"]}`
+	wm.Config.PushReconnectWait = 50 * time.Millisecond
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, 16)}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.startPushSubscriber()
+	defer bs.stopPushSubscriber()
+
+	select {
+	case <-push.connected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("push subscriber not connected")
+	}
+
+	//新区块通知立即触发扫描
+	push.send(t, `{"type":"block","hash":"`+chain.blockHash(3)+`","index":3}`)
+	waitHeight(t, recorder, 3)
+
+	//新交易通知直接提取交易池中的交易
+	txid := "0x" + strings.Repeat("0", 60) + "f003"
+	chain.addMemPoolTx(txid, address)
+	push.send(t, `{"type":"tx","txid":"`+txid+`"}`)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		recorder.mu.Lock()
+		found := false
+		for _, data := range recorder.data {
+			if data.Transaction.TxID == txid {
+				found = true
+			}
+		}
+		recorder.mu.Unlock()
+		if found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pushed transaction %s is not extracted", txid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//断线期间出块没有推送，重连后通过RPC补扫
+	chain.mu.Lock()
+	chain.blocks = blocks
+	chain.mu.Unlock()
+	push.drop()
+
+	select {
+	case <-push.connected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("push subscriber not reconnected")
+	}
+	waitHeight(t, recorder, 7)
+
+	if height, _ := wm.GetLocalNewBlock(); height != 7 {
+		t.Fatalf("scanned height wrong: %d", height)
+	}
+	push.mu.Lock()
+	defer push.mu.Unlock()
+	if push.connections != 2 || push.subscribes[1] != wm.Config.PushSubscribeMessage {
+		t.Fatalf("push connections wrong: %d, %v", push.connections, push.subscribes)
+	}
+}
+
+//blockingSubscriber 连接时阻塞，直到测试放行
+type blockingSubscriber struct {
+	connecting chan struct{}
+	release    chan struct{}
+	closed     chan struct{}
+	receives   int32
+}
+
+func (s *blockingSubscriber) Connect() error {
+	s.connecting <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *blockingSubscriber) Receive() (*PushNotification, error) {
+	atomic.AddInt32(&s.receives, 1)
+	<-s.closed
+	return nil, errors.New("closed")
+}
+
+func (s *blockingSubscriber) Close() error {
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	return nil
+}
+
+func TestNEOBlockScanner_PushSubscriberStop(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(4, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+
+	//暂停期间推送触发的扫描不执行
+	subscriber := &blockingSubscriber{
+		connecting: make(chan struct{}, 1),
+		release:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	bs.SetPushSubscriber(subscriber)
+	bs.Scanning = false
+	bs.startPushSubscriber()
+	bs.triggerScan()
+	time.Sleep(50 * time.Millisecond)
+	if chain.callCount("getblockcount") != 0 {
+		t.Fatal("paused scanner should not scan on push")
+	}
+
+	//连接期间停止订阅，连接建立后立即断开，不再读取通知
+	select {
+	case <-subscriber.connecting:
+	case <-time.After(3 * time.Second):
+		t.Fatal("push subscriber not connecting")
+	}
+	bs.stopPushSubscriber()
+	subscriber.closed = make(chan struct{})
+	close(subscriber.release)
+
+	select {
+	case <-subscriber.closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection established after stop is not closed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&subscriber.receives) != 0 {
+		t.Fatal("stopped subscriber should not receive")
+	}
+}
@@ -0,0 +1,498 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/shopspring/decimal"
+)
+
+//对账差异类型
+const (
+	ReconcileMissingUnspent = "missing_unspent" //节点存在，本地索引缺失的未花费
+	ReconcileExtraUnspent   = "extra_unspent"   //本地索引存在，节点已不存在的未花费
+	ReconcileUnspentValue   = "unspent_value"   //同一输出金额不一致
+	ReconcileBalance        = "balance"         //全局资产余额不一致
+	ReconcileNEP5Balance    = "nep5_balance"    //NEP-5代币余额不一致
+)
+
+//ReconcileOptions 对账参数
+type ReconcileOptions struct {
+	Addresses  []string //指定对账地址，为空时使用观察地址表
+	SampleSize int      //随机抽样的地址数量，0表示遍历全部地址
+	Repair     bool     //是否以节点数据修复本地存储
+}
+
+//ReconcileDivergence 一条对账差异
+type ReconcileDivergence struct {
+	Address string `json:"address"`
+	Kind    string `json:"kind"`
+	AssetID string `json:"asset_id"` //全局资产ID或NEP-5合约脚本哈希
+	TxID    string `json:"txid,omitempty"`
+	N       uint64 `json:"n,omitempty"`
+	Local   string `json:"local"`
+	Node    string `json:"node"`
+}
+
+//ReconcileReport 对账报告
+type ReconcileReport struct {
+	StartedAt   int64                  `json:"started_at"`
+	FinishedAt  int64                  `json:"finished_at"`
+	Total       int                    `json:"total"`   //观察地址总数
+	Checked     int                    `json:"checked"` //已对账地址数
+	Repaired    int                    `json:"repaired"`
+	Divergences []*ReconcileDivergence `json:"divergences"`
+	Errors      map[string]string      `json:"errors"` //对账失败的地址及原因
+}
+
+//Consistent 本次对账没有发现差异和错误
+func (report *ReconcileReport) Consistent() bool {
+	return len(report.Divergences) == 0 && len(report.Errors) == 0
+}
+
+//GetAccountState 通过 getaccountstate 获取地址的全局资产余额
+//返回值 key 为资产ID（小写，不带0x）
+func (wm *WalletManager) GetAccountState(address string) (map[string]decimal.Decimal, error) {
+	result, err := wm.WalletClient.Call("getaccountstate", []interface{}{address})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	for _, b := range result.Get("balances").Array() {
+		value, err := decimal.NewFromString(b.Get("value").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid account state balance of %s: %s", b.Get("asset").String(), b.Get("value").String())
+		}
+		if value.IsPositive() {
+			balances[normalizeAssetID(b.Get("asset").String())] = value
+		}
+	}
+
+	return balances, nil
+}
+
+//Reconcile 对比本地未花费索引、余额和NEP-5余额与节点数据，输出差异报告
+//opts.Repair 为true时，以节点返回的数据修复差异地址的本地记录，要求扫描器已同步到节点高度
+func (wm *WalletManager) Reconcile(opts ReconcileOptions) (*ReconcileReport, error) {
+
+	addresses := opts.Addresses
+	if len(addresses) == 0 {
+		for _, a := range wm.WatchOnly.List("") {
+			addresses = append(addresses, a.Address)
+		}
+	}
+	sort.Strings(addresses)
+
+	report := &ReconcileReport{
+		StartedAt:   time.Now().Unix(),
+		Total:       len(addresses),
+		Divergences: make([]*ReconcileDivergence, 0),
+		Errors:      make(map[string]string),
+	}
+
+	//扫描器落后于节点时，节点余额包含扫描器之后还会登记的记录，修复会重复计入
+	var repairHeight uint64
+	if opts.Repair {
+		blockCount, err := wm.GetBlockHeight()
+		if err != nil {
+			return nil, err
+		}
+		repairHeight, _ = wm.GetLocalNewBlock()
+		if blockCount > repairHeight+1 {
+			return nil, fmt.Errorf("block scanner height %d is behind the node height %d, repair after it catches up", repairHeight, blockCount-1)
+		}
+	}
+
+	if opts.SampleSize > 0 && opts.SampleSize < len(addresses) {
+		sample := make([]string, 0, opts.SampleSize)
+		for _, i := range rand.Perm(len(addresses))[:opts.SampleSize] {
+			sample = append(sample, addresses[i])
+		}
+		sort.Strings(sample)
+		addresses = sample
+	}
+
+	for _, address := range addresses {
+		divergences, node, err := wm.reconcileAddress(address)
+		if err != nil {
+			wm.Log.Std.Error("reconcile address %s failed, unexpected error: %v", address, err)
+			report.Errors[address] = err.Error()
+			continue
+		}
+		report.Checked++
+		report.Divergences = append(report.Divergences, divergences...)
+
+		if opts.Repair && len(divergences) > 0 {
+			err = wm.repairAddress(address, repairHeight, divergences, node)
+			if err != nil {
+				wm.Log.Std.Error("repair address %s failed, unexpected error: %v", address, err)
+				report.Errors[address] = err.Error()
+				continue
+			}
+			report.Repaired++
+		}
+	}
+
+	report.FinishedAt = time.Now().Unix()
+
+	return report, nil
+}
+
+//reconcileNodeState 对账时从节点获取的地址数据
+type reconcileNodeState struct {
+	unspents *UnspentBalance
+	nep5     map[string]*big.Int
+}
+
+//reconcileAddress 对比单个地址的本地记录与节点数据
+func (wm *WalletManager) reconcileAddress(address string) ([]*ReconcileDivergence, *reconcileNodeState, error) {
+
+	divergences := make([]*ReconcileDivergence, 0)
+
+	localUnspents, err := wm.listUnspentByIndex(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeUnspents, err := wm.getListUnspentByCore(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	accountState, err := wm.GetAccountState(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//NEP-5转账记录只在使用本地索引时由扫描器维护
+	var localNEP5, nodeNEP5 map[string]*big.Int
+	if wm.Config.LocalUnspentIndex {
+		localNEP5, err = wm.listLocalNEP5Balances(address)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodeNEP5, err = wm.GetNEP5Balances(address)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	//逐个输出对比未花费
+	localOutputs := reconcileOutputs(localUnspents)
+	nodeOutputs := reconcileOutputs(nodeUnspents)
+	for key, nodeOutput := range nodeOutputs {
+		localOutput, ok := localOutputs[key]
+		if !ok {
+			divergences = append(divergences, &ReconcileDivergence{
+				Address: address,
+				Kind:    ReconcileMissingUnspent,
+				AssetID: nodeOutput.assetID,
+				TxID:    nodeOutput.TxID,
+				N:       nodeOutput.N,
+				Node:    nodeOutput.value.String(),
+			})
+		} else if !localOutput.value.Equal(nodeOutput.value) {
+			divergences = append(divergences, &ReconcileDivergence{
+				Address: address,
+				Kind:    ReconcileUnspentValue,
+				AssetID: nodeOutput.assetID,
+				TxID:    nodeOutput.TxID,
+				N:       nodeOutput.N,
+				Local:   localOutput.value.String(),
+				Node:    nodeOutput.value.String(),
+			})
+		}
+	}
+	for key, localOutput := range localOutputs {
+		if _, ok := nodeOutputs[key]; !ok {
+			divergences = append(divergences, &ReconcileDivergence{
+				Address: address,
+				Kind:    ReconcileExtraUnspent,
+				AssetID: localOutput.assetID,
+				TxID:    localOutput.TxID,
+				N:       localOutput.N,
+				Local:   localOutput.value.String(),
+			})
+		}
+	}
+
+	//本地余额由未花费索引汇总，与账户状态对比
+	//索引只登记已注册的全局资产，账户状态中未注册的资产不参与对比
+	localBalances := make(map[string]decimal.Decimal)
+	for _, output := range localOutputs {
+		localBalances[output.assetID] = localBalances[output.assetID].Add(output.value)
+	}
+	for assetID := range accountState {
+		if _, ok := wm.GetUTXOAsset(assetID); !ok {
+			delete(accountState, assetID)
+		}
+	}
+	for _, assetID := range decimalKeys(localBalances, accountState) {
+		local, node := localBalances[assetID], accountState[assetID]
+		if !local.Equal(node) {
+			divergences = append(divergences, &ReconcileDivergence{
+				Address: address,
+				Kind:    ReconcileBalance,
+				AssetID: assetID,
+				Local:   local.String(),
+				Node:    node.String(),
+			})
+		}
+	}
+
+	//NEP-5余额
+	for _, contractHash := range bigIntKeys(localNEP5, nodeNEP5) {
+		local, node := localNEP5[contractHash], nodeNEP5[contractHash]
+		if local == nil {
+			local = new(big.Int)
+		}
+		if node == nil {
+			node = new(big.Int)
+		}
+		if local.Cmp(node) != 0 {
+			divergences = append(divergences, &ReconcileDivergence{
+				Address: address,
+				Kind:    ReconcileNEP5Balance,
+				AssetID: contractHash,
+				Local:   local.String(),
+				Node:    node.String(),
+			})
+		}
+	}
+
+	return divergences, &reconcileNodeState{unspents: nodeUnspents, nep5: nodeNEP5}, nil
+}
+
+//repairAddress 用节点数据重建地址的未花费索引，并补录NEP-5余额差额
+//补录的未花费使用所在交易的区块高度，NEP-5差额记录在当前扫描高度，分叉回滚时一并删除
+func (wm *WalletManager) repairAddress(address string, height uint64, divergences []*ReconcileDivergence, node *reconcileNodeState) error {
+
+	//先从节点查询缺失输出所在的区块高度
+	outputHeights := make(map[string]uint64)
+	for _, d := range divergences {
+		if d.Kind != ReconcileMissingUnspent {
+			continue
+		}
+		txid := normalizeAssetID(d.TxID)
+		if _, ok := outputHeights[txid]; ok {
+			continue
+		}
+		blockHeight, err := wm.getTransactionBlockHeight(txid)
+		if err != nil {
+			return err
+		}
+		outputHeights[txid] = blockHeight
+	}
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	index := tx.From(utxoIndexBucket)
+
+	var local []*IndexedUnspent
+	err = index.Select(q.Eq("Address", address), q.Eq("SpentHeight", uint64(0))).Find(&local)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	nodeOutputs := reconcileOutputs(node.unspents)
+	for _, u := range local {
+		if _, ok := nodeOutputs[u.Key]; !ok {
+			err = index.DeleteStruct(u)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, output := range nodeOutputs {
+		unspent := IndexedUnspent{
+			Key:         key,
+			TxID:        normalizeAssetID(output.TxID),
+			N:           output.N,
+			Address:     address,
+			AssetID:     output.assetID,
+			Value:       output.value.String(),
+			BlockHeight: outputHeights[normalizeAssetID(output.TxID)],
+		}
+		var exist IndexedUnspent
+		err = index.One("Key", key, &exist)
+		if err == nil {
+			unspent.BlockHeight = exist.BlockHeight
+		} else if err != storm.ErrNotFound {
+			return err
+		}
+		err = index.Save(&unspent)
+		if err != nil {
+			return err
+		}
+	}
+
+	if wm.Config.LocalUnspentIndex {
+		err = wm.repairNEP5Balances(tx.From(nep5TransferBucket), address, height, node.nep5)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//repairNEP5Balances 把本地NEP-5余额与节点的差额登记为一条修复记录
+//同一高度重复修复时累加到已有的修复记录
+func (wm *WalletManager) repairNEP5Balances(node storm.Node, address string, height uint64, nodeNEP5 map[string]*big.Int) error {
+
+	var list []*NEP5Transfer
+	err := node.Select(q.Eq("Address", address)).Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	localNEP5, err := sumNEP5Transfers(list)
+	if err != nil {
+		return err
+	}
+
+	for _, contractHash := range bigIntKeys(localNEP5, nodeNEP5) {
+		diff := new(big.Int)
+		if amount, ok := nodeNEP5[contractHash]; ok {
+			diff.Set(amount)
+		}
+		if amount, ok := localNEP5[contractHash]; ok {
+			diff.Sub(diff, amount)
+		}
+		if diff.Sign() == 0 {
+			continue
+		}
+
+		transfer := NEP5Transfer{
+			Key:          fmt.Sprintf("repair:%d:%s:%s", height, address, contractHash),
+			Address:      address,
+			ContractHash: contractHash,
+			BlockHeight:  height,
+		}
+		var exist NEP5Transfer
+		err = node.One("Key", transfer.Key, &exist)
+		if err == nil {
+			amount, ok := new(big.Int).SetString(exist.Amount, 10)
+			if !ok {
+				return fmt.Errorf("invalid local nep5 transfer of %s: %s", exist.Key, exist.Amount)
+			}
+			diff.Add(diff, amount)
+		} else if err != storm.ErrNotFound {
+			return err
+		}
+		transfer.Amount = diff.String()
+
+		err = node.Save(&transfer)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//getTransactionBlockHeight 查询交易所在的区块高度
+func (wm *WalletManager) getTransactionBlockHeight(txid string) (uint64, error) {
+	trx, err := wm.GetTransaction(txid)
+	if err != nil {
+		return 0, err
+	}
+	if trx.BlockHash == "" {
+		return 0, fmt.Errorf("transaction %s is not confirmed", txid)
+	}
+	block, err := wm.GetBlock(trx.BlockHash)
+	if err != nil {
+		return 0, err
+	}
+	return block.Height, nil
+}
+
+//reconcileOutput 对账使用的未花费输出
+type reconcileOutput struct {
+	UnspentTx
+	assetID string
+	value   decimal.Decimal
+}
+
+//reconcileOutputs 展开地址未花费，key 为 outputCacheKey
+func reconcileOutputs(balance *UnspentBalance) map[string]*reconcileOutput {
+	outputs := make(map[string]*reconcileOutput)
+	for assetID, unspent := range balance.Unspents {
+		if unspent.UnspentTxs == nil {
+			continue
+		}
+		for _, u := range *unspent.UnspentTxs {
+			value, _ := decimal.NewFromString(u.Value)
+			outputs[outputCacheKey(u.TxID, u.N)] = &reconcileOutput{
+				UnspentTx: u,
+				assetID:   normalizeAssetID(assetID),
+				value:     value,
+			}
+		}
+	}
+	return outputs
+}
+
+//decimalKeys 合并两个全局资产余额表的key并排序
+func decimalKeys(a, b map[string]decimal.Decimal) []string {
+	set := make(map[string]bool)
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sortedKeys(set)
+}
+
+//bigIntKeys 合并两个NEP-5余额表的key并排序
+func bigIntKeys(a, b map[string]*big.Int) []string {
+	set := make(map[string]bool)
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sortedKeys(set)
+}
+
+//sortedKeys 集合的key排序
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,280 @@
+package neocoin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/asdine/storm"
+)
+
+func newReconcileNodeStandIn(address string) *httptest.Server {
+	results := map[string]interface{}{
+		"getunspents": map[string]interface{}{
+			"address": address,
+			"balance": []interface{}{
+				map[string]interface{}{
+					"asset_hash": neoTransaction.NeoAssetId, "asset_symbol": "NEO", "amount": "15",
+					"unspent": []interface{}{
+						map[string]interface{}{"txid": "c3182952855314b3f4b1ecf01a03b891d4627d19426ce841275f6d4c186e729a", "n": 0, "value": "10"},
+						map[string]interface{}{"txid": "bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", "n": 1, "value": "5"},
+					},
+				},
+				map[string]interface{}{
+					"asset_hash": "0x" + neoTransaction.NeoGasAssetId, "asset_symbol": "GAS", "amount": "1.5",
+					"unspent": []interface{}{
+						map[string]interface{}{"txid": "bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", "n": 0, "value": "1.5"},
+					},
+				},
+			},
+		},
+		"getaccountstate": map[string]interface{}{
+			"version": 0,
+			"balances": []interface{}{
+				map[string]interface{}{"asset": "0x" + neoTransaction.NeoAssetId, "value": "15"},
+				map[string]interface{}{"asset": "0x" + neoTransaction.NeoGasAssetId, "value": "1.5"},
+				//未注册的全局资产不参与对比
+				map[string]interface{}{"asset": "0x" + fmt.Sprintf("%064x", 0xa55e7), "value": "100"},
+			},
+		},
+		"getnep5balances": map[string]interface{}{
+			"address": address,
+			"balance": []interface{}{
+				map[string]interface{}{"asset_hash": "0xecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", "amount": "123400000000", "last_updated_block": 100},
+			},
+		},
+		"getblockcount": 21,
+		"getrawtransaction": map[string]interface{}{
+			"txid":      "0xbd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4",
+			"type":      "ContractTransaction",
+			"blockhash": "0x" + fmt.Sprintf("%064x", 9),
+		},
+		"getblock": map[string]interface{}{
+			"hash":  "0x" + fmt.Sprintf("%064x", 9),
+			"index": 9,
+			"tx":    []interface{}{},
+		},
+		"getapplicationlog": map[string]interface{}{
+			"txid": "0x" + fmt.Sprintf("%064x", 2),
+			"executions": []interface{}{
+				map[string]interface{}{
+					"trigger": "Application",
+					"vmstate": "HALT",
+					"notifications": []interface{}{
+						map[string]interface{}{
+							"contract": "0xecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9",
+							"state": map[string]interface{}{
+								"type": "Array",
+								"value": []interface{}{
+									map[string]interface{}{"type": "ByteArray", "value": "7472616e73666572"},
+									map[string]interface{}{"type": "ByteArray", "value": fmt.Sprintf("%040x", 1)},
+									map[string]interface{}{"type": "ByteArray", "value": "7658ff7d3d061e25ec6e3e1b891073889a67af7e"},
+									map[string]interface{}{"type": "ByteArray", "value": "00e8764817"},
+								},
+							},
+						},
+						map[string]interface{}{
+							"contract": "0xecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9",
+							"state": map[string]interface{}{
+								"type": "Array",
+								"value": []interface{}{
+									map[string]interface{}{"type": "ByteArray", "value": "617070726f7665"},
+									map[string]interface{}{"type": "ByteArray", "value": fmt.Sprintf("%040x", 1)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		result, ok := results[request.Method]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": result})
+	}))
+}
+
+func TestWalletManager_Reconcile(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	server := newReconcileNodeStandIn(address)
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.LocalUnspentIndex = true
+
+	//本地索引：一笔一致，一笔金额不同，一笔节点已花费，缺少一笔GAS
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := []*IndexedUnspent{
+		{TxID: "c3182952855314b3f4b1ecf01a03b891d4627d19426ce841275f6d4c186e729a", N: 0, AssetID: neoTransaction.NeoAssetId, Value: "10", BlockHeight: 5},
+		{TxID: "bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", N: 1, AssetID: neoTransaction.NeoAssetId, Value: "4", BlockHeight: 6},
+		{TxID: fmt.Sprintf("%064x", 1), N: 0, AssetID: neoTransaction.NeoGasAssetId, Value: "2", BlockHeight: 7},
+	}
+	for _, u := range local {
+		u.Key = outputCacheKey(u.TxID, u.N)
+		u.Address = address
+		err = db.From(utxoIndexBucket).Save(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	report, err := wm.Reconcile(ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if report.Total != 1 || report.Checked != 1 || report.Repaired != 0 || len(report.Errors) != 0 {
+		t.Fatalf("report wrong: %+v", report)
+	}
+
+	kinds := make(map[string]int)
+	for _, d := range report.Divergences {
+		kinds[d.Kind]++
+		switch d.Kind {
+		case ReconcileUnspentValue:
+			if d.N != 1 || d.Local != "4" || d.Node != "5" {
+				t.Fatalf("value divergence wrong: %+v", d)
+			}
+		case ReconcileMissingUnspent:
+			if d.AssetID != neoTransaction.NeoGasAssetId || d.N != 0 || d.Node != "1.5" {
+				t.Fatalf("missing divergence wrong: %+v", d)
+			}
+		case ReconcileExtraUnspent:
+			if d.TxID != fmt.Sprintf("%064x", 1) || d.Local != "2" {
+				t.Fatalf("extra divergence wrong: %+v", d)
+			}
+		case ReconcileNEP5Balance:
+			if d.AssetID != "ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9" || d.Local != "0" || d.Node != "123400000000" {
+				t.Fatalf("nep5 divergence wrong: %+v", d)
+			}
+		}
+	}
+	if len(report.Divergences) != 6 || kinds[ReconcileUnspentValue] != 1 || kinds[ReconcileMissingUnspent] != 1 ||
+		kinds[ReconcileExtraUnspent] != 1 || kinds[ReconcileBalance] != 2 || kinds[ReconcileNEP5Balance] != 1 {
+		t.Fatalf("divergences wrong: %v", kinds)
+	}
+
+	//扫描器落后于节点时不修复
+	_, err = wm.Reconcile(ReconcileOptions{Repair: true})
+	if err == nil {
+		t.Fatalf("repair should fail when the scanner is behind the node")
+	}
+	wm.SaveLocalNewBlock(20, fmt.Sprintf("%064x", 20))
+
+	//修复后再次对账一致
+	report, err = wm.Reconcile(ReconcileOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if report.Repaired != 1 {
+		t.Fatalf("repair report wrong: %+v", report)
+	}
+
+	report, err = wm.Reconcile(ReconcileOptions{SampleSize: 1})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if !report.Consistent() || report.Checked != 1 {
+		t.Fatalf("store not repaired: %+v", report.Divergences)
+	}
+
+	//修复保留已知输出的区块高度，补录的输出使用交易所在的区块高度，NEP-5差额记录在扫描高度
+	db, err = storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unspent IndexedUnspent
+	err = db.From(utxoIndexBucket).One("Key", outputCacheKey(local[1].TxID, 1), &unspent)
+	if err != nil || unspent.BlockHeight != 6 || unspent.Value != "5" {
+		t.Fatalf("repaired unspent wrong: %+v, %v", unspent, err)
+	}
+	err = db.From(utxoIndexBucket).One("Key", outputCacheKey(local[1].TxID, 0), &unspent)
+	if err != nil || unspent.BlockHeight != 9 || unspent.Value != "1.5" {
+		t.Fatalf("missing unspent wrong: %+v, %v", unspent, err)
+	}
+	var transfer NEP5Transfer
+	err = db.From(nep5TransferBucket).One("Key", "repair:20:"+address+":ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", &transfer)
+	if err != nil || transfer.BlockHeight != 20 || transfer.Amount != "123400000000" {
+		t.Fatalf("repaired nep5 balance wrong: %+v, %v", transfer, err)
+	}
+	db.Close()
+
+	//回滚到修复高度之前，NEP-5差额记录一并删除
+	err = wm.rollbackUnspentIndex(19)
+	if err != nil {
+		t.Fatalf("rollbackUnspentIndex failed: %v", err)
+	}
+	report, err = wm.Reconcile(ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(report.Divergences) != 1 || report.Divergences[0].Kind != ReconcileNEP5Balance {
+		t.Fatalf("rollback divergences wrong: %+v", report.Divergences)
+	}
+}
+
+func TestNEOBlockScanner_ExtractNEP5Transfers(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	server := newReconcileNodeStandIn(address)
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.LocalUnspentIndex = true
+
+	scanAddressFunc := func(a string) (string, bool) {
+		return "account1", a == address
+	}
+	trx := &Transaction{TxID: "0x" + fmt.Sprintf("%064x", 2), Type: "InvocationTransaction"}
+
+	//只保留观察地址的转入记录，approve 通知不计入
+	result := wm.Blockscanner.extractTransactionDetail(10, fmt.Sprintf("%064x", 10), trx, scanAddressFunc)
+	if !result.Success || len(result.nep5Transfers) != 1 {
+		t.Fatalf("extract nep5 transfers wrong: %+v", result)
+	}
+	transfer := result.nep5Transfers[0]
+	if transfer.Key != fmt.Sprintf("%064x:0:%s", 2, address) || transfer.Amount != "100000000000" ||
+		transfer.ContractHash != "ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9" {
+		t.Fatalf("nep5 transfer wrong: %+v", transfer)
+	}
+
+	//重复写入同一区块不重复计入余额
+	for i := 0; i < 2; i++ {
+		err := wm.saveScannedBlock(10, fmt.Sprintf("%064x", 10), []ExtractResult{result})
+		if err != nil {
+			t.Fatalf("saveScannedBlock failed: %v", err)
+		}
+	}
+	balances, err := wm.listLocalNEP5Balances(address)
+	if err != nil || len(balances) != 1 || balances["ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9"].String() != "100000000000" {
+		t.Fatalf("local nep5 balances wrong: %v, %v", balances, err)
+	}
+
+	err = wm.rollbackUnspentIndex(9)
+	if err != nil {
+		t.Fatalf("rollbackUnspentIndex failed: %v", err)
+	}
+	balances, err = wm.listLocalNEP5Balances(address)
+	if err != nil || len(balances) != 0 {
+		t.Fatalf("rollback nep5 balances wrong: %v, %v", balances, err)
+	}
+}
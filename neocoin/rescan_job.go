@@ -0,0 +1,410 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/pborman/uuid"
+)
+
+const (
+	rescanJobBucket = "rescanJobs"
+
+	RescanJobRunning  = "running"  //扫描中
+	RescanJobStopped  = "stopped"  //已停止，可继续
+	RescanJobFinished = "finished" //已完成
+	RescanJobFailed   = "failed"   //扫描失败，可继续
+
+	//BackfillExtParamKey 重扫任务提取的数据在交易单和输出的扩展参数中带有此标记，值为任务ID
+	BackfillExtParamKey = "backfill"
+)
+
+//RescanJob 指定地址集合的区块重扫任务，与实时扫描器并行运行，进度独立保存
+type RescanJob struct {
+	ID          string            `json:"id" storm:"id"`
+	Addresses   map[string]string `json:"addresses"` //需要扫描的地址，值为通知观察者的sourceKey
+	StartHeight uint64            `json:"startHeight"`
+	EndHeight   uint64            `json:"endHeight"`
+	NextHeight  uint64            `json:"nextHeight"` //下一个要扫描的高度，超过结束高度时为补记花费的进度
+	Status      string            `json:"status"`
+	Reason      string            `json:"reason"` //失败原因
+	CreatedAt   int64             `json:"createdAt"`
+	UpdatedAt   int64             `json:"updatedAt"`
+}
+
+//rescanJobRunner 运行中的重扫任务
+type rescanJobRunner struct {
+	quit chan struct{}
+	done chan struct{}
+}
+
+//StartRescanJob 创建重扫任务，扫描 startHeight 到 endHeight 的区块，只提取指定地址的数据
+// addresses : 地址及其sourceKey
+func (bs *NEOBlockScanner) StartRescanJob(addresses map[string]string, startHeight, endHeight uint64) (*RescanJob, error) {
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("rescan job has no addresses")
+	}
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("rescan job start height %d is greater than end height %d", startHeight, endHeight)
+	}
+
+	maxHeight, err := bs.wm.GetBlockHeight()
+	if err != nil {
+		return nil, err
+	}
+	//getblockcount 包含创世区块
+	if endHeight >= maxHeight {
+		return nil, fmt.Errorf("rescan job end height %d is greater than chain height %d", endHeight, maxHeight-1)
+	}
+
+	for address := range addresses {
+		if !bs.wm.Decoder.AddressVerify(address) {
+			return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid address[%s]", address)
+		}
+	}
+
+	now := time.Now().Unix()
+	job := &RescanJob{
+		ID:          uuid.New(),
+		Addresses:   addresses,
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		NextHeight:  startHeight,
+		Status:      RescanJobRunning,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = bs.saveRescanJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	bs.startRescanJob(job)
+
+	return job, nil
+}
+
+//ResumeRescanJob 从保存的进度继续已停止或失败的重扫任务
+func (bs *NEOBlockScanner) ResumeRescanJob(id string) error {
+
+	job, err := bs.GetRescanJob(id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == RescanJobFinished {
+		return fmt.Errorf("rescan job %s has finished", id)
+	}
+
+	job.Status = RescanJobRunning
+	job.Reason = ""
+	err = bs.saveRescanJob(job)
+	if err != nil {
+		return err
+	}
+
+	bs.startRescanJob(job)
+	return nil
+}
+
+//StopRescanJob 停止重扫任务，等待正在扫描的区块完成
+func (bs *NEOBlockScanner) StopRescanJob(id string) error {
+
+	bs.rescanJobsLock.Lock()
+	runner, ok := bs.rescanJobs[id]
+	if ok {
+		delete(bs.rescanJobs, id)
+	}
+	bs.rescanJobsLock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("rescan job %s is not running", id)
+	}
+
+	close(runner.quit)
+	<-runner.done
+
+	job, err := bs.GetRescanJob(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != RescanJobRunning {
+		return nil
+	}
+	job.Status = RescanJobStopped
+	return bs.saveRescanJob(job)
+}
+
+//GetRescanJob 获取重扫任务及进度
+func (bs *NEOBlockScanner) GetRescanJob(id string) (*RescanJob, error) {
+
+	db, err := storm.Open(filepath.Join(bs.wm.Config.DBPath, bs.wm.Config.BlockchainFile))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var job RescanJob
+	err = db.From(rescanJobBucket).One("ID", id, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+//GetRescanJobs 获取全部重扫任务
+func (bs *NEOBlockScanner) GetRescanJobs() ([]*RescanJob, error) {
+
+	dbFile := filepath.Join(bs.wm.Config.DBPath, bs.wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var jobs []*RescanJob
+	err = db.From(rescanJobBucket).All(&jobs)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+//resumeRescanJobs 继续进程退出时仍在运行的重扫任务
+func (bs *NEOBlockScanner) resumeRescanJobs() {
+
+	jobs, err := bs.GetRescanJobs()
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not load rescan jobs; unexpected error: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.Status == RescanJobRunning {
+			bs.startRescanJob(job)
+		}
+	}
+}
+
+//startRescanJob 启动重扫任务的线程，任务已在运行时忽略
+func (bs *NEOBlockScanner) startRescanJob(job *RescanJob) {
+
+	bs.rescanJobsLock.Lock()
+	defer bs.rescanJobsLock.Unlock()
+
+	if _, ok := bs.rescanJobs[job.ID]; ok {
+		return
+	}
+
+	runner := &rescanJobRunner{
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	bs.rescanJobs[job.ID] = runner
+
+	go bs.runRescanJob(job, runner)
+}
+
+//runRescanJob 按高度顺序扫描任务的区块，每个区块完成后保存进度
+func (bs *NEOBlockScanner) runRescanJob(job *RescanJob, runner *rescanJobRunner) {
+
+	defer close(runner.done)
+
+	scanAddressFunc := func(address string) (string, bool) {
+		sourceKey, ok := job.Addresses[address]
+		return sourceKey, ok
+	}
+
+	bs.wm.Log.Std.Info("rescan job %s scanning height: %d - %d ...", job.ID, job.NextHeight, job.EndHeight)
+
+	for job.NextHeight <= job.EndHeight {
+
+		select {
+		case <-runner.quit:
+			return
+		default:
+		}
+
+		err := bs.rescanJobBlock(job, job.NextHeight, scanAddressFunc)
+		if err != nil {
+			bs.wm.Log.Std.Error("rescan job %s failed on height: %d; unexpected error: %v", job.ID, job.NextHeight, err)
+			job.Status = RescanJobFailed
+			job.Reason = err.Error()
+			bs.finishRescanJob(job)
+			return
+		}
+
+		job.NextHeight++
+		err = bs.saveRescanJob(job)
+		if err != nil {
+			bs.wm.Log.Std.Error("rescan job %s can not save progress; unexpected error: %v", job.ID, err)
+		}
+	}
+
+	//结束高度之后花费的输出，实时扫描器扫描时还不在索引中，继续扫描到实时扫描器的当前高度补记花费
+	for job.NextHeight <= bs.GetScannedBlockHeight() {
+
+		select {
+		case <-runner.quit:
+			return
+		default:
+		}
+
+		err := bs.rescanJobSpents(job.NextHeight, scanAddressFunc)
+		if err != nil {
+			bs.wm.Log.Std.Error("rescan job %s failed on height: %d; unexpected error: %v", job.ID, job.NextHeight, err)
+			job.Status = RescanJobFailed
+			job.Reason = err.Error()
+			bs.finishRescanJob(job)
+			return
+		}
+
+		job.NextHeight++
+		err = bs.saveRescanJob(job)
+		if err != nil {
+			bs.wm.Log.Std.Error("rescan job %s can not save progress; unexpected error: %v", job.ID, err)
+		}
+	}
+
+	job.Status = RescanJobFinished
+	bs.finishRescanJob(job)
+
+	bs.wm.Log.Std.Info("rescan job %s has finished", job.ID)
+}
+
+//finishRescanJob 保存任务的最终状态并移出运行列表
+func (bs *NEOBlockScanner) finishRescanJob(job *RescanJob) {
+
+	err := bs.saveRescanJob(job)
+	if err != nil {
+		bs.wm.Log.Std.Error("rescan job %s can not save status; unexpected error: %v", job.ID, err)
+	}
+
+	bs.rescanJobsLock.Lock()
+	delete(bs.rescanJobs, job.ID)
+	bs.rescanJobsLock.Unlock()
+}
+
+//rescanJobBlock 扫描任务的一个区块，提取结果带上补扫标记后通知观察者
+func (bs *NEOBlockScanner) rescanJobBlock(job *RescanJob, height uint64, scanAddressFunc openwallet.BlockScanAddressFunc) error {
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+
+	block, err := bs.wm.GetBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	err = bs.checkStoredHeader(block)
+	if err != nil {
+		return err
+	}
+
+	results := bs.extractBlock(block, scanAddressFunc)
+
+	//整个区块提取成功才通知，失败时从该区块继续
+	for _, result := range results {
+		if !result.Success {
+			return fmt.Errorf("extract transaction %s failed", result.TxID)
+		}
+	}
+
+	//补扫的输出同样写入未花费索引
+	err = bs.wm.saveBackfillUnspents(height, results, false)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		markBackfill(result.extractData, job.ID)
+		markBackfill(result.extractOmniData, job.ID)
+
+		err = bs.newExtractDataNotify(height, result.extractData)
+		if err != nil {
+			return err
+		}
+		err = bs.newExtractDataNotify(height, result.extractOmniData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//rescanJobSpents 扫描任务结束高度之后的一个区块，只把任务地址花费的输出标记为已花费，不通知观察者
+func (bs *NEOBlockScanner) rescanJobSpents(height uint64, scanAddressFunc openwallet.BlockScanAddressFunc) error {
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+
+	block, err := bs.wm.GetBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	results := bs.extractBlock(block, scanAddressFunc)
+	for _, result := range results {
+		if !result.Success {
+			return fmt.Errorf("extract transaction %s failed", result.TxID)
+		}
+	}
+
+	return bs.wm.saveBackfillUnspents(height, results, true)
+}
+
+//saveRescanJob 保存重扫任务
+func (bs *NEOBlockScanner) saveRescanJob(job *RescanJob) error {
+
+	file.MkdirAll(bs.wm.Config.DBPath)
+	db, err := storm.Open(filepath.Join(bs.wm.Config.DBPath, bs.wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	job.UpdatedAt = time.Now().Unix()
+	return db.From(rescanJobBucket).Save(job)
+}
+
+//markBackfill 在交易单和输出的扩展参数中标记补扫数据
+func markBackfill(extractData map[string]*openwallet.TxExtractData, jobID string) {
+	for _, data := range extractData {
+		if data.Transaction != nil {
+			data.Transaction.SetExtParam(BackfillExtParamKey, jobID)
+		}
+		for _, output := range data.TxOutputs {
+			output.SetExtParam(BackfillExtParamKey, jobID)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//waitRescanJob 等待重扫任务结束
+func waitRescanJob(t *testing.T, bs *NEOBlockScanner, id string) *RescanJob {
+	for i := 0; i < 200; i++ {
+		job, err := bs.GetRescanJob(id)
+		if err != nil {
+			t.Fatalf("GetRescanJob failed: %v", err)
+		}
+		if job.Status != RescanJobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("rescan job %s not finished", id)
+	return nil
+}
+
+func TestNEOBlockScanner_RescanJob(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(12, address)
+	//每个区块间隔一段时间，便于中途停止任务
+	chain.delay = func(method string, params []interface{}) time.Duration {
+		if method == "getblock" {
+			return 20 * time.Millisecond
+		}
+		return 0
+	}
+	server := chain.serve()
+	defer server.Close()
+
+	//实时扫描器的登记表不包含该地址
+	wm, cleanup := newScanTestWallet(t, server.URL, "AK2nJJpJr6o664CWJKi1QRXjqeic2zRp8y", "account1")
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))}
+	bs.AddObserver(recorder)
+
+	_, err := bs.StartRescanJob(map[string]string{address: "backfill"}, 5, 20)
+	if err == nil {
+		t.Fatalf("end height beyond the chain should be rejected")
+	}
+
+	job, err := bs.StartRescanJob(map[string]string{address: "backfill"}, 3, 10)
+	if err != nil {
+		t.Fatalf("StartRescanJob failed: %v", err)
+	}
+
+	time.Sleep(70 * time.Millisecond)
+	err = bs.StopRescanJob(job.ID)
+	if err != nil {
+		t.Fatalf("StopRescanJob failed: %v", err)
+	}
+
+	stopped, err := bs.GetRescanJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetRescanJob failed: %v", err)
+	}
+	if stopped.Status != RescanJobStopped || stopped.NextHeight <= 3 || stopped.NextHeight > 10 {
+		t.Fatalf("stopped job wrong: %+v", stopped)
+	}
+	recorder.mu.Lock()
+	notified := len(recorder.data)
+	recorder.mu.Unlock()
+	if uint64(notified) != stopped.NextHeight-3 {
+		t.Fatalf("notified %d blocks, progress %d", notified, stopped.NextHeight)
+	}
+
+	err = bs.ResumeRescanJob(job.ID)
+	if err != nil {
+		t.Fatalf("ResumeRescanJob failed: %v", err)
+	}
+	finished := waitRescanJob(t, bs, job.ID)
+	if finished.Status != RescanJobFinished || finished.NextHeight != 11 {
+		t.Fatalf("finished job wrong: %+v", finished)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.data) != 8 {
+		t.Fatalf("backfill notify count wrong: %v", recorder.heights)
+	}
+	for i, data := range recorder.data {
+		if recorder.heights[i] != uint64(i+3) {
+			t.Fatalf("backfill heights wrong: %v", recorder.heights)
+		}
+		if data.Transaction.GetExtParam().Get(BackfillExtParamKey).String() != job.ID {
+			t.Errorf("transaction should be marked as backfill: %s", data.Transaction.ExtParam)
+		}
+		for _, output := range data.TxOutputs {
+			if output.GetExtParam().Get(BackfillExtParamKey).String() != job.ID {
+				t.Errorf("output should be marked as backfill: %s", output.ExtParam)
+			}
+		}
+	}
+
+	//实时扫描器的进度不受影响
+	if height, _ := wm.GetLocalNewBlock(); height != 0 {
+		t.Errorf("live scanner height changed: %d", height)
+	}
+}
+
+// 结束高度之后花费的输出继续补记到实时扫描器的高度
+func TestNEOBlockScanner_RescanJobSpentAfterEnd(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(12, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, "AK2nJJpJr6o664CWJKi1QRXjqeic2zRp8y", "account1")
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(11, chain.blockHash(11))
+
+	job, err := bs.StartRescanJob(map[string]string{address: "backfill"}, 3, 6)
+	if err != nil {
+		t.Fatalf("StartRescanJob failed: %v", err)
+	}
+	finished := waitRescanJob(t, bs, job.ID)
+	if finished.Status != RescanJobFinished || finished.NextHeight != 12 {
+		t.Fatalf("finished job wrong: %+v", finished)
+	}
+
+	//只通知任务范围内的区块
+	recorder.mu.Lock()
+	notified := len(recorder.heights)
+	recorder.mu.Unlock()
+	if notified != 4 {
+		t.Fatalf("backfill notify count wrong: %d", notified)
+	}
+
+	//高度6的输出在高度7花费，结束高度之后的输出不登记
+	balance, err := wm.listUnspentByIndex(address)
+	if err != nil {
+		t.Fatalf("listUnspentByIndex failed: %v", err)
+	}
+	if balance.GASUnspent != nil {
+		t.Fatalf("outputs spent after end height should not be unspent: %+v", balance.GASUnspent)
+	}
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//chainStandIn 模拟节点RPC的区块链数据
+type chainStandIn struct {
+	mu      sync.Mutex
+	blocks  []map[string]interface{}
+	txs     map[string]map[string]interface{}
+	mempool []string
+	calls   map[string]int
+	delay   func(method string, params []interface{}) time.Duration
+	fail    func(method string, params []interface{}) bool
+}
+
+//newChainStandIn 生成 count 个区块的链，每个区块一笔向 address 转账 GAS 的交易，输出全部已花费
+func newChainStandIn(count int, address string) *chainStandIn {
+	chain := &chainStandIn{
+		txs:   make(map[string]map[string]interface{}),
+		calls: make(map[string]int),
+	}
+	for i := 0; i < count; i++ {
+		txid := fmt.Sprintf("0x%064x", i+1)
+		//每笔交易花费上一区块交易的输出
+		vin := []interface{}{}
+		if i > 0 {
+			vin = append(vin, map[string]interface{}{"txid": fmt.Sprintf("0x%064x", i), "vout": 0})
+		}
+		tx := map[string]interface{}{
+			"txid": txid,
+			"type": "ContractTransaction",
+			"vin":  vin,
+			"vout": []interface{}{
+				map[string]interface{}{"n": 0, "asset": "0x" + neoTransaction.NeoGasAssetId, "value": fmt.Sprintf("%d", i+1), "address": address},
+			},
+			"blockhash": chain.blockHash(i),
+			"blocktime": 1500000000 + i,
+		}
+		chain.txs[txid] = tx
+		prev := ""
+		if i > 0 {
+			prev = chain.blockHash(i - 1)
+		}
+		chain.blocks = append(chain.blocks, map[string]interface{}{
+			"index":             i,
+			"hash":              chain.blockHash(i),
+			"previousblockhash": prev,
+			"tx":                []interface{}{tx},
+		})
+	}
+	return chain
+}
+
+func (chain *chainStandIn) blockHash(height int) string {
+	return fmt.Sprintf("0x%064x", 0xb0000+height)
+}
+
+func (chain *chainStandIn) callCount(method string) int {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	return chain.calls[method]
+}
+
+func (chain *chainStandIn) result(method string, params []interface{}) (interface{}, bool) {
+	switch method {
+	case "getblockcount":
+		return len(chain.blocks), true
+	case "getblockhash":
+		height := int(params[0].(float64))
+		if height >= len(chain.blocks) {
+			return nil, false
+		}
+		return chain.blockHash(height), true
+	case "getblock":
+		for _, b := range chain.blocks {
+			if b["hash"] == params[0] {
+				return b, true
+			}
+		}
+	case "getrawtransaction":
+		tx, ok := chain.txs[params[0].(string)]
+		return tx, ok
+	case "gettxout":
+		return nil, true
+	case "getrawmempool":
+		return append([]string{}, chain.mempool...), true
+	}
+	return nil, false
+}
+
+func (chain *chainStandIn) serve() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		chain.mu.Lock()
+		chain.calls[request.Method]++
+		result, ok := chain.result(request.Method, request.Params)
+		failed := chain.fail != nil && chain.fail(request.Method, request.Params)
+		chain.mu.Unlock()
+
+		if chain.delay != nil {
+			time.Sleep(chain.delay(request.Method, request.Params))
+		}
+
+		if failed {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -32603, "message": "Internal error"}})
+			return
+		}
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -100, "message": "Unknown transaction"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": result})
+	}))
+}
+
+//scanRecorder 按通知顺序记录扫描结果
+type scanRecorder struct {
+	mu      sync.Mutex
+	heights []uint64
+	data    []*openwallet.TxExtractData
+	headers chan *openwallet.BlockHeader
+}
+
+func (r *scanRecorder) BlockScanNotify(header *openwallet.BlockHeader) error {
+	r.headers <- header
+	return nil
+}
+
+func (r *scanRecorder) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.heights = append(r.heights, data.Transaction.BlockHeight)
+	r.data = append(r.data, data)
+	return nil
+}
+
+//newScanTestWallet 使用临时数据库和节点模拟的钱包管理器，address 登记到 accountID
+func newScanTestWallet(t *testing.T, serverURL, address, accountID string) (*WalletManager, func()) {
+	dir, err := ioutil.TempDir("", "neo-scanner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := NewWalletManager()
+	wm.Config.DBPath = dir
+	wm.WalletClient = NewClient(serverURL, "", false)
+	err = wm.WatchOnly.Import(&WatchOnlyAddress{Address: address, AccountID: accountID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wm, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNEOBlockScanner_ScanBlockTaskPipeline(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(12, address)
+	//越早的区块返回越慢，预取的区块乱序完成
+	chain.delay = func(method string, params []interface{}) time.Duration {
+		if method != "getblock" {
+			return 0
+		}
+		for i, b := range chain.blocks {
+			if b["hash"] == params[0] {
+				return time.Duration(len(chain.blocks)-i) * 5 * time.Millisecond
+			}
+		}
+		return 0
+	}
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.ScanLookAhead = 4
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.ScanBlockTask()
+
+	height, hash := wm.GetLocalNewBlock()
+	if height != 11 || hash != chain.blockHash(11) {
+		t.Fatalf("scanned height wrong: %d, %s", height, hash)
+	}
+
+	if len(recorder.heights) != 10 {
+		t.Fatalf("extract notify count wrong: %v", recorder.heights)
+	}
+	for i, h := range recorder.heights {
+		if h != uint64(i+2) {
+			t.Fatalf("extract notify out of order: %v", recorder.heights)
+		}
+	}
+
+	for i := 2; i < 12; i++ {
+		select {
+		case header := <-recorder.headers:
+			if header.Height != uint64(i) || header.Fork {
+				t.Fatalf("block notify wrong at %d: %+v", i, header)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("block notify of height %d not received", i)
+		}
+	}
+}
+
+func TestNEOBlockScanner_RescanFailedBlockUnspents(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(3, address)
+	//第一次获取最新区块失败，扫描器记录未扫区块后重扫
+	failed := false
+	chain.fail = func(method string, params []interface{}) bool {
+		if method == "getblock" && params[0] == chain.blockHash(2) && !failed {
+			failed = true
+			return true
+		}
+		return false
+	}
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	recorder := &scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))}
+	bs.AddObserver(recorder)
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.ScanBlockTask()
+
+	if !failed {
+		t.Fatalf("block was not failed")
+	}
+	if len(recorder.heights) != 1 || recorder.heights[0] != 2 {
+		t.Fatalf("rescanned deposit not notified: %v", recorder.heights)
+	}
+	if records, _ := wm.GetUnscanRecords(); len(records) != 0 {
+		t.Errorf("unscan records not deleted: %d", len(records))
+	}
+
+	balance, err := wm.listUnspentByIndex(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.GASUnspent == nil || balance.GASUnspent.Amount != "3" {
+		t.Fatalf("rescanned deposit not indexed: %+v", balance.GASUnspent)
+	}
+	unspents := *balance.GASUnspent.UnspentTxs
+	if len(unspents) != 1 || unspents[0].TxID != fmt.Sprintf("%064x", 3) {
+		t.Errorf("indexed unspent wrong: %+v", unspents)
+	}
+}
+
+func TestNEOBlockScanner_ScanLookAhead(t *testing.T) {
+	wm := NewWalletManager()
+	for _, c := range []struct {
+		config, want int
+	}{{0, 1}, {3, 3}, {100, maxExtractingSize}} {
+		wm.Config.ScanLookAhead = c.config
+		if got := wm.Blockscanner.scanLookAhead(); got != c.want {
+			t.Errorf("scanLookAhead(%d) = %d, want %d", c.config, got, c.want)
+		}
+	}
+}
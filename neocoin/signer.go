@@ -0,0 +1,186 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/imroc/req"
+	"github.com/tidwall/gjson"
+)
+
+//SignRequest 摘要签名请求，签名者由派生路径指定，导入的私钥没有派生路径时由公钥指定
+type SignRequest struct {
+	WalletID  string `json:"walletID"`  //钱包ID
+	Address   string `json:"address"`   //签名者地址
+	PublicKey string `json:"publicKey"` //签名者压缩公钥，十六进制，旧地址可能为空
+	HDPath    string `json:"hdPath"`    //签名者派生路径
+	Digest    string `json:"digest"`    //待签名摘要，十六进制，交易的摘要为 SHA256(未签名交易)
+}
+
+//Signer 签名器，私钥可以在本进程中派生，也可以保存在隔离的签名服务中
+type Signer interface {
+	//SignDigest 对摘要签名，返回64字节签名及签名者公钥
+	SignDigest(wrapper openwallet.WalletDAI, request *SignRequest) (*neoTransaction.SignaturePubkey, error)
+}
+
+//LocalSigner 本地签名器，通过钱包HDKey派生私钥
+type LocalSigner struct {
+	wm *WalletManager
+}
+
+//NewLocalSigner 创建本地签名器
+func NewLocalSigner(wm *WalletManager) *LocalSigner {
+	return &LocalSigner{wm: wm}
+}
+
+//SignDigest 对摘要签名
+func (signer *LocalSigner) SignDigest(wrapper openwallet.WalletDAI, request *SignRequest) (*neoTransaction.SignaturePubkey, error) {
+
+	digest, err := hex.DecodeString(request.Digest)
+	if err != nil || len(digest) != 32 {
+		return nil, fmt.Errorf("invalid digest")
+	}
+
+	key, err := wrapper.HDKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyBytes []byte
+	if len(request.HDPath) > 0 {
+		keyBytes, err = signer.wm.DerivePrivateKey(key, request.HDPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		//导入的私钥，按公钥查找地址
+		if len(request.PublicKey) == 0 {
+			return nil, fmt.Errorf("signer should be specified by public key or derived path")
+		}
+		addrs, err := wrapper.GetAddressList(0, -1, "PublicKey", request.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if isImportedKeyAddress(a) {
+				keyBytes, err = getImportedPrivateKey(key, a)
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		if keyBytes == nil {
+			return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "private key of public key[%s] not found", request.PublicKey)
+		}
+	}
+
+	return neoTransaction.SignDigest(digest, keyBytes)
+}
+
+//RemoteSigner 远程签名器，通过HTTP/JSON调用隔离的签名服务，适配器不接触私钥
+//请求为 POST SignRequest，响应为 {"signature": "...", "publicKey": "..."}，失败时响应 {"error": "..."}
+type RemoteSigner struct {
+	URL         string
+	AccessToken string
+	client      *req.Req
+}
+
+//NewRemoteSigner 创建远程签名器
+func NewRemoteSigner(url, token string) *RemoteSigner {
+	return &RemoteSigner{
+		URL:         url,
+		AccessToken: token,
+		client:      req.New(),
+	}
+}
+
+//SignDigest 请求签名服务对摘要签名
+func (signer *RemoteSigner) SignDigest(wrapper openwallet.WalletDAI, request *SignRequest) (*neoTransaction.SignaturePubkey, error) {
+
+	if len(signer.URL) == 0 {
+		return nil, errors.New("Signer url is not setup. ")
+	}
+
+	header := req.Header{
+		"Accept": "application/json",
+	}
+	if len(signer.AccessToken) > 0 {
+		header["Authorization"] = "Bearer " + signer.AccessToken
+	}
+
+	r, err := signer.client.Post(signer.URL, req.BodyJSON(request), header)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := gjson.ParseBytes(r.Bytes())
+	if msg := resp.Get("error"); msg.Exists() && msg.String() != "" {
+		return nil, fmt.Errorf("remote signer error: %s", msg.String())
+	}
+	if r.Response().StatusCode != 200 {
+		return nil, fmt.Errorf("remote signer error: %s", r.Response().Status)
+	}
+
+	signature, err := hex.DecodeString(resp.Get("signature").String())
+	if err != nil || len(signature) != 64 {
+		return nil, fmt.Errorf("remote signer returned invalid signature")
+	}
+	pub, err := hex.DecodeString(resp.Get("publicKey").String())
+	if err != nil || len(pub) != neoTransaction.PublicKeySize {
+		return nil, fmt.Errorf("remote signer returned invalid public key")
+	}
+
+	return &neoTransaction.SignaturePubkey{Signature: signature, Pubkey: pub}, nil
+}
+
+//signDigest 通过签名器对地址签名，并校验签名者与签名结果
+func (decoder *TransactionDecoder) signDigest(wrapper openwallet.WalletDAI, addr *openwallet.Address, digest []byte) ([]byte, error) {
+
+	request := &SignRequest{
+		Address:   addr.Address,
+		PublicKey: addr.PublicKey,
+		HDPath:    addr.HDPath,
+		Digest:    hex.EncodeToString(digest),
+	}
+	if w := wrapper.GetWallet(); w != nil {
+		request.WalletID = w.WalletID
+	}
+
+	sigPub, err := decoder.wm.Signer.SignDigest(wrapper, request)
+	if err != nil {
+		return nil, err
+	}
+
+	//签名者公钥必须对应地址，防止签名服务用错私钥
+	if len(addr.PublicKey) > 0 && addr.PublicKey != hex.EncodeToString(sigPub.Pubkey) {
+		return nil, fmt.Errorf("signer public key of address[%s] is not match", addr.Address)
+	}
+	address, err := decoder.wm.Decoder.PublicKeyToAddress(sigPub.Pubkey, decoder.wm.Config.IsTestNet)
+	if err != nil || address != addr.Address {
+		return nil, fmt.Errorf("signer public key of address[%s] is not match", addr.Address)
+	}
+	if !neoTransaction.VerifyDigest(digest, sigPub.Pubkey, sigPub.Signature) {
+		return nil, fmt.Errorf("signature of address[%s] is invalid", addr.Address)
+	}
+
+	return sigPub.Signature, nil
+}
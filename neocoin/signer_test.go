@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+// 测试用钱包，持有HDKey及地址列表
+type signerTestWallet struct {
+	openwallet.WalletDAIBase
+	key   *hdkeystore.HDKey
+	addrs []*openwallet.Address
+}
+
+func (w *signerTestWallet) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func (w *signerTestWallet) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	ret := make([]*openwallet.Address, 0)
+	for _, a := range w.addrs {
+		if len(cols) == 2 && cols[0] == "PublicKey" && a.PublicKey != cols[1] {
+			continue
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+func (w *signerTestWallet) GetAddress(address string) (*openwallet.Address, error) {
+	for _, a := range w.addrs {
+		if a.Address == address {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("address not found")
+}
+
+// 签名服务替身，私钥只在服务端的钱包中
+func newSignerStandIn(signer Signer, wallet openwallet.WalletDAI, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := func(status int, body map[string]string) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(body)
+		}
+
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer "+token {
+			reply(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		var request SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			reply(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		sigPub, err := signer.SignDigest(wallet, &request)
+		if err != nil {
+			reply(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		reply(http.StatusOK, map[string]string{
+			"signature": hex.EncodeToString(sigPub.Signature),
+			"publicKey": hex.EncodeToString(sigPub.Pubkey),
+		})
+	}))
+}
+
+func TestSigner(t *testing.T) {
+	wm := NewWalletManager()
+
+	key, err := hdkeystore.NewHDKey([]byte("0123456789abcdef0123456789abcdef"), "test", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HD地址
+	priv, err := wm.DerivePrivateKey(key, BIP44Path(0, false, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigPub, _ := neoTransaction.SignDigest(make([]byte, 32), priv)
+	address, _ := wm.Decoder.PublicKeyToAddress(sigPub.Pubkey, wm.Config.IsTestNet)
+	hdAddr := &openwallet.Address{AccountID: "test", Address: address, PublicKey: hex.EncodeToString(sigPub.Pubkey), HDPath: BIP44Path(0, false, 0)}
+
+	// 导入私钥地址
+	importedPriv, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	importedAddr, err := wm.newImportedKeyAddress(key, "test", importedPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverWallet := &signerTestWallet{key: key, addrs: []*openwallet.Address{hdAddr, importedAddr}}
+	server := newSignerStandIn(NewLocalSigner(wm), serverWallet, "secret")
+	defer server.Close()
+
+	// 适配器端的钱包没有私钥
+	hotWallet := &signerTestWallet{addrs: []*openwallet.Address{hdAddr, importedAddr}}
+
+	decoder := wm.TxDecoder.(*TransactionDecoder)
+	digest, _ := neoTransaction.GetTransactionDigest("80000001ff")
+
+	for _, signer := range []Signer{NewLocalSigner(wm), NewRemoteSigner(server.URL, "secret")} {
+		wallet := openwallet.WalletDAI(serverWallet)
+		if _, ok := signer.(*RemoteSigner); ok {
+			wallet = hotWallet
+		}
+		wm.Signer = signer
+		for _, addr := range []*openwallet.Address{hdAddr, importedAddr} {
+			signature, err := decoder.signDigest(wallet, addr, digest)
+			if err != nil {
+				t.Errorf("%T sign %s failed: %v", signer, addr.Address, err)
+				continue
+			}
+			pub, _ := hex.DecodeString(addr.PublicKey)
+			if !neoTransaction.VerifyDigest(digest, pub, signature) {
+				t.Errorf("%T signature of %s is invalid", signer, addr.Address)
+			}
+		}
+	}
+
+	// 签名服务使用了其它私钥
+	wrongAddr := *hdAddr
+	wrongAddr.HDPath = BIP44Path(0, false, 1)
+	if _, err := decoder.signDigest(hotWallet, &wrongAddr, digest); err == nil {
+		t.Errorf("signature of wrong key should be rejected")
+	}
+
+	// 访问令牌错误
+	wm.Signer = NewRemoteSigner(server.URL, "wrong")
+	if _, err := decoder.signDigest(hotWallet, hdAddr, digest); err == nil {
+		t.Errorf("unauthorized request should fail")
+	}
+
+	// 通过远程签名器签名交易单
+	wm.Signer = NewRemoteSigner(server.URL, "secret")
+	rawTx := &openwallet.RawTransaction{
+		RawHex:  "80000001ff",
+		Account: &openwallet.AssetsAccount{AccountID: "test"},
+		Signatures: map[string][]*openwallet.KeySignature{
+			"test": {{Address: hdAddr}, {Address: importedAddr}},
+		},
+	}
+	err = decoder.SignNEORawTransaction(hotWallet, rawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keySig := range rawTx.Signatures["test"] {
+		signature, _ := hex.DecodeString(keySig.Signature)
+		pub, _ := hex.DecodeString(keySig.Address.PublicKey)
+		if !neoTransaction.VerifyDigest(digest, pub, signature) {
+			t.Errorf("transaction signature of %s is invalid", keySig.Address.Address)
+		}
+	}
+}
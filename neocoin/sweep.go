@@ -0,0 +1,481 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+//ClaimableTx 可提取GAS的已花费NEO输出
+type ClaimableTx struct {
+	TxID      string          `json:"txid"`
+	N         uint16          `json:"n"`
+	Unclaimed decimal.Decimal `json:"unclaimed"`
+}
+
+//SweepHolding 纸钱包地址持有的一种资产
+type SweepHolding struct {
+	Coin    openwallet.Coin `json:"coin"`
+	Balance string          `json:"balance"`
+}
+
+//SweepHoldings 纸钱包地址的全部资产
+//AvailableGas 为已花费NEO产生的可提取GAS，UnavailableGas 为未花费NEO产生的GAS，需要NEO转出确认后才能提取
+type SweepHoldings struct {
+	Address        string          `json:"address"`
+	Holdings       []*SweepHolding `json:"holdings"`
+	AvailableGas   string          `json:"availableGas"`
+	UnavailableGas string          `json:"unavailableGas"`
+
+	unspent   *UnspentBalance
+	claimable []*ClaimableTx
+	nep5      map[string]*SweepHolding
+}
+
+//sweepKey 待清扫的纸钱包私钥及其地址
+type sweepKey struct {
+	privateKey []byte
+	address    *openwallet.Address
+}
+
+//sweepWrapper 在钱包接口上附加纸钱包地址，使交易单构建时可以按钱包地址查找
+type sweepWrapper struct {
+	openwallet.WalletDAI
+	address *openwallet.Address
+}
+
+func (w *sweepWrapper) GetAddress(address string) (*openwallet.Address, error) {
+	if address == w.address.Address {
+		return w.address, nil
+	}
+	return w.WalletDAI.GetAddress(address)
+}
+
+//GetClaimable 通过 getclaimable 获取地址可提取GAS的已花费NEO输出，需要节点开启 RpcSystemAssetTracker 插件
+func (wm *WalletManager) GetClaimable(address string) ([]*ClaimableTx, error) {
+	result, err := wm.WalletClient.Call("getclaimable", []interface{}{address})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make([]*ClaimableTx, 0)
+	for _, c := range result.Get("claimable").Array() {
+		unclaimed, err := decimal.NewFromString(c.Get("unclaimed").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid unclaimed gas: %s", c.Get("unclaimed").String())
+		}
+		claims = append(claims, &ClaimableTx{
+			TxID:      normalizeAssetID(c.Get("txid").String()),
+			N:         uint16(c.Get("n").Uint()),
+			Unclaimed: unclaimed,
+		})
+	}
+
+	return claims, nil
+}
+
+//GetUnclaimedGas 通过 getunclaimed 获取地址可提取和不可提取的GAS
+func (wm *WalletManager) GetUnclaimedGas(address string) (decimal.Decimal, decimal.Decimal, error) {
+	result, err := wm.WalletClient.Call("getunclaimed", []interface{}{address})
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	available, _ := decimal.NewFromString(result.Get("available").String())
+	unavailable, _ := decimal.NewFromString(result.Get("unavailable").String())
+	return available, unavailable, nil
+}
+
+//decodeSweepKey 解析纸钱包私钥，6P开头的按NEP-2解密，否则按WIF解析
+func (decoder *TransactionDecoder) decodeSweepKey(key, passphrase string) (*sweepKey, error) {
+	var (
+		priv []byte
+		err  error
+	)
+
+	if strings.HasPrefix(key, "6P") {
+		priv, err = decoder.wm.Decoder.NEP2ToPrivateKey(key, passphrase)
+	} else {
+		priv, err = decoder.wm.Decoder.WIFToPrivateKey(key, decoder.wm.Config.IsTestNet)
+	}
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid private key: %v", err)
+	}
+
+	pub, ret := owcrypt.GenPubkey(priv, owcrypt.ECC_CURVE_SECP256R1)
+	if ret != owcrypt.SUCCESS {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid private key")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1)
+
+	address, err := decoder.wm.Decoder.PublicKeyToAddress(pub, decoder.wm.Config.IsTestNet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sweepKey{
+		privateKey: priv,
+		address: &openwallet.Address{
+			Address:   address,
+			PublicKey: fmt.Sprintf("%x", pub),
+			Symbol:    decoder.wm.Symbol(),
+		},
+	}, nil
+}
+
+//GetSweepHoldings 查询纸钱包地址持有的NEO、GAS、全局资产、NEP-5代币及未提取的GAS
+// key : WIF或NEP-2加密私钥
+// passphrase : NEP-2密码，WIF时为空
+func (decoder *TransactionDecoder) GetSweepHoldings(key, passphrase string) (*SweepHoldings, error) {
+	sk, err := decoder.decodeSweepKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.getSweepHoldings(sk.address.Address)
+}
+
+//getSweepHoldings 查询地址的全部资产
+func (decoder *TransactionDecoder) getSweepHoldings(address string) (*SweepHoldings, error) {
+
+	holdings := &SweepHoldings{
+		Address:  address,
+		Holdings: make([]*SweepHolding, 0),
+		nep5:     make(map[string]*SweepHolding),
+	}
+
+	unspent, err := decoder.wm.ListUnspent(address)
+	if err != nil {
+		return nil, err
+	}
+	holdings.unspent = unspent
+
+	for assetID, u := range unspent.Unspents {
+		asset, ok := decoder.wm.GetUTXOAsset(assetID)
+		if !ok {
+			//未登记的全局资产只列出，不清扫
+			asset = &UTXOAsset{AssetID: assetID, Symbol: u.AssetSymbol, Precision: decoder.wm.Decimal()}
+		}
+		holdings.Holdings = append(holdings.Holdings, &SweepHolding{
+			Coin:    decoder.wm.GetUTXOAssetCoin(asset),
+			Balance: u.Amount,
+		})
+	}
+
+	balances, err := decoder.wm.GetNEP5Balances(address)
+	if err != nil {
+		return nil, err
+	}
+
+	for contractHash, amount := range balances {
+		symbol, decimals, err := decoder.wm.GetNEP5TokenInfo(contractHash)
+		if err != nil {
+			return nil, fmt.Errorf("get nep5 token [%s] info failed, unexpected error: %v", contractHash, err)
+		}
+		contractID := openwallet.GenContractID(decoder.wm.Symbol(), contractHash)
+		holding := &SweepHolding{
+			Coin: openwallet.Coin{
+				Symbol:     decoder.wm.Symbol(),
+				IsContract: true,
+				ContractID: contractID,
+				Contract: openwallet.SmartContract{
+					ContractID: contractID,
+					Symbol:     decoder.wm.Symbol(),
+					Address:    contractHash,
+					Token:      symbol,
+					Protocol:   NEP5Protocol,
+					Name:       symbol,
+					Decimals:   uint64(decimals),
+				},
+			},
+			Balance: decimal.NewFromBigInt(amount, -decimals).String(),
+		}
+		holdings.Holdings = append(holdings.Holdings, holding)
+		holdings.nep5[contractHash] = holding
+	}
+
+	claimable, err := decoder.wm.GetClaimable(address)
+	if err != nil {
+		return nil, err
+	}
+	holdings.claimable = claimable
+
+	available, unavailable, err := decoder.wm.GetUnclaimedGas(address)
+	if err != nil {
+		return nil, err
+	}
+	holdings.AvailableGas = available.String()
+	holdings.UnavailableGas = unavailable.String()
+
+	return holdings, nil
+}
+
+//BuildSweepRawTransactions 创建、签名并验证纸钱包清扫交易单，返回可直接广播的交易单
+//可提取的GAS通过提取交易直接提取到接收地址，每种全局资产和NEP-5代币各一笔转账
+//未花费NEO产生的GAS要等NEO转出确认后才能提取，需要再次清扫
+// wrapper ： 钱包接口
+// key : WIF或NEP-2加密私钥
+// passphrase : NEP-2密码，WIF时为空
+// to : 接收地址，必须是钱包内的地址
+func (decoder *TransactionDecoder) BuildSweepRawTransactions(wrapper openwallet.WalletDAI, key, passphrase, to string) ([]*openwallet.RawTransaction, error) {
+
+	var (
+		rawTxs = make([]*openwallet.RawTransaction, 0)
+	)
+
+	sk, err := decoder.decodeSweepKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	toAddr, err := wrapper.GetAddress(to)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "receiver address[%s] is not in wallet", to)
+	}
+
+	if toAddr.Address == sk.address.Address {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver address is the sweep address")
+	}
+
+	account, err := wrapper.GetAssetsAccountInfo(toAddr.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, err := decoder.getSweepHoldings(sk.address.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &sweepWrapper{WalletDAI: wrapper, address: sk.address}
+	newRawTx := func(coin openwallet.Coin) *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Coin:    coin,
+			Account: account,
+			To:      map[string]string{to: ""},
+		}
+	}
+
+	//提取GAS
+	for start := 0; start < len(holdings.claimable); start += decoder.wm.Config.MaxTxInputs {
+		end := start + decoder.wm.Config.MaxTxInputs
+		if end > len(holdings.claimable) {
+			end = len(holdings.claimable)
+		}
+		gas, _ := decoder.wm.GetUTXOAsset(neoTransaction.NeoGasAssetId)
+		rawTx := newRawTx(decoder.wm.GetUTXOAssetCoin(gas))
+		err = decoder.createClaimRawTransaction(sw, rawTx, sk.address, holdings.claimable[start:end], to)
+		if err != nil {
+			return nil, err
+		}
+		rawTxs = append(rawTxs, rawTx)
+	}
+
+	//全局资产，输入超过限制时分拆成多笔
+	for assetID, u := range holdings.unspent.Unspents {
+		asset, ok := decoder.wm.GetUTXOAsset(assetID)
+		if !ok {
+			decoder.wm.Log.Std.Warning("asset [%s] is not registered, skip sweeping %s", assetID, u.Amount)
+			continue
+		}
+
+		for _, used := range splitUnspent(holdings.unspent.Address, u, decoder.wm.Config.MaxTxInputs) {
+			amount, _ := decimal.NewFromString(used.GetUnspent(assetID).Amount)
+			if !amount.GreaterThan(decimal.Zero) {
+				continue
+			}
+			rawTx := newRawTx(decoder.wm.GetUTXOAssetCoin(asset))
+			err = decoder.createNEORawTransaction(sw, rawTx, []*UnspentBalance{used}, map[string]decimal.Decimal{to: amount})
+			if err != nil {
+				return nil, err
+			}
+			rawTxs = append(rawTxs, rawTx)
+		}
+	}
+
+	//NEP-5代币
+	for contractHash, holding := range holdings.nep5 {
+		amount, _ := decimal.NewFromString(holding.Balance)
+		rawTx := newRawTx(holding.Coin)
+		err = decoder.createNEP5RawTransaction(sw, rawTx, sk.address, map[string]decimal.Decimal{to: amount}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create nep5 token [%s] sweep transaction failed, unexpected error: %v", contractHash, err)
+		}
+		rawTxs = append(rawTxs, rawTx)
+	}
+
+	if len(rawTxs) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "[%s] has nothing to sweep", sk.address.Address)
+	}
+
+	for _, rawTx := range rawTxs {
+		err = decoder.signSweepRawTransaction(sw, rawTx, sk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rawTxs, nil
+}
+
+//SweepPrivateKey 清扫纸钱包私钥的全部资产到钱包地址并广播，返回已广播的交易记录
+//广播失败时返回已成功广播的交易记录和错误
+func (decoder *TransactionDecoder) SweepPrivateKey(wrapper openwallet.WalletDAI, key, passphrase, to string) ([]*openwallet.Transaction, error) {
+
+	rawTxs, err := decoder.BuildSweepRawTransactions(wrapper, key, passphrase, to)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]*openwallet.Transaction, 0)
+	for _, rawTx := range rawTxs {
+		tx, err := decoder.SubmitRawTransaction(wrapper, rawTx)
+		if err != nil {
+			return txs, err
+		}
+		decoder.wm.Log.Std.Info("Sweep transaction: %s, amount: %s", tx.TxID, strings.Join(tx.To, ", "))
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+//createClaimRawTransaction 创建提取GAS交易单，提取的GAS全部输出到接收地址
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据
+// from : 已花费NEO的所有者地址
+// claims : 可提取GAS的已花费NEO输出
+// to : 接收地址
+func (decoder *TransactionDecoder) createClaimRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, from *openwallet.Address, claims []*ClaimableTx, to string) error {
+
+	var (
+		vins      = make([]neoTransaction.Vin, 0)
+		totalGas  = decimal.Zero
+		gasAmount = decimal.Zero
+	)
+
+	for _, c := range claims {
+		vins = append(vins, neoTransaction.Vin{TxID: c.TxID, Vout: c.N})
+		totalGas = totalGas.Add(c.Unclaimed)
+	}
+
+	//GAS 输出为 Fixed8
+	gasAmount = totalGas.Shift(decoder.wm.Decimal()).Truncate(0)
+	if !gasAmount.GreaterThan(decimal.Zero) {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "[%s] has no gas to claim", from.Address)
+	}
+
+	vouts := []neoTransaction.Vout{
+		{Asset: neoTransaction.NeoGasAssetId, Address: to, Value: uint64(gasAmount.IntPart())},
+	}
+
+	emptyTrans, err := neoTransaction.CreateEmptyClaimTransaction(vins, vouts, nil)
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	rawTx.RawHex = emptyTrans
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+
+	keySigs, err := decoder.appendAddressKeySignatures(wrapper, rawTx, make([]*openwallet.KeySignature, 0), from)
+	if err != nil {
+		return err
+	}
+
+	claimed := gasAmount.Shift(-decoder.wm.Decimal())
+	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	rawTx.IsBuilt = true
+	rawTx.Fees = "0"
+	rawTx.TxAmount = claimed.StringFixed(decoder.wm.Decimal())
+	rawTx.TxFrom = []string{fmt.Sprintf("%s:%s", from.Address, claimed.String())}
+	rawTx.TxTo = []string{fmt.Sprintf("%s:%s", to, claimed.String())}
+	return nil
+}
+
+//signSweepRawTransaction 用纸钱包私钥签名交易单并验证
+func (decoder *TransactionDecoder) signSweepRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, sk *sweepKey) error {
+
+	digest, err := neoTransaction.GetTransactionDigest(rawTx.RawHex)
+	if err != nil {
+		return err
+	}
+
+	sigPub, err := neoTransaction.SignDigest(digest, sk.privateKey)
+	if err != nil {
+		return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
+	}
+
+	for _, keySignature := range rawTx.Signatures[rawTx.Account.AccountID] {
+		if keySignature.Address.Address == sk.address.Address {
+			keySignature.Signature = fmt.Sprintf("%x", sigPub.Signature)
+		}
+	}
+
+	err = decoder.VerifyNEORawTransaction(wrapper, rawTx)
+	if err != nil {
+		return err
+	}
+
+	if !rawTx.IsCompleted {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "sweep transaction verify failed")
+	}
+
+	return nil
+}
+
+//splitUnspent 按最大输入数分拆地址的资产未花费
+func splitUnspent(address string, unspent *Unspent, maxInputs int) []*UnspentBalance {
+	ret := make([]*UnspentBalance, 0)
+	if unspent.UnspentTxs == nil {
+		return ret
+	}
+
+	txs := *unspent.UnspentTxs
+	assetID := normalizeAssetID(unspent.AssetHash)
+	for start := 0; start < len(txs); start += maxInputs {
+		end := start + maxInputs
+		if end > len(txs) {
+			end = len(txs)
+		}
+		chunk := append([]UnspentTx{}, txs[start:end]...)
+		amount := decimal.Zero
+		for _, tx := range chunk {
+			value, _ := decimal.NewFromString(tx.Value)
+			amount = amount.Add(value)
+		}
+		ret = append(ret, &UnspentBalance{
+			Address: address,
+			Unspents: map[string]*Unspent{
+				assetID: {
+					UnspentTxs:  &chunk,
+					AssetHash:   unspent.AssetHash,
+					Asset:       unspent.Asset,
+					AssetSymbol: unspent.AssetSymbol,
+					Amount:      amount.String(),
+				},
+			},
+		})
+	}
+	return ret
+}
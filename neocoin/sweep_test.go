@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+// 测试用钱包，增加资产账户查询
+type sweepTestWallet struct {
+	signerTestWallet
+}
+
+func (w *sweepTestWallet) GetAssetsAccountInfo(accountID string) (*openwallet.AssetsAccount, error) {
+	return &openwallet.AssetsAccount{AccountID: accountID}, nil
+}
+
+// 节点RPC替身，返回纸钱包地址的未花费、NEP-5余额和可提取GAS
+func newSweepNodeStandIn(address string) *httptest.Server {
+	results := map[string]interface{}{
+		"getunspents": map[string]interface{}{
+			"address": address,
+			"balance": []interface{}{
+				map[string]interface{}{
+					"asset_hash": neoTransaction.NeoAssetId, "asset_symbol": "NEO", "amount": "15",
+					"unspent": []interface{}{
+						map[string]interface{}{"txid": "c3182952855314b3f4b1ecf01a03b891d4627d19426ce841275f6d4c186e729a", "n": 0, "value": "10"},
+						map[string]interface{}{"txid": "bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", "n": 1, "value": "5"},
+					},
+				},
+				map[string]interface{}{
+					"asset_hash": "0x" + neoTransaction.NeoGasAssetId, "asset_symbol": "GAS", "amount": "1.5",
+					"unspent": []interface{}{
+						map[string]interface{}{"txid": "bd454059e58da4221aaf4effa3278660b231e9af7cea97912f4ac5c4995bb7e4", "n": 0, "value": "1.5"},
+					},
+				},
+			},
+		},
+		"getnep5balances": map[string]interface{}{
+			"address": address,
+			"balance": []interface{}{
+				map[string]interface{}{"asset_hash": "0xecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", "amount": "123400000000", "last_updated_block": 100},
+			},
+		},
+		"getclaimable": map[string]interface{}{
+			"address": address,
+			"claimable": []interface{}{
+				map[string]interface{}{"txid": "0x7a8ebdd5d8fed7d3a8e1ac9c7fe2d0b0d8a1ba9ee33a8c0de3bce28c7a9e3b1c", "n": 0, "value": 10, "unclaimed": 0.12345678},
+			},
+			"unclaimed": 0.12345678,
+		},
+		"getunclaimed": map[string]interface{}{"available": 0.12345678, "unavailable": 0.5, "unclaimed": 0.62345678},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		result, ok := results[request.Method]
+		if request.Method == "invokefunction" {
+			ok = true
+			switch request.Params[1] {
+			case neoTransaction.NEP5MethodDecimals:
+				result = map[string]interface{}{"state": "HALT", "stack": []interface{}{map[string]interface{}{"type": "Integer", "value": "8"}}}
+			case neoTransaction.NEP5MethodSymbol:
+				result = map[string]interface{}{"state": "HALT", "stack": []interface{}{map[string]interface{}{"type": "ByteArray", "value": hex.EncodeToString([]byte("TKN"))}}}
+			}
+		}
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": result})
+	}))
+}
+
+func TestSweepPrivateKey(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Config.MaxTxInputs = 1
+	wm.Config.NEP2Scrypt = neoTransaction.ScryptParams{N: 16, R: 1, P: 1}
+
+	priv, _ := hex.DecodeString("55c87b7b8f435364250b271d979bfd3f83ebbc9950598a7b52b11ed7b117f89c")
+	paperAddress := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	server := newSweepNodeStandIn(paperAddress)
+	defer server.Close()
+	wm.WalletClient = NewClient(server.URL, "", false)
+
+	// 接收地址
+	key, err := hdkeystore.NewHDKey([]byte("0123456789abcdef0123456789abcdef"), "test", "m/44'/888'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toPriv, err := wm.DerivePrivateKey(key, BIP44Path(0, false, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigPub, _ := neoTransaction.SignDigest(make([]byte, 32), toPriv)
+	to, _ := wm.Decoder.PublicKeyToAddress(sigPub.Pubkey, wm.Config.IsTestNet)
+	wallet := &sweepTestWallet{signerTestWallet{key: key, addrs: []*openwallet.Address{
+		{AccountID: "test", Address: to, PublicKey: hex.EncodeToString(sigPub.Pubkey), HDPath: BIP44Path(0, false, 0)},
+	}}}
+
+	decoder := wm.TxDecoder.(*TransactionDecoder)
+
+	wif, _ := wm.Decoder.PrivateKeyToWIF(priv, wm.Config.IsTestNet)
+	nep2, _ := wm.Decoder.PrivateKeyToNEP2(priv, "paper")
+
+	// WIF 和 NEP-2 解析为同一地址
+	for _, k := range [][2]string{{wif, ""}, {nep2, "paper"}} {
+		holdings, err := decoder.GetSweepHoldings(k[0], k[1])
+		if err != nil {
+			t.Fatalf("get holdings of %s failed: %v", k[0], err)
+		}
+		if holdings.Address != paperAddress {
+			t.Errorf("sweep address: %s, expected: %s", holdings.Address, paperAddress)
+		}
+		if len(holdings.Holdings) != 3 || holdings.AvailableGas != "0.12345678" || holdings.UnavailableGas != "0.5" {
+			t.Errorf("unexpected holdings: %+v", holdings)
+		}
+	}
+
+	if _, err := decoder.GetSweepHoldings(nep2, "wrong"); err == nil {
+		t.Errorf("wrong nep2 passphrase should be rejected")
+	}
+
+	rawTxs, err := decoder.BuildSweepRawTransactions(wallet, wif, "", to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 提取GAS 1笔，NEO 按最大输入数分拆2笔，GAS 1笔，NEP-5 1笔
+	if len(rawTxs) != 5 {
+		t.Fatalf("sweep transactions: %d, expected: 5", len(rawTxs))
+	}
+
+	claimed := false
+	for _, rawTx := range rawTxs {
+		if !rawTx.IsCompleted || !neoTransaction.VerifyRawTransaction(rawTx.RawHex) {
+			t.Errorf("sweep transaction is not completed: %s", rawTx.RawHex)
+		}
+		if rawTx.RawHex[:2] == "02" {
+			claimed = true
+			if rawTx.TxAmount != "0.12345678" {
+				t.Errorf("claim amount: %s, expected: 0.12345678", rawTx.TxAmount)
+			}
+		}
+	}
+	if !claimed {
+		t.Errorf("claim transaction not found")
+	}
+
+	// 接收地址必须在钱包内
+	if _, err := decoder.BuildSweepRawTransactions(wallet, wif, "", paperAddress); err == nil {
+		t.Errorf("receiver outside the wallet should be rejected")
+	}
+}
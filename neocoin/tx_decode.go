@@ -16,13 +16,16 @@
 package neocoin
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"github.com/LeorCao/neo-adapter/neoTransaction"
 	"github.com/blocktree/go-owcdrivers/omniTransaction"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"math/big"
 	"sort"
 	"strings"
 
@@ -45,29 +48,22 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.CreateOmniRawTransaction(wrapper, rawTx)
-	} else {
+	//已登记的全局资产（NEO、GAS及注册资产）使用UTXO转账，其它合约为NEP-5代币
+	if _, ok := decoder.wm.GetCoinUTXOAsset(rawTx.Coin); ok {
 		return decoder.CreateNEORawTransaction(wrapper, rawTx)
+	} else {
+		return decoder.CreateNEP5RawTransaction(wrapper, rawTx)
 	}
 }
 
 //SignRawTransaction 签名交易单
 func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.SignOmniRawTransaction(wrapper, rawTx)
-	} else {
-		return decoder.SignNEORawTransaction(wrapper, rawTx)
-	}
+	return decoder.SignNEORawTransaction(wrapper, rawTx)
 }
 
 //VerifyRawTransaction 验证交易单，验证交易单并返回加入签名后的交易单
 func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.VerifyOmniRawTransaction(wrapper, rawTx)
-	} else {
-		return decoder.VerifyNEORawTransaction(wrapper, rawTx)
-	}
+	return decoder.VerifyNEORawTransaction(wrapper, rawTx)
 }
 
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
@@ -77,11 +73,7 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 		rawTxArray        = make([]*openwallet.RawTransaction, 0)
 		err               error
 	)
-	if sumRawTx.Coin.IsContract {
-		rawTxWithErrArray, err = decoder.CreateOmniSummaryRawTransaction(wrapper, sumRawTx)
-	} else {
-		rawTxWithErrArray, err = decoder.CreateNEOSummaryRawTransaction(wrapper, sumRawTx)
-	}
+	rawTxWithErrArray, err = decoder.CreateSummaryRawTransactionWithError(wrapper, sumRawTx)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +154,11 @@ func (decoder *TransactionDecoder) CreateNEORawTransaction(wrapper openwallet.Wa
 		limit = 2000
 	)
 
+	asset, ok := decoder.wm.GetCoinUTXOAsset(rawTx.Coin)
+	if !ok {
+		return openwallet.Errorf(openwallet.ErrContractNotFound, "asset [%s] is not registered", rawTx.Coin.Contract.Address)
+	}
+
 	address, err := wrapper.GetAddressList(0, limit, "AccountID", rawTx.Account.AccountID)
 	if err != nil {
 		return err
@@ -184,7 +181,7 @@ func (decoder *TransactionDecoder) CreateNEORawTransaction(wrapper openwallet.Wa
 		if err != nil {
 			return err
 		}
-		if unspent.NEOUnspent != nil {
+		if unspent.GetUnspent(asset.AssetID) != nil {
 			unspents = append(unspents, unspent)
 		}
 	}
@@ -197,6 +194,11 @@ func (decoder *TransactionDecoder) CreateNEORawTransaction(wrapper openwallet.Wa
 		return errors.New("Receiver addresses is empty!")
 	}
 
+	err = decoder.verifyReceivers(rawTx.To)
+	if err != nil {
+		return err
+	}
+
 	//计算总发送金额
 	for addr, amount := range rawTx.To {
 		deamount, _ := decimal.NewFromString(amount)
@@ -212,8 +214,8 @@ func (decoder *TransactionDecoder) CreateNEORawTransaction(wrapper openwallet.Wa
 
 	// 从小到大排序排序UTXO NEO
 	sort.Sort(UnspentSort{unspents, func(a, b *UnspentBalance) int {
-		a_amount, _ := decimal.NewFromString(a.NEOUnspent.Amount)
-		b_amount, _ := decimal.NewFromString(b.NEOUnspent.Amount)
+		a_amount, _ := decimal.NewFromString(a.GetUnspent(asset.AssetID).Amount)
+		b_amount, _ := decimal.NewFromString(b.GetUnspent(asset.AssetID).Amount)
 		if a_amount.GreaterThan(b_amount) {
 			return 1
 		} else {
@@ -253,7 +255,7 @@ func (decoder *TransactionDecoder) CreateNEORawTransaction(wrapper openwallet.Wa
 
 		//计算一个可用于支付的余额
 		for _, u := range unspents {
-			ua, _ := decimal.NewFromString(u.NEOUnspent.Amount)
+			ua, _ := decimal.NewFromString(u.GetUnspent(asset.AssetID).Amount)
 			if ua.GreaterThan(decimal.Zero) {
 				neoBalance = neoBalance.Add(ua)
 				usedNEOUTXO = append(usedNEOUTXO, u)
@@ -342,44 +344,61 @@ func (decoder *TransactionDecoder) SignNEORawTransaction(wrapper openwallet.Wall
 		return fmt.Errorf("transaction signature is empty")
 	}
 
-	key, err := wrapper.HDKey()
+	//交易摘要，由签名器签名
+	digest, err := neoTransaction.GetTransactionDigest(rawTx.RawHex)
+	if err != nil {
+		return err
+	}
+
+	witnesses, err := getContractWitnesses(rawTx)
 	if err != nil {
 		return err
 	}
 
 	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
-	if keySignatures != nil {
+
+	//合约地址的见证人由参数模板中的签名者签名
+	allSignatures := append([]*openwallet.KeySignature{}, keySignatures...)
+	for _, witness := range witnesses {
+		allSignatures = append(allSignatures, witness.Signatures...)
+	}
+
+	if len(allSignatures) > 0 {
 		verifyKey := make(map[string]*openwallet.KeySignature, 0)
 
-		for _, keySign := range keySignatures {
+		for _, keySign := range allSignatures {
 			verifyKey[keySign.Address.Address] = keySign
 		}
 
 		for _, keySignature := range verifyKey {
 
-			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
-			if err != nil {
-				return err
-			}
-			keyBytes, err := childKey.GetPrivateKeyBytes()
-			if err != nil {
-				return err
-			}
-			decoder.wm.Log.Debug("privateKey:", hex.EncodeToString(keyBytes))
-
 			// 签名交易
 			// 交易单哈希签名
-			sigPub, err := neoTransaction.SignRawTransaction(rawTx.RawHex, keyBytes)
+			signature, err := decoder.signDigest(wrapper, keySignature.Address, digest)
 			if err != nil {
 				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
 			}
 
 			decoder.wm.Log.Info("Signature raw transaction : ", rawTx.RawHex)
 
-			keySignature.Signature = hex.EncodeToString(sigPub.Signature)
+			keySignature.Signature = hex.EncodeToString(signature)
+		}
+
+		//同一地址作为多个见证人的签名者时使用相同的签名
+		for _, keySign := range allSignatures {
+			if signed, ok := verifyKey[keySign.Address.Address]; ok {
+				keySign.Signature = signed.Signature
+			}
 		}
 	}
 	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
+
+	if len(witnesses) > 0 {
+		err = rawTx.SetExtParam(contractWitnessesKey, witnesses)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -423,6 +442,21 @@ func (decoder *TransactionDecoder) VerifyNEORawTransaction(wrapper openwallet.Wa
 		}
 	}
 
+	//合约地址的见证人，缺少签名者的签名时验证失败
+	witnesses, err := getContractWitnesses(rawTx)
+	if err != nil {
+		return err
+	}
+	contracts := make([]neoTransaction.ContractTx, 0)
+	for _, witness := range witnesses {
+		txHash, err := newContractTxHash(witness)
+		if err != nil {
+			return err
+		}
+		transHash = append(transHash, *txHash)
+		contracts = append(contracts, *txHash.Contract)
+	}
+
 	// 填充签名结果到空交易单
 	// 传入TxUnlock结构体的原因是： 解锁向脚本支付的UTXO时需要对应地址的赎回脚本， 当前案例的对应字段置为 "" 即可
 	signedTrans, err := neoTransaction.InsertSignatureIntoEmptyTransaction(emptyTrans, transHash)
@@ -430,8 +464,8 @@ func (decoder *TransactionDecoder) VerifyNEORawTransaction(wrapper openwallet.Wa
 		return fmt.Errorf("transaction compose signatures failed")
 	}
 
-	// 验证交易单
-	pass := neoTransaction.VerifyRawTransaction(hex.EncodeToString(signedTrans))
+	// 验证交易单，合约见证人按参数模板验证签名参数
+	pass := neoTransaction.VerifyRawTransactionWithContracts(hex.EncodeToString(signedTrans), contracts)
 	if pass {
 		decoder.wm.Log.Debugf("Transaction verify passed, transaction size : %d", len(signedTrans))
 		decoder.wm.Log.Debug("transaction verify passed")
@@ -455,6 +489,782 @@ func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, u
 	return rate.StringFixed(decoder.wm.Decimal()), "K", nil
 }
 
+////////////////////////// NEP-5 implement //////////////////////////
+
+//CreateNEP5RawTransaction 创建NEP-5代币交易单
+//系统费为0的转账不需要GAS输入，发送者通过 Script 附加信息声明并提供见证人
+func (decoder *TransactionDecoder) CreateNEP5RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		accountID     = rawTx.Account.AccountID
+		contract      = rawTx.Coin.Contract
+		tokenDecimals = int32(contract.Decimals)
+		totalSend     = decimal.Zero
+		outputAddrs   = make(map[string]decimal.Decimal)
+		sender        *openwallet.Address
+		senderBalance = decimal.Zero
+		limit         = 2000
+	)
+
+	if len(rawTx.To) == 0 {
+		return errors.New("Receiver addresses is empty!")
+	}
+
+	err := decoder.verifyReceivers(rawTx.To)
+	if err != nil {
+		return err
+	}
+
+	//计算总发送金额
+	for addr, amount := range rawTx.To {
+		deamount, err := decimal.NewFromString(amount)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s", amount)
+		}
+		totalSend = totalSend.Add(deamount)
+		outputAddrs = appendOutput(outputAddrs, addr, deamount)
+	}
+
+	addresses, err := wrapper.GetAddressList(0, limit, "AccountID", accountID)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) == 0 {
+		return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+	}
+
+	//查找代币余额足够的发送地址
+	for _, address := range addresses {
+		balance, err := decoder.wm.GetNEP5Balance(contract.Address, tokenDecimals, address.Address)
+		if err != nil {
+			decoder.wm.Log.Errorf("get address[%v] nep5 token balance failed, err: %v", address.Address, err)
+			continue
+		}
+		if balance.GreaterThanOrEqual(totalSend) {
+			sender = address
+			senderBalance = balance
+			break
+		}
+	}
+
+	if sender == nil {
+		return openwallet.Errorf(openwallet.ErrInsufficientTokenBalanceOfAddress, "[%s] token balance is not enough", accountID)
+	}
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("From Account: %s", accountID)
+	decoder.wm.Log.Std.Notice("From Address: %s", sender.Address)
+	decoder.wm.Log.Std.Notice("Token Balance: %v", senderBalance.String())
+	decoder.wm.Log.Std.Notice("Receive: %v", totalSend.String())
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	return decoder.createNEP5RawTransaction(wrapper, rawTx, sender, outputAddrs, nil)
+}
+
+//createNEP5RawTransaction 创建NEP-5原始交易单
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据
+// sender : 代币发送地址
+// to : key : 交易接收地址 value : 代币数量
+// fee : GAS手续费输入，为nil时不支付手续费
+func (decoder *TransactionDecoder) createNEP5RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, sender *openwallet.Address, to map[string]decimal.Decimal, fee *gasFeeInputs) error {
+
+	var (
+		contract      = rawTx.Coin.Contract
+		tokenDecimals = int32(contract.Decimals)
+		totalSend     = decimal.Zero
+		txTo          = make([]string, 0)
+		sb            = neoTransaction.NewScriptBuilder()
+	)
+
+	_, senderHash, err := neoTransaction.DecodeCheck(sender.Address)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid sender address: %s", sender.Address)
+	}
+
+	//装配转账脚本，每个接收地址调用一次 transfer
+	for addr, amount := range to {
+		sendAmount, ok := new(big.Int).SetString(amount.Shift(tokenDecimals).Truncate(0).String(), 10)
+		if !ok {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s", amount.String())
+		}
+		err = sb.EmitNEP5Transfer(contract.Address, sender.Address, addr, sendAmount)
+		if err != nil {
+			return fmt.Errorf("create nep5 transfer script failed, unexpected error: %v", err)
+		}
+		totalSend = totalSend.Add(amount)
+		txTo = append(txTo, fmt.Sprintf("%s:%s", addr, amount.String()))
+	}
+
+	//随机备注，保证相同转账的交易哈希不重复
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	attrs := []neoTransaction.Attribute{
+		{Attr: neoTransaction.AttrScript, Data: hex.EncodeToString(senderHash)},
+		{Attr: neoTransaction.AttrRemark, Data: hex.EncodeToString(nonce)},
+	}
+
+	if fee == nil {
+		fee = &gasFeeInputs{fee: decimal.Zero}
+	}
+
+	//构建交易单，系统费为0，只有手续费的GAS输入和找零
+	emptyTrans, err := neoTransaction.CreateEmptyInvocationTransaction(sb.ToBytes(), 0, fee.vins, fee.vouts, attrs)
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	rawTx.RawHex = emptyTrans
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+
+	//装配签名，签名者为 Script 附加信息声明的发送地址
+	addr, err := wrapper.GetAddress(sender.Address)
+	if err != nil {
+		return err
+	}
+
+	signature := openwallet.KeySignature{
+		EccType: decoder.wm.Config.CurveType,
+		Nonce:   "",
+		Address: addr,
+		Message: "",
+	}
+
+	keySigs := []*openwallet.KeySignature{&signature}
+	for _, signer := range fee.signers {
+		if signer.Address == addr.Address {
+			continue
+		}
+		keySigs = append(keySigs, &openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: signer,
+			Message: "",
+		})
+	}
+
+	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	rawTx.IsBuilt = true
+	rawTx.Fees = fee.fee.String()
+	rawTx.TxAmount = decimal.Zero.Sub(totalSend).StringFixed(tokenDecimals)
+	rawTx.TxFrom = []string{fmt.Sprintf("%s:%s", sender.Address, totalSend.String())}
+	rawTx.TxTo = txTo
+	return nil
+}
+
+//CreateNEP5SummaryRawTransaction 创建NEP-5代币汇总交易单，每个达到最低转账的地址一笔交易单
+//手续费按 FeeRate 以GAS从账户地址支付，FeeRate 为空时使用最低手续费
+func (decoder *TransactionDecoder) CreateNEP5SummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	var (
+		accountID          = sumRawTx.Account.AccountID
+		contract           = sumRawTx.Coin.Contract
+		tokenDecimals      = int32(contract.Decimals)
+		minTransfer, _     = decimal.NewFromString(sumRawTx.MinTransfer)
+		retainedBalance, _ = decimal.NewFromString(sumRawTx.RetainedBalance)
+		fee                = decoder.wm.Config.MinFees
+		rawTxArray         = make([]*openwallet.RawTransactionWithError, 0)
+		usedInputs         = make(map[string]bool)
+	)
+
+	if len(sumRawTx.FeeRate) > 0 {
+		feeRate, err := decimal.NewFromString(sumRawTx.FeeRate)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid fee rate: %s", sumRawTx.FeeRate)
+		}
+		fee = feeRate
+	}
+
+	if minTransfer.LessThan(retainedBalance) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "mini transfer amount must be greater than address retained balance")
+	}
+
+	if !decoder.wm.Decoder.AddressVerify(sumRawTx.SummaryAddress) {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid summary address: %s", sumRawTx.SummaryAddress)
+	}
+
+	sumAddresses, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sumAddresses) == 0 {
+		return nil, fmt.Errorf("[%s] have not addresses", accountID)
+	}
+
+	//手续费从账户全部地址中支付
+	feeAddresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, address := range sumAddresses {
+
+		if address.Address == sumRawTx.SummaryAddress {
+			continue
+		}
+
+		balance, err := decoder.wm.GetNEP5Balance(contract.Address, tokenDecimals, address.Address)
+		if err != nil {
+			decoder.wm.Log.Errorf("get address[%v] nep5 token balance failed, err: %v", address.Address, err)
+			continue
+		}
+
+		//检查余额是否超过最低转账
+		if balance.LessThan(minTransfer) || balance.LessThanOrEqual(decimal.Zero) {
+			continue
+		}
+
+		sumAmount := balance.Sub(retainedBalance)
+		if sumAmount.LessThanOrEqual(decimal.Zero) {
+			continue
+		}
+
+		decoder.wm.Log.Debugf("balance: %v", balance.String())
+		decoder.wm.Log.Debugf("fees: %v", fee.String())
+		decoder.wm.Log.Debugf("sumAmount: %v", sumAmount.String())
+
+		//创建一笔交易单
+		rawTx := &openwallet.RawTransaction{
+			Coin:     sumRawTx.Coin,
+			Account:  sumRawTx.Account,
+			FeeRate:  sumRawTx.FeeRate,
+			To:       map[string]string{sumRawTx.SummaryAddress: sumAmount.StringFixed(tokenDecimals)},
+			Required: 1,
+		}
+
+		var createErr error
+		vins, vouts, signers, feeErr := decoder.assembleGASFeeExcluding(feeAddresses, fee, usedInputs)
+		if feeErr != nil {
+			createErr = feeErr
+		} else {
+			feeInputs := &gasFeeInputs{vins: vins, vouts: vouts, signers: signers, fee: fee}
+			createErr = decoder.createNEP5RawTransaction(wrapper, rawTx, address, map[string]decimal.Decimal{sumRawTx.SummaryAddress: sumAmount}, feeInputs)
+		}
+
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxArray, nil
+}
+
+////////////////////////// Vote implement //////////////////////////
+
+//CreateVoteRawTransaction 创建投票交易单，地址的全部NEO投给候选人，候选人为空时取消投票
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据，只使用 Account 和 Coin
+// address : 投票地址
+// candidates : 候选人公钥
+func (decoder *TransactionDecoder) CreateVoteRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, address string, candidates []string) error {
+
+	addr, err := wrapper.GetAddress(address)
+	if err != nil {
+		return err
+	}
+
+	if addr.AccountID != rawTx.Account.AccountID {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "address[%s] is not belong to account[%s]", address, rawTx.Account.AccountID)
+	}
+
+	descriptor, err := neoTransaction.NewVoteStateDescriptor(address, candidates)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create vote descriptor failed, unexpected error: %v", err)
+	}
+
+	//随机备注，保证重复投票的交易哈希不重复
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	attrs := []neoTransaction.Attribute{
+		{Attr: neoTransaction.AttrRemark, Data: hex.EncodeToString(nonce)},
+	}
+
+	//构建空交易单，投票不需要输入和输出
+	emptyTrans, err := neoTransaction.CreateEmptyStateTransaction([]neoTransaction.StateDescriptor{*descriptor}, nil, nil, attrs)
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("Vote Address: %s", address)
+	decoder.wm.Log.Std.Notice("Candidates: %s", strings.Join(candidates, ", "))
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	rawTx.RawHex = emptyTrans
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+
+	//装配签名，签名者为状态描述中的投票账户
+	signature := openwallet.KeySignature{
+		EccType: decoder.wm.Config.CurveType,
+		Nonce:   "",
+		Address: addr,
+		Message: "",
+	}
+
+	rawTx.Signatures[rawTx.Account.AccountID] = []*openwallet.KeySignature{&signature}
+	rawTx.IsBuilt = true
+	rawTx.Fees = "0"
+	rawTx.TxAmount = "0"
+	rawTx.TxFrom = []string{address}
+	rawTx.TxTo = candidates
+	return nil
+}
+
+//BuildVoteRawTransaction 创建、签名并验证投票交易单，返回可直接广播的交易单
+func (decoder *TransactionDecoder) BuildVoteRawTransaction(wrapper openwallet.WalletDAI, account *openwallet.AssetsAccount, address string, candidates []string) (*openwallet.RawTransaction, error) {
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{
+			Symbol: decoder.wm.Config.Symbol,
+		},
+		Account: account,
+	}
+
+	err := decoder.CreateVoteRawTransaction(wrapper, rawTx, address, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	err = decoder.SignNEORawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = decoder.VerifyNEORawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rawTx.IsCompleted {
+		return nil, openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "vote transaction verify failed")
+	}
+
+	return rawTx, nil
+}
+
+////////////////////////// Register/Issue implement //////////////////////////
+
+//CreateRegisterAssetRawTransaction 创建注册资产交易单，资产所有者必须是账户内的地址，交易上链后扫描器将资产ID登记到全局资产
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据，只使用 Account 和 Coin
+// symbol : 资产符号
+// asset : 注册资产元数据
+func (decoder *TransactionDecoder) CreateRegisterAssetRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, symbol string, asset neoTransaction.Asset) (string, error) {
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(addresses) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
+	}
+
+	//查找所有者公钥对应的地址
+	var owner *openwallet.Address
+	for _, addr := range addresses {
+		if strings.EqualFold(addr.PublicKey, asset.Owner) {
+			owner = addr
+			break
+		}
+	}
+
+	if owner == nil {
+		return "", openwallet.Errorf(openwallet.ErrAddressNotFound, "owner[%s] is not belong to account[%s]", asset.Owner, rawTx.Account.AccountID)
+	}
+
+	vins, vouts, signers, err := decoder.assembleGASFee(addresses, decoder.wm.Config.RegisterAssetFee)
+	if err != nil {
+		return "", err
+	}
+
+	//随机备注，保证相同资产重复注册的交易哈希不重复
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	attrs := []neoTransaction.Attribute{
+		{Attr: neoTransaction.AttrRemark, Data: hex.EncodeToString(nonce)},
+	}
+
+	emptyTrans, err := neoTransaction.CreateEmptyRegisterTransaction(asset, vins, vouts, attrs)
+	if err != nil {
+		return "", fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	//注册资产交易的交易ID即资产ID
+	assetID, err := neoTransaction.GetTransactionHash(emptyTrans)
+	if err != nil {
+		return "", err
+	}
+
+	//交易上链后由扫描器登记资产
+	err = decoder.wm.addUTXOAssetRegistration(assetID, symbol, int32(asset.Precision))
+	if err != nil {
+		return "", err
+	}
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("Register Asset: %s", asset.String())
+	decoder.wm.Log.Std.Notice("Asset ID: %s", assetID)
+	decoder.wm.Log.Std.Notice("Fees: %s GAS", decoder.wm.Config.RegisterAssetFee.String())
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	signers = appendSigner(signers, owner)
+
+	decoder.fillFeeRawTransaction(rawTx, emptyTrans, signers, decoder.wm.Config.RegisterAssetFee)
+	rawTx.TxFrom = []string{owner.Address}
+	rawTx.TxTo = []string{}
+	return assetID, nil
+}
+
+//CreateIssueAssetRawTransaction 创建发行资产交易单，资产管理员必须是账户内的地址
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据，使用 Account 和 To，To 为发行的接收地址和数量
+// assetID : 资产ID
+func (decoder *TransactionDecoder) CreateIssueAssetRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, assetID string) error {
+
+	asset, ok := decoder.wm.GetUTXOAsset(assetID)
+	if !ok {
+		return openwallet.Errorf(openwallet.ErrContractNotFound, "asset [%s] is not registered", assetID)
+	}
+
+	if len(rawTx.To) == 0 {
+		return errors.New("Receiver addresses is empty!")
+	}
+
+	err := decoder.verifyReceivers(rawTx.To)
+	if err != nil {
+		return err
+	}
+
+	admin, err := decoder.wm.GetAssetAdmin(asset.AssetID)
+	if err != nil {
+		return err
+	}
+
+	adminAddr, err := wrapper.GetAddress(admin)
+	if err != nil {
+		return err
+	}
+
+	if adminAddr.AccountID != rawTx.Account.AccountID {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "admin[%s] is not belong to account[%s]", admin, rawTx.Account.AccountID)
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+
+	vins, vouts, signers, err := decoder.assembleGASFee(addresses, decoder.wm.Config.IssueAssetFee)
+	if err != nil {
+		return err
+	}
+
+	//装配发行输出
+	txTo := make([]string, 0)
+	totalIssue := decimal.Zero
+	for to, amount := range rawTx.To {
+		amountDec, err := decimal.NewFromString(amount)
+		if err != nil || !amountDec.GreaterThan(decimal.Zero) {
+			return fmt.Errorf("invalid issue amount: %s", amount)
+		}
+		err = checkAssetPrecision(asset, amountDec)
+		if err != nil {
+			return err
+		}
+		totalIssue = totalIssue.Add(amountDec)
+		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amountDec.String()))
+		value := amountDec.Shift(decoder.wm.Decimal())
+		vouts = append(vouts, neoTransaction.Vout{Asset: asset.AssetID, Address: to, Value: uint64(value.IntPart())})
+	}
+
+	_, adminHash, err := neoTransaction.DecodeCheck(adminAddr.Address)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	//管理员通过脚本属性声明为见证人
+	attrs := []neoTransaction.Attribute{
+		{Attr: neoTransaction.AttrScript, Data: hex.EncodeToString(adminHash)},
+		{Attr: neoTransaction.AttrRemark, Data: hex.EncodeToString(nonce)},
+	}
+
+	emptyTrans, err := neoTransaction.CreateEmptyIssueTransaction(vins, vouts, attrs)
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("Issue Asset: %s [%s]", asset.Symbol, asset.AssetID)
+	decoder.wm.Log.Std.Notice("Total Issue: %s", totalIssue.String())
+	decoder.wm.Log.Std.Notice("Fees: %s GAS", decoder.wm.Config.IssueAssetFee.String())
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	signers = appendSigner(signers, adminAddr)
+
+	decoder.fillFeeRawTransaction(rawTx, emptyTrans, signers, decoder.wm.Config.IssueAssetFee)
+	rawTx.TxFrom = []string{adminAddr.Address}
+	rawTx.TxTo = txTo
+	return nil
+}
+
+//gasFeeInputs 装配好的GAS手续费输入、找零和签名地址
+type gasFeeInputs struct {
+	vins    []neoTransaction.Vin
+	vouts   []neoTransaction.Vout
+	signers []*openwallet.Address
+	fee     decimal.Decimal
+}
+
+//assembleGASFee 从账户地址的GAS未花中按金额从大到小装配手续费输入，找零到第一个使用的地址
+//手续费在最大输入数以内无法凑足时返回错误
+func (decoder *TransactionDecoder) assembleGASFee(addresses []*openwallet.Address, fee decimal.Decimal) ([]neoTransaction.Vin, []neoTransaction.Vout, []*openwallet.Address, error) {
+	return decoder.assembleGASFeeExcluding(addresses, fee, nil)
+}
+
+//assembleGASFeeExcluding 同 assembleGASFee，跳过 usedInputs 中的输入并记录本次选择的输入
+//批量创建交易单时避免多笔交易单使用同一个GAS输入，usedInputs 的 key 为 outputCacheKey
+func (decoder *TransactionDecoder) assembleGASFeeExcluding(addresses []*openwallet.Address, fee decimal.Decimal, usedInputs map[string]bool) ([]neoTransaction.Vin, []neoTransaction.Vout, []*openwallet.Address, error) {
+
+	var (
+		vins     = make([]neoTransaction.Vin, 0)
+		vouts    = make([]neoTransaction.Vout, 0)
+		signers  = make([]*openwallet.Address, 0)
+		totalGAS = decimal.Zero
+	)
+
+	if !fee.GreaterThan(decimal.Zero) {
+		return vins, vouts, signers, nil
+	}
+
+	type gasUnspent struct {
+		addr  *openwallet.Address
+		tx    UnspentTx
+		value decimal.Decimal
+	}
+
+	candidates := make([]gasUnspent, 0)
+	for _, addr := range addresses {
+		unspent, err := decoder.wm.ListUnspent(addr.Address)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		gas := unspent.GetUnspent(neoTransaction.NeoGasAssetId)
+		if gas == nil || gas.UnspentTxs == nil {
+			continue
+		}
+
+		for _, tx := range *gas.UnspentTxs {
+			if usedInputs[outputCacheKey(tx.TxID, tx.N)] {
+				continue
+			}
+			value, _ := decimal.NewFromString(tx.Value)
+			candidates = append(candidates, gasUnspent{addr: addr, tx: tx, value: value})
+		}
+	}
+
+	//优先使用金额大的输入，手续费足够后停止选择
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].value.GreaterThan(candidates[j].value)
+	})
+
+	used := make(map[string]bool)
+	for _, c := range candidates {
+		if totalGAS.GreaterThanOrEqual(fee) {
+			break
+		}
+		if len(vins) >= decoder.wm.Config.MaxTxInputs {
+			return nil, nil, nil, fmt.Errorf("The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
+		}
+		totalGAS = totalGAS.Add(c.value)
+		vins = append(vins, neoTransaction.Vin{TxID: c.tx.TxID, Vout: uint16(c.tx.N)})
+		if !used[c.addr.Address] {
+			used[c.addr.Address] = true
+			signers = append(signers, c.addr)
+		}
+	}
+
+	if totalGAS.LessThan(fee) {
+		return nil, nil, nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "The GAS balance: %s is not enough for fees: %s", totalGAS.String(), fee.String())
+	}
+
+	if usedInputs != nil {
+		for _, vin := range vins {
+			usedInputs[outputCacheKey(vin.TxID, uint64(vin.Vout))] = true
+		}
+	}
+
+	//GAS找零
+	change := totalGAS.Sub(fee)
+	if change.GreaterThan(decimal.Zero) {
+		value := change.Shift(decoder.wm.Decimal())
+		vouts = append(vouts, neoTransaction.Vout{Asset: neoTransaction.NeoGasAssetId, Address: signers[0].Address, Value: uint64(value.IntPart())})
+	}
+
+	return vins, vouts, signers, nil
+}
+
+//fillFeeRawTransaction 填充只消耗手续费的交易单
+func (decoder *TransactionDecoder) fillFeeRawTransaction(rawTx *openwallet.RawTransaction, emptyTrans string, signers []*openwallet.Address, fee decimal.Decimal) {
+
+	rawTx.RawHex = emptyTrans
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+
+	keySigs := make([]*openwallet.KeySignature, 0)
+	for _, addr := range signers {
+		signature := openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: addr,
+			Message: "",
+		}
+		keySigs = append(keySigs, &signature)
+	}
+
+	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	rawTx.IsBuilt = true
+	rawTx.Fees = fee.String()
+	rawTx.TxAmount = "0"
+}
+
+//appendSigner 添加签名地址，已存在则忽略
+func appendSigner(signers []*openwallet.Address, addr *openwallet.Address) []*openwallet.Address {
+	for _, s := range signers {
+		if s.Address == addr.Address {
+			return signers
+		}
+	}
+	return append(signers, addr)
+}
+
+////////////////////////// Deploy implement //////////////////////////
+
+//CreateDeployContractRawTransaction 创建部署合约交易单，系统费以GAS从账户地址中支付，返回合约脚本哈希
+// wrapper ： 钱包接口
+// rawTx : 交易原始数据，只使用 Account 和 Coin
+// contract : 部署合约元数据
+func (decoder *TransactionDecoder) CreateDeployContractRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, contract *neoTransaction.ContractDeployment) (string, error) {
+
+	script, err := neoTransaction.BuildContractCreateScript(*contract)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create contract script failed, unexpected error: %v", err)
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(addresses) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
+	}
+
+	gas := contract.GetDeployFee()
+	fee := decimal.New(int64(gas), -decoder.wm.Decimal())
+
+	vins, vouts, signers, err := decoder.assembleGASFee(addresses, fee)
+	if err != nil {
+		return "", err
+	}
+
+	if len(signers) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrInsufficientFees, "deploy contract need a GAS input as signer")
+	}
+
+	emptyTrans, err := neoTransaction.CreateEmptyInvocationTransaction(script, gas, vins, vouts, nil)
+	if err != nil {
+		return "", fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	scriptHash := contract.GetScriptHash()
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("Deploy Contract: %s %s", contract.Name, contract.Version)
+	decoder.wm.Log.Std.Notice("Script Hash: %s", scriptHash)
+	decoder.wm.Log.Std.Notice("Fees: %s GAS", fee.String())
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	decoder.fillFeeRawTransaction(rawTx, emptyTrans, signers, fee)
+	rawTx.TxFrom = []string{signers[0].Address}
+	rawTx.TxTo = []string{scriptHash}
+	return scriptHash, nil
+}
+
+//BuildDeployContractRawTransaction 读取AVM文件，创建、签名并验证部署合约交易单，返回可直接广播的交易单及合约脚本哈希
+// avmFile : 合约AVM文件路径
+// manifest : 合约描述参数
+func (decoder *TransactionDecoder) BuildDeployContractRawTransaction(wrapper openwallet.WalletDAI, account *openwallet.AssetsAccount, avmFile string, manifest *ContractManifest) (*openwallet.RawTransaction, string, error) {
+
+	script, err := ioutil.ReadFile(avmFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	contract, err := manifest.NewContractDeployment(script)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{
+			Symbol: decoder.wm.Config.Symbol,
+		},
+		Account: account,
+	}
+
+	scriptHash, err := decoder.CreateDeployContractRawTransaction(wrapper, rawTx, contract)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = decoder.SignNEORawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = decoder.VerifyNEORawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !rawTx.IsCompleted {
+		return nil, "", openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "deploy contract transaction verify failed")
+	}
+
+	return rawTx, scriptHash, nil
+}
+
 ////////////////////////// omnicore implement //////////////////////////
 
 //CreateOmniRawTransaction 创建Omni交易单
@@ -762,8 +1572,7 @@ func (decoder *TransactionDecoder) SignOmniRawTransaction(wrapper openwallet.Wal
 		if keySignatures != nil {
 			for _, keySignature := range keySignatures {
 
-				childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
-				keyBytes, err := childKey.GetPrivateKeyBytes()
+				keyBytes, err := decoder.wm.DerivePrivateKey(key, keySignature.Address.HDPath)
 				if err != nil {
 					return err
 				}
@@ -945,8 +1754,18 @@ func (decoder *TransactionDecoder) CreateNEOSummaryRawTransaction(wrapper openwa
 		sumUnspents      []*UnspentBalance
 		outputAddrs      map[string]decimal.Decimal
 		totalInputAmount decimal.Decimal
+		addrUnspents     = make(map[string]*UnspentBalance)
 	)
 
+	asset, ok := decoder.wm.GetCoinUTXOAsset(sumRawTx.Coin)
+	if !ok {
+		return nil, openwallet.Errorf(openwallet.ErrContractNotFound, "asset [%s] is not registered", sumRawTx.Coin.Contract.Address)
+	}
+
+	if !decoder.wm.Decoder.AddressVerify(sumRawTx.SummaryAddress) {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid summary address: %s", sumRawTx.SummaryAddress)
+	}
+
 	address, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit, "AccountID", sumRawTx.Account.AccountID)
 	if err != nil {
 		return nil, err
@@ -961,22 +1780,21 @@ func (decoder *TransactionDecoder) CreateNEOSummaryRawTransaction(wrapper openwa
 		searchAddrs = append(searchAddrs, address.Address)
 	}
 
-	addrBalanceArray := make([]*openwallet.Balance, 0)
-
 	for _, searchAddr := range searchAddrs {
-		balance, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddr)
+		unspent, err := decoder.wm.ListUnspent(searchAddr)
 		if err != nil {
 			continue
 		}
-		addrBalanceArray = append(addrBalanceArray, balance...)
-	}
-
-	for _, addrBalance := range addrBalanceArray {
+		assetUnspent := unspent.GetUnspent(asset.AssetID)
+		if assetUnspent == nil {
+			continue
+		}
 		//检查余额是否超过最低转账
-		addrBalance_dec, _ := decimal.NewFromString(addrBalance.Balance)
+		addrBalance_dec, _ := decimal.NewFromString(assetUnspent.Amount)
 		if addrBalance_dec.GreaterThanOrEqual(minTransfer) {
 			//添加到转账地址数组
-			sumAddresses = append(sumAddresses, addrBalance.Address)
+			sumAddresses = append(sumAddresses, searchAddr)
+			addrUnspents[searchAddr] = unspent
 		}
 	}
 
@@ -990,26 +1808,19 @@ func (decoder *TransactionDecoder) CreateNEOSummaryRawTransaction(wrapper openwa
 
 	for i, addr := range sumAddresses {
 
-		unspent, err := decoder.wm.ListUnspent(addr)
-		if err != nil {
-			return nil, err
-		}
+		unspent := addrUnspents[addr]
 
 		// 尽可能筹够最大input数
 		if len(sumUnspents) < decoder.wm.Config.MaxTxInputs {
-			if unspent.NEOUnspent != nil {
-				sumUnspents = append(sumUnspents, unspent)
-			}
+			sumUnspents = append(sumUnspents, unspent)
 		}
 
 		// 如果utxo已经超过最大输入，或遍历地址完结，就可以进行构建交易单
 		if i == len(sumAddresses)-1 || len(sumUnspents) >= decoder.wm.Config.MaxTxInputs {
 			//计算这笔交易单的汇总数量
 			for _, u := range sumUnspents {
-				if u.NEOUnspent != nil {
-					ua, _ := decimal.NewFromString(u.NEOUnspent.Amount)
-					totalInputAmount = totalInputAmount.Add(ua)
-				}
+				ua, _ := decimal.NewFromString(u.GetUnspent(asset.AssetID).Amount)
+				totalInputAmount = totalInputAmount.Add(ua)
 			}
 
 			/*
@@ -1085,6 +1896,11 @@ func (decoder *TransactionDecoder) createNEORawTransaction(wrapper openwallet.Wa
 		return fmt.Errorf("utxo is empty")
 	}
 
+	asset, ok := decoder.wm.GetCoinUTXOAsset(rawTx.Coin)
+	if !ok {
+		return openwallet.Errorf(openwallet.ErrContractNotFound, "asset [%s] is not registered", rawTx.Coin.Contract.Address)
+	}
+
 	if len(to) == 0 {
 		return fmt.Errorf("Receiver addresses is empty! ")
 	}
@@ -1110,22 +1926,28 @@ func (decoder *TransactionDecoder) createNEORawTransaction(wrapper openwallet.Wa
 
 	//装配输入
 	for _, utxo := range usedUtxos {
-		if (*utxo).NEOUnspent == nil {
+		unspent := utxo.GetUnspent(asset.AssetID)
+		if unspent == nil {
 			continue
 		}
-		for _, tx := range *utxo.NEOUnspent.UnspentTxs {
+		for _, tx := range *unspent.UnspentTxs {
 			in := neoTransaction.Vin{tx.TxID, uint16(tx.N)}
 			vins = append(vins, in)
 		}
 
-		txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, utxo.NEOUnspent.Amount))
+		txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, unspent.Amount))
 	}
 
 	//装配输出
 	for to, amount := range to {
+		err = checkAssetPrecision(asset, amount)
+		if err != nil {
+			return err
+		}
 		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amount.String()))
+		//全局资产的输出金额统一为 Fixed8
 		amount = amount.Shift(decoder.wm.Decimal())
-		out := neoTransaction.Vout{neoTransaction.NeoAssetId, to, uint64(amount.IntPart())}
+		out := neoTransaction.Vout{Asset: asset.AssetID, Address: to, Value: uint64(amount.IntPart())}
 		vouts = append(vouts, out)
 	}
 
@@ -1145,20 +1967,25 @@ func (decoder *TransactionDecoder) createNEORawTransaction(wrapper openwallet.Wa
 	//装配签名
 	keySigs := make([]*openwallet.KeySignature, 0)
 
+	//重新构建时清除之前记录的合约地址见证人
+	if rawTx.GetExtParam().Get(contractWitnessesKey).Exists() {
+		err = rawTx.SetExtParam(contractWitnessesKey, []*ContractWitness{})
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, usedUtxo := range usedUtxos {
 		addr, err := wrapper.GetAddress(usedUtxo.Address)
 		if err != nil {
 			return err
 		}
 
-		signature := openwallet.KeySignature{
-			EccType: decoder.wm.Config.CurveType,
-			Nonce:   "",
-			Address: addr,
-			Message: "",
+		//合约地址需要参数模板中的签名者签名
+		keySigs, err = decoder.appendAddressKeySignatures(wrapper, rawTx, keySigs, addr)
+		if err != nil {
+			return err
 		}
-
-		keySigs = append(keySigs, &signature)
 	}
 
 	feesDec, _ := decimal.NewFromString(rawTx.Fees)
@@ -1599,10 +2426,11 @@ func (decoder *TransactionDecoder) CreateOmniSummaryRawTransaction(wrapper openw
 
 // CreateSummaryRawTransactionWithError 创建汇总交易，返回能原始交易单数组（包含带错误的原始交易单）
 func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
-	if sumRawTx.Coin.IsContract {
-		return decoder.CreateOmniSummaryRawTransaction(wrapper, sumRawTx)
-	} else {
+	//已登记的全局资产使用UTXO汇总，其它合约为NEP-5代币
+	if _, ok := decoder.wm.GetCoinUTXOAsset(sumRawTx.Coin); ok {
 		return decoder.CreateNEOSummaryRawTransaction(wrapper, sumRawTx)
+	} else {
+		return decoder.CreateNEP5SummaryRawTransaction(wrapper, sumRawTx)
 	}
 }
 
@@ -1713,6 +2541,16 @@ func removeUTXO(slice []*Unspent, elem *Unspent) []*Unspent {
 	return slice
 }
 
+//verifyReceivers 校验接收地址，拒绝格式错误的地址
+func (decoder *TransactionDecoder) verifyReceivers(to map[string]string) error {
+	for addr := range to {
+		if !decoder.wm.Decoder.AddressVerify(addr) {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid receiver address: %s", addr)
+		}
+	}
+	return nil
+}
+
 func appendOutput(output map[string]decimal.Decimal, address string, amount decimal.Decimal) map[string]decimal.Decimal {
 	if origin, ok := output[address]; ok {
 		origin = origin.Add(amount)
@@ -16,9 +16,16 @@
 package neocoin
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/shopspring/decimal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
 )
 
 func TestDecimalShit(t *testing.T) {
@@ -66,3 +73,149 @@ func TestOrderHash(t *testing.T) {
 
 	fmt.Println(confused)
 }
+
+// 节点RPC替身，按地址返回GAS未花费和NEP-5余额
+// gas : key 为地址，value 为GAS未花费金额，交易ID为 序号 的64位十六进制
+// tokens : key 为大端序脚本哈希，value 为 balanceOf 返回的小端序金额
+func newFeeNodeStandIn(gas map[string][]string, tokens map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		var result interface{}
+		switch request.Method {
+		case "getunspents":
+			address := request.Params[0].(string)
+			unspents := make([]interface{}, 0)
+			total := decimal.Zero
+			for i, value := range gas[address] {
+				unspents = append(unspents, map[string]interface{}{"txid": fmt.Sprintf("%064x", len(address)*100+i), "n": i, "value": value})
+				v, _ := decimal.NewFromString(value)
+				total = total.Add(v)
+			}
+			balance := make([]interface{}, 0)
+			if len(unspents) > 0 {
+				balance = append(balance, map[string]interface{}{
+					"asset_hash": "0x" + neoTransaction.NeoGasAssetId, "asset_symbol": "GAS", "amount": total.String(), "unspent": unspents,
+				})
+			}
+			result = map[string]interface{}{"address": address, "balance": balance}
+		case "invokefunction":
+			param := request.Params[2].([]interface{})[0].(map[string]interface{})
+			result = map[string]interface{}{"state": "HALT", "stack": []interface{}{
+				map[string]interface{}{"type": "ByteArray", "value": tokens[param["value"].(string)]},
+			}}
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": result})
+	}))
+}
+
+func TestTransactionDecoder_AssembleGASFee(t *testing.T) {
+	addrA := &openwallet.Address{AccountID: "test", Address: "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"}
+	addrB := &openwallet.Address{AccountID: "test", Address: "ANYZ11AmUfwiZFLbAWHoExFyBuqgLmfz88"}
+
+	server := newFeeNodeStandIn(map[string][]string{
+		addrA.Address: {"0.1", "0.2", "3"},
+		addrB.Address: {"5"},
+	}, nil)
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.WalletClient = NewClient(server.URL, "", false)
+	wm.Config.MaxTxInputs = 2
+	decoder := wm.TxDecoder.(*TransactionDecoder)
+	addresses := []*openwallet.Address{addrA, addrB}
+
+	//手续费足够后停止选择，不受其它小额未花费影响
+	vins, vouts, signers, err := decoder.assembleGASFee(addresses, decimal.New(4, 0))
+	if err != nil {
+		t.Fatalf("assembleGASFee failed: %v", err)
+	}
+	if len(vins) != 1 || len(signers) != 1 || signers[0] != addrB || len(vouts) != 1 || vouts[0].Value != 100000000 {
+		t.Fatalf("assembleGASFee wrong: %v, %v, %v", vins, vouts, signers)
+	}
+
+	vins, _, signers, err = decoder.assembleGASFee(addresses, decimal.New(8, 0))
+	if err != nil || len(vins) != 2 || len(signers) != 2 {
+		t.Fatalf("assembleGASFee wrong: %v, %v, %v", vins, signers, err)
+	}
+
+	//最大输入数以内无法凑足时失败
+	_, _, _, err = decoder.assembleGASFee(addresses, decimal.RequireFromString("8.2"))
+	if err == nil {
+		t.Fatalf("assembleGASFee should fail over max inputs")
+	}
+
+	//批量创建时跳过已使用的输入
+	used := make(map[string]bool)
+	_, _, _, err = decoder.assembleGASFeeExcluding(addresses, decimal.New(4, 0), used)
+	if err != nil {
+		t.Fatalf("assembleGASFeeExcluding failed: %v", err)
+	}
+	vins, _, signers, err = decoder.assembleGASFeeExcluding(addresses, decimal.New(3, 0), used)
+	if err != nil || len(vins) != 1 || signers[0] != addrA {
+		t.Fatalf("assembleGASFeeExcluding wrong: %v, %v, %v", vins, signers, err)
+	}
+}
+
+func TestTransactionDecoder_CreateNEP5SummaryRawTransaction(t *testing.T) {
+	addrA := &openwallet.Address{AccountID: "test", Address: "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"}
+	addrB := &openwallet.Address{AccountID: "test", Address: "ANYZ11AmUfwiZFLbAWHoExFyBuqgLmfz88"}
+	summary := "AXXYzk1kn9Bj8PHeqha921gqCpwJNRmuHC"
+
+	//A 持有 2 个代币和GAS，B 没有代币
+	server := newFeeNodeStandIn(map[string][]string{
+		addrA.Address: {"0.5"},
+	}, map[string]string{
+		"7eaf679a887310891b3e6eec251e063d7dff5876": "00c2eb0b",
+		"38f08b26c0faacdbc6cd9839a237013e5fe8434a": "",
+	})
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.WalletClient = NewClient(server.URL, "", false)
+	wm.Config.MaxTxInputs = 10
+	decoder := wm.TxDecoder.(*TransactionDecoder)
+	wallet := &signerTestWallet{addrs: []*openwallet.Address{addrA, addrB}}
+
+	contract := openwallet.SmartContract{Address: "ecc6b20d3ccac1ee9ef109af5a7cdb85706b1df9", Symbol: "NEO", Token: "TKN", Decimals: 8}
+	sumRawTx := &openwallet.SummaryRawTransaction{
+		Coin:           openwallet.Coin{Symbol: "NEO", IsContract: true, ContractID: "tkn", Contract: contract},
+		Account:        &openwallet.AssetsAccount{AccountID: "test"},
+		FeeRate:        "0.001",
+		SummaryAddress: summary,
+		MinTransfer:    "1",
+		AddressLimit:   10,
+	}
+
+	rawTxs, err := decoder.CreateSummaryRawTransaction(wallet, sumRawTx)
+	if err != nil {
+		t.Fatalf("CreateSummaryRawTransaction failed: %v", err)
+	}
+	if len(rawTxs) != 1 {
+		t.Fatalf("summary transactions wrong: %d", len(rawTxs))
+	}
+	rawTx := rawTxs[0]
+	if rawTx.Fees != "0.001" || rawTx.TxTo[0] != summary+":2" || rawTx.TxFrom[0] != addrA.Address+":2" {
+		t.Fatalf("summary transaction wrong: %+v", rawTx)
+	}
+	//发送地址同时支付手续费，只需要一个签名
+	if sigs := rawTx.Signatures["test"]; len(sigs) != 1 || sigs[0].Address.Address != addrA.Address {
+		t.Fatalf("summary signatures wrong: %v", sigs)
+	}
+	//交易单包含GAS手续费输入
+	txid := fmt.Sprintf("%064x", len(addrA.Address)*100)
+	reversed := ""
+	for i := len(txid); i > 0; i -= 2 {
+		reversed += txid[i-2 : i]
+	}
+	if !strings.Contains(rawTx.RawHex, reversed) {
+		t.Fatalf("summary transaction has no fee input: %s", rawTx.RawHex)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	utxoAssetBucket             = "utxoAssets"
+	utxoAssetRegistrationBucket = "utxoAssetRegistrations"
+)
+
+//UTXOAssetRegistration 已创建但未上链的注册资产交易，交易上链后才登记为全局资产
+type UTXOAssetRegistration struct {
+	AssetID   string `json:"asset_id" storm:"id"` // 资产ID，即注册资产交易的交易ID
+	Symbol    string `json:"symbol"`              // 资产符号
+	Precision int32  `json:"precision"`           // 资产精度
+}
+
+//normalizeAssetID 统一资产ID格式：小写、去掉0x前缀
+func normalizeAssetID(assetID string) string {
+	return strings.TrimPrefix(strings.ToLower(assetID), "0x")
+}
+
+//RegisterUTXOAsset 登记全局资产，登记后扫描器和转账交易单按 NEO、GAS 的方式处理该资产
+// assetID : 资产ID，即注册资产交易的交易ID
+// symbol : 资产符号
+// precision : 资产精度
+func (wm *WalletManager) RegisterUTXOAsset(assetID, symbol string, precision int32) error {
+	assetID = normalizeAssetID(assetID)
+	if len(assetID) != 64 {
+		return fmt.Errorf("invalid asset id: %s", assetID)
+	}
+	if precision < 0 || precision > neoTransaction.MaxAssetPrecision {
+		return fmt.Errorf("invalid asset precision: %d", precision)
+	}
+
+	asset := &UTXOAsset{
+		AssetID:   assetID,
+		Symbol:    symbol,
+		Precision: precision,
+	}
+
+	//持久化到本地数据库
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.From(utxoAssetBucket).Save(asset)
+	if err != nil {
+		return err
+	}
+
+	wm.utxoAssetsLock.Lock()
+	wm.Config.UTXOAssets[assetID] = asset
+	wm.utxoAssetsLock.Unlock()
+	return nil
+}
+
+//GetUTXOAsset 获取已登记的全局资产
+func (wm *WalletManager) GetUTXOAsset(assetID string) (*UTXOAsset, bool) {
+	wm.utxoAssetsLock.RLock()
+	defer wm.utxoAssetsLock.RUnlock()
+	asset, ok := wm.Config.UTXOAssets[normalizeAssetID(assetID)]
+	return asset, ok
+}
+
+//addUTXOAssetRegistration 记录本地创建的注册资产交易，扫描器在区块中发现该交易后登记资产
+// assetID : 资产ID，即注册资产交易的交易ID
+// symbol : 资产符号
+// precision : 资产精度
+func (wm *WalletManager) addUTXOAssetRegistration(assetID, symbol string, precision int32) error {
+	registration := &UTXOAssetRegistration{
+		AssetID:   normalizeAssetID(assetID),
+		Symbol:    symbol,
+		Precision: precision,
+	}
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.From(utxoAssetRegistrationBucket).Save(registration)
+	if err != nil {
+		return err
+	}
+
+	wm.utxoAssetsLock.Lock()
+	if wm.utxoAssetRegistrations == nil {
+		wm.utxoAssetRegistrations = make(map[string]*UTXOAssetRegistration)
+	}
+	wm.utxoAssetRegistrations[registration.AssetID] = registration
+	wm.utxoAssetsLock.Unlock()
+	return nil
+}
+
+//confirmUTXOAssetRegistration 注册资产交易已上链，登记为全局资产并删除待确认记录，txid 不是待确认的注册资产交易时不处理
+func (wm *WalletManager) confirmUTXOAssetRegistration(txid string) error {
+	wm.utxoAssetsLock.RLock()
+	registration, ok := wm.utxoAssetRegistrations[normalizeAssetID(txid)]
+	wm.utxoAssetsLock.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	err := wm.RegisterUTXOAsset(registration.AssetID, registration.Symbol, registration.Precision)
+	if err != nil {
+		return err
+	}
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.From(utxoAssetRegistrationBucket).DeleteStruct(registration)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	wm.utxoAssetsLock.Lock()
+	delete(wm.utxoAssetRegistrations, registration.AssetID)
+	wm.utxoAssetsLock.Unlock()
+
+	wm.Log.Std.Info("UTXO asset %s[%s] registered on chain", registration.Symbol, registration.AssetID)
+	return nil
+}
+
+//loadUTXOAssets 从本地数据库加载已登记的全局资产和待确认的注册资产交易
+func (wm *WalletManager) loadUTXOAssets() error {
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var assets []*UTXOAsset
+	err = db.From(utxoAssetBucket).All(&assets)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	var registrations []*UTXOAssetRegistration
+	err = db.From(utxoAssetRegistrationBucket).All(&registrations)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	wm.utxoAssetsLock.Lock()
+	defer wm.utxoAssetsLock.Unlock()
+	for _, asset := range assets {
+		wm.Config.UTXOAssets[asset.AssetID] = asset
+	}
+	wm.utxoAssetRegistrations = make(map[string]*UTXOAssetRegistration)
+	for _, registration := range registrations {
+		wm.utxoAssetRegistrations[registration.AssetID] = registration
+	}
+	return nil
+}
+
+//GetUTXOAssetCoin 全局资产对应的 openwallet.Coin
+//NEO、GAS 与之前一样为主币，不改变已有记录的SID和余额，GAS 以 Contract.Address 区分资产
+//注册的全局资产作为合约代币
+func (wm *WalletManager) GetUTXOAssetCoin(asset *UTXOAsset) openwallet.Coin {
+	switch asset.AssetID {
+	case neoTransaction.NeoAssetId:
+		return openwallet.Coin{
+			Symbol:     wm.Symbol(),
+			IsContract: false,
+		}
+	case neoTransaction.NeoGasAssetId:
+		return openwallet.Coin{
+			Symbol:     wm.Symbol(),
+			IsContract: false,
+			Contract: openwallet.SmartContract{
+				Symbol:   wm.Symbol(),
+				Address:  asset.AssetID,
+				Token:    asset.Symbol,
+				Name:     asset.Symbol,
+				Decimals: uint64(asset.Precision),
+			},
+		}
+	}
+
+	contractID := openwallet.GenContractID(wm.Symbol(), asset.AssetID)
+	return openwallet.Coin{
+		Symbol:     wm.Symbol(),
+		IsContract: true,
+		ContractID: contractID,
+		Contract: openwallet.SmartContract{
+			ContractID: contractID,
+			Symbol:     wm.Symbol(),
+			Address:    asset.AssetID,
+			Token:      asset.Symbol,
+			Protocol:   UTXOAssetProtocol,
+			Name:       asset.Symbol,
+			Decimals:   uint64(asset.Precision),
+		},
+	}
+}
+
+//GetCoinUTXOAsset 获取转账币种对应的全局资产，NEP-5 代币返回 false
+//主币的 Contract.Address 为 GAS 资产ID时为 GAS，否则为 NEO
+func (wm *WalletManager) GetCoinUTXOAsset(coin openwallet.Coin) (*UTXOAsset, bool) {
+	if !coin.IsContract {
+		if normalizeAssetID(coin.Contract.Address) == neoTransaction.NeoGasAssetId {
+			return wm.GetUTXOAsset(neoTransaction.NeoGasAssetId)
+		}
+		return wm.GetUTXOAsset(neoTransaction.NeoAssetId)
+	}
+	return wm.GetUTXOAsset(coin.Contract.Address)
+}
+
+//checkAssetPrecision 检查转账数量是否符合资产精度
+func checkAssetPrecision(asset *UTXOAsset, amount decimal.Decimal) error {
+	shifted := amount.Shift(asset.Precision)
+	if !shifted.Equal(shifted.Truncate(0)) {
+		return fmt.Errorf("amount %s exceeds the precision of %s: %d", amount.String(), asset.Symbol, asset.Precision)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+func TestNewUnspentBalance_Assets(t *testing.T) {
+	raw := `{"balance":[
+		{"unspent":[{"txid":"aa","n":0,"value":10}],"asset_hash":"c56f33fc6ecfcd0c225c4ab356fee59390af8560be0e930faebe74a6daff7c9b","asset":"NEO","asset_symbol":"NEO","amount":10},
+		{"unspent":[{"txid":"bb","n":1,"value":1.5}],"asset_hash":"602c79718b16e442de58778e148d0b1084e3b2dffd5de6b7b16cee7969282de7","asset":"GAS","asset_symbol":"GAS","amount":1.5},
+		{"unspent":[{"txid":"cc","n":2,"value":7}],"asset_hash":"0x1d1f2ea79d0aba6e04a2b1c8cf0d7f2a1cb23e0a3bc7dc4ea2a0d1d5ed8e7c7a","asset":"TEST","asset_symbol":"TEST","amount":7}
+	],"address":"ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"}`
+	json := gjson.Parse(raw)
+	ub := NewUnspentBalance(&json)
+
+	if ub.NEOUnspent == nil || ub.NEOUnspent.Amount != "10" {
+		t.Errorf("NEO unspent wrong: %+v", ub.NEOUnspent)
+	}
+	if ub.GASUnspent == nil || ub.GASUnspent.Amount != "1.5" {
+		t.Errorf("GAS unspent wrong: %+v", ub.GASUnspent)
+	}
+	other := ub.GetUnspent("0x1D1F2EA79D0ABA6E04A2B1C8CF0D7F2A1CB23E0A3BC7DC4EA2A0D1D5ED8E7C7A")
+	if other == nil || other.Amount != "7" {
+		t.Errorf("registered asset unspent wrong: %+v", other)
+	}
+}
+
+func TestWalletManager_RegisterUTXOAsset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-utxo-asset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := &WalletManager{Config: NewConfig(Symbol, CurveType, Decimals)}
+	wm.Config.DBPath = dir
+
+	assetID := "0x1D1F2EA79D0ABA6E04A2B1C8CF0D7F2A1CB23E0A3BC7DC4EA2A0D1D5ED8E7C7A"
+	err = wm.RegisterUTXOAsset(assetID, "TEST", 2)
+	if err != nil {
+		t.Fatalf("RegisterUTXOAsset failed: %v", err)
+	}
+
+	//重新加载
+	reload := &WalletManager{Config: NewConfig(Symbol, CurveType, Decimals)}
+	reload.Config.DBPath = dir
+	err = reload.loadUTXOAssets()
+	if err != nil {
+		t.Fatalf("loadUTXOAssets failed: %v", err)
+	}
+
+	asset, ok := reload.GetUTXOAsset(assetID)
+	if !ok || asset.Symbol != "TEST" || asset.Precision != 2 {
+		t.Fatalf("registered asset not loaded: %+v", asset)
+	}
+
+	coin := reload.GetUTXOAssetCoin(asset)
+	if !coin.IsContract || coin.Contract.Protocol != UTXOAssetProtocol || coin.Contract.Address != normalizeAssetID(assetID) {
+		t.Errorf("asset coin wrong: %+v", coin)
+	}
+	found, ok := reload.GetCoinUTXOAsset(coin)
+	if !ok || found.AssetID != asset.AssetID {
+		t.Errorf("GetCoinUTXOAsset wrong: %+v", found)
+	}
+
+	neo, ok := reload.GetCoinUTXOAsset(reload.GetUTXOAssetCoin(reload.Config.UTXOAssets[neoTransaction.NeoAssetId]))
+	if !ok || neo.AssetID != neoTransaction.NeoAssetId {
+		t.Errorf("NEO coin should map to NEO asset")
+	}
+
+	//NEO、GAS 保持主币，SID与之前一致
+	gasCoin := reload.GetUTXOAssetCoin(reload.Config.UTXOAssets[neoTransaction.NeoGasAssetId])
+	if gasCoin.IsContract || gasCoin.ContractID != "" {
+		t.Errorf("GAS coin should stay the main coin: %+v", gasCoin)
+	}
+	gas, ok := reload.GetCoinUTXOAsset(gasCoin)
+	if !ok || gas.AssetID != neoTransaction.NeoGasAssetId {
+		t.Errorf("GAS coin should map to GAS asset")
+	}
+
+	if err := checkAssetPrecision(asset, decimal.RequireFromString("1.23")); err != nil {
+		t.Errorf("unexpected precision error: %v", err)
+	}
+	if err := checkAssetPrecision(asset, decimal.RequireFromString("1.234")); err == nil {
+		t.Errorf("expected precision error")
+	}
+}
+
+func TestWalletManager_UTXOAssetRegistration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-utxo-asset-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.DBPath = dir
+
+	assetID := "0x1d1f2ea79d0aba6e04a2b1c8cf0d7f2a1cb23e0a3bc7dc4ea2a0d1d5ed8e7c7a"
+	err = wm.addUTXOAssetRegistration(assetID, "TEST", 2)
+	if err != nil {
+		t.Fatalf("addUTXOAssetRegistration failed: %v", err)
+	}
+
+	//交易未上链，资产未登记
+	if _, ok := wm.GetUTXOAsset(assetID); ok {
+		t.Fatalf("asset should not be registered before transaction is on chain")
+	}
+
+	//重新加载后仍待确认
+	reload := NewWalletManager()
+	reload.Config.DBPath = dir
+	err = reload.loadUTXOAssets()
+	if err != nil {
+		t.Fatalf("loadUTXOAssets failed: %v", err)
+	}
+	if _, ok := reload.GetUTXOAsset(assetID); ok {
+		t.Fatalf("asset should not be registered after reload")
+	}
+
+	//其它交易不处理
+	err = reload.confirmUTXOAssetRegistration("aa00000000000000000000000000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatalf("confirm other transaction failed: %v", err)
+	}
+
+	err = reload.confirmUTXOAssetRegistration(assetID)
+	if err != nil {
+		t.Fatalf("confirmUTXOAssetRegistration failed: %v", err)
+	}
+	asset, ok := reload.GetUTXOAsset(assetID)
+	if !ok || asset.Symbol != "TEST" || asset.Precision != 2 {
+		t.Fatalf("asset not registered after confirmation: %+v", asset)
+	}
+
+	//确认后待确认记录删除，登记的资产持久化
+	final := NewWalletManager()
+	final.Config.DBPath = dir
+	err = final.loadUTXOAssets()
+	if err != nil {
+		t.Fatalf("loadUTXOAssets failed: %v", err)
+	}
+	if len(final.utxoAssetRegistrations) != 0 {
+		t.Errorf("registration should be removed after confirmation")
+	}
+	if _, ok := final.GetUTXOAsset(assetID); !ok {
+		t.Errorf("confirmed asset not persisted")
+	}
+}
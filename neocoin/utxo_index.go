@@ -0,0 +1,343 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	utxoIndexBucket = "utxoIndex"
+
+	//已花费的记录保留的区块数，分叉回滚时恢复为未花费
+	utxoIndexReorgDepth = 100
+)
+
+//IndexedUnspent 扫描器维护的观察地址交易输出，保存在区块链数据库
+type IndexedUnspent struct {
+	Key         string `json:"key" storm:"id"` //交易ID:输出序号
+	TxID        string `json:"txid"`           //小写，不带0x
+	N           uint64 `json:"n"`
+	Address     string `json:"address" storm:"index"`
+	AssetID     string `json:"asset_id"`
+	Value       string `json:"value"`
+	BlockHeight uint64 `json:"block_height"`
+	SpentHeight uint64 `json:"spent_height" storm:"index"` //花费所在的区块高度，未花费为0
+}
+
+//saveScannedBlock 在同一事务中把区块的提取结果写入未花费索引，并记录扫描高度
+//输出登记为未花费，输入把引用的输出标记为已花费
+func (wm *WalletManager) saveScannedBlock(height uint64, hash string, results []ExtractResult) error {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = wm.indexUnspents(tx.From(utxoIndexBucket), height, results)
+	if err != nil {
+		return err
+	}
+
+	err = wm.indexNEP5Transfers(tx.From(nep5TransferBucket), height, results)
+	if err != nil {
+		return err
+	}
+
+	//清理超过回滚深度的已花费记录，按花费高度索引查找，不遍历整个索引
+	if height > utxoIndexReorgDepth+1 {
+		node := tx.From(utxoIndexBucket)
+		var expired []*IndexedUnspent
+		err = node.Range("SpentHeight", uint64(1), height-utxoIndexReorgDepth-1, &expired)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		for _, unspent := range expired {
+			err = node.DeleteStruct(unspent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tx.Set(blockchainBucket, "blockHeight", &height)
+	if err != nil {
+		return err
+	}
+	err = tx.Set(blockchainBucket, "blockHash", &hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//saveBackfillUnspents 重扫任务的提取结果写入未花费索引，不改变扫描高度
+//spentOnly 为 true 时只把引用的输出标记为已花费，不登记新的输出
+func (wm *WalletManager) saveBackfillUnspents(height uint64, results []ExtractResult, spentOnly bool) error {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if spentOnly {
+		err = wm.indexSpents(tx.From(utxoIndexBucket), height, results)
+	} else {
+		err = wm.indexUnspents(tx.From(utxoIndexBucket), height, results)
+	}
+	if err != nil {
+		return err
+	}
+
+	//NEP-5转账记录可重复写入，结束高度之后的区块同样登记
+	err = wm.indexNEP5Transfers(tx.From(nep5TransferBucket), height, results)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//indexUnspents 把区块提取结果中的输出登记为未花费，再把输入引用的输出标记为已花费
+func (wm *WalletManager) indexUnspents(node storm.Node, height uint64, results []ExtractResult) error {
+
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		for _, data := range result.extractData {
+			for _, output := range data.TxOutputs {
+				asset, ok := wm.GetCoinUTXOAsset(output.Coin)
+				if !ok {
+					continue
+				}
+				txid := normalizeAssetID(output.TxID)
+				unspent := &IndexedUnspent{
+					Key:         outputCacheKey(txid, output.Index),
+					TxID:        txid,
+					N:           output.Index,
+					Address:     output.Address,
+					AssetID:     asset.AssetID,
+					Value:       output.Amount,
+					BlockHeight: height,
+				}
+				//重复提取的输出保留已花费状态
+				var stored IndexedUnspent
+				err := node.One("Key", unspent.Key, &stored)
+				if err == nil {
+					unspent.SpentHeight = stored.SpentHeight
+				} else if err != storm.ErrNotFound {
+					return err
+				}
+				err = node.Save(unspent)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return wm.indexSpents(node, height, results)
+}
+
+//indexSpents 把区块提取结果中输入引用的输出标记为已花费
+func (wm *WalletManager) indexSpents(node storm.Node, height uint64, results []ExtractResult) error {
+
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		for _, data := range result.extractData {
+			for _, input := range data.TxInputs {
+				var unspent IndexedUnspent
+				err := node.One("Key", outputCacheKey(input.SourceTxID, input.SourceIndex), &unspent)
+				if err == storm.ErrNotFound {
+					//开始扫描之前的输出不在索引中
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				unspent.SpentHeight = height
+				err = node.Save(&unspent)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//rollbackUnspentIndex 分叉时回滚未花费索引到指定高度
+//删除更高区块的输出和NEP-5转账记录，恢复更高区块花费的输出
+func (wm *WalletManager) rollbackUnspentIndex(height uint64) error {
+
+	db, err := storm.Open(filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	node := tx.From(utxoIndexBucket)
+
+	err = node.Select(q.Gt("BlockHeight", height)).Delete(new(IndexedUnspent))
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	var spent []*IndexedUnspent
+	err = node.Select(q.Gt("SpentHeight", height)).Find(&spent)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	for _, unspent := range spent {
+		unspent.SpentHeight = 0
+		err = node.Save(unspent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.From(nep5TransferBucket).Select(q.Gt("BlockHeight", height)).Delete(new(NEP5Transfer))
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//listUnspentByIndex 从本地未花费索引查询地址的未花费，格式与 getunspents 一致
+func (wm *WalletManager) listUnspentByIndex(address string) (*UnspentBalance, error) {
+
+	balance := &UnspentBalance{Unspents: make(map[string]*Unspent), Address: address}
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return balance, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var list []*IndexedUnspent
+	err = db.From(utxoIndexBucket).Select(q.Eq("Address", address), q.Eq("SpentHeight", uint64(0))).Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	//按区块高度排序，与节点返回的顺序接近
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BlockHeight != list[j].BlockHeight {
+			return list[i].BlockHeight < list[j].BlockHeight
+		}
+		return list[i].Key < list[j].Key
+	})
+
+	amounts := make(map[string]decimal.Decimal)
+	for _, u := range list {
+		unspent, ok := balance.Unspents[u.AssetID]
+		if !ok {
+			unspent = &Unspent{
+				UnspentTxs: new([]UnspentTx),
+				AssetHash:  u.AssetID,
+			}
+			if asset, ok := wm.GetUTXOAsset(u.AssetID); ok {
+				unspent.Asset = asset.Symbol
+				unspent.AssetSymbol = asset.Symbol
+			}
+			balance.Unspents[u.AssetID] = unspent
+		}
+		*unspent.UnspentTxs = append(*unspent.UnspentTxs, UnspentTx{TxID: u.TxID, N: u.N, Value: u.Value})
+		value, _ := decimal.NewFromString(u.Value)
+		amounts[u.AssetID] = amounts[u.AssetID].Add(value)
+	}
+
+	for assetID, unspent := range balance.Unspents {
+		unspent.Amount = amounts[assetID].String()
+		switch assetID {
+		case neoTransaction.NeoAssetId:
+			balance.NEOUnspent = unspent
+		case neoTransaction.NeoGasAssetId:
+			balance.GASUnspent = unspent
+		}
+	}
+
+	return balance, nil
+}
+
+//getIndexedOutput 从本地未花费索引查询交易输出，包括保留的已花费记录，不存在返回nil
+func (wm *WalletManager) getIndexedOutput(txid string, n uint64) (*Vout, error) {
+
+	dbFile := filepath.Join(wm.Config.DBPath, wm.Config.BlockchainFile)
+	if !file.Exists(dbFile) {
+		return nil, nil
+	}
+
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var unspent IndexedUnspent
+	err = db.From(utxoIndexBucket).One("Key", outputCacheKey(txid, n), &unspent)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Vout{
+		N:     unspent.N,
+		Addr:  unspent.Address,
+		Value: unspent.Value,
+		Asset: "0x" + unspent.AssetID,
+	}, nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestWalletManager_LocalUnspentIndex(t *testing.T) {
+	address := "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"
+
+	chain := newChainStandIn(12, address)
+	server := chain.serve()
+	defer server.Close()
+
+	wm, cleanup := newScanTestWallet(t, server.URL, address, "account1")
+	defer cleanup()
+	wm.Config.LocalUnspentIndex = true
+
+	bs := wm.Blockscanner
+	bs.AddObserver(&scanRecorder{headers: make(chan *openwallet.BlockHeader, len(chain.blocks))})
+	wm.SaveLocalNewBlock(1, chain.blockHash(1))
+	bs.IsScanMemPool = false
+	bs.Scanning = true
+
+	bs.ScanBlockTask()
+
+	//每笔交易花费上一笔的输出，只剩最新区块的输出未花费
+	checkUnspent := func(height int) {
+		utxo, err := wm.ListUnspent(address)
+		if err != nil {
+			t.Fatalf("ListUnspent failed: %v", err)
+		}
+		if utxo.NEOUnspent != nil || utxo.GASUnspent == nil {
+			t.Fatalf("unspent assets wrong: %+v", utxo)
+		}
+		txs := *utxo.GASUnspent.UnspentTxs
+		if len(txs) != 1 || txs[0].TxID != fmt.Sprintf("%064x", height+1) || txs[0].N != 0 {
+			t.Fatalf("unspent txs wrong: %+v", txs)
+		}
+		if utxo.GASUnspent.Amount != fmt.Sprintf("%d", height+1) || utxo.GASUnspent.AssetHash != neoTransaction.NeoGasAssetId || utxo.GASUnspent.AssetSymbol != AssetSymbolGAS {
+			t.Fatalf("gas unspent wrong: %+v", utxo.GASUnspent)
+		}
+	}
+
+	checkUnspent(11)
+
+	if height, _ := wm.GetLocalNewBlock(); height != 11 {
+		t.Fatalf("scanned height wrong: %d", height)
+	}
+
+	balances, err := bs.GetBalanceByAddress(address)
+	if err != nil {
+		t.Fatalf("GetBalanceByAddress failed: %v", err)
+	}
+	if len(balances) != 1 || balances[0].Balance != "0" {
+		t.Fatalf("balance wrong: %+v", balances)
+	}
+
+	//重复提取已花费的输出，保留已花费状态
+	block, err := wm.GetBlock(chain.blockHash(5))
+	if err != nil {
+		t.Fatalf("GetBlock failed: %v", err)
+	}
+	results := bs.extractBlock(block, func(a string) (string, bool) { return "account1", a == address })
+	err = wm.saveBackfillUnspents(5, results, false)
+	if err != nil {
+		t.Fatalf("saveBackfillUnspents failed: %v", err)
+	}
+	checkUnspent(11)
+
+	//分叉回滚后恢复被花费的输出
+	err = wm.rollbackUnspentIndex(9)
+	if err != nil {
+		t.Fatalf("rollbackUnspentIndex failed: %v", err)
+	}
+	checkUnspent(9)
+
+	if n := chain.callCount("getunspents"); n != 0 {
+		t.Errorf("getunspents called %d times", n)
+	}
+}
+
+func TestWalletManager_PruneSpentUnspents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-utxo-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.DBPath = dir
+
+	db, err := storm.Open(filepath.Join(dir, wm.Config.BlockchainFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, spent := range []uint64{0, 1, 98, 99, 100, 150} {
+		err = db.From(utxoIndexBucket).Save(&IndexedUnspent{Key: fmt.Sprintf("%064x:0", i), SpentHeight: spent})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	//高度200时清理花费高度小于100的记录
+	err = wm.saveScannedBlock(200, "0xb0", nil)
+	if err != nil {
+		t.Fatalf("saveScannedBlock failed: %v", err)
+	}
+
+	db, err = storm.Open(filepath.Join(dir, wm.Config.BlockchainFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var list []*IndexedUnspent
+	err = db.From(utxoIndexBucket).All(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remained := make([]uint64, 0)
+	for _, unspent := range list {
+		remained = append(remained, unspent.SpentHeight)
+	}
+	if fmt.Sprint(remained) != "[0 100 150]" {
+		t.Errorf("pruned records wrong: %v", remained)
+	}
+}
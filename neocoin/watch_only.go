@@ -0,0 +1,267 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//ExportAccountPublicKey 导出BIP44账户 m/44'/888'/account' 的扩展公钥
+//在离线签名机上执行，热钱包服务器只保存扩展公钥，用于创建观察钱包
+func (wm *WalletManager) ExportAccountPublicKey(key *hdkeystore.HDKey, account uint32) (string, error) {
+	master, err := NewHDMasterNode(key.Seed())
+	if err != nil {
+		return "", err
+	}
+	node, err := master.DerivePath(BIP44AccountPath(account))
+	if err != nil {
+		return "", err
+	}
+	return node.Neuter().String(), nil
+}
+
+//CreateWatchOnlyWallet 通过BIP44账户的扩展公钥创建观察钱包
+//观察钱包没有种子文件，只能派生地址和扫描充值，签名由持有种子的离线签名机完成
+func (wm *WalletManager) CreateWatchOnlyWallet(name, xpub string) (*openwallet.Wallet, *openwallet.AssetsAccount, error) {
+
+	node, err := NewHDNodeFromString(xpub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if node.IsPrivate() {
+		return nil, nil, errors.New("Watch-only wallet should be created with an extended public key!")
+	}
+
+	//扩展公钥需要是 m/44'/888'/account' 层级，离线签名机才能按地址路径派生私钥
+	if node.Depth != 3 || node.ChildNumber < HardenedKeyBase {
+		return nil, nil, errors.New("Extended public key should be derived at m/44'/888'/account'!")
+	}
+	rootPath := BIP44AccountPath(node.ChildNumber - HardenedKeyBase)
+
+	//钱包ID与种子钱包的KeyID格式一致，由账户公钥计算
+	walletID := neoTransaction.EncodeCheck(append([]byte{}, hdkeystore.KeyIDVer...), neoTransaction.Hash160(node.PublicKey))
+
+	//检查钱包名和钱包ID是否存在
+	wallets, err := wm.GetWallets()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, w := range wallets {
+		if w.Alias == name {
+			return nil, nil, errors.New("The wallet's alias is duplicated!")
+		}
+		if w.WalletID == walletID {
+			return nil, nil, errors.New("The wallet's extended public key is duplicated!")
+		}
+	}
+
+	fileName := hdkeystore.KeyFileName(name, walletID)
+
+	file.MkdirAll(wm.Config.DBPath)
+	file.MkdirAll(wm.Config.watchOnlyDir)
+
+	w := &openwallet.Wallet{
+		WalletID:  walletID,
+		Alias:     name,
+		RootPub:   xpub,
+		RootPath:  rootPath,
+		WatchOnly: true,
+		DBFile:    filepath.Join(wm.Config.DBPath, fileName+".db"),
+	}
+
+	content, err := json.MarshalIndent(w, "", "\t")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !file.WriteFile(filepath.Join(wm.Config.watchOnlyDir, fileName+".json"), content, false) {
+		return nil, nil, errors.New("Save watch-only wallet failed!")
+	}
+
+	account := &openwallet.AssetsAccount{
+		WalletID:  walletID,
+		Alias:     name,
+		AccountID: walletID,
+		Index:     uint64(node.ChildNumber - HardenedKeyBase),
+		HDPath:    rootPath,
+		PublicKey: xpub,
+		OwnerKeys: []string{xpub},
+		Required:  1,
+		Symbol:    wm.Config.Symbol,
+	}
+
+	db, err := w.OpenDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	err = db.Save(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = db.Save(account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return w, account, nil
+}
+
+//CreateWatchOnlyAddress 通过扩展公钥派生观察地址
+// accountID : 所属账户
+// chain : 地址链的扩展公钥，即 m/44'/888'/account'/change
+// derivedPath : 地址链的路径
+// index : 地址索引
+func (wm *WalletManager) CreateWatchOnlyAddress(accountID string, chain *HDNode, derivedPath string, index uint64) (*openwallet.Address, error) {
+
+	if index >= uint64(HardenedKeyBase) {
+		return nil, fmt.Errorf("address index %d is out of range", index)
+	}
+
+	child, err := chain.Child(uint32(index))
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := wm.Decoder.PublicKeyToAddress(child.PublicKey, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openwallet.Address{
+		Address:     address,
+		AccountID:   accountID,
+		PublicKey:   hex.EncodeToString(child.PublicKey),
+		HDPath:      fmt.Sprintf("%s/%d", derivedPath, index),
+		CreatedTime: time.Now().Unix(),
+		Symbol:      wm.Config.Symbol,
+		Index:       index,
+		WatchOnly:   true,
+	}, nil
+}
+
+//watchOnlyChain 获取观察钱包的地址链扩展公钥及路径
+func (wm *WalletManager) watchOnlyChain(w *openwallet.Wallet, change bool) (*HDNode, string, error) {
+	node, err := NewHDNodeFromString(w.RootPub)
+	if err != nil {
+		return nil, "", err
+	}
+	chainIndex := uint32(0)
+	if change {
+		chainIndex = 1
+	}
+	chain, err := node.Child(chainIndex)
+	if err != nil {
+		return nil, "", err
+	}
+	return chain, fmt.Sprintf("%s/%d", w.RootPath, chainIndex), nil
+}
+
+//createWatchOnlyAddressWork 观察钱包创建地址过程，地址登记到本地观察地址表
+func (wm *WalletManager) createWatchOnlyAddressWork(chain *HDNode, producer chan<- []*openwallet.Address, walletID string, derivedPath string, start, end uint64) {
+
+	runAddress := make([]*openwallet.Address, 0)
+
+	for i := start; i < end; i++ {
+		// 生成地址
+		address, errRun := wm.CreateWatchOnlyAddress(walletID, chain, derivedPath, i)
+		if errRun != nil {
+			wm.Log.Std.Info("Create watch-only address failed unexpected error: %v", errRun)
+			continue
+		}
+		runAddress = append(runAddress, address)
+	}
+
+	//批量登记观察地址
+	errRun := wm.ImportWatchOnlyAddress(runAddress...)
+	if errRun != nil {
+		wm.Log.Std.Info("Import watch-only address failed unexpected error: %v", errRun)
+		producer <- make([]*openwallet.Address, 0)
+		return
+	}
+
+	//生成完成
+	producer <- runAddress
+}
+
+//loadWatchOnlyWallets 加载观察钱包列表
+func (wm *WalletManager) loadWatchOnlyWallets() ([]*openwallet.Wallet, error) {
+
+	wallets := make([]*openwallet.Wallet, 0)
+
+	files, err := ioutil.ReadDir(wm.Config.watchOnlyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return wallets, nil
+		}
+		return nil, err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(wm.Config.watchOnlyDir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var w openwallet.Wallet
+		err = json.Unmarshal(content, &w)
+		if err != nil {
+			wm.Log.Std.Warning("watch-only wallet file %s is invalid: %v", fi.Name(), err)
+			continue
+		}
+		w.WatchOnly = true
+		w.DBFile = filepath.Join(wm.Config.DBPath, strings.TrimSuffix(fi.Name(), ".json")+".db")
+		wallets = append(wallets, &w)
+	}
+
+	return wallets, nil
+}
+
+//backupWatchOnlyWallet 备份观察钱包，复制描述文件和地址数据库
+func (wm *WalletManager) backupWatchOnlyWallet(w *openwallet.Wallet) (string, error) {
+	fileName := hdkeystore.KeyFileName(w.Alias, w.WalletID)
+
+	//创建备份文件夹
+	newBackupDir := filepath.Join(wm.Config.backupDir, fileName+"-"+common.TimeFormat("20060102150405"))
+	file.MkdirAll(newBackupDir)
+
+	err := file.Copy(filepath.Join(wm.Config.watchOnlyDir, fileName+".json"), newBackupDir)
+	if err != nil {
+		return "", err
+	}
+
+	file.Copy(w.DBFile, newBackupDir)
+
+	return newBackupDir, nil
+}
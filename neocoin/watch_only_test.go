@@ -0,0 +1,120 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LeorCao/neo-adapter/neoTransaction"
+)
+
+// 扩展公钥创建观察钱包，派生的地址与私钥派生一致
+func TestCreateWatchOnlyWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-watchonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Decoder = NewAddressDecoder(wm)
+	wm.Config.keyDir = filepath.Join(dir, "key")
+	wm.Config.DBPath = filepath.Join(dir, "db")
+	wm.Config.watchOnlyDir = filepath.Join(dir, "watchonly")
+
+	master, err := NewHDMasterNode(MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountNode, err := master.DerivePath(BIP44AccountPath(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 序列化往返
+	xprv := accountNode.String()
+	xpub := accountNode.Neuter().String()
+	parsed, err := NewHDNodeFromString(xprv)
+	if err != nil || parsed.String() != xprv || !parsed.IsPrivate() {
+		t.Errorf("extended private key round trip failed: %v", err)
+	}
+	parsed, err = NewHDNodeFromString(xpub)
+	if err != nil || parsed.String() != xpub || parsed.IsPrivate() {
+		t.Errorf("extended public key round trip failed: %v", err)
+	}
+	if _, err := NewHDNodeFromString(xpub[:len(xpub)-1] + "1"); err == nil {
+		t.Errorf("invalid checksum should fail")
+	}
+	if !strings.HasPrefix(xpub, "npub") || !strings.HasPrefix(xprv, "nprv") {
+		t.Errorf("extended key prefix wrong: %s, %s", xpub, xprv)
+	}
+
+	// 比特币版本号的扩展公钥
+	data, _ := neoTransaction.Decode(xpub, neoTransaction.NeocoinAlphabet)
+	bitcoinXpub := neoTransaction.EncodeCheck([]byte{0x04, 0x88, 0xb2, 0x1e}, data[4:hdSerializedKeyLength])
+	if _, err := NewHDNodeFromString(bitcoinXpub); err == nil {
+		t.Errorf("extended key with bitcoin version should be rejected")
+	}
+
+	// 只接受账户层级的扩展公钥
+	if _, _, err := wm.CreateWatchOnlyWallet("hot", xprv); err == nil {
+		t.Errorf("extended private key should be rejected")
+	}
+	if _, _, err := wm.CreateWatchOnlyWallet("hot", master.Neuter().String()); err == nil {
+		t.Errorf("extended public key of master should be rejected")
+	}
+
+	w, account, err := wm.CreateWatchOnlyWallet("hot", xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.WatchOnly || w.RootPath != "m/44'/888'/0'" || account.PublicKey != xpub {
+		t.Errorf("watch-only wallet wrong: %+v", w)
+	}
+	if _, _, err := wm.CreateWatchOnlyWallet("hot2", xpub); err == nil {
+		t.Errorf("duplicated extended public key should be rejected")
+	}
+
+	loaded, err := wm.GetWalletInfo(w.WalletID)
+	if err != nil || !loaded.WatchOnly || loaded.RootPub != xpub || loaded.DBFile != w.DBFile {
+		t.Fatalf("watch-only wallet load failed: %v", err)
+	}
+
+	for _, change := range []bool{false, true} {
+		chain, derivedPath, err := wm.watchOnlyChain(loaded, change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < 3; i++ {
+			addr, err := wm.CreateWatchOnlyAddress(loaded.WalletID, chain, derivedPath, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			node, _ := master.DerivePath(addr.HDPath)
+			expected, _ := wm.Decoder.PublicKeyToAddress(node.PublicKey, false)
+			if addr.HDPath != BIP44Path(0, change, i) || addr.Address != expected || !addr.WatchOnly {
+				t.Errorf("watch-only address wrong: %s, %s", addr.HDPath, addr.Address)
+			}
+			if !change && i == 0 && addr.Address != "AJHeWQn2qKKqD4nBE82etebgT3GEM9HDRH" {
+				t.Errorf("watch-only address wrong: %s", addr.Address)
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	watchOnlyAddressBucket = "watchOnlyAddresses"
+)
+
+//WatchOnlyAddress 观察地址登记记录，保存在区块链数据库
+type WatchOnlyAddress struct {
+	Address   string `json:"address" storm:"id"`
+	AccountID string `json:"accountID" storm:"index"`
+	Label     string `json:"label"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+//WatchOnlyRegistry 本地观察地址登记表
+//NEO节点没有比特币核心钱包的 importmulti 接口，观察地址由适配器自己登记，扫描器通过内存集合判断地址归属
+type WatchOnlyRegistry struct {
+	wm        *WalletManager
+	mu        sync.RWMutex
+	addresses map[string]*WatchOnlyAddress
+}
+
+//NewWatchOnlyRegistry 创建观察地址登记表
+func NewWatchOnlyRegistry(wm *WalletManager) *WatchOnlyRegistry {
+	return &WatchOnlyRegistry{
+		wm:        wm,
+		addresses: make(map[string]*WatchOnlyAddress),
+	}
+}
+
+//dbFile 登记表所在的数据库文件
+func (reg *WatchOnlyRegistry) dbFile() string {
+	return filepath.Join(reg.wm.Config.DBPath, reg.wm.Config.BlockchainFile)
+}
+
+//Load 从本地数据库加载观察地址到内存集合
+func (reg *WatchOnlyRegistry) Load() error {
+	if !file.Exists(reg.dbFile()) {
+		return nil
+	}
+
+	db, err := storm.Open(reg.dbFile())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var list []*WatchOnlyAddress
+	err = db.From(watchOnlyAddressBucket).All(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	addresses := make(map[string]*WatchOnlyAddress, len(list))
+	for _, a := range list {
+		addresses[a.Address] = a
+	}
+
+	reg.mu.Lock()
+	reg.addresses = addresses
+	reg.mu.Unlock()
+	return nil
+}
+
+//Import 批量登记观察地址，已登记的地址更新所属账户和标签
+func (reg *WatchOnlyRegistry) Import(addresses ...*WatchOnlyAddress) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	for _, a := range addresses {
+		if !reg.wm.Decoder.AddressVerify(a.Address) {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid address[%s]", a.Address)
+		}
+		if a.CreatedAt == 0 {
+			a.CreatedAt = time.Now().Unix()
+		}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	file.MkdirAll(reg.wm.Config.DBPath)
+	db, err := storm.Open(reg.dbFile())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.From(watchOnlyAddressBucket).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range addresses {
+		//保留首次登记时间
+		if old, ok := reg.addresses[a.Address]; ok {
+			a.CreatedAt = old.CreatedAt
+		}
+		err = tx.Save(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range addresses {
+		reg.addresses[a.Address] = a
+	}
+	return nil
+}
+
+//Remove 批量删除观察地址，未登记的地址忽略
+func (reg *WatchOnlyRegistry) Remove(addresses ...string) error {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	removed := make([]*WatchOnlyAddress, 0, len(addresses))
+	for _, address := range addresses {
+		if a, ok := reg.addresses[address]; ok {
+			removed = append(removed, a)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	db, err := storm.Open(reg.dbFile())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.From(watchOnlyAddressBucket).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range removed {
+		err = tx.DeleteStruct(a)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range removed {
+		delete(reg.addresses, a.Address)
+	}
+	return nil
+}
+
+//SetLabel 修改观察地址的标签
+func (reg *WatchOnlyRegistry) SetLabel(address, label string) error {
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	a, ok := reg.addresses[address]
+	if !ok {
+		return fmt.Errorf("watch-only address[%s] is not registered", address)
+	}
+
+	db, err := storm.Open(reg.dbFile())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated := *a
+	updated.Label = label
+	err = db.From(watchOnlyAddressBucket).Save(&updated)
+	if err != nil {
+		return err
+	}
+
+	reg.addresses[address] = &updated
+	return nil
+}
+
+//Get 获取已登记的观察地址
+func (reg *WatchOnlyRegistry) Get(address string) (*WatchOnlyAddress, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	a, ok := reg.addresses[address]
+	if !ok {
+		return nil, false
+	}
+	copied := *a
+	return &copied, true
+}
+
+//List 列出已登记的观察地址，accountID为空时列出全部
+func (reg *WatchOnlyRegistry) List(accountID string) []*WatchOnlyAddress {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	list := make([]*WatchOnlyAddress, 0, len(reg.addresses))
+	for _, a := range reg.addresses {
+		if len(accountID) > 0 && a.AccountID != accountID {
+			continue
+		}
+		copied := *a
+		list = append(list, &copied)
+	}
+	return list
+}
+
+//Lookup 扫描器使用的地址归属查询，返回地址所属的账户ID作为sourceKey
+func (reg *WatchOnlyRegistry) Lookup(address string) (string, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	a, ok := reg.addresses[address]
+	if !ok {
+		return "", false
+	}
+	return a.AccountID, true
+}
+
+//newWatchOnlyAddresses openwallet地址转登记记录，标签使用地址别名
+func newWatchOnlyAddresses(addresses []*openwallet.Address) []*WatchOnlyAddress {
+	list := make([]*WatchOnlyAddress, 0, len(addresses))
+	for _, a := range addresses {
+		list = append(list, &WatchOnlyAddress{
+			Address:   a.Address,
+			AccountID: a.AccountID,
+			Label:     a.Alias,
+			CreatedAt: a.CreatedTime,
+		})
+	}
+	return list
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package neocoin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestWatchOnlyRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo-watch-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.DBPath = dir
+
+	addresses := []*openwallet.Address{
+		{Address: "ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", AccountID: "account1", Alias: "alice"},
+		{Address: "AK2nJJpJr6o664CWJKi1QRXjqeic2zRp8y", AccountID: "account2"},
+	}
+	err = wm.ImportWatchOnlyAddress(addresses...)
+	if err != nil {
+		t.Fatalf("ImportWatchOnlyAddress failed: %v", err)
+	}
+
+	err = wm.ImportWatchOnlyAddress(&openwallet.Address{Address: "invalid", AccountID: "account1"})
+	if err == nil {
+		t.Fatalf("invalid address should not be imported")
+	}
+
+	//扫描器默认使用登记表
+	key, ok := wm.Blockscanner.ScanAddressFunc("ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA")
+	if !ok || key != "account1" {
+		t.Fatalf("scanner lookup wrong: %s, %v", key, ok)
+	}
+	if _, ok := wm.Blockscanner.ScanAddressFunc("AJN5bz5f1jyXbSCYjzAydrA9ru4G3ahWgQ"); ok {
+		t.Fatalf("unregistered address should not be found")
+	}
+
+	err = wm.WatchOnly.SetLabel("AK2nJJpJr6o664CWJKi1QRXjqeic2zRp8y", "bob")
+	if err != nil {
+		t.Fatalf("SetLabel failed: %v", err)
+	}
+	err = wm.WatchOnly.Remove("ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA", "AJN5bz5f1jyXbSCYjzAydrA9ru4G3ahWgQ")
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	//重新加载
+	reload := NewWalletManager()
+	reload.Config.DBPath = dir
+	err = reload.WatchOnly.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	list := reload.WatchOnly.List("")
+	if len(list) != 1 {
+		t.Fatalf("registry size wrong: %d", len(list))
+	}
+	a, ok := reload.WatchOnly.Get("AK2nJJpJr6o664CWJKi1QRXjqeic2zRp8y")
+	if !ok || a.AccountID != "account2" || a.Label != "bob" || a.CreatedAt == 0 {
+		t.Fatalf("registered address wrong: %+v", a)
+	}
+	if _, ok := reload.WatchOnly.Lookup("ASZdzpkWB3H7oMw917BmrUZ5sDKmRkKEWA"); ok {
+		t.Fatalf("removed address should not be found")
+	}
+	if len(reload.WatchOnly.List("account1")) != 0 {
+		t.Fatalf("account1 should have no addresses")
+	}
+}